@@ -10,6 +10,7 @@ import (
 
 	app "github.com/farberg/dynamic-zones/internal"
 	"github.com/farberg/dynamic-zones/internal/helper"
+	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -191,7 +192,11 @@ func testDnsUpdate(t *testing.T, zone app.ZoneDataResponse, nameserverPort uint1
 	// Create a new DNS record using RFC 2136 update
 	t.Logf("testDnsUpdate: Using data from zone %s for DNS update test. Zone name: %s, Zone keys: %+v", zone.Zone, zone.Zone, zone.ZoneKeys)
 
-	_, err = helper.Rfc2136AddARecord(zone.ZoneKeys[0].Keyname, zone.ZoneKeys[0].Algorithm, zone.ZoneKeys[0].Key, nameserver+":"+strconv.Itoa(int(nameserverPort)), zone.Zone+".", testname, testcontent, testttl)
+	rr, err := helper.NewRecord(testname, "A", testcontent, testttl)
+	if err != nil {
+		t.Fatalf("testDnsUpdate: Failed to build DNS record: %v", err)
+	}
+	_, err = helper.Rfc2136AddRecords(zone.ZoneKeys[0].Keyname, zone.ZoneKeys[0].Algorithm, zone.ZoneKeys[0].Key, nameserver+":"+strconv.Itoa(int(nameserverPort)), zone.Zone+".", []dns.RR{rr})
 	if err != nil {
 		t.Fatalf("testDnsUpdate: Failed to create DNS record: %v", err)
 	}
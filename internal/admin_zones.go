@@ -0,0 +1,371 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/miekg/dns"
+)
+
+// metadataSuspendedUpdates holds the user keys whose TSIG-ALLOW-DNSUPDATE
+// grant is withheld while the zone is suspended. PowerDNS leaves metadata
+// kinds starting with "X-" to its users.
+const metadataSuspendedUpdates powerdns.MetadataKind = "X-DYNAMIC-ZONES-SUSPENDED-UPDATES"
+
+// Page size of GET /v1/admin/zones.
+const (
+	adminZonesDefaultLimit = 100
+	adminZonesMaxLimit     = 1000
+)
+
+// AdminZone is a stored zone as the admins see it: all owners in one entry.
+type AdminZone struct {
+	Zone      string    `json:"zone"`
+	Owners    []string  `json:"owners"`
+	CreatedAt time.Time `json:"created_at"`
+	// DisabledAt is when the records were disabled because the lease expired.
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	// SuspendedAt is when an admin disabled the records.
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+	// Lease is only filled for a single zone.
+	Lease *ZoneLease `json:"lease,omitempty"`
+}
+
+// AdminZonesResponse is a page of GET /v1/admin/zones.
+type AdminZonesResponse struct {
+	Zones []AdminZone `json:"zones"`
+	// Total is the number of matching zones, across all pages.
+	Total int `json:"total"`
+}
+
+// AdminZoneFilter selects the zones of GET /v1/admin/zones.
+type AdminZoneFilter struct {
+	// Query is a part of the zone name.
+	Query string
+	// Owner is a part of the name of an owner.
+	Owner  string
+	Limit  int
+	Offset int
+}
+
+// AdminZoneRotateRequest is the body of POST /v1/admin/zones/{zone}/keys/rotate.
+type AdminZoneRotateRequest struct {
+	// Owner whose key is rotated; all owners when empty.
+	Owner string `json:"owner,omitempty" example:"alice@example.com"`
+	// KeyAlgorithm of the new keys; the current one when empty.
+	KeyAlgorithm string `json:"key_algorithm,omitempty" example:"hmac-sha256"`
+	// Immediate replaces the old keys at once instead of after the grace
+	// period.
+	Immediate bool `json:"immediate,omitempty"`
+}
+
+// adminZoneOf returns the zone as AdminZone.
+func adminZoneOf(l *zoneLeaseRows) AdminZone {
+	return AdminZone{Zone: l.zone, Owners: l.owners, CreatedAt: l.createdAt, DisabledAt: l.disabled, SuspendedAt: l.suspended}
+}
+
+// adminZoneRows returns the lease rows of zone, or an error result unless admin
+// may manage it: super-admins every zone, delegated admins the zones at or
+// below their delegated suffixes.
+func (app *AppData) adminZoneRows(admin *UserClaims, zone string) (*zoneLeaseRows, int, any, error) {
+	scopes, err := app.auditScopes(admin)
+	if err != nil {
+		status, resp, err := errorResult(http.StatusInternalServerError, "Failed to look up your delegations", err)
+		return nil, status, resp, err
+	}
+	if scopes != nil && !slices.ContainsFunc(scopes, func(suffix string) bool { return zoneInScope(zone, suffix) }) {
+		status, resp, err := errorResult(http.StatusForbidden, "This zone is not delegated to you", fmt.Errorf("%s is outside the delegations of %s", zone, admin.Email))
+		return nil, status, resp, err
+	}
+	rows, err := app.Storage.ZoneRows(zone)
+	if err != nil {
+		status, resp, err := errorResult(http.StatusInternalServerError, "Failed to look up the zone", err)
+		return nil, status, resp, err
+	}
+	if len(rows) == 0 {
+		status, resp, err := errorResult(http.StatusNotFound, "Zone does not exist", fmt.Errorf("%s is not stored", zone))
+		return nil, status, resp, err
+	}
+	return groupZoneLeases(rows)[0], 0, nil, nil
+}
+
+// AdminZoneList returns a page of the zones admin may manage that match filter,
+// sorted by name.
+func (app *AppData) AdminZoneList(ctx context.Context, admin *UserClaims, filter AdminZoneFilter) (int, any, error) {
+	scopes, err := app.auditScopes(admin)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to look up your delegations", fmt.Errorf("app.AdminZoneList: %w", err))
+	}
+	rows, err := app.Storage.ListAllZones()
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list zones", fmt.Errorf("app.AdminZoneList: %w", err))
+	}
+
+	query, owner := strings.ToLower(filter.Query), strings.ToLower(filter.Owner)
+	zones := make([]AdminZone, 0)
+	for _, l := range groupZoneLeases(rows) {
+		if scopes != nil && !slices.ContainsFunc(scopes, func(suffix string) bool { return zoneInScope(l.zone, suffix) }) {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(l.zone), query) {
+			continue
+		}
+		if owner != "" && !slices.ContainsFunc(l.owners, func(o string) bool { return strings.Contains(strings.ToLower(o), owner) }) {
+			continue
+		}
+		zones = append(zones, adminZoneOf(l))
+	}
+
+	total := len(zones)
+	zones = zones[min(filter.Offset, total):]
+	zones = zones[:min(filter.Limit, len(zones))]
+	return http.StatusOK, AdminZonesResponse{Zones: zones, Total: total}, nil
+}
+
+// AdminZoneGet returns a zone with its owners and lease.
+func (app *AppData) AdminZoneGet(ctx context.Context, admin *UserClaims, zone string) (int, any, error) {
+	rows, status, resp, err := app.adminZoneRows(admin, zone)
+	if err != nil {
+		return status, resp, fmt.Errorf("app.AdminZoneGet: %w", err)
+	}
+	def, err := app.zoneGoverningDef(zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to resolve the policy of this zone", fmt.Errorf("app.AdminZoneGet: %w", err))
+	}
+	var days uint32
+	if def != nil {
+		days = def.LeaseDays
+	}
+	lease := app.zoneLease(rows, days)
+	z := adminZoneOf(rows)
+	z.Lease = &lease
+	return http.StatusOK, z, nil
+}
+
+// AdminZoneAddOwner makes owner an owner of zone, whether or not the zone may
+// be shared or a rule grants it to them.
+func (app *AppData) AdminZoneAddOwner(ctx context.Context, admin *UserClaims, zone, owner string) (int, any, error) {
+	owner = strings.ToLower(strings.TrimSpace(owner))
+	if _, err := mail.ParseAddress(owner); err != nil {
+		return errorResult(http.StatusBadRequest, "Invalid owner email", fmt.Errorf("app.AdminZoneAddOwner: %w", err))
+	}
+	if _, status, resp, err := app.adminZoneRows(admin, zone); err != nil {
+		return status, resp, fmt.Errorf("app.AdminZoneAddOwner: %w", err)
+	}
+	return app.addZoneOwner(ctx, admin.Email, zone, owner)
+}
+
+// AdminZoneRemoveOwner takes zone from owner. The last owner cannot be removed;
+// delete the zone or transfer it instead.
+func (app *AppData) AdminZoneRemoveOwner(ctx context.Context, admin *UserClaims, zone, owner string) (int, any, error) {
+	if _, status, resp, err := app.adminZoneRows(admin, zone); err != nil {
+		return status, resp, fmt.Errorf("app.AdminZoneRemoveOwner: %w", err)
+	}
+	return app.removeZoneOwner(ctx, admin.Email, zone, strings.ToLower(strings.TrimSpace(owner)))
+}
+
+// AdminZoneTransfer makes newOwner the only owner of zone: they get a key of
+// the zone and its subzones, and all other owners lose theirs.
+func (app *AppData) AdminZoneTransfer(ctx context.Context, admin *UserClaims, zone, newOwner string) (int, any, error) {
+	newOwner = strings.ToLower(strings.TrimSpace(newOwner))
+	if _, err := mail.ParseAddress(newOwner); err != nil {
+		return errorResult(http.StatusBadRequest, "Invalid owner email", fmt.Errorf("app.AdminZoneTransfer: %w", err))
+	}
+	rows, status, resp, err := app.adminZoneRows(admin, zone)
+	if err != nil {
+		return status, resp, fmt.Errorf("app.AdminZoneTransfer: %w", err)
+	}
+
+	// Some failures of the owner helpers come without an error value.
+	if status, resp, err := app.addZoneOwner(ctx, admin.Email, zone, newOwner); status >= http.StatusBadRequest {
+		return status, resp, err
+	}
+	for _, owner := range rows.owners {
+		if owner == newOwner {
+			continue
+		}
+		if status, resp, err := app.removeZoneOwner(ctx, admin.Email, zone, owner); status >= http.StatusBadRequest {
+			return status, resp, err
+		}
+	}
+
+	app.Log.Infof("app.AdminZoneTransfer: %s transferred %s from %v to %s", admin.Email, zone, rows.owners, newOwner)
+	app.audit(ctx, AuditZoneTransfer, zone, zone, gin.H{"owners": rows.owners}, gin.H{"owners": []string{newOwner}})
+	return http.StatusOK, gin.H{"owners": []string{newOwner}}, nil
+}
+
+// ZoneUpdatesSuspended reports whether SuspendZoneUpdates withholds the update
+// grants of zone.
+func (p *PowerDnsClient) ZoneUpdatesSuspended(ctx context.Context, zone string) (bool, error) {
+	metadata, err := p.powerdns.Metadata.Get(ctx, dns.Fqdn(zone), metadataSuspendedUpdates)
+	if err != nil {
+		return false, fmt.Errorf("ZoneUpdatesSuspended: %w", err)
+	}
+	return metadata != nil && len(metadata.Metadata) > 0, nil
+}
+
+// SuspendZoneUpdates moves the user keys out of the zone's TSIG-ALLOW-DNSUPDATE
+// metadata, so that none of them can update the zone over RFC 2136 any more;
+// they may still transfer it. The admin key keeps its grant.
+func (p *PowerDnsClient) SuspendZoneUpdates(ctx context.Context, zone string) error {
+	zoneFQDN := dns.Fqdn(zone)
+	metadata, err := p.powerdns.Metadata.Get(ctx, zoneFQDN, powerdns.MetadataTSIGAllowDNSUpdate)
+	if err != nil {
+		return fmt.Errorf("SuspendZoneUpdates: %w", err)
+	}
+	if metadata == nil {
+		return nil
+	}
+	for _, keyname := range metadata.Metadata {
+		if !p.isUserKey(keyname) {
+			continue
+		}
+		if err := p.addValueToMetadata(ctx, zoneFQDN, metadataSuspendedUpdates, keyname); err != nil {
+			return fmt.Errorf("SuspendZoneUpdates: %w", err)
+		}
+		if err := p.removeValueFromMetadata(ctx, zoneFQDN, powerdns.MetadataTSIGAllowDNSUpdate, keyname); err != nil {
+			return fmt.Errorf("SuspendZoneUpdates: %w", err)
+		}
+	}
+	return nil
+}
+
+// ResumeZoneUpdates grants the keys SuspendZoneUpdates withheld updates again.
+func (p *PowerDnsClient) ResumeZoneUpdates(ctx context.Context, zone string) error {
+	zoneFQDN := dns.Fqdn(zone)
+	metadata, err := p.powerdns.Metadata.Get(ctx, zoneFQDN, metadataSuspendedUpdates)
+	if err != nil {
+		return fmt.Errorf("ResumeZoneUpdates: %w", err)
+	}
+	if metadata == nil {
+		return nil
+	}
+	for _, keyname := range metadata.Metadata {
+		if err := p.addValueToMetadata(ctx, zoneFQDN, powerdns.MetadataTSIGAllowDNSUpdate, keyname); err != nil {
+			return fmt.Errorf("ResumeZoneUpdates: %w", err)
+		}
+		if err := p.removeValueFromMetadata(ctx, zoneFQDN, metadataSuspendedUpdates, keyname); err != nil {
+			return fmt.Errorf("ResumeZoneUpdates: %w", err)
+		}
+	}
+	return nil
+}
+
+// requireZoneWritable refuses changes to the records of a zone that an admin
+// suspended or whose lease expired: its records are disabled, and records
+// written now would be served.
+func (app *AppData) requireZoneWritable(zone string) (int, any, error) {
+	rows, err := app.Storage.ZoneRows(zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the zone", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil, nil
+	}
+	switch l := groupZoneLeases(rows)[0]; {
+	case l.suspended != nil:
+		return errorResult(http.StatusForbidden, "The zone is suspended by an admin", fmt.Errorf("%s is suspended", zone))
+	case l.disabled != nil:
+		return errorResult(http.StatusForbidden, "The lease of the zone has expired; renew it first", fmt.Errorf("the lease of %s has expired", zone))
+	}
+	return 0, nil, nil
+}
+
+// AdminZoneSetDisabled disables (suspends) or enables the records of zone. A
+// suspended zone stays disabled until an admin enables it; its owners cannot
+// enable it by renewing, nor change its records: the API refuses, and the
+// update grants of their keys are withheld until it is enabled (or longer,
+// see syncZoneUpdateGrants). Enabling
+// leaves the records of a zone whose lease expired disabled: that takes a
+// renewal.
+func (app *AppData) AdminZoneSetDisabled(ctx context.Context, admin *UserClaims, zone string, disabled bool) (int, any, error) {
+	rows, status, resp, err := app.adminZoneRows(admin, zone)
+	if err != nil {
+		return status, resp, fmt.Errorf("app.AdminZoneSetDisabled: %w", err)
+	}
+	before := adminZoneOf(rows)
+
+	var suspended *time.Time
+	if disabled {
+		now := time.Now().UTC()
+		suspended = &now
+	}
+	if disabled {
+		if err := app.PowerDns.SuspendZoneUpdates(ctx, zone); err != nil {
+			return errorResult(http.StatusBadGateway, "Failed to revoke the update grants of the zone", fmt.Errorf("app.AdminZoneSetDisabled: %w", err))
+		}
+	}
+	if disabled || rows.disabled == nil {
+		if err := app.PowerDns.SetZoneRecordsDisabled(ctx, zone, disabled); err != nil {
+			return errorResult(http.StatusBadGateway, "Failed to change the records of the zone", fmt.Errorf("app.AdminZoneSetDisabled: %w", err))
+		}
+	}
+	var column any // a typed nil would not be stored as NULL
+	if suspended != nil {
+		column = *suspended
+	}
+	if err := app.Storage.ZoneLeaseSet(zone, map[string]any{"suspended_at": column}); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to store the zone state", fmt.Errorf("app.AdminZoneSetDisabled: %w", err))
+	}
+	// The rule of the zone may still withhold the grants.
+	if !disabled {
+		if err := app.syncZoneUpdateGrants(ctx, zone); err != nil {
+			return errorResult(http.StatusBadGateway, "Failed to restore the update grants of the zone", fmt.Errorf("app.AdminZoneSetDisabled: %w", err))
+		}
+	}
+	rows.suspended = suspended
+	after := adminZoneOf(rows)
+
+	action := AuditZoneEnable
+	if disabled {
+		action = AuditZoneDisable
+	}
+	app.Log.Infof("app.AdminZoneSetDisabled: %s set %s disabled=%t", admin.Email, zone, disabled)
+	app.audit(ctx, action, zone, zone, before, after)
+	return http.StatusOK, after, nil
+}
+
+// AdminZoneDelete deletes zone for all its owners, like an owner would: it goes
+// to the trash. A zone with subzones is refused.
+func (app *AppData) AdminZoneDelete(ctx context.Context, admin *UserClaims, zone string) (int, any, error) {
+	rows, status, resp, err := app.adminZoneRows(admin, zone)
+	if err != nil {
+		return status, resp, fmt.Errorf("app.AdminZoneDelete: %w", err)
+	}
+	// ZoneDelete only looks for subzones of the one owner it acts as.
+	all, err := app.Storage.ListAllZones()
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list zones", fmt.Errorf("app.AdminZoneDelete: %w", err))
+	}
+	for _, z := range all {
+		if isSubdomainOf(z.Zone, zone) {
+			return errorResult(http.StatusConflict, "Zone still has subzones — delete them first", fmt.Errorf("app.AdminZoneDelete: %s still has subzone %s", zone, z.Zone))
+		}
+	}
+	return app.ZoneDelete(ctx, rows.owners[0], zone)
+}
+
+// AdminZoneRotateKeys rotates the key of one owner of zone, or of all owners
+// when owner is empty, as ZoneRotateKeys does.
+func (app *AppData) AdminZoneRotateKeys(ctx context.Context, admin *UserClaims, zone string, req AdminZoneRotateRequest) (int, any, error) {
+	rows, status, resp, err := app.adminZoneRows(admin, zone)
+	if err != nil {
+		return status, resp, fmt.Errorf("app.AdminZoneRotateKeys: %w", err)
+	}
+	owners := rows.owners
+	if req.Owner != "" {
+		owner := strings.ToLower(strings.TrimSpace(req.Owner))
+		if !slices.Contains(owners, owner) {
+			return errorResult(http.StatusNotFound, "Not an owner of this zone", fmt.Errorf("app.AdminZoneRotateKeys: %s does not own %s", owner, zone))
+		}
+		owners = []string{owner}
+	}
+	return app.rotateZoneKeys(ctx, admin, zone, owners, req.KeyAlgorithm, req.Immediate)
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Super-admins manage every zone, delegated admins the zones below their
+// suffixes. A transfer leaves the new owner alone, and a suspended zone stays
+// disabled until an admin enables it, renewals notwithstanding: its owners'
+// keys lose their update grants and the API refuses to change its records.
+func TestAdminZones(t *testing.T) {
+	app := newTestApp(t)
+	fake := useFakePdns(t, app)
+	ctx := context.Background()
+	app.Config.DnsPolicyConfig.SuperAdminEmails = map[string]struct{}{"root@example.com": {}}
+	root, dana := &UserClaims{Email: "root@example.com"}, &UserClaims{Email: "dana@example.com"}
+	const zone = "alice.users.example.com"
+	const www = zone + ". www." + zone + ". A"
+	const updaters = zone + ". TSIG-ALLOW-DNSUPDATE"
+
+	CreateAdminZonesApiGroup(gin.New().Group("/v1"), app) // the routes must not conflict
+
+	if _, err := app.Storage.DelegationCreate(&DelegationPolicy{TargetUserFilter: "dana@example.com", ZoneSuffix: "team.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.PolicyCreateRule(ctx, PolicyRuleRequest{ZonePattern: "%u.users.example.com", ZoneSoa: "users.example.com", TargetUserFilter: "*"}); err != nil {
+		t.Fatal(err)
+	}
+	if status, _, err := app.ZoneCreate(ctx, "alice", ZoneResponse{Zone: zone, ZoneSOA: "users.example.com"}, ""); status != http.StatusCreated {
+		t.Fatalf("ZoneCreate: %d %v", status, err)
+	}
+	addZone(t, app, "carol", "app.team.example.com")
+	fake.rrsets[www] = []string{"192.0.2.1"}
+
+	list := func(admin *UserClaims, filter AdminZoneFilter) []AdminZone {
+		t.Helper()
+		filter.Limit = adminZonesDefaultLimit
+		_, resp, err := app.AdminZoneList(ctx, admin, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.(AdminZonesResponse).Zones
+	}
+	if zones := list(root, AdminZoneFilter{}); len(zones) != 2 {
+		t.Fatalf("expected every zone for a super admin, got %+v", zones)
+	}
+	if zones := list(dana, AdminZoneFilter{}); len(zones) != 1 || zones[0].Zone != "app.team.example.com" {
+		t.Fatalf("expected only the delegated zone, got %+v", zones)
+	}
+	if zones := list(root, AdminZoneFilter{Owner: "ALI"}); len(zones) != 1 || zones[0].Zone != zone {
+		t.Errorf("expected the zone of alice, got %+v", zones)
+	}
+	if status, _, _ := app.AdminZoneTransfer(ctx, dana, zone, "bob@example.com"); status != http.StatusForbidden {
+		t.Errorf("expected a zone outside the delegation to be refused, got %d", status)
+	}
+
+	if status, resp, err := app.AdminZoneTransfer(ctx, root, zone, "bob@example.com"); status != http.StatusOK {
+		t.Fatalf("AdminZoneTransfer: %d %+v %v", status, resp, err)
+	}
+	if owners, _ := app.Storage.ListZoneOwners(zone); !slices.Equal(owners, []string{"bob@example.com"}) {
+		t.Fatalf("expected bob to be the only owner, got %v", owners)
+	}
+	if status, _, _ := app.AdminZoneRemoveOwner(ctx, root, zone, "bob@example.com"); status != http.StatusConflict {
+		t.Errorf("expected the last owner to stay, got %d", status)
+	}
+
+	if status, resp, err := app.AdminZoneSetDisabled(ctx, root, zone, true); status != http.StatusOK || !fake.disabled[www] || resp.(AdminZone).SuspendedAt == nil {
+		t.Fatalf("AdminZoneSetDisabled: %d %+v %v", status, resp, err)
+	}
+	bobKey := app.PowerDns.keyNameFor("bob@example.com", zone)
+	if slices.Contains(fake.metadata[updaters], bobKey) {
+		t.Errorf("expected the owner's update grant to be withheld, got %v", fake.metadata[updaters])
+	}
+	if status, _, _ := app.ZoneRollback(ctx, "bob@example.com", zone, 1, false); status != http.StatusForbidden {
+		t.Errorf("expected a rollback of a suspended zone to be refused, got %d", status)
+	}
+	if status, _, _ := app.ZoneRecordsReplace(ctx, "bob@example.com", zone, ZoneRecordsRequest{Records: []ZoneRecordSet{}}, false); status != http.StatusForbidden {
+		t.Errorf("expected a write to a suspended zone to be refused, got %d", status)
+	}
+	// As if the lease had expired as well.
+	if err := app.Storage.ZoneLeaseSet(zone, map[string]any{"disabled_at": time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if status, _, err := app.ZoneRenew(ctx, "bob@example.com", zone); status != http.StatusOK || !fake.disabled[www] {
+		t.Fatalf("expected a renewal to leave a suspended zone disabled: %d %v", status, err)
+	}
+	if slices.Contains(fake.metadata[updaters], bobKey) {
+		t.Errorf("expected a renewal to leave the update grants of a suspended zone withheld, got %v", fake.metadata[updaters])
+	}
+	if status, resp, err := app.AdminZoneSetDisabled(ctx, root, zone, false); status != http.StatusOK || fake.disabled[www] || resp.(AdminZone).SuspendedAt != nil {
+		t.Fatalf("expected the zone to be enabled: %d %+v %v", status, resp, err)
+	}
+	if !slices.Contains(fake.metadata[updaters], bobKey) {
+		t.Errorf("expected the owner's update grant back, got %v", fake.metadata[updaters])
+	}
+}
@@ -92,6 +92,9 @@ type WebServerConfig struct {
 	WebserverBaseUrl string `json:"webserver_base_url" validate:"required,url"`
 	// The TTL (in hours) for API tokens
 	ApiTokenTTLHours int `json:"api_token_ttl_hours"`
+	// The longest TTL (in hours) a token may be requested with; 0 means
+	// ApiTokenTTLHours, so a custom TTL can only be shorter.
+	ApiTokenMaxTTLHours int `json:"api_token_max_ttl_hours" validate:"min=0"`
 	// The version of the external DNS image to use
 	ExternalDnsVersion string `json:"external_dns_version" validate:"required"`
 	// CORSAllowedOrigins lists the exact browser origins allowed to call this
@@ -99,6 +102,9 @@ type WebServerConfig struct {
 	// default) allows none: behind the BFF the SPA is same-origin with the API.
 	// dyndns clients are not browsers and never see a CORS check.
 	CORSAllowedOrigins []string `json:"cors_allowed_origins"`
+	// MetricsToken is the bearer token Prometheus scrapes /metrics with.
+	// Empty (the default) does not serve the metrics at all.
+	MetricsToken string `json:"metrics_token"`
 }
 
 type DefaultRecord struct {
@@ -126,6 +132,25 @@ type ZoneDefaults struct {
 	DefaultAdminTsigKey string `json:"default_admin_tsig_key,omitempty" validate:"omitempty"`
 	// TSIG algorithm for for admin updates, added to all zones (intermediate and requested)provider
 	DefaultAdminTsigAlg string `json:"default_admin_tsig_alg,omitempty" validate:"omitempty"`
+	// TSIG algorithms users may choose for their zone keys; the first one is
+	// used when they do not choose. Key lengths follow the algorithm.
+	UserTsigAlgorithms []string `json:"user_tsig_algorithms" validate:"min=1,dive,oneof=hmac-sha1 hmac-sha224 hmac-sha256 hmac-sha384 hmac-sha512"`
+	// Seconds the old zone keys stay valid after a key rotation; 0 replaces
+	// them at once.
+	KeyRotationGraceSeconds int `json:"key_rotation_grace_seconds" validate:"min=0"`
+	// Days before a zone lease expires that the owners are warned; they always
+	// get at least this long before the zone is disabled.
+	LeaseWarningDays int `json:"lease_warning_days" validate:"min=0"`
+	// Days a zone stays disabled after its lease expired before it is deleted.
+	LeaseGraceDays int `json:"lease_grace_days" validate:"min=0"`
+	// Days a deleted zone stays in the trash, restorable; 0 deletes zones at
+	// once.
+	TrashRetentionDays int `json:"trash_retention_days" validate:"min=0"`
+	// Versions of its records kept per zone; 0 keeps no history.
+	HistoryVersions int `json:"history_versions" validate:"min=0"`
+	// Seconds between the zone transfers that catch changes made straight
+	// over RFC 2136; 0 only records the changes made through the API.
+	HistoryIntervalSeconds int `json:"history_interval_seconds" validate:"min=0"`
 }
 
 type DnsPolicyConfig struct {
@@ -133,6 +158,29 @@ type DnsPolicyConfig struct {
 	// Filename of a JavaScript script to initialize default policies and data
 }
 
+type ReconcileConfig struct {
+	// Seconds between scheduled reconcile runs; 0 disables the schedule, manual
+	// runs through the admin API still work.
+	IntervalSeconds int `json:"interval" validate:"gte=0"`
+	// DryRun makes scheduled runs only report drift instead of repairing it.
+	DryRun bool `json:"dry_run"`
+}
+
+type NotifyConfig struct {
+	// Days before its expiry the owner of an API token is warned; 0 disables
+	// the warnings.
+	TokenExpiryWarningDays int `json:"token_expiry_warning_days" validate:"gte=0"`
+	// Backend delivers the notifications: "log" only logs them.
+	Backend string `json:"backend" validate:"oneof=log smtp webhook"`
+	// The mail server (host:port) and sender for the smtp backend.
+	SmtpAddr     string `json:"smtp_addr" validate:"required_if=Backend smtp"`
+	SmtpFrom     string `json:"smtp_from" validate:"required_if=Backend smtp"`
+	SmtpUsername string `json:"smtp_username,omitempty"`
+	SmtpPassword string `json:"smtp_password,omitempty"`
+	// The URL the webhook backend posts notifications to.
+	WebhookURL string `json:"webhook_url" validate:"required_if=Backend webhook"`
+}
+
 type AppConfig struct {
 	UpstreamDns     UpstreamDnsUpdateConfig `json:"upstream_dns_config"`
 	PowerDns        PowerDnsConfig          `json:"powerdns_config"`
@@ -140,6 +188,8 @@ type AppConfig struct {
 	WebServer       WebServerConfig         `json:"webserver_config"`
 	ZoneDefaults    ZoneDefaults            `json:"zone_defaults"`
 	DnsPolicyConfig DnsPolicyConfig         `json:"dns_policy_config"`
+	Reconcile       ReconcileConfig         `json:"reconcile_config"`
+	Notify          NotifyConfig            `json:"notify_config"`
 	// Path to the initial data script file (JavaScript) to run on startup
 	InitialDataScriptPath string `json:"initial_data_script_path,omitempty"`
 	// Flag indicating if the application is running in development mode
@@ -180,18 +230,27 @@ func GetAppConfigFromEnvironment() (AppConfig, error) {
 			DbConnectionString: envconf.String("DB_CONNECTION_STRING", "file::memory:?cache=shared"),
 		},
 		WebServer: WebServerConfig{
-			ApiTokenTTLHours:   envconf.Int("API_TOKEN_TTL_HOURS", 24),
-			OIDCIssuerURL:      envconf.String("OIDC_ISSUER_URL", ""),
-			OIDCClientID:       envconf.String("OIDC_CLIENT_ID", ""),
-			GinBindString:      envconf.String("API_BIND", ":8082"),
-			WebserverBaseUrl:   envconf.String("API_BASE_URL", "http://localhost:8082"),
-			ExternalDnsVersion: envconf.String("EXTERNAL_DNS_IMAGE_VERSION", "v0.19.0"),
-			CORSAllowedOrigins: envconf.StringSlice("CORS_ALLOWED_ORIGINS", []string{}),
+			ApiTokenTTLHours:    envconf.Int("API_TOKEN_TTL_HOURS", 24),
+			ApiTokenMaxTTLHours: envconf.Int("API_TOKEN_MAX_TTL_HOURS", 0),
+			OIDCIssuerURL:       envconf.String("OIDC_ISSUER_URL", ""),
+			OIDCClientID:        envconf.String("OIDC_CLIENT_ID", ""),
+			GinBindString:       envconf.String("API_BIND", ":8082"),
+			WebserverBaseUrl:    envconf.String("API_BASE_URL", "http://localhost:8082"),
+			ExternalDnsVersion:  envconf.String("EXTERNAL_DNS_IMAGE_VERSION", "v0.19.0"),
+			CORSAllowedOrigins:  envconf.StringSlice("CORS_ALLOWED_ORIGINS", []string{}),
+			MetricsToken:        envconf.String("METRICS_TOKEN", ""),
 		},
 		ZoneDefaults: ZoneDefaults{
 			DefaultAdminTsigKeyName: envconf.String("ZONE_DEFAULTS_ADMIN_TSIG_NAME", ""),
 			DefaultAdminTsigKey:     envconf.String("ZONE_DEFAULTS_ADMIN_TSIG_KEY", ""),
 			DefaultAdminTsigAlg:     envconf.String("ZONE_DEFAULTS_ADMIN_TSIG_ALG", ""),
+			UserTsigAlgorithms:      envconf.StringSlice("ZONE_DEFAULTS_TSIG_ALGORITHMS", []string{"hmac-sha512", "hmac-sha384", "hmac-sha256"}),
+			KeyRotationGraceSeconds: envconf.Int("ZONE_DEFAULTS_KEY_ROTATION_GRACE", 24*60*60),
+			LeaseWarningDays:        envconf.Int("ZONE_DEFAULTS_LEASE_WARNING_DAYS", 14),
+			LeaseGraceDays:          envconf.Int("ZONE_DEFAULTS_LEASE_GRACE_DAYS", 30),
+			TrashRetentionDays:      envconf.Int("ZONE_DEFAULTS_TRASH_RETENTION_DAYS", 30),
+			HistoryVersions:         envconf.Int("ZONE_DEFAULTS_HISTORY_VERSIONS", 100),
+			HistoryIntervalSeconds:  envconf.Int("ZONE_DEFAULTS_HISTORY_SNAPSHOT_INTERVAL", 60*60),
 			DefaultRecords: func() []DefaultRecord {
 				raw := envconf.String("ZONE_DEFAULTS_ADMIN_RECORDS", "[]")
 				var records []DefaultRecord
@@ -212,6 +271,19 @@ func GetAppConfigFromEnvironment() (AppConfig, error) {
 		DnsPolicyConfig: DnsPolicyConfig{
 			SuperAdminEmails: envconf.StringSet("DNS_POLICY_SUPERADMIN_EMAILS", map[string]struct{}{}, strings.ToLower),
 		},
+		Reconcile: ReconcileConfig{
+			IntervalSeconds: envconf.Int("RECONCILE_INTERVAL", 60*60),
+			DryRun:          envconf.String("RECONCILE_DRY_RUN", "false") == "true",
+		},
+		Notify: NotifyConfig{
+			TokenExpiryWarningDays: envconf.Int("NOTIFY_TOKEN_EXPIRY_DAYS", 7),
+			Backend:                envconf.String("NOTIFY_BACKEND", NotifyBackendLog),
+			SmtpAddr:               envconf.String("NOTIFY_SMTP_ADDR", ""),
+			SmtpFrom:               envconf.String("NOTIFY_SMTP_FROM", ""),
+			SmtpUsername:           envconf.String("NOTIFY_SMTP_USERNAME", ""),
+			SmtpPassword:           envconf.String("NOTIFY_SMTP_PASSWORD", ""),
+			WebhookURL:             envconf.String("NOTIFY_WEBHOOK_URL", ""),
+		},
 
 		InitialDataScriptPath: envconf.String("INITIAL_DATA_SCRIPT_PATH", ""),
 		DevMode:               envconf.String("API_MODE", "production") == "development",
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/mail"
+	"slices"
 	"strings"
 	"text/template"
 	"time"
@@ -31,7 +32,11 @@ type PolicyRuleRequest struct {
 	TargetUserFilter string `json:"target_user_filter" binding:"required"`
 	AllowSubdomains  bool   `json:"allow_subdomains"`
 	SharingAllowed   bool   `json:"sharing_allowed"`
+	Dnssec           bool   `json:"dnssec"`
 	Description      string `json:"description"`
+	RecordConstraints
+	ZoneQuotas
+	LeaseDays uint32 `json:"lease_days"`
 }
 
 // PolicyRulesResponse wraps policy rules for list endpoint.
@@ -131,7 +136,9 @@ func (app *AppData) PolicyIsZoneAllowedForUser(zone string, user *UserClaims) (b
 		app.Log.Debugf("User %s is allowed to use subzone %s under %s", user.PreferredUsername, zone, bestParent.Zone)
 		// Delegate the subzone under its parent (ZoneSOA = parent zone); the
 		// subzone inherits the parent's sharing setting.
-		return true, &ZoneResponse{Zone: zone, ZoneSOA: bestParent.Zone, AllowSubdomains: true, SharingAllowed: bestParent.SharingAllowed}, nil
+		return true, &ZoneResponse{Zone: zone, ZoneSOA: bestParent.Zone, AllowSubdomains: true, SharingAllowed: bestParent.SharingAllowed,
+			Dnssec: bestParent.Dnssec, RecordConstraints: bestParent.RecordConstraints, BaseZone: quotaBase(bestParent), ZoneQuotas: bestParent.ZoneQuotas,
+			LeaseDays: bestParent.LeaseDays}, nil
 	}
 
 	app.Log.Debugf("User %s is not allowed to use zone %s", user.PreferredUsername, zone)
@@ -147,7 +154,7 @@ func isSubdomainOf(child, parent string) bool {
 	return c != p && strings.HasSuffix(c, "."+p)
 }
 
-func (app *AppData) PolicyCreateRule(req PolicyRuleRequest) (*PolicyRule, error) {
+func (app *AppData) PolicyCreateRule(ctx context.Context, req PolicyRuleRequest) (*PolicyRule, error) {
 	err := policyValidateRequest(req)
 	if err != nil {
 		app.Log.Errorf("Invalid policy rule request: %v", err)
@@ -156,25 +163,35 @@ func (app *AppData) PolicyCreateRule(req PolicyRuleRequest) (*PolicyRule, error)
 
 	// Create and store the new rule
 	newRule := PolicyRule{
-		ZonePattern:      req.ZonePattern,
-		ZoneSoa:          req.ZoneSoa,
-		TargetUserFilter: req.TargetUserFilter,
-		AllowSubdomains:  req.AllowSubdomains,
-		SharingAllowed:   req.SharingAllowed,
-		Description:      req.Description,
+		ZonePattern:       req.ZonePattern,
+		ZoneSoa:           req.ZoneSoa,
+		TargetUserFilter:  req.TargetUserFilter,
+		AllowSubdomains:   req.AllowSubdomains,
+		SharingAllowed:    req.SharingAllowed,
+		Dnssec:            req.Dnssec,
+		RecordConstraints: req.RecordConstraints,
+		ZoneQuotas:        req.ZoneQuotas,
+		LeaseDays:         req.LeaseDays,
+		Description:       req.Description,
 	}
 
 	app.Log.Infof("Storing new policy rule: %+v", newRule)
+	emitOrphans := app.watchOrphans(ctx)
+	syncGrants := app.watchUpdateGrants(ctx)
 	createdRule, err := app.Storage.PolicyCreate(&newRule)
 	if err != nil {
 		app.Log.Errorf("Error storing policy rule: %v", err)
 		return nil, err
 	}
 
+	app.audit(ctx, AuditRuleCreate, fmt.Sprintf("rule/%d", createdRule.ID), createdRule.ZoneSoa, nil, createdRule)
+	app.emit(ctx, EventRuleCreated, createdRule.ZoneSoa, createdRule)
+	emitOrphans()
+	syncGrants()
 	return createdRule, nil
 }
 
-func (app *AppData) PolicyUpdateRule(id int64, req PolicyRuleRequest) (*PolicyRule, error) {
+func (app *AppData) PolicyUpdateRule(ctx context.Context, id int64, req PolicyRuleRequest) (*PolicyRule, error) {
 	err := policyValidateRequest(req)
 	if err != nil {
 		app.Log.Errorf("Invalid policy rule request: %v", err)
@@ -192,15 +209,23 @@ func (app *AppData) PolicyUpdateRule(id int64, req PolicyRuleRequest) (*PolicyRu
 		}
 	}
 
+	before := *existingRule
+
 	// Update the fields on the existing rule object
 	existingRule.ZonePattern = req.ZonePattern
 	existingRule.ZoneSoa = req.ZoneSoa
 	existingRule.TargetUserFilter = req.TargetUserFilter
 	existingRule.AllowSubdomains = req.AllowSubdomains
 	existingRule.SharingAllowed = req.SharingAllowed
+	existingRule.Dnssec = req.Dnssec
+	existingRule.RecordConstraints = req.RecordConstraints
+	existingRule.ZoneQuotas = req.ZoneQuotas
+	existingRule.LeaseDays = req.LeaseDays
 	existingRule.Description = req.Description
 
 	app.Log.Infof("Updating policy rule #%d to: %+v", id, existingRule)
+	emitOrphans := app.watchOrphans(ctx)
+	syncGrants := app.watchUpdateGrants(ctx)
 	updatedRule, err := app.Storage.PolicyUpdate(existingRule)
 	if err != nil {
 		app.Log.Errorf("Error updating policy rule #%d: %v", id, err)
@@ -210,12 +235,23 @@ func (app *AppData) PolicyUpdateRule(id int64, req PolicyRuleRequest) (*PolicyRu
 		return nil, fmt.Errorf("failed to update rule: %w", err)
 	}
 
+	// Filed under the new SOA: a rule moved out of a delegate's subtree is
+	// still visible there through its before.
+	app.audit(ctx, AuditRuleUpdate, fmt.Sprintf("rule/%d", id), updatedRule.ZoneSoa, before, updatedRule)
+	app.emit(ctx, EventRuleUpdated, updatedRule.ZoneSoa, gin.H{"before": before, "after": updatedRule})
+	emitOrphans()
+	syncGrants()
 	return updatedRule, nil
 }
 
-func (app *AppData) PolicyDeleteRule(id int64) error {
+func (app *AppData) PolicyDeleteRule(ctx context.Context, id int64) error {
 	app.Log.Debugf("Deleting policy rule #%d", id)
 
+	// Looked up for the audit log only; a missing rule is reported below.
+	before, _ := app.Storage.PolicyGetByID(id)
+
+	emitOrphans := app.watchOrphans(ctx)
+	syncGrants := app.watchUpdateGrants(ctx)
 	if err := app.Storage.PolicyDelete(id); err != nil {
 		app.Log.Errorf("Error deleting policy rule #%d: %v", id, err)
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -224,6 +260,14 @@ func (app *AppData) PolicyDeleteRule(id int64) error {
 		return fmt.Errorf("failed to delete rule: %w", err)
 	}
 
+	zoneSoa := ""
+	if before != nil {
+		zoneSoa = before.ZoneSoa
+	}
+	app.audit(ctx, AuditRuleDelete, fmt.Sprintf("rule/%d", id), zoneSoa, before, nil)
+	app.emit(ctx, EventRuleDeleted, zoneSoa, before)
+	emitOrphans()
+	syncGrants()
 	return nil
 }
 
@@ -260,6 +304,17 @@ func (app *AppData) ZoneGet(ctx context.Context, user *UserClaims, zone, externa
 		return errorResult(http.StatusInternalServerError, "Failed to get zone from DNS server", fmt.Errorf("app.getZone: %w", err))
 	}
 
+	namedKeys, err := app.Storage.NamedKeyList(zone, username)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list named keys", fmt.Errorf("app.getZone: %w", err))
+	}
+	pdnsZone.NamedKeys = namedKeys
+
+	_, rotation, err := app.ZoneKeyRotationStatus(ctx, nil, zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the key rotation state", fmt.Errorf("app.getZone: %w", err))
+	}
+
 	// Generate external-dns config
 	valuesYaml, err := toExternalDNSConfig(app, pdnsZone, externalDnsVersion)
 	if err != nil {
@@ -276,6 +331,12 @@ func (app *AppData) ZoneGet(ctx context.Context, user *UserClaims, zone, externa
 		return errorResult(http.StatusInternalServerError, "Failed to evaluate sharing", fmt.Errorf("app.getZone: %w", err))
 	}
 
+	// Keys and DS records, so the owner can register the DS upstream.
+	dnssecInfo, err := app.PowerDns.ZoneDnssec(ctx, zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to get DNSSEC keys from DNS server", fmt.Errorf("app.getZone: %w", err))
+	}
+
 	// Return zone data
 	app.Log.Infof("app.getZone: returning zone %s", zone)
 
@@ -284,6 +345,8 @@ func (app *AppData) ZoneGet(ctx context.Context, user *UserClaims, zone, externa
 		"externalDnsValuesYaml": valuesYaml,
 		"owners":                owners,
 		"sharing_allowed":       sharingAllowed,
+		"dnssec":                dnssecInfo,
+		"key_rotation":          rotation,
 	}, nil
 }
 
@@ -301,10 +364,44 @@ func (app *AppData) ZoneDelete(ctx context.Context, username, zone string) (int,
 		}
 	}
 
+	owners, err := app.Storage.ListZoneOwners(zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list zone owners", fmt.Errorf("app.ZoneDelete: %w", err))
+	}
+
+	namedKeys, err := app.Storage.NamedKeyList(zone, "")
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list named keys", fmt.Errorf("app.ZoneDelete: %w", err))
+	}
+
+	// Keep the records and owners, so the zone can be restored for a while.
+	// They are read first, but only trashed once the zone is gone.
+	trashed, err := app.zoneTrashEntry(ctx, zone, owners)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the zone for the trash", fmt.Errorf("app.ZoneDelete: %w", err))
+	}
+
 	if err := app.PowerDns.DeleteZone(ctx, zone, true); err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to delete zone from DNS server",
 			fmt.Errorf("app.ZoneDelete: %w", err))
 	}
+	if err := app.trashZone(zone, trashed); err != nil {
+		app.Log.Warnf("app.ZoneDelete: %s deleted, but not moved to the trash: %v", zone, err)
+	}
+
+	// Scoped named keys are only granted AXFR, so DeleteZone leaves them.
+	if err := app.deleteNamedKeys(ctx, namedKeys); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to delete named keys", fmt.Errorf("app.ZoneDelete: %w", err))
+	}
+	if err := app.Storage.KeyRotationDelete(zone, ""); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to delete the key rotation state", fmt.Errorf("app.ZoneDelete: %w", err))
+	}
+
+	// A DS left in the parent would make a zone re-created under this name
+	// bogus for validating resolvers.
+	if err := app.PowerDns.PublishDS(ctx, parentZone(zone), zone); err != nil {
+		app.Log.Warnf("app.ZoneDelete: DS of %s not withdrawn: %v", zone, err)
+	}
 
 	// Deleting the zone removes it for ALL owners (their per-owner keys are gone
 	// with the pdns zone above), so drop every owner row, not just the caller's.
@@ -314,6 +411,8 @@ func (app *AppData) ZoneDelete(ctx context.Context, username, zone string) (int,
 	}
 
 	app.Log.Infof("app.ZoneDelete: %s deleted for user %s", zone, username)
+	app.audit(ctx, AuditZoneDelete, zone, zone, gin.H{"owners": owners}, nil)
+	app.emit(ctx, EventZoneDeleted, zone, gin.H{"zone": auditZone(zone), "owners": owners})
 	return http.StatusNoContent, nil, nil
 }
 
@@ -365,6 +464,8 @@ func (app *AppData) ZoneJoin(ctx context.Context, user *UserClaims, zone string)
 	if err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to list owners", err)
 	}
+	app.audit(ctx, AuditZoneJoin, zone, zone, nil, gin.H{"owners": owners, "subzones": subzones})
+	app.emit(ctx, EventZoneOwnerAdded, zone, gin.H{"zone": auditZone(zone), "owner": username, "owners": owners, "subzones": subzones})
 	return http.StatusOK, gin.H{"owners": owners}, nil
 }
 
@@ -422,6 +523,16 @@ func (app *AppData) ZoneAddOwner(ctx context.Context, caller *UserClaims, zone,
 	if !shareable {
 		return errorResult(http.StatusForbidden, "Sharing is not enabled for this zone", nil)
 	}
+	return app.addZoneOwner(ctx, caller.PreferredUsername, zone, newOwner)
+}
+
+// addZoneOwner gives newOwner a row and a TSIG key of zone and of the zones
+// delegated below it. The caller checks who may do this; actor is logged.
+func (app *AppData) addZoneOwner(ctx context.Context, actor, zone, newOwner string) (int, any, error) {
+	ownersBefore, err := app.Storage.ListZoneOwners(zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list owners", err)
+	}
 
 	if already, err := app.Storage.IsZoneOwner(newOwner, zone); err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to check ownership", err)
@@ -433,7 +544,7 @@ func (app *AppData) ZoneAddOwner(ctx context.Context, caller *UserClaims, zone,
 		if err := app.PowerDns.AddOwnerKey(ctx, zone, newOwner); err != nil {
 			return errorResult(http.StatusInternalServerError, "Failed to provision owner key", err)
 		}
-		app.Log.Infof("app.ZoneAddOwner: %s added %s as owner of %s", caller.PreferredUsername, newOwner, zone)
+		app.Log.Infof("app.ZoneAddOwner: %s added %s as owner of %s", actor, newOwner, zone)
 	}
 
 	// Unconditional (not only for a fresh owner): sharing covers the subtree, so
@@ -450,6 +561,8 @@ func (app *AppData) ZoneAddOwner(ctx context.Context, caller *UserClaims, zone,
 	if err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to list owners", err)
 	}
+	app.audit(ctx, AuditZoneOwnerAdd, zone+"/owners/"+newOwner, zone, gin.H{"owners": ownersBefore}, gin.H{"owners": owners, "subzones": subzones})
+	app.emit(ctx, EventZoneOwnerAdded, zone, gin.H{"zone": auditZone(zone), "owner": newOwner, "owners": owners, "subzones": subzones})
 	return http.StatusOK, gin.H{"owners": owners}, nil
 }
 
@@ -465,7 +578,13 @@ func (app *AppData) ZoneRemoveOwner(ctx context.Context, caller *UserClaims, zon
 	if !isOwner {
 		return errorResult(http.StatusForbidden, "You are not an owner of this zone", nil)
 	}
+	return app.removeZoneOwner(ctx, caller.PreferredUsername, zone, owner)
+}
 
+// removeZoneOwner takes zone and the zones delegated below it from owner: the
+// row, the TSIG key and the named keys. The last owner cannot be removed. The
+// caller checks who may do this; actor is logged.
+func (app *AppData) removeZoneOwner(ctx context.Context, actor, zone, owner string) (int, any, error) {
 	if targetIsOwner, err := app.Storage.IsZoneOwner(owner, zone); err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to check ownership", err)
 	} else if !targetIsOwner {
@@ -479,6 +598,10 @@ func (app *AppData) ZoneRemoveOwner(ctx context.Context, caller *UserClaims, zon
 	if count <= 1 {
 		return errorResult(http.StatusConflict, "Cannot remove the last owner — delete the zone instead", nil)
 	}
+	ownersBefore, err := app.Storage.ListZoneOwners(zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list owners", err)
+	}
 
 	if err := app.Storage.DeleteZone(owner, zone); err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to remove owner", err)
@@ -486,6 +609,16 @@ func (app *AppData) ZoneRemoveOwner(ctx context.Context, caller *UserClaims, zon
 	if err := app.PowerDns.RemoveOwnerKey(ctx, zone, owner); err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to remove owner key", err)
 	}
+	namedKeys, err := app.Storage.NamedKeyList(zone, owner)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list named keys", err)
+	}
+	if err := app.deleteNamedKeys(ctx, namedKeys); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to remove named keys", err)
+	}
+	if err := app.Storage.KeyRotationDelete(zone, owner); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to remove the key rotation state", err)
+	}
 
 	// Symmetric to joining: giving up a zone gives up what it delegates. Subzones
 	// where they are the last owner are kept — see revokeOwnerSubtree.
@@ -493,7 +626,7 @@ func (app *AppData) ZoneRemoveOwner(ctx context.Context, caller *UserClaims, zon
 	if err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to revoke subzone access", err)
 	}
-	app.Log.Infof("app.ZoneRemoveOwner: %s removed %s from %s (%d subzone(s) revoked)", caller.PreferredUsername, owner, zone, len(revoked))
+	app.Log.Infof("app.ZoneRemoveOwner: %s removed %s from %s (%d subzone(s) revoked)", actor, owner, zone, len(revoked))
 	for _, sub := range kept {
 		app.Log.Warnf("app.ZoneRemoveOwner: %s stays the only owner of subzone '%s' — removing them would orphan it", owner, sub)
 	}
@@ -502,13 +635,18 @@ func (app *AppData) ZoneRemoveOwner(ctx context.Context, caller *UserClaims, zon
 	if err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to list owners", err)
 	}
+	app.audit(ctx, AuditZoneOwnerRemove, zone+"/owners/"+owner, zone, gin.H{"owners": ownersBefore}, gin.H{"owners": owners, "revoked_subzones": revoked})
+	app.emit(ctx, EventZoneOwnerRemoved, zone, gin.H{"zone": auditZone(zone), "owner": owner, "owners": owners, "revoked_subzones": revoked})
 	return http.StatusOK, gin.H{"owners": owners}, nil
 }
 
-// ZoneRotateKeys regenerates the TSIG key of every owner of `zone` (e.g. after a
-// suspected key compromise). The caller must be an owner; all owners must
-// re-fetch their key afterwards.
-func (app *AppData) ZoneRotateKeys(ctx context.Context, caller *UserClaims, zone string) (int, any, error) {
+// ZoneRotateKeys regenerates the TSIG key of every owner of `zone`, switching to
+// algorithm unless it is empty. With a grace period configured the new keys are
+// issued next to the old ones, which keep working until the cutoff; otherwise,
+// or when immediate is set (e.g. after a suspected key compromise), the old keys
+// are replaced at once. The caller must be an owner; all owners must re-fetch
+// their key afterwards.
+func (app *AppData) ZoneRotateKeys(ctx context.Context, caller *UserClaims, zone, algorithm string, immediate bool) (int, any, error) {
 	isOwner, err := app.Storage.IsZoneOwner(caller.PreferredUsername, zone)
 	if err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to check ownership", err)
@@ -520,13 +658,43 @@ func (app *AppData) ZoneRotateKeys(ctx context.Context, caller *UserClaims, zone
 	if err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to list owners", err)
 	}
-	if err := app.PowerDns.RotateZoneKeys(ctx, zone, owners); err != nil {
+	return app.rotateZoneKeys(ctx, caller, zone, owners, algorithm, immediate)
+}
+
+// rotateZoneKeys regenerates the TSIG keys of owners of zone as
+// ZoneRotateKeys describes. The caller checks who may do this.
+func (app *AppData) rotateZoneKeys(ctx context.Context, caller *UserClaims, zone string, owners []string, algorithm string, immediate bool) (int, any, error) {
+	if algorithm != "" && !slices.Contains(app.tsigAlgorithms(), algorithm) {
+		return errorResult(http.StatusBadRequest, fmt.Sprintf("TSIG algorithm %q is not allowed, use one of %v", algorithm, app.tsigAlgorithms()), nil)
+	}
+	if !immediate && app.keyRotationGrace() > 0 {
+		return app.zoneKeyRotationGraceful(ctx, caller, zone, owners, algorithm)
+	}
+	if err := app.PowerDns.RotateZoneKeys(ctx, zone, owners, algorithm); err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to rotate keys", err)
 	}
+	// RotateZoneKeys removed the old keys of a graceful rotation as well.
+	for _, owner := range owners {
+		if err := app.Storage.KeyRotationDelete(zone, owner); err != nil {
+			return errorResult(http.StatusInternalServerError, "Failed to reset the rotation state", err)
+		}
+	}
 	app.Log.Infof("app.ZoneRotateKeys: %s rotated %d key(s) for %s", caller.PreferredUsername, len(owners), zone)
+	// Which keys were rotated, never the keys themselves.
+	app.audit(ctx, AuditZoneKeysRotate, zone, zone, nil, gin.H{"owners": owners, "algorithm": algorithm})
+	app.emit(ctx, EventZoneKeysRotated, zone, gin.H{"zone": auditZone(zone), "owners": owners, "algorithm": algorithm})
 	return http.StatusOK, gin.H{"rotated": len(owners)}, nil
 }
 
+// tsigAlgorithms returns the algorithms users may choose for their zone keys,
+// the default first.
+func (app *AppData) tsigAlgorithms() []string {
+	if len(app.Config.ZoneDefaults.UserTsigAlgorithms) == 0 {
+		return []string{defaultUserTsigAlg}
+	}
+	return app.Config.ZoneDefaults.UserTsigAlgorithms
+}
+
 // OrphanedZone is a stored zone that is no longer covered by any policy rule for
 // its owner (e.g. because the policy was later deleted or changed).
 type OrphanedZone struct {
@@ -555,12 +723,30 @@ func (app *AppData) OrphanedZones() ([]OrphanedZone, error) {
 	return orphaned, nil
 }
 
-func (app *AppData) ZoneCreate(ctx context.Context, username string, zone ZoneResponse) (int, any, error) {
+// ZoneCreate creates zone for username, with a TSIG key of keyAlgorithm (the
+// default one when empty).
+func (app *AppData) ZoneCreate(ctx context.Context, username string, zone ZoneResponse, keyAlgorithm string) (int, any, error) {
+	if keyAlgorithm == "" {
+		keyAlgorithm = app.tsigAlgorithms()[0]
+	}
+	if !slices.Contains(app.tsigAlgorithms(), keyAlgorithm) {
+		return errorResult(http.StatusBadRequest, fmt.Sprintf("TSIG algorithm %q is not allowed, use one of %v", keyAlgorithm, app.tsigAlgorithms()),
+			fmt.Errorf("app.ZoneCreate: algorithm %q", keyAlgorithm))
+	}
+
 	// Check if zone exists
 	if status, msg, err := app.checkZoneExists(zone.Zone); err != nil {
 		return status, msg, err
 	}
 
+	if status, err := app.checkZoneQuotas(username, &zone); err != nil {
+		msg := err.Error()
+		if status == http.StatusInternalServerError {
+			msg = "Failed to check zone quotas"
+		}
+		return errorResult(status, msg, fmt.Errorf("app.ZoneCreate: %w", err))
+	}
+
 	// Check which zones this nameserver is authoritative for. A nil result means
 	// the zone is NOT under its own SOA — the chain of intermediate zones cannot
 	// be built, and creating the zone anyway would mint a name outside the SOA
@@ -572,28 +758,27 @@ func (app *AppData) ZoneCreate(ctx context.Context, username string, zone ZoneRe
 	}
 
 	// Create all  intermediates zones
-	for i, z := range authoritative {
-		// Skip the requested zone itself
-		if z == zone.Zone {
-			continue
-		}
-
-		// Determine next child zone
-		nextChildZone := next(authoritative, i)
-
-		app.Log.Infof("app.ZoneCreate: Creating intermediate zone '%s' I'm authoritative for (with child zone delegation to %s)", z, nextChildZone)
-		if err := app.PowerDns.EnsureIntermediateZoneExists(ctx, z, nextChildZone); err != nil {
-			return errorResult(http.StatusInternalServerError, "Failed to ensure intermediate zone exists", err)
-		}
+	if err := app.ensureIntermediateZones(ctx, zone.Zone, authoritative, zone.Dnssec); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to ensure intermediate zone exists", err)
 	}
 
 	// This is the requested zone, create it
-	zoneResponse, err := app.PowerDns.CreateUserZone(ctx, username, zone.Zone, true)
+	zoneResponse, err := app.PowerDns.CreateUserZone(ctx, username, zone.Zone, true, zone.Dnssec, keyAlgorithm)
 	if err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to create zone in DNS server", fmt.Errorf("app.ZoneCreate: %w", err))
 	}
 
+	// Chain the signed zones: each one's DS goes into the zone above it.
+	if zone.Dnssec {
+		if err := app.publishDSChain(ctx, authoritative); err != nil {
+			return errorResult(http.StatusInternalServerError, "Failed to publish DS records", fmt.Errorf("app.ZoneCreate: %w", err))
+		}
+	}
+
 	refreshTime := time.Now().Add(time.Duration(app.RefreshTime) * time.Second)
+	if zone.LeaseDays > 0 {
+		refreshTime = leaseEnd(time.Now(), zone.LeaseDays)
+	}
 	if _, err := app.Storage.CreateZone(username, zone.Zone, refreshTime); err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to create zone in storage", fmt.Errorf("app.ZoneCreate: %w", err))
 	}
@@ -603,10 +788,42 @@ func (app *AppData) ZoneCreate(ctx context.Context, username string, zone ZoneRe
 	if err := app.inheritOwnersFromParent(ctx, zone.Zone, username); err != nil {
 		return errorResult(http.StatusInternalServerError, "Failed to inherit parent owners", fmt.Errorf("app.ZoneCreate: %w", err))
 	}
+	if err := app.syncZoneUpdateGrants(ctx, zone.Zone); err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to withhold the update grants of the zone", fmt.Errorf("app.ZoneCreate: %w", err))
+	}
+
+	app.audit(ctx, AuditZoneCreate, zone.Zone, zone.Zone, nil, gin.H{"zone_soa": zone.ZoneSOA, "base_zone": zone.BaseZone})
+	app.emit(ctx, EventZoneCreated, zone.Zone, gin.H{"zone": auditZone(zone.Zone), "owner": username, "zone_soa": zone.ZoneSOA, "base_zone": zone.BaseZone})
 
+	// The history of an earlier zone of this name is not the new zone's.
+	if err := app.Storage.ZoneVersionDeleteAll(auditZone(zone.Zone)); err != nil {
+		app.Log.Warnf("app.ZoneCreate: %v", err)
+	}
+	app.recordZoneVersion(ctx, zone.Zone, ZoneVersionAPI)
 	return http.StatusCreated, gin.H{"success": zoneResponse}, nil
 }
 
+// ensureIntermediateZones creates the zones of authoritative (see
+// getAuthoritativeZones) above zone, each delegating to the next one down.
+// With dnssec they are signed as well, so the chain of trust reaches zone.
+func (app *AppData) ensureIntermediateZones(ctx context.Context, zone string, authoritative []string, dnssec bool) error {
+	for i, z := range authoritative {
+		// Skip the requested zone itself
+		if z == zone {
+			continue
+		}
+
+		// Determine next child zone
+		nextChildZone := next(authoritative, i)
+
+		app.Log.Infof("app.ensureIntermediateZones: Creating intermediate zone '%s' I'm authoritative for (with child zone delegation to %s)", z, nextChildZone)
+		if err := app.PowerDns.EnsureIntermediateZoneExists(ctx, z, nextChildZone, dnssec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Generic helper for consistent error returns
 func errorResult(code int, msg string, err error) (int, gin.H, error) {
 	return code, gin.H{"error": msg}, err
@@ -644,7 +861,7 @@ func toExternalDNSConfig(app *AppData, pdnsZone *ZoneDataResponse, externalDnsVe
 	}
 
 	data := map[string]any{
-		"txtPrefix":        "dynamic-zones-dns-",
+		"txtPrefix":        externalDNSTxtPrefix,
 		"txtOwnerId":       "dynamic-zones-dns",
 		// external-dns runs in the user's cluster; advertise the public NS
 		// hostname (falls back to the literal IP when unset).
@@ -717,6 +934,10 @@ func policyValidateRequest(req PolicyRuleRequest) error {
 		return err
 	}
 
+	if err := req.RecordConstraints.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -846,10 +1067,15 @@ func ruleToZoneResponse(rule PolicyRule, user *UserClaims) ZoneResponse {
 	zone := strings.ReplaceAll(rule.ZonePattern, "%u", userDnsLabel)
 
 	return ZoneResponse{
-		Zone:            zone,
-		ZoneSOA:         rule.ZoneSoa,
-		AllowSubdomains: rule.AllowSubdomains,
-		SharingAllowed:  rule.SharingAllowed,
+		Zone:              zone,
+		ZoneSOA:           rule.ZoneSoa,
+		AllowSubdomains:   rule.AllowSubdomains,
+		SharingAllowed:    rule.SharingAllowed,
+		Dnssec:            rule.Dnssec,
+		RecordConstraints: rule.RecordConstraints,
+		BaseZone:          zone,
+		ZoneQuotas:        rule.ZoneQuotas,
+		LeaseDays:         rule.LeaseDays,
 	}
 }
 
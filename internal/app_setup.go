@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -24,8 +25,14 @@ type AppData struct {
 	Storage     *Storage
 	PowerDns    *PowerDnsClient
 	RefreshTime uint64
+	Reconciler  *Reconciler
+	TokenUsage  *TokenUsage
+	Notifier    Notifier
+	Webhooks    *WebhookDispatcher
 	Logger      *zap.Logger
 	Log         *zap.SugaredLogger
+
+	orphans *orphanCount
 }
 
 func CreateAppLogger(appConfig AppConfig) (*zap.Logger, *zap.SugaredLogger) {
@@ -64,7 +71,7 @@ func RunApplication() {
 	pdns, err := NewPowerDnsClient(
 		appConfig.PowerDns.PdnsUrl, appConfig.PowerDns.PdnsVhost, appConfig.PowerDns.PdnsApiKey, appConfig.PowerDns.DefaultTTLSeconds,
 		[]string{thisNsServer}, appConfig.ZoneDefaults.DefaultAdminTsigKeyName, appConfig.ZoneDefaults.DefaultAdminTsigKey,
-		appConfig.ZoneDefaults.DefaultAdminTsigAlg,
+		appConfig.ZoneDefaults.DefaultAdminTsigAlg, appConfig.ZoneDefaults.UserTsigAlgorithms[0],
 		appConfig.ZoneDefaults.DefaultRecords,
 		appConfig.ZoneDefaults.DefaultRecordsSoa,
 		log,
@@ -86,10 +93,26 @@ func RunApplication() {
 		PowerDns: pdns,
 		Logger:   logger,
 		Log:      log,
+		orphans:  &orphanCount{},
 	}
 
+	appData.Reconciler = NewReconciler(&appData)
+	appData.TokenUsage = NewTokenUsage(db)
+	appData.Notifier = NewNotifier(appConfig.Notify, log)
+	appData.Webhooks = NewWebhookDispatcher(db, log)
+
 	// Start application
 	go RunPeriodicUpstreamDnsUpdateCheck(appData)
+	go appData.Reconciler.RunPeriodically(context.Background())
+	go appData.RunKeyExpiry(context.Background())
+	go appData.RunTokenUsageFlush(context.Background())
+	go appData.RunTokenExpiryWarnings(context.Background())
+	go appData.Webhooks.Run(context.Background())
+	go appData.RunZoneLeases(context.Background())
+	go appData.RunZoneTrash(context.Background())
+	go appData.RunZoneHistorySnapshots(context.Background())
+	go appData.RunOrphanCount(context.Background())
+	go appData.SyncAllZoneUpdateGrants(context.Background())
 
 	// If requested, insert initial data into the database
 	if appConfig.InitialDataScriptPath != "" {
@@ -143,6 +166,16 @@ func setupGinWebserver(app *AppData) (router *gin.Engine) {
 	gin.DefaultWriter = ginLogWriter
 	gin.DefaultErrorWriter = ginLogWriter
 	router.Use(ginzap.RecoveryWithZap(app.Logger, true))
+	router.Use(MetricsMiddleware())
+
+	// Prometheus scrapes /metrics with the configured bearer token; without a
+	// token the metrics are not served.
+	if token := app.Config.WebServer.MetricsToken; token != "" {
+		router.GET("/metrics", requireMetricsToken(token), metricsHandler(app))
+	}
+
+	// Routers and ddclient authenticate with an API token in Basic credentials.
+	CreateDynDnsRoutes(router, app)
 
 	// Create OIDC Auth Verifier
 	oidcConfig := OIDCVerifierConfig{
@@ -170,11 +203,15 @@ func setupGinWebserver(app *AppData) (router *gin.Engine) {
 	// Create router group for  API routes for v1
 	apiV1Group := router.Group("/v1")
 	enableCors(apiV1Group, app.Config.WebServer.CORSAllowedOrigins, app.Config.DevMode, app.Log)
-	apiV1Group.Use(CombinedAuthMiddleware(oidcAuthVerifier, app.Storage, app.Log, app.Config.DevMode))
+	apiV1Group.Use(RequestIDMiddleware())
+	apiV1Group.Use(CombinedAuthMiddleware(oidcAuthVerifier, app.Storage, app.TokenUsage, app.Log, app.Config.DevMode))
 	CreateApiV1Zones(apiV1Group, app)
 	CreateTokensApiGroup(apiV1Group, app)
 	CreateRfc2136ClientApiGroup(apiV1Group, app)
 	CreatePolicyApiGroup(apiV1Group, app)
+	CreateAuditApiGroup(apiV1Group, app)
+	CreateAdminApiGroup(apiV1Group, app)
+	CreateAdminZonesApiGroup(apiV1Group, app)
 
 	return router
 }
@@ -221,6 +258,8 @@ func logAppConfig(appConfig AppConfig, log *zap.SugaredLogger) {
 		appConfig.PowerDns.PdnsApiKey = maskSecret(appConfig.PowerDns.PdnsApiKey)
 		appConfig.ZoneDefaults.DefaultAdminTsigKey = maskSecret(appConfig.ZoneDefaults.DefaultAdminTsigKey)
 		appConfig.Storage.DbConnectionString = maskConnString(appConfig.Storage.DbConnectionString)
+		appConfig.Notify.SmtpPassword = maskSecret(appConfig.Notify.SmtpPassword)
+		appConfig.WebServer.MetricsToken = maskSecret(appConfig.WebServer.MetricsToken)
 		// In production mode, we use a compact JSON format without indentation
 		appConfigJson, err = json.Marshal(appConfig)
 	}
@@ -0,0 +1,262 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Actions of AuditEvent.Action.
+const (
+	AuditZoneCreate         = "zone.create"
+	AuditZoneDelete         = "zone.delete"
+	AuditZoneJoin           = "zone.join"
+	AuditZoneOwnerAdd       = "zone.owner.add"
+	AuditZoneOwnerRemove    = "zone.owner.remove"
+	AuditZoneKeysRotate     = "zone.keys.rotate"
+	AuditZoneKeysRetire     = "zone.keys.retire"
+	AuditZoneKeyCreate      = "zone.key.create"
+	AuditZoneKeyDelete      = "zone.key.delete"
+	AuditZoneKeyExpire      = "zone.key.expire"
+	AuditZoneDnssecRollover = "zone.dnssec.rollover"
+	AuditZoneImport         = "zone.import"
+	AuditZoneRepair         = "zone.repair"
+	AuditZoneAdopt          = "zone.adopt"
+	AuditZoneCollect        = "zone.collect"
+	AuditZoneGrantRevoke    = "zone.grant.revoke"
+	AuditZoneRenew          = "zone.renew"
+	AuditZoneDisable        = "zone.disable"
+	AuditZoneEnable         = "zone.enable"
+	AuditZoneTransfer       = "zone.transfer"
+	AuditZoneRestore        = "zone.restore"
+	AuditZoneRollback       = "zone.rollback"
+	AuditRecordCreate       = "record.create"
+	AuditRecordDelete       = "record.delete"
+	AuditRecordBatch        = "record.batch"
+	AuditRecordReplace      = "record.replace"
+	AuditRuleCreate         = "policy.rule.create"
+	AuditRuleUpdate         = "policy.rule.update"
+	AuditRuleDelete         = "policy.rule.delete"
+	AuditDelegationCreate   = "policy.delegation.create"
+	AuditDelegationUpdate   = "policy.delegation.update"
+	AuditDelegationDelete   = "policy.delegation.delete"
+	AuditTokenCreate        = "token.create"
+	AuditTokenDelete        = "token.delete"
+	AuditTsigKeyDelete      = "tsigkey.delete"
+	AuditWebhookCreate      = "webhook.create"
+	AuditWebhookUpdate      = "webhook.update"
+	AuditWebhookDelete      = "webhook.delete"
+)
+
+// Values of AuditEvent.AuthMethod.
+const (
+	AuthMethodOIDC     = "oidc"
+	AuthMethodApiToken = "api_token"
+	AuthMethodDev      = "dev"
+	// AuthMethodSystem is the service itself, e.g. the initial data script.
+	AuthMethodSystem = "system"
+)
+
+// RequestIDKey is the gin context key of the request ID.
+const RequestIDKey = "__api_requestID"
+
+// AuditEvent is one successful mutation: who did what to which object, and
+// what it looked like before and after. Events are only ever appended.
+type AuditEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	// Actor is the username the request acted as.
+	Actor      string `gorm:"type:varchar(255);index" json:"actor"`
+	AuthMethod string `gorm:"type:varchar(32)" json:"auth_method" enums:"oidc,api_token,dev,system"`
+	// TokenID is the API token the request was authenticated with, if any.
+	TokenID uint   `json:"token_id,omitempty"`
+	Action  string `gorm:"type:varchar(64);index" json:"action"`
+	// Target names the changed object, e.g. a zone, "rule/12" or "token/3".
+	Target string `gorm:"type:varchar(255)" json:"target"`
+	// Zone is the zone the event concerns (a rule's SOA, a delegation's
+	// suffix), lower case without trailing dot; delegated admins see the events
+	// within their suffix. Empty for events outside of any zone.
+	Zone      string `gorm:"type:varchar(255);index" json:"zone,omitempty"`
+	Before    string `gorm:"type:text" json:"before,omitempty" swaggertype:"object"`
+	After     string `gorm:"type:text" json:"after,omitempty" swaggertype:"object"`
+	RequestID string `gorm:"type:varchar(64)" json:"request_id,omitempty"`
+}
+
+// MarshalJSON embeds Before and After as JSON instead of strings holding JSON.
+func (e AuditEvent) MarshalJSON() ([]byte, error) {
+	type plain AuditEvent
+	raw := func(s string) json.RawMessage {
+		if s == "" {
+			return nil
+		}
+		return json.RawMessage(s)
+	}
+	return json.Marshal(struct {
+		plain
+		Before json.RawMessage `json:"before,omitempty"`
+		After  json.RawMessage `json:"after,omitempty"`
+	}{plain(e), raw(e.Before), raw(e.After)})
+}
+
+// AuditFilter selects audit events. Empty fields do not filter.
+type AuditFilter struct {
+	Actor string
+	// Action matches exactly, or as a prefix when it ends in "." ("zone.").
+	Action string
+	// Zone matches the zone and everything below it.
+	Zone  string
+	Since time.Time
+	Until time.Time
+	Limit int
+	// Scopes, when not nil, restricts the result to events at or below one of
+	// these zones — what a delegated admin may see.
+	Scopes []string
+}
+
+// AuditActor is who a request acts as, as the audit log records it.
+type AuditActor struct {
+	Actor      string
+	AuthMethod string
+	TokenID    uint
+	RequestID  string
+}
+
+type auditActorKey struct{}
+
+// withAuditActor returns ctx carrying actor.
+func withAuditActor(ctx context.Context, actor AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// auditActorFrom returns the actor of ctx; without one it is the service itself.
+func auditActorFrom(ctx context.Context) AuditActor {
+	if ctx != nil {
+		if actor, ok := ctx.Value(auditActorKey{}).(AuditActor); ok {
+			return actor
+		}
+	}
+	return AuditActor{Actor: AuthMethodSystem, AuthMethod: AuthMethodSystem}
+}
+
+// setAuditActor stores who an authenticated request acts as in its context,
+// so the logic functions can attribute what they change.
+func setAuditActor(c *gin.Context, username, authMethod string, tokenID uint) {
+	c.Request = c.Request.WithContext(withAuditActor(c.Request.Context(), AuditActor{
+		Actor:      username,
+		AuthMethod: authMethod,
+		TokenID:    tokenID,
+		RequestID:  c.GetString(RequestIDKey),
+	}))
+}
+
+// RequestIDMiddleware gives every request an ID, taken from X-Request-ID when
+// a proxy set one and generated otherwise, and echoes it in the response.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.TrimSpace(c.GetHeader("X-Request-ID"))
+		if id == "" || len(id) > 64 {
+			b := make([]byte, 8)
+			_, _ = rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		c.Set(RequestIDKey, id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
+
+// auditZone normalizes a zone name for AuditEvent.Zone.
+func auditZone(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(zone), "."))
+}
+
+// auditJSON renders a before/after value; nil stays empty.
+func auditJSON(v any) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// audit records a mutation that has already happened. A failure to record is
+// logged, not returned: the change itself cannot be undone anymore.
+func (app *AppData) audit(ctx context.Context, action, target, zone string, before, after any) {
+	actor := auditActorFrom(ctx)
+	event := AuditEvent{
+		Actor:      actor.Actor,
+		AuthMethod: actor.AuthMethod,
+		TokenID:    actor.TokenID,
+		Action:     action,
+		Target:     target,
+		Zone:       auditZone(zone),
+		RequestID:  actor.RequestID,
+	}
+	var err error
+	if event.Before, err = auditJSON(before); err == nil {
+		event.After, err = auditJSON(after)
+	}
+	if err == nil {
+		err = app.Storage.AuditCreate(&event)
+	}
+	if err != nil {
+		app.Log.Errorf("app.audit: failed to record %s on %s by %s: %v", action, target, actor.Actor, err)
+	}
+}
+
+// AuditCreate appends an event to the audit log.
+func (s *Storage) AuditCreate(event *AuditEvent) error {
+	if err := s.db.Create(event).Error; err != nil {
+		return fmt.Errorf("storage.AuditCreate: %w", err)
+	}
+	return nil
+}
+
+// AuditList returns the events matching filter, newest first.
+func (s *Storage) AuditList(filter AuditFilter) ([]AuditEvent, error) {
+	q := s.db.Model(&AuditEvent{})
+	if filter.Actor != "" {
+		q = q.Where("actor = ?", filter.Actor)
+	}
+	if action, ok := strings.CutSuffix(filter.Action, "."); ok {
+		q = q.Where("action LIKE ?", action+".%")
+	} else if filter.Action != "" {
+		q = q.Where("action = ?", filter.Action)
+	}
+	if filter.Zone != "" {
+		zone := auditZone(filter.Zone)
+		q = q.Where("(zone = ? OR zone LIKE ?)", zone, "%."+zone)
+	}
+	if !filter.Since.IsZero() {
+		q = q.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		q = q.Where("created_at < ?", filter.Until)
+	}
+	if filter.Scopes != nil {
+		if len(filter.Scopes) == 0 {
+			return []AuditEvent{}, nil
+		}
+		scope := s.db.Where("1 = 0")
+		for _, suffix := range filter.Scopes {
+			suffix = auditZone(suffix)
+			scope = scope.Or("zone = ? OR zone LIKE ?", suffix, "%."+suffix)
+		}
+		q = q.Where(scope)
+	}
+
+	events := make([]AuditEvent, 0)
+	if err := q.Order("id DESC").Limit(filter.Limit).Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("storage.AuditList: %w", err)
+	}
+	return events, nil
+}
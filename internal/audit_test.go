@@ -0,0 +1,55 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// Events carry who acted and how, and a delegated admin only reads the events
+// of the subtree delegated to them.
+func TestAuditEventsAreAttributedAndScoped(t *testing.T) {
+	app := newTestApp(t)
+	ctx := withAuditActor(context.Background(), AuditActor{Actor: "alice@dhbw.de", AuthMethod: AuthMethodApiToken, TokenID: 7, RequestID: "req-1"})
+
+	app.audit(ctx, AuditZoneCreate, "alice.users.dhbw.site", "alice.users.dhbw.site.", nil, map[string]string{"zone_soa": "users.dhbw.site"})
+	app.audit(ctx, AuditZoneOwnerAdd, "alice.users.dhbw.site/owners/bob@dhbw.de", "alice.users.dhbw.site", nil, nil)
+	app.audit(context.Background(), AuditRuleCreate, "rule/1", "projects.dhbw.site", nil, nil)
+
+	all, err := app.Storage.AuditList(AuditFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("AuditList failed: %v", err)
+	}
+	if len(all) != 3 || all[0].Action != AuditRuleCreate {
+		t.Fatalf("expected 3 events, newest first, got %+v", all)
+	}
+	if all[0].Actor != AuthMethodSystem {
+		t.Errorf("expected an event without a request to be the system's, got %q", all[0].Actor)
+	}
+	if e := all[2]; e.Actor != "alice@dhbw.de" || e.TokenID != 7 || e.RequestID != "req-1" || e.Zone != "alice.users.dhbw.site" {
+		t.Errorf("unexpected attribution %+v", e)
+	}
+
+	zoneEvents, err := app.Storage.AuditList(AuditFilter{Action: "zone.", Limit: 10})
+	if err != nil || len(zoneEvents) != 2 {
+		t.Errorf("expected the 2 zone events, got %d (%v)", len(zoneEvents), err)
+	}
+
+	scoped, err := app.Storage.AuditList(AuditFilter{Scopes: []string{"users.dhbw.site"}, Limit: 10})
+	if err != nil || len(scoped) != 2 {
+		t.Errorf("expected the 2 events under users.dhbw.site, got %d (%v)", len(scoped), err)
+	}
+	none, err := app.Storage.AuditList(AuditFilter{Scopes: []string{"evil-users.dhbw.site"}, Limit: 10})
+	if err != nil || len(none) != 0 {
+		t.Errorf("expected no events for a look-alike suffix, got %d (%v)", len(none), err)
+	}
+
+	b, err := json.Marshal(all[2])
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if !strings.Contains(string(b), `"after":{"zone_soa":"users.dhbw.site"}`) {
+		t.Errorf("expected after to be embedded as JSON, got %s", b)
+	}
+}
@@ -113,13 +113,16 @@ func (m *OIDCAuthVerifier) BearerTokenAuthMiddleware() gin.HandlerFunc {
 
 		// Store user claims in Gin context for access in subsequent handlers
 		c.Set(UserDataKey, &claims)
+		setAuditActor(c, claims.PreferredUsername, AuthMethodOIDC, 0)
 		//m.Logger.Debugf("Token verified for user '%s' (sub: %s, email: %s).", claims.PreferredUsername, claims.Subject, claims.Email)
 
 		c.Next() // Continue to the next handler in the chain
 	}
 }
 
-func CombinedAuthMiddleware(oidcVerifier *OIDCAuthVerifier, store *Storage, log *zap.SugaredLogger, devMode bool) gin.HandlerFunc {
+// CombinedAuthMiddleware authenticates with an API token or an OIDC bearer
+// token. The use of API tokens is recorded in usage.
+func CombinedAuthMiddleware(oidcVerifier *OIDCAuthVerifier, store *Storage, usage *TokenUsage, log *zap.SugaredLogger, devMode bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 
@@ -138,6 +141,7 @@ func CombinedAuthMiddleware(oidcVerifier *OIDCAuthVerifier, store *Storage, log
 			if dummyUser := c.GetHeader("X-Dummy-Auth-User"); dummyUser != "" {
 				log.Warnf("DEV MODE: trusting X-Dummy-Auth-User '%s' without token verification", dummyUser)
 				c.Set(UserDataKey, &UserClaims{Subject: dummyUser, Email: dummyUser, PreferredUsername: dummyUser})
+				setAuditActor(c, dummyUser, AuthMethodDev, 0)
 				c.Next()
 				return
 			}
@@ -174,6 +178,13 @@ func CombinedAuthMiddleware(oidcVerifier *OIDCAuthVerifier, store *Storage, log
 				return
 			}
 
+			// Check the token's addresses, scopes and zones
+			if status, msg := checkTokenRequest(c, token); status != 0 {
+				log.Warnf("Token %d refused for %s %s: %s", token.ID, c.Request.Method, c.Request.URL.Path, msg)
+				c.AbortWithStatusJSON(status, gin.H{"error": msg})
+				return
+			}
+
 			// Check whether the operation is GET (read-only) and the token is read-only
 			if c.Request.Method != http.MethodGet && token.ReadOnly {
 				log.Warnf("Attempt to use read-only token for non-GET operation: %s %s", c.Request.Method, c.Request.URL.Path)
@@ -185,6 +196,9 @@ func CombinedAuthMiddleware(oidcVerifier *OIDCAuthVerifier, store *Storage, log
 			c.Set(UserDataKey, &UserClaims{
 				PreferredUsername: token.Username,
 			})
+			usage.Record(token.ID, c.ClientIP())
+			c.Set(ApiTokenKey, token)
+			setAuditActor(c, token.Username, AuthMethodApiToken, token.ID)
 
 			c.Next()
 			return
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -19,7 +20,7 @@ func (app *AppData) DelegationGetAll() ([]DelegationPolicy, error) {
 	return app.Storage.DelegationGetAll()
 }
 
-func (app *AppData) DelegationCreate(req DelegationPolicyRequest) (*DelegationPolicy, error) {
+func (app *AppData) DelegationCreate(ctx context.Context, req DelegationPolicyRequest) (*DelegationPolicy, error) {
 	if err := validateUserFilter(req.TargetUserFilter); err != nil {
 		return nil, err
 	}
@@ -31,10 +32,15 @@ func (app *AppData) DelegationCreate(req DelegationPolicyRequest) (*DelegationPo
 		ZoneSuffix:       req.ZoneSuffix,
 		Description:      req.Description,
 	}
-	return app.Storage.DelegationCreate(&d)
+	created, err := app.Storage.DelegationCreate(&d)
+	if err != nil {
+		return nil, err
+	}
+	app.audit(ctx, AuditDelegationCreate, fmt.Sprintf("delegation/%d", created.ID), created.ZoneSuffix, nil, created)
+	return created, nil
 }
 
-func (app *AppData) DelegationUpdate(id int64, req DelegationPolicyRequest) (*DelegationPolicy, error) {
+func (app *AppData) DelegationUpdate(ctx context.Context, id int64, req DelegationPolicyRequest) (*DelegationPolicy, error) {
 	if err := validateUserFilter(req.TargetUserFilter); err != nil {
 		return nil, err
 	}
@@ -48,19 +54,32 @@ func (app *AppData) DelegationUpdate(id int64, req DelegationPolicyRequest) (*De
 		}
 		return nil, err
 	}
+	before := *existing
 	existing.TargetUserFilter = req.TargetUserFilter
 	existing.ZoneSuffix = req.ZoneSuffix
 	existing.Description = req.Description
-	return app.Storage.DelegationUpdate(existing)
+	updated, err := app.Storage.DelegationUpdate(existing)
+	if err != nil {
+		return nil, err
+	}
+	app.audit(ctx, AuditDelegationUpdate, fmt.Sprintf("delegation/%d", id), updated.ZoneSuffix, before, updated)
+	return updated, nil
 }
 
-func (app *AppData) DelegationDelete(id int64) error {
+func (app *AppData) DelegationDelete(ctx context.Context, id int64) error {
+	// Looked up for the audit log only; a missing delegation is reported below.
+	before, _ := app.Storage.DelegationGetByID(id)
 	if err := app.Storage.DelegationDelete(id); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return fmt.Errorf("delegation not found")
 		}
 		return err
 	}
+	zoneSuffix := ""
+	if before != nil {
+		zoneSuffix = before.ZoneSuffix
+	}
+	app.audit(ctx, AuditDelegationDelete, fmt.Sprintf("delegation/%d", id), zoneSuffix, before, nil)
 	return nil
 }
 
@@ -0,0 +1,327 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/miekg/dns"
+)
+
+// Phases of a DNSSEC key rollover, see ZoneDnssecRollover.
+const (
+	DnssecRolloverStart  = "start"
+	DnssecRolloverFinish = "finish"
+)
+
+var (
+	errDnssecUnsigned        = errors.New("the zone is not DNSSEC-signed")
+	errDnssecRolloverPending = errors.New("a key rollover is already in progress")
+	errDnssecNoRollover      = errors.New("no key rollover is in progress")
+)
+
+// DnssecKey is one signing key of a zone.
+type DnssecKey struct {
+	ID      uint64 `json:"id"`
+	KeyType string `json:"keytype" enums:"csk,ksk,zsk"`
+	// Active keys sign the zone; an inactive key is published for a rollover.
+	Active    bool   `json:"active"`
+	Algorithm string `json:"algorithm"`
+	DNSKEY    string `json:"dnskey"`
+	// DS are the DS records of the key, one per digest type.
+	DS []string `json:"ds,omitempty"`
+}
+
+// DnssecInfo is the signing state of a zone.
+type DnssecInfo struct {
+	Signed bool        `json:"signed"`
+	Keys   []DnssecKey `json:"keys"`
+	// DS are the records the parent zone should hold; the service publishes
+	// them itself when it maintains the parent zone.
+	DS []string `json:"ds"`
+	// RolloverPending: a rollover was started and not finished yet.
+	RolloverPending bool `json:"rollover_pending"`
+}
+
+// cryptokeyRequest is the body of the cryptokey calls powerdns does not offer.
+type cryptokeyRequest struct {
+	KeyType   string `json:"keytype,omitempty"`
+	Active    bool   `json:"active"`
+	Published bool   `json:"published"`
+}
+
+// cryptokeysDo sends a request to the cryptokeys of zone (and key id, if not
+// empty). powerdns can only list and delete cryptokeys; creating and
+// activating them goes through here. Errors are *powerdns.Error like theirs.
+func (p *PowerDnsClient) cryptokeysDo(ctx context.Context, method, zoneFQDN, id string, body any) error {
+	apiURL, err := url.Parse(p.powerdns.BaseURL)
+	if err != nil {
+		return fmt.Errorf("cryptokeysDo: %w", err)
+	}
+	apiURL.Path = path.Join("/api/v1/servers", p.powerdns.VHost, "zones", zoneFQDN, "cryptokeys", id)
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("cryptokeysDo: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, apiURL.String(), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("cryptokeysDo: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-API-Key", p.apiKey)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cryptokeysDo: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		pdnsErr := &powerdns.Error{Status: resp.Status, StatusCode: resp.StatusCode}
+		message, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(message, pdnsErr) != nil {
+			pdnsErr.Message = string(message)
+		}
+		return pdnsErr
+	}
+	return nil
+}
+
+// SignZone makes sure zone has an active signing key. PowerDNS usually
+// creates one when a zone is created with DNSSEC enabled; an existing zone,
+// or one created by a PowerDNS that does not, gets a combined signing key.
+func (p *PowerDnsClient) SignZone(ctx context.Context, zone string) error {
+	zoneFQDN := dns.Fqdn(zone)
+	keys, err := p.powerdns.Cryptokeys.List(ctx, zoneFQDN)
+	if err != nil {
+		return fmt.Errorf("SignZone: listing cryptokeys of %s failed: %w", zoneFQDN, err)
+	}
+	for _, key := range keys {
+		if key.Active != nil && *key.Active {
+			return nil
+		}
+	}
+
+	p.log.Infof("Signing zone %s", zoneFQDN)
+	if err := p.cryptokeysDo(ctx, http.MethodPost, zoneFQDN, "", cryptokeyRequest{KeyType: "csk", Active: true, Published: true}); err != nil {
+		return fmt.Errorf("SignZone: adding a key to %s failed: %w", zoneFQDN, err)
+	}
+	return nil
+}
+
+// ZoneDnssec returns the signing keys of zone and the DS records its parent
+// should hold. A zone that PowerDNS does not know is reported unsigned.
+func (p *PowerDnsClient) ZoneDnssec(ctx context.Context, zone string) (*DnssecInfo, error) {
+	keys, err := p.powerdns.Cryptokeys.List(ctx, dns.Fqdn(zone))
+	if err != nil && !isPdnsNotFound(err) {
+		return nil, fmt.Errorf("ZoneDnssec: %w", err)
+	}
+
+	info := &DnssecInfo{Keys: []DnssecKey{}, DS: []string{}}
+	for _, key := range keys {
+		k := DnssecKey{DS: key.DS}
+		if key.ID != nil {
+			k.ID = *key.ID
+		}
+		if key.KeyType != nil {
+			k.KeyType = *key.KeyType
+		}
+		if key.Active != nil {
+			k.Active = *key.Active
+		}
+		if key.Algorithm != nil {
+			k.Algorithm = *key.Algorithm
+		}
+		if key.DNSkey != nil {
+			k.DNSKEY = *key.DNSkey
+		}
+		info.Signed = info.Signed || k.Active
+		info.RolloverPending = info.RolloverPending || !k.Active
+		info.Keys = append(info.Keys, k)
+	}
+	info.DS = dsRecords(info.Keys)
+	return info, nil
+}
+
+// dsRecords returns the DS records of keys, leaving out SHA-1 digests (digest
+// type 1), which RFC 8624 says must not be published anymore.
+func dsRecords(keys []DnssecKey) []string {
+	seen := make(map[string]bool)
+	ds := []string{}
+	for _, key := range keys {
+		for _, record := range key.DS {
+			fields := strings.Fields(record)
+			if len(fields) != 4 || fields[2] == "1" || seen[record] {
+				continue
+			}
+			seen[record] = true
+			ds = append(ds, record)
+		}
+	}
+	return ds
+}
+
+// PublishDS makes the DS records of child in parent match child's keys: they
+// are replaced, or removed when child is unsigned or gone. Nothing happens
+// when this nameserver does not hold parent; its DS must be registered
+// upstream.
+func (p *PowerDnsClient) PublishDS(ctx context.Context, parent, child string) error {
+	parentFQDN, childFQDN := dns.Fqdn(parent), dns.Fqdn(child)
+
+	info, err := p.ZoneDnssec(ctx, childFQDN)
+	if err != nil {
+		return fmt.Errorf("PublishDS: %w", err)
+	}
+
+	if len(info.DS) == 0 {
+		err = p.powerdns.Records.Delete(ctx, parentFQDN, childFQDN, powerdns.RRTypeDS)
+	} else {
+		p.log.Debugf("Publishing DS of %s in %s: %v", childFQDN, parentFQDN, info.DS)
+		err = p.powerdns.Records.Change(ctx, parentFQDN, childFQDN, powerdns.RRTypeDS, p.defaultTTLSeconds, info.DS)
+	}
+	if isPdnsNotFound(err) {
+		p.log.Debugf("Parent zone %s of %s is not on this nameserver, its DS is not published", parentFQDN, childFQDN)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("PublishDS: %s in %s: %w", childFQDN, parentFQDN, err)
+	}
+	return nil
+}
+
+// StartKeyRollover publishes a new signing key next to the active ones. It
+// does not sign yet; FinishKeyRollover activates it once resolvers have seen
+// its DNSKEY and DS.
+func (p *PowerDnsClient) StartKeyRollover(ctx context.Context, zone string) error {
+	info, err := p.ZoneDnssec(ctx, zone)
+	if err != nil {
+		return fmt.Errorf("StartKeyRollover: %w", err)
+	}
+	if !info.Signed {
+		return errDnssecUnsigned
+	}
+	if info.RolloverPending {
+		return errDnssecRolloverPending
+	}
+	if err := p.cryptokeysDo(ctx, http.MethodPost, dns.Fqdn(zone), "", cryptokeyRequest{KeyType: "csk", Active: false, Published: true}); err != nil {
+		return fmt.Errorf("StartKeyRollover: adding a key to %s failed: %w", zone, err)
+	}
+	return nil
+}
+
+// FinishKeyRollover activates the keys StartKeyRollover published and
+// deletes the keys that signed the zone before.
+func (p *PowerDnsClient) FinishKeyRollover(ctx context.Context, zone string) error {
+	zoneFQDN := dns.Fqdn(zone)
+	info, err := p.ZoneDnssec(ctx, zoneFQDN)
+	if err != nil {
+		return fmt.Errorf("FinishKeyRollover: %w", err)
+	}
+	if !info.Signed {
+		return errDnssecUnsigned
+	}
+	if !info.RolloverPending {
+		return errDnssecNoRollover
+	}
+
+	// Activate first, so the zone is signed at every step.
+	for _, key := range info.Keys {
+		if key.Active {
+			continue
+		}
+		if err := p.cryptokeysDo(ctx, http.MethodPut, zoneFQDN, fmt.Sprint(key.ID), cryptokeyRequest{Active: true, Published: true}); err != nil {
+			return fmt.Errorf("FinishKeyRollover: activating key %d of %s failed: %w", key.ID, zoneFQDN, err)
+		}
+	}
+	for _, key := range info.Keys {
+		if !key.Active {
+			continue
+		}
+		if err := p.powerdns.Cryptokeys.Delete(ctx, zoneFQDN, key.ID); err != nil {
+			return fmt.Errorf("FinishKeyRollover: deleting key %d of %s failed: %w", key.ID, zoneFQDN, err)
+		}
+	}
+	return nil
+}
+
+// isDnssecType reports whether rrtype is maintained by the signer rather than
+// written by users.
+func isDnssecType(rrtype uint16) bool {
+	switch rrtype {
+	case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM, dns.TypeDNSKEY, dns.TypeCDS, dns.TypeCDNSKEY:
+		return true
+	}
+	return false
+}
+
+// parentZone returns the zone one label above zone, where its delegation and
+// DS records are kept.
+func parentZone(zone string) string {
+	_, parent, _ := strings.Cut(strings.TrimSuffix(zone, "."), ".")
+	return parent
+}
+
+// publishDSChain publishes the DS records of every zone of authoritative (see
+// getAuthoritativeZones) in the zone above it.
+func (app *AppData) publishDSChain(ctx context.Context, authoritative []string) error {
+	for i := len(authoritative) - 1; i > 0; i-- {
+		if err := app.PowerDns.PublishDS(ctx, authoritative[i-1], authoritative[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ZoneDnssecRollover runs one phase of a key rollover of a signed zone. The
+// start publishes a new key and adds its DS to the parent zone next to the
+// old one; after the TTL of the DNSKEY and DS records has passed, the finish
+// signs with the new key, deletes the old one and withdraws its DS. Where the
+// parent zone is not on this nameserver, the owner must update the DS
+// upstream between the phases. The caller must be an owner.
+func (app *AppData) ZoneDnssecRollover(ctx context.Context, caller *UserClaims, zone, phase string) (int, any, error) {
+	isOwner, err := app.Storage.IsZoneOwner(caller.PreferredUsername, zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to check ownership", fmt.Errorf("app.ZoneDnssecRollover: %w", err))
+	}
+	if !isOwner {
+		return errorResult(http.StatusForbidden, "You are not an owner of this zone", fmt.Errorf("app.ZoneDnssecRollover: %s not owned by %s", zone, caller.PreferredUsername))
+	}
+
+	switch phase {
+	case DnssecRolloverStart:
+		err = app.PowerDns.StartKeyRollover(ctx, zone)
+	case DnssecRolloverFinish:
+		err = app.PowerDns.FinishKeyRollover(ctx, zone)
+	default:
+		return errorResult(http.StatusBadRequest, "phase must be start or finish", fmt.Errorf("app.ZoneDnssecRollover: phase %q", phase))
+	}
+	if errors.Is(err, errDnssecUnsigned) || errors.Is(err, errDnssecRolloverPending) || errors.Is(err, errDnssecNoRollover) {
+		return errorResult(http.StatusConflict, err.Error(), fmt.Errorf("app.ZoneDnssecRollover: %w", err))
+	}
+	if err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to roll the zone's keys", fmt.Errorf("app.ZoneDnssecRollover: %w", err))
+	}
+
+	if err := app.PowerDns.PublishDS(ctx, parentZone(zone), zone); err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to publish the DS records in the parent zone", fmt.Errorf("app.ZoneDnssecRollover: %w", err))
+	}
+
+	info, err := app.PowerDns.ZoneDnssec(ctx, zone)
+	if err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to read the zone's keys", fmt.Errorf("app.ZoneDnssecRollover: %w", err))
+	}
+	app.Log.Infof("app.ZoneDnssecRollover: %s ran rollover phase %s for %s", caller.PreferredUsername, phase, zone)
+	app.audit(ctx, AuditZoneDnssecRollover, zone, zone, nil, gin.H{"phase": phase, "ds": info.DS})
+	return http.StatusOK, info, nil
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// A signed zone gets its DS into the parent on creation, and a rollover
+// publishes both DS records until it is finished.
+func TestDnssecCreateAndRollover(t *testing.T) {
+	app := newTestApp(t)
+	fake := useFakePdns(t, app)
+	ctx := context.Background()
+	alice := &UserClaims{Email: "alice@dhbw.de", PreferredUsername: "alice@dhbw.de"}
+	const parentDS = "users.example.com. alice.users.example.com. DS"
+
+	status, _, err := app.ZoneCreate(ctx, alice.PreferredUsername, ZoneResponse{Zone: "alice.users.example.com", ZoneSOA: "users.example.com", Dnssec: true}, "")
+	if status != http.StatusCreated {
+		t.Fatalf("ZoneCreate: %d %v", status, err)
+	}
+	if len(fake.cryptokeys["users.example.com."]) != 1 || len(fake.cryptokeys["alice.users.example.com."]) != 1 {
+		t.Fatalf("expected both zones to be signed, got %v", fake.cryptokeys)
+	}
+	if ds := fake.rrsets[parentDS]; !slices.Equal(ds, []string{"2 13 2 C0FFEE"}) {
+		t.Fatalf("expected the SHA-256 DS of key 2 in the parent, got %v", ds)
+	}
+
+	if status, _, _ := app.ZoneDnssecRollover(ctx, alice, "alice.users.example.com", DnssecRolloverFinish); status != http.StatusConflict {
+		t.Errorf("expected finishing a rollover that was not started to conflict, got %d", status)
+	}
+	if status, _, _ := app.ZoneDnssecRollover(ctx, alice, "alice.users.example.com", DnssecRolloverStart); status != http.StatusOK {
+		t.Fatalf("rollover start: %d", status)
+	}
+	if ds := fake.rrsets[parentDS]; len(ds) != 2 {
+		t.Errorf("expected the old and the new DS during the rollover, got %v", ds)
+	}
+	if status, _, _ := app.ZoneDnssecRollover(ctx, alice, "alice.users.example.com", DnssecRolloverStart); status != http.StatusConflict {
+		t.Errorf("expected a second start to conflict, got %d", status)
+	}
+
+	status, resp, _ := app.ZoneDnssecRollover(ctx, alice, "alice.users.example.com", DnssecRolloverFinish)
+	info, _ := resp.(*DnssecInfo)
+	if status != http.StatusOK || info == nil || len(info.Keys) != 1 || info.Keys[0].ID != 3 || !info.Keys[0].Active {
+		t.Fatalf("rollover finish: %d %+v", status, resp)
+	}
+	if ds := fake.rrsets[parentDS]; !slices.Equal(ds, []string{"3 13 2 C0FFEE"}) {
+		t.Errorf("expected only the new DS after the rollover, got %v", ds)
+	}
+
+	bob := &UserClaims{Email: "bob@dhbw.de", PreferredUsername: "bob@dhbw.de"}
+	if status, _, _ := app.ZoneDnssecRollover(ctx, bob, "alice.users.example.com", DnssecRolloverStart); status != http.StatusForbidden {
+		t.Errorf("expected a non-owner to be refused, got %d", status)
+	}
+}
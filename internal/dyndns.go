@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/farberg/dynamic-zones/internal/helper"
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// dynDnsTTL is the TTL of an address record a DynDNS2 client creates; an
+// existing record keeps its TTL.
+const dynDnsTTL = 60
+
+// DynDNS2 return codes. They are the whole response body of /nic/update, one
+// line per hostname, as routers and ddclient expect them.
+const (
+	DynDnsGood    = "good"
+	DynDnsNochg   = "nochg"
+	DynDnsBadauth = "badauth"
+	DynDnsNotfqdn = "notfqdn"
+	DynDnsNohost  = "nohost"
+	DynDnsDnserr  = "dnserr"
+	DynDns911     = "911"
+)
+
+// parseDynDnsIPs parses the comma-separated addresses of myip (and myipv6),
+// without duplicates.
+func parseDynDnsIPs(values ...string) ([]net.IP, error) {
+	var ips []net.IP
+	seen := make(map[string]bool)
+	for _, v := range values {
+		for _, s := range splitList(v) {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", s)
+			}
+			if !seen[ip.String()] {
+				seen[ip.String()] = true
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips, nil
+}
+
+// dynDnsZone returns the zone of zones hostname is updated in: the longest one
+// it lies in that scope allows. "" if there is none.
+func dynDnsZone(zones []Zone, scope *TokenScope, hostname string) string {
+	best := ""
+	for _, z := range zones {
+		zone := auditZone(z.Zone)
+		if !scope.AllowsZone(zone) {
+			continue
+		}
+		if dns.IsSubDomain(dns.Fqdn(zone), dns.Fqdn(hostname)) && len(zone) > len(best) {
+			best = zone
+		}
+	}
+	return best
+}
+
+// dynDnsRecords returns the A and AAAA records that make hostname point at
+// ips, and the current records they replace. Only the address families in ips
+// are touched: an IPv4-only client leaves the AAAA records alone. RRsets that
+// already hold exactly ips are left out, so nothing to add means no change.
+func dynDnsRecords(hostname string, current []dns.RR, ips []net.IP, constraints *RecordConstraints) (add, replaced []dns.RR, err error) {
+	name := dns.Fqdn(hostname)
+	for _, recordType := range []string{"A", "AAAA"} {
+		var values []string
+		for _, ip := range ips {
+			if (ip.To4() != nil) == (recordType == "A") {
+				values = append(values, ip.String())
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		var existing []dns.RR
+		ttl := uint32(dynDnsTTL)
+		for _, rr := range current {
+			if strings.EqualFold(rr.Header().Name, name) && dns.TypeToString[rr.Header().Rrtype] == recordType {
+				existing = append(existing, rr)
+				ttl = rr.Header().Ttl
+			}
+		}
+		if constraints != nil && len(existing) == 0 {
+			if constraints.MinTTL > 0 && ttl < constraints.MinTTL {
+				ttl = constraints.MinTTL
+			}
+			if constraints.MaxTTL > 0 && ttl > constraints.MaxTTL {
+				ttl = constraints.MaxTTL
+			}
+		}
+
+		var desired []dns.RR
+		for _, v := range values {
+			rr, err := helper.NewRecord(name, recordType, v, ttl)
+			if err != nil {
+				return nil, nil, err
+			}
+			desired = append(desired, rr)
+		}
+		if plus, minus := helper.DiffRecords(existing, desired); len(plus)+len(minus) == 0 {
+			continue
+		}
+		add = append(add, desired...)
+		replaced = append(replaced, existing...)
+	}
+	return add, replaced, nil
+}
+
+// DynDnsUpdate points hostname at ips on behalf of the owner of token, the way
+// createDNSRecord upserts an RRset: each changed A or AAAA RRset is replaced in
+// one update message, signed with the owner's key. The response is the DynDNS2
+// line for hostname.
+func (app *AppData) DynDnsUpdate(ctx context.Context, token *Token, hostname string, ips []net.IP) (int, any, error) {
+	hostname = auditZone(hostname)
+	if err := helper.DnsValidateName(hostname); err != nil {
+		return errorResult(http.StatusBadRequest, "Invalid hostname", fmt.Errorf("app.DynDnsUpdate: %s: %w", hostname, err))
+	}
+
+	zones, err := app.Storage.ListUserZones(token.Username)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list zones", fmt.Errorf("app.DynDnsUpdate: %w", err))
+	}
+	zone := dynDnsZone(zones, &token.TokenScope, hostname)
+	if zone == "" {
+		return errorResult(http.StatusNotFound, "The hostname is in none of your zones", fmt.Errorf("app.DynDnsUpdate: %s not in a zone of %s", hostname, token.Username))
+	}
+	zoneFQDN := dns.Fqdn(zone)
+	if status, resp, err := app.requireZoneWritable(zone); err != nil {
+		return status, resp, fmt.Errorf("app.DynDnsUpdate: %w", err)
+	}
+
+	constraints, quotas, err := app.zoneLimits(zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to resolve the policy of this zone", fmt.Errorf("app.DynDnsUpdate: %w", err))
+	}
+	status, current, err := app.zoneRecordsAsUser(ctx, token.Username, zone)
+	if err != nil {
+		return errorResult(status, "Failed to transfer the zone", fmt.Errorf("app.DynDnsUpdate: %w", err))
+	}
+	add, replaced, err := dynDnsRecords(hostname, current, ips, constraints)
+	if err != nil {
+		return errorResult(http.StatusBadRequest, err.Error(), fmt.Errorf("app.DynDnsUpdate: %w", err))
+	}
+
+	addresses := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, ip.String())
+	}
+	if len(add) == 0 {
+		return http.StatusOK, DynDnsNochg + " " + strings.Join(addresses, ","), nil
+	}
+	if err := constraints.CheckAll(zoneFQDN, add); err != nil {
+		return errorResult(http.StatusForbidden, err.Error(), fmt.Errorf("app.DynDnsUpdate: %w", err))
+	}
+
+	u := helper.NewRfc2136Update(zoneFQDN)
+	for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		var rrset []dns.RR
+		for _, rr := range add {
+			if rr.Header().Rrtype == recordType {
+				rrset = append(rrset, rr)
+			}
+		}
+		if len(rrset) > 0 {
+			u.DeleteRRset(dns.Fqdn(hostname), recordType)
+			u.Add(rrset)
+		}
+	}
+	if err := quotas.CheckRecordCount(zoneFQDN, current, u.Apply(current)); err != nil {
+		return errorResult(http.StatusForbidden, err.Error(), fmt.Errorf("app.DynDnsUpdate: %w", err))
+	}
+
+	key, err := app.userZoneKey(ctx, token.Username, zone)
+	if err == nil {
+		key, err = app.apiUpdateKey(zone, key)
+	}
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to look up the TSIG key", fmt.Errorf("app.DynDnsUpdate: %w", err))
+	}
+	before, after := recordsOf(zoneFQDN, replaced), recordsOf(zoneFQDN, add)
+	msg, err := u.Send(key.Keyname, key.Algorithm, key.Key, GetServerAddress(app))
+	countUpdate(msg, err)
+	if err != nil {
+		return errorResult(http.StatusBadGateway, "The DNS server refused the update: "+err.Error(), fmt.Errorf("app.DynDnsUpdate: %w", err))
+	}
+
+	app.Log.Infof("app.DynDnsUpdate: %s pointed %s at %v", token.Username, hostname, addresses)
+	app.audit(ctx, AuditRecordCreate, dns.Fqdn(hostname)+" "+after[0].Type, zone, gin.H{"records": before}, gin.H{"mode": "upserted", "records": after})
+	app.recordZoneVersion(ctx, zone, ZoneVersionAPI)
+	return http.StatusOK, DynDnsGood + " " + strings.Join(addresses, ","), nil
+}
+
+// dynDnsCode is the DynDNS2 return code for a failed DynDnsUpdate.
+func dynDnsCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return DynDnsNotfqdn
+	case http.StatusForbidden, http.StatusNotFound:
+		return DynDnsNohost
+	case http.StatusBadGateway:
+		return DynDnsDnserr
+	}
+	return DynDns911
+}
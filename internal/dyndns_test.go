@@ -0,0 +1,54 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// A DynDNS2 update picks the innermost zone of the hostname, touches only the
+// address families it was given and reports no change when they already match.
+func TestDynDnsRecords(t *testing.T) {
+	zones := []Zone{{Zone: "alice.users.example.com"}, {Zone: "home.alice.users.example.com"}, {Zone: "other.example.com"}}
+	if zone := dynDnsZone(zones, &TokenScope{}, "router.home.alice.users.example.com"); zone != "home.alice.users.example.com" {
+		t.Errorf("expected the innermost zone, got %q", zone)
+	}
+	if zone := dynDnsZone(zones, &TokenScope{Zones: "other.example.com"}, "router.home.alice.users.example.com"); zone != "" {
+		t.Errorf("expected a token bound to another zone to find none, got %q", zone)
+	}
+	if zone := dynDnsZone(zones, &TokenScope{}, "notalice.users.example.com"); zone != "" {
+		t.Errorf("expected no zone for a mere suffix match, got %q", zone)
+	}
+
+	var current []dns.RR
+	for _, s := range []string{"nas.example.com. 300 IN A 192.0.2.1", "nas.example.com. 300 IN AAAA 2001:db8::1"} {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		current = append(current, rr)
+	}
+
+	ips, err := parseDynDnsIPs("192.0.2.1", "2001:db8::1,192.0.2.1")
+	if err != nil || len(ips) != 2 {
+		t.Fatalf("parseDynDnsIPs: %v %v", ips, err)
+	}
+	if add, _, err := dynDnsRecords("nas.example.com", current, ips, nil); err != nil || len(add) != 0 {
+		t.Errorf("expected no change, got %v %v", add, err)
+	}
+
+	ips, _ = parseDynDnsIPs("198.51.100.7")
+	add, replaced, err := dynDnsRecords("nas.example.com", current, ips, nil)
+	if err != nil || len(add) != 1 || len(replaced) != 1 || add[0].Header().Rrtype != dns.TypeA || add[0].Header().Ttl != 300 {
+		t.Errorf("expected the A record alone to be replaced with its TTL kept, got %v replacing %v (%v)", add, replaced, err)
+	}
+
+	add, _, _ = dynDnsRecords("new.example.com", current, ips, &RecordConstraints{MinTTL: 120})
+	if len(add) != 1 || add[0].Header().Ttl != 120 {
+		t.Errorf("expected a new record to get the default TTL raised to the minimum, got %v", add)
+	}
+
+	if _, err := parseDynDnsIPs("not-an-ip"); err == nil {
+		t.Errorf("expected an invalid address to be refused")
+	}
+}
@@ -0,0 +1,382 @@
+package helper
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// SupportedRecordTypes are the record types the record API can write. Anything
+// else (SOA, DNSSEC records, ...) is owned by PowerDNS or by this service.
+var SupportedRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "TXT", "SRV", "CAA", "NS", "PTR", "SSHFP"}
+
+// IsSupportedRecordType reports whether recordType (case-insensitive) is one of
+// SupportedRecordTypes.
+func IsSupportedRecordType(recordType string) bool {
+	recordType = strings.ToUpper(strings.TrimSpace(recordType))
+	for _, t := range SupportedRecordTypes {
+		if t == recordType {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRecord builds a validated resource record from the value format the record
+// API uses — the RDATA in presentation format, the same that listDNSRecords
+// returns:
+//
+//	A      192.0.2.10
+//	AAAA   2001:db8::1
+//	CNAME  target.example.com.      (NS and PTR alike)
+//	MX     10 mail.example.com.
+//	TXT    any text                 (or one or more "quoted" "segments")
+//	SRV    10 5 443 target.example.com.
+//	CAA    0 issue "letsencrypt.org"
+//	SSHFP  4 2 <hex fingerprint>
+//
+// Each type is checked on its own terms, so a malformed value is refused here
+// with a readable message instead of as an opaque FORMERR from the nameserver.
+// Relative target names are taken as absolute.
+func NewRecord(recordName, recordType string, value string, ttl uint32) (dns.RR, error) {
+	recordType = strings.ToUpper(strings.TrimSpace(recordType))
+	rrtype, ok := dns.StringToType[recordType]
+	if !ok || !IsSupportedRecordType(recordType) {
+		return nil, fmt.Errorf("unsupported type %q (supported: %s)", recordType, strings.Join(SupportedRecordTypes, ", "))
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, errors.New("value is empty")
+	}
+
+	hdr := dns.RR_Header{Name: dns.Fqdn(recordName), Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+	fields := strings.Fields(value)
+
+	switch rrtype {
+	case dns.TypeA:
+		ip := net.ParseIP(value)
+		if ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("A value %q is not an IPv4 address", value)
+		}
+		return &dns.A{Hdr: hdr, A: ip.To4()}, nil
+
+	case dns.TypeAAAA:
+		ip := net.ParseIP(value)
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("AAAA value %q is not an IPv6 address", value)
+		}
+		return &dns.AAAA{Hdr: hdr, AAAA: ip}, nil
+
+	case dns.TypeCNAME, dns.TypeNS, dns.TypePTR:
+		target, err := recordTarget(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s value: %w", recordType, err)
+		}
+		switch rrtype {
+		case dns.TypeCNAME:
+			return &dns.CNAME{Hdr: hdr, Target: target}, nil
+		case dns.TypeNS:
+			return &dns.NS{Hdr: hdr, Ns: target}, nil
+		default:
+			return &dns.PTR{Hdr: hdr, Ptr: target}, nil
+		}
+
+	case dns.TypeMX:
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("MX value %q must be '<preference> <host>'", value)
+		}
+		pref, err := parseUint(fields[0], 16, "MX preference")
+		if err != nil {
+			return nil, err
+		}
+		target, err := recordTarget(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("MX value: %w", err)
+		}
+		return &dns.MX{Hdr: hdr, Preference: uint16(pref), Mx: target}, nil
+
+	case dns.TypeSRV:
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("SRV value %q must be '<priority> <weight> <port> <target>'", value)
+		}
+		nums := make([]uint16, 3)
+		for i, what := range []string{"SRV priority", "SRV weight", "SRV port"} {
+			n, err := parseUint(fields[i], 16, what)
+			if err != nil {
+				return nil, err
+			}
+			nums[i] = uint16(n)
+		}
+		target, err := recordTarget(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("SRV value: %w", err)
+		}
+		return &dns.SRV{Hdr: hdr, Priority: nums[0], Weight: nums[1], Port: nums[2], Target: target}, nil
+
+	case dns.TypeTXT:
+		segments, err := txtSegments(value)
+		if err != nil {
+			return nil, err
+		}
+		return &dns.TXT{Hdr: hdr, Txt: segments}, nil
+
+	case dns.TypeCAA:
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("CAA value %q must be '<flags> <tag> <value>'", value)
+		}
+		flags, err := parseUint(fields[0], 8, "CAA flags")
+		if err != nil {
+			return nil, err
+		}
+		tag := strings.ToLower(fields[1])
+		switch tag {
+		case "issue", "issuewild", "issuemail", "iodef":
+		default:
+			return nil, fmt.Errorf("CAA tag %q is not one of issue, issuewild, issuemail, iodef", fields[1])
+		}
+		// The value may contain spaces (issue parameters), so take the rest of
+		// the line rather than the third field.
+		afterFlags := strings.TrimSpace(value[len(fields[0]):])
+		rest := strings.TrimSpace(afterFlags[len(fields[1]):])
+		return &dns.CAA{Hdr: hdr, Flag: uint8(flags), Tag: tag, Value: strings.Trim(rest, `"`)}, nil
+
+	case dns.TypeSSHFP:
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("SSHFP value %q must be '<algorithm> <type> <fingerprint>'", value)
+		}
+		alg, err := parseUint(fields[0], 8, "SSHFP algorithm")
+		if err != nil {
+			return nil, err
+		}
+		fpType, err := parseUint(fields[1], 8, "SSHFP fingerprint type")
+		if err != nil {
+			return nil, err
+		}
+		fp := strings.ToUpper(fields[2])
+		raw, err := hex.DecodeString(fp)
+		if err != nil {
+			return nil, fmt.Errorf("SSHFP fingerprint %q is not hex", fields[2])
+		}
+		// RFC 4255 / 6594: type 1 is SHA-1 (20 bytes), type 2 SHA-256 (32 bytes).
+		switch {
+		case fpType == 1 && len(raw) != 20, fpType == 2 && len(raw) != 32:
+			return nil, fmt.Errorf("SSHFP fingerprint has %d bytes, which does not match type %d", len(raw), fpType)
+		case fpType != 1 && fpType != 2:
+			return nil, fmt.Errorf("SSHFP fingerprint type %d is not 1 (SHA-1) or 2 (SHA-256)", fpType)
+		}
+		return &dns.SSHFP{Hdr: hdr, Algorithm: uint8(alg), Type: uint8(fpType), FingerPrint: fp}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %q", recordType)
+}
+
+// recordTarget validates a host name used as record data and makes it absolute.
+func recordTarget(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." {
+		return "", errors.New("target name is empty")
+	}
+	if _, ok := dns.IsDomainName(name); !ok {
+		return "", fmt.Errorf("%q is not a valid domain name", name)
+	}
+	return dns.Fqdn(name), nil
+}
+
+func parseUint(s string, bits int, what string) (uint64, error) {
+	n, err := strconv.ParseUint(s, 10, bits)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q is not a number between 0 and %d", what, s, uint64(1)<<bits-1)
+	}
+	return n, nil
+}
+
+// txtSegments splits a TXT value into its character-strings. A value starting
+// with a quote is parsed as presentation format ("a" "b"), anything else is one
+// text that is cut into the 255-byte pieces a character-string can hold.
+func txtSegments(value string) ([]string, error) {
+	if strings.HasPrefix(value, `"`) {
+		rr, err := dns.NewRR(". 0 IN TXT " + value)
+		if err != nil || rr == nil {
+			return nil, fmt.Errorf("TXT value %s is not valid quoted text: %v", value, err)
+		}
+		return rr.(*dns.TXT).Txt, nil
+	}
+
+	const maxSegment = 255
+	segments := make([]string, 0, len(value)/maxSegment+1)
+	for len(value) > maxSegment {
+		segments = append(segments, value[:maxSegment])
+		value = value[maxSegment:]
+	}
+	return append(segments, value), nil
+}
+
+// RecordData is the record data of one record as typed fields, the structured
+// counterpart of the presentation-format value. Only the fields of the record's
+// type are set; numbers are pointers so that a 0 (a valid preference or flag)
+// is still sent.
+type RecordData struct {
+	// A, AAAA
+	Address string `json:"address,omitempty"`
+	// CNAME, NS, PTR, and the host of MX and SRV
+	Target string `json:"target,omitempty"`
+	// MX
+	Preference *uint16 `json:"preference,omitempty"`
+	// SRV
+	Priority *uint16 `json:"priority,omitempty"`
+	Weight   *uint16 `json:"weight,omitempty"`
+	Port     *uint16 `json:"port,omitempty"`
+	// TXT: the character-strings, segment boundaries kept
+	Text []string `json:"text,omitempty"`
+	// CAA
+	Flags *uint8 `json:"flags,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+	Value string `json:"value,omitempty"`
+	// SSHFP
+	Algorithm       *uint8 `json:"algorithm,omitempty"`
+	FingerprintType *uint8 `json:"fingerprint_type,omitempty"`
+	Fingerprint     string `json:"fingerprint,omitempty"`
+}
+
+// RecordDataOf returns the typed data of rr, or nil for a type outside
+// SupportedRecordTypes.
+func RecordDataOf(rr dns.RR) *RecordData {
+	switch t := rr.(type) {
+	case *dns.A:
+		return &RecordData{Address: t.A.String()}
+	case *dns.AAAA:
+		return &RecordData{Address: t.AAAA.String()}
+	case *dns.CNAME:
+		return &RecordData{Target: t.Target}
+	case *dns.NS:
+		return &RecordData{Target: t.Ns}
+	case *dns.PTR:
+		return &RecordData{Target: t.Ptr}
+	case *dns.MX:
+		return &RecordData{Preference: &t.Preference, Target: t.Mx}
+	case *dns.SRV:
+		return &RecordData{Priority: &t.Priority, Weight: &t.Weight, Port: &t.Port, Target: t.Target}
+	case *dns.TXT:
+		text := make([]string, len(t.Txt))
+		for i, segment := range t.Txt {
+			text[i] = unescapeTxt(segment)
+		}
+		return &RecordData{Text: text}
+	case *dns.CAA:
+		return &RecordData{Flags: &t.Flag, Tag: t.Tag, Value: t.Value}
+	case *dns.SSHFP:
+		return &RecordData{Algorithm: &t.Algorithm, FingerprintType: &t.Type, Fingerprint: t.FingerPrint}
+	}
+	return nil
+}
+
+// PresentationValue turns typed data into the value NewRecord takes, so both
+// forms go through the same validation. Fields of the type that are missing are
+// an error; fields of other types are ignored.
+func (d *RecordData) PresentationValue(recordType string) (string, error) {
+	recordType = strings.ToUpper(strings.TrimSpace(recordType))
+	missing := func(fields string) (string, error) {
+		return "", fmt.Errorf("%s data needs %s", recordType, fields)
+	}
+
+	switch recordType {
+	case "A", "AAAA":
+		if d.Address == "" {
+			return missing("address")
+		}
+		return d.Address, nil
+	case "CNAME", "NS", "PTR":
+		if d.Target == "" {
+			return missing("target")
+		}
+		return d.Target, nil
+	case "MX":
+		if d.Preference == nil || d.Target == "" {
+			return missing("preference and target")
+		}
+		return fmt.Sprintf("%d %s", *d.Preference, d.Target), nil
+	case "SRV":
+		if d.Priority == nil || d.Weight == nil || d.Port == nil || d.Target == "" {
+			return missing("priority, weight, port and target")
+		}
+		return fmt.Sprintf("%d %d %d %s", *d.Priority, *d.Weight, *d.Port, d.Target), nil
+	case "TXT":
+		if len(d.Text) == 0 {
+			return missing("text")
+		}
+		quoted := make([]string, len(d.Text))
+		for i, segment := range d.Text {
+			quoted[i] = `"` + escapeTxt(segment) + `"`
+		}
+		return strings.Join(quoted, " "), nil
+	case "CAA":
+		if d.Flags == nil || d.Tag == "" || d.Value == "" {
+			return missing("flags, tag and value")
+		}
+		// NewRecord takes the rest of the line as the value, no quoting needed.
+		return fmt.Sprintf("%d %s %s", *d.Flags, d.Tag, d.Value), nil
+	case "SSHFP":
+		if d.Algorithm == nil || d.FingerprintType == nil || d.Fingerprint == "" {
+			return missing("algorithm, fingerprint_type and fingerprint")
+		}
+		return fmt.Sprintf("%d %d %s", *d.Algorithm, *d.FingerprintType, d.Fingerprint), nil
+	}
+	return "", fmt.Errorf("unsupported type %q (supported: %s)", recordType, strings.Join(SupportedRecordTypes, ", "))
+}
+
+// unescapeTxt turns a TXT segment as miekg/dns holds it — with the escapes of
+// the presentation format, \" and \\ and \DDD — into the plain text.
+func unescapeTxt(segment string) string {
+	if !strings.Contains(segment, `\`) {
+		return segment
+	}
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		if segment[i] != '\\' || i+1 == len(segment) {
+			b.WriteByte(segment[i])
+			continue
+		}
+		if i+3 < len(segment) && isDigits(segment[i+1:i+4]) {
+			n, _ := strconv.Atoi(segment[i+1 : i+4])
+			b.WriteByte(byte(n))
+			i += 3
+			continue
+		}
+		i++
+		b.WriteByte(segment[i])
+	}
+	return b.String()
+}
+
+// escapeTxt is the reverse of unescapeTxt: a plain text segment in the escaped
+// form a quoted presentation-format string needs.
+func escapeTxt(segment string) string {
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		switch c := segment[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
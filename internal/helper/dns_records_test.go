@@ -0,0 +1,133 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestNewRecordAcceptsEveryWritableType(t *testing.T) {
+	cases := []struct {
+		recordType, value, wantRdata string
+	}{
+		{"A", "192.0.2.10", "192.0.2.10"},
+		{"aaaa", "2001:db8::1", "2001:db8::1"},
+		{"CNAME", "target.example.com", "target.example.com."},
+		{"MX", "10 mail.example.com.", "10 mail.example.com."},
+		{"TXT", "v=spf1 -all", `"v=spf1 -all"`},
+		{"TXT", `"first" "second"`, `"first" "second"`},
+		{"SRV", "10 5 443 svc.example.com.", "10 5 443 svc.example.com."},
+		{"CAA", `0 issue "letsencrypt.org"`, `0 issue "letsencrypt.org"`},
+		{"NS", "ns1.example.net.", "ns1.example.net."},
+		{"PTR", "host.example.com.", "host.example.com."},
+		{"SSHFP", "4 2 " + strings.Repeat("ab", 32), "4 2 " + strings.Repeat("AB", 32)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.recordType+" "+tc.value, func(t *testing.T) {
+			rr, err := NewRecord("www.example.com", tc.recordType, tc.value, 300)
+			if err != nil {
+				t.Fatalf("NewRecord(%s, %q) failed: %v", tc.recordType, tc.value, err)
+			}
+			if rr.Header().Name != "www.example.com." || rr.Header().Ttl != 300 {
+				t.Errorf("unexpected header %+v", rr.Header())
+			}
+			rdata := strings.TrimPrefix(rr.String(), rr.Header().String())
+			if rdata != tc.wantRdata {
+				t.Errorf("rdata = %q, want %q", rdata, tc.wantRdata)
+			}
+		})
+	}
+}
+
+func TestNewRecordRejectsMalformedValues(t *testing.T) {
+	cases := []struct {
+		recordType, value string
+	}{
+		{"A", "2001:db8::1"},
+		{"A", "not-an-ip"},
+		{"AAAA", "192.0.2.10"},
+		{"CNAME", ""},
+		{"MX", "mail.example.com."},
+		{"MX", "70000 mail.example.com."},
+		{"SRV", "10 5 svc.example.com."},
+		{"CAA", "0 policy letsencrypt.org"},
+		{"SSHFP", "4 2 abcd"},
+		{"SSHFP", "4 3 " + strings.Repeat("ab", 32)},
+		{"SOA", "ns.example.com. hostmaster.example.com. 1 2 3 4 5"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.recordType+" "+tc.value, func(t *testing.T) {
+			if rr, err := NewRecord("www.example.com", tc.recordType, tc.value, 300); err == nil {
+				t.Errorf("NewRecord(%s, %q) should fail, got %v", tc.recordType, tc.value, rr)
+			}
+		})
+	}
+}
+
+// A long TXT value must be split into 255-byte character-strings, or the
+// nameserver refuses the whole update.
+func TestNewRecordSplitsLongTxt(t *testing.T) {
+	rr, err := NewRecord("_dkim.example.com", "TXT", strings.Repeat("x", 600), 300)
+	if err != nil {
+		t.Fatalf("NewRecord failed: %v", err)
+	}
+	txt := rr.(*dns.TXT).Txt
+	if len(txt) != 3 || len(txt[0]) != 255 || len(txt[2]) != 90 {
+		t.Errorf("unexpected segments: %d (%d ... %d bytes)", len(txt), len(txt[0]), len(txt[len(txt)-1]))
+	}
+}
+
+// Typed data must round-trip: what RecordDataOf returns, written back through
+// PresentationValue and NewRecord, is the same record — including the segment
+// boundaries and quotes of TXT that the flat value loses.
+func TestRecordDataRoundTrip(t *testing.T) {
+	cases := []struct{ recordType, value string }{
+		{"A", "192.0.2.10"},
+		{"AAAA", "2001:db8::1"},
+		{"CNAME", "target.example.com."},
+		{"MX", "0 mail.example.com."},
+		{"TXT", `"first segment" "say \"hi\"" "back\\slash"`},
+		{"SRV", "0 0 443 svc.example.com."},
+		{"CAA", `0 issue "letsencrypt.org; validationmethods=dns-01"`},
+		{"SSHFP", "4 2 " + strings.Repeat("AB", 32)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.recordType, func(t *testing.T) {
+			rr, err := NewRecord("www.example.com.", tc.recordType, tc.value, 300)
+			if err != nil {
+				t.Fatalf("NewRecord failed: %v", err)
+			}
+			data := RecordDataOf(rr)
+			if data == nil {
+				t.Fatal("expected typed data")
+			}
+			value, err := data.PresentationValue(tc.recordType)
+			if err != nil {
+				t.Fatalf("PresentationValue failed: %v", err)
+			}
+			again, err := NewRecord("www.example.com.", tc.recordType, value, 300)
+			if err != nil {
+				t.Fatalf("NewRecord(%q) failed: %v", value, err)
+			}
+			if RecordKey(rr) != RecordKey(again) {
+				t.Errorf("round trip changed the record: %s became %s", rr, again)
+			}
+		})
+	}
+}
+
+func TestRecordDataRequiresTheFieldsOfItsType(t *testing.T) {
+	if _, err := (&RecordData{Target: "mail.example.com."}).PresentationValue("MX"); err == nil {
+		t.Error("expected MX data without preference to be rejected")
+	}
+	if _, err := (&RecordData{Address: "192.0.2.1"}).PresentationValue("HINFO"); err == nil {
+		t.Error("expected an unsupported type to be rejected")
+	}
+	if RecordDataOf(&dns.HINFO{Hdr: dns.RR_Header{Rrtype: dns.TypeHINFO}}) != nil {
+		t.Error("expected no typed data for an unsupported type")
+	}
+}
@@ -2,12 +2,16 @@ package helper
 
 import (
 	"fmt"
-	"net"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
+// udpUpdateLimit is the largest unsigned update sent over UDP: the 512 bytes of
+// a classic DNS datagram minus room for the TSIG record added on signing.
+const udpUpdateLimit = dns.MinMsgSize - 128
+
 // sendDNSUpdate is a helper function to handle the common DNS client setup,
 // TSIG signing, and message exchange for RFC 2136 updates.
 func sendDNSUpdate(tsigName, tsigAlg, tsigSecret, serverAddr string, m *dns.Msg) (*dns.Msg, error) {
@@ -15,6 +19,12 @@ func sendDNSUpdate(tsigName, tsigAlg, tsigSecret, serverAddr string, m *dns.Msg)
 	client := new(dns.Client)
 	client.TsigSecret = map[string]string{dns.Fqdn(tsigName): tsigSecret}
 
+	// A batch does not fit into a plain UDP datagram; RFC 2136 section 6 has
+	// such updates sent over TCP.
+	if m.Len() > udpUpdateLimit {
+		client.Net = "tcp"
+	}
+
 	// Set the TSIG for the message
 	m.SetTsig(dns.Fqdn(tsigName), dns.Fqdn(tsigAlg), 300, time.Now().Unix())
 
@@ -31,105 +41,171 @@ func sendDNSUpdate(tsigName, tsigAlg, tsigSecret, serverAddr string, m *dns.Msg)
 	return msg, nil
 }
 
-// Rfc2136AddARecord adds an A record to a DNS zone using RFC 2136 dynamic updates.
+// Rfc2136AddRecords adds records to a DNS zone using RFC 2136 dynamic updates.
+// Records already present with the same data are left as they are, so adding
+// is idempotent; other values of the same RRset are kept.
 // tsigName: The FQDN of the TSIG key.
-// tsigAlg: The TSIG algorithm (e.g., "hmac-md5.sig-alg.reg.int.").
+// tsigAlg: The TSIG algorithm (e.g., "hmac-sha512.").
 // tsigSecret: The base64 encoded TSIG secret.
 // serverAddr: The address of the DNS server (e.g., "192.0.2.1:53").
 // zoneName: The FQDN of the zone to update (e.g., "example.com.").
-// recordName: The FQDN of the record to add (e.g., "host.example.com.").
-// recordType: The DNS record type (e.g., dns.TypeA).
-// recordValue: The IP address for the A record (e.g., "192.0.2.10").
-// ttl: The TTL for the record in seconds.
-func Rfc2136AddARecord(tsigName, tsigAlg, tsigSecret, serverAddr, zoneName, recordName string, recordValue string, ttl uint32) (*dns.Msg, error) {
-	// Create a new DNS UPDATE message.
+// rrs: The records to add, see NewRecord.
+func Rfc2136AddRecords(tsigName, tsigAlg, tsigSecret, serverAddr, zoneName string, rrs []dns.RR) (*dns.Msg, error) {
 	m := new(dns.Msg)
-	m.SetUpdate(zoneName)
-
-	// Add an A record to be added.
-	rr := &dns.A{
-		Hdr: dns.RR_Header{
-			Name:   dns.Fqdn(recordName), // Ensure FQDN
-			Rrtype: dns.TypeA,
-			Class:  dns.ClassINET,
-			Ttl:    ttl,
-		},
-		A: net.ParseIP(recordValue),
-	}
-	m.Insert([]dns.RR{rr})
+	m.SetUpdate(dns.Fqdn(zoneName))
+	m.Insert(rrs)
 
 	return sendDNSUpdate(tsigName, tsigAlg, tsigSecret, serverAddr, m)
 }
 
-// Rfc2136DeleteARecord deletes an A record from a DNS zone using RFC 2136 dynamic updates.
-// It removes all A records for the given recordName.
-// tsigName, tsigAlg, tsigSecret, serverAddr, zoneName: Same as Rfc2136AddARecord.
+// Rfc2136DeleteRRset deletes all records of one type for a name using RFC 2136
+// dynamic updates. Records of other types at the same name are not touched.
+// tsigName, tsigAlg, tsigSecret, serverAddr, zoneName: Same as Rfc2136AddRecords.
 // recordName: The FQDN of the record to delete (e.g., "host.example.com.").
-func Rfc2136DeleteARecord(tsigName, tsigAlg, tsigSecret, serverAddr, zoneName, recordName string) (*dns.Msg, error) {
-	// Create a new DNS UPDATE message.
+// rrtype: The type of the RRset to delete (e.g., dns.TypeTXT).
+func Rfc2136DeleteRRset(tsigName, tsigAlg, tsigSecret, serverAddr, zoneName, recordName string, rrtype uint16) (*dns.Msg, error) {
 	m := new(dns.Msg)
-	m.SetUpdate(zoneName)
-
-	// Remove all A records for the specified name.
-	// To delete all records of a specific type for a name, use the ANY class (dns.ClassANY)
-	// and a TTL of 0.
-	rr := &dns.A{
-		Hdr: dns.RR_Header{
-			Name:   dns.Fqdn(recordName),
-			Rrtype: dns.TypeANY, // TypeANY indicates "delete all records of this type"
-			Class:  dns.ClassINET,
-			Ttl:    0, // TTL 0 is for deletion
-		},
-	}
-	m.RemoveRRset([]dns.RR{rr})
+	m.SetUpdate(dns.Fqdn(zoneName))
+	m.RemoveRRset([]dns.RR{rrsetSelector(recordName, rrtype)})
 
 	return sendDNSUpdate(tsigName, tsigAlg, tsigSecret, serverAddr, m)
 }
 
-// Rfc2136AddAAAARecord adds an AAAA record to a DNS zone using RFC 2136 dynamic updates.
-// tsigName, tsigAlg, tsigSecret, serverAddr, zoneName: Same as Rfc2136AddARecord.
-// recordName: The FQDN of the record to add (e.g., "host.example.com.").
-// recordValue: The IPv6 address for the AAAA record (e.g., "2001:db8::1").
-// ttl: The TTL for the record in seconds.
-func Rfc2136AddAAAARecord(tsigName, tsigAlg, tsigSecret, serverAddr, zoneName, recordName string, recordValue string, ttl uint32) (*dns.Msg, error) {
-	// Create a new DNS UPDATE message.
+// Rfc2136DeleteRecords deletes individual records using RFC 2136 dynamic
+// updates: only the given values go, the rest of their RRsets stays. A value
+// that is not present is ignored by the server.
+// tsigName, tsigAlg, tsigSecret, serverAddr, zoneName: Same as Rfc2136AddRecords.
+// rrs: The records to delete, see NewRecord; their TTL does not matter.
+func Rfc2136DeleteRecords(tsigName, tsigAlg, tsigSecret, serverAddr, zoneName string, rrs []dns.RR) (*dns.Msg, error) {
 	m := new(dns.Msg)
-	m.SetUpdate(zoneName)
-
-	// Add an AAAA record to be added.
-	rr := &dns.AAAA{
-		Hdr: dns.RR_Header{
-			Name:   dns.Fqdn(recordName), // Ensure FQDN
-			Rrtype: dns.TypeAAAA,
-			Class:  dns.ClassINET,
-			Ttl:    ttl,
-		},
-		AAAA: net.ParseIP(recordValue),
-	}
-	m.Insert([]dns.RR{rr})
+	m.SetUpdate(dns.Fqdn(zoneName))
+	m.Remove(rrs)
 
 	return sendDNSUpdate(tsigName, tsigAlg, tsigSecret, serverAddr, m)
 }
 
-// Rfc2136DeleteAAAARecord deletes an AAAA record from a DNS zone using RFC 2136 dynamic updates.
-// It removes all AAAA records for the given recordName.
-// tsigName, tsigAlg, tsigSecret, serverAddr, zoneName: Same as Rfc2136AddARecord.
-// recordName: The FQDN of the record to delete (e.g., "host.example.com.").
-func Rfc2136DeleteAAAARecord(tsigName, tsigAlg, tsigSecret, serverAddr, zoneName, recordName string) (*dns.Msg, error) {
-	// Create a new DNS UPDATE message.
+// rrsetSelector returns an empty RR naming an RRset, which is all RemoveRRset
+// looks at: it rewrites the class to ANY and the TTL to 0 itself. The type must
+// be the real one — TypeANY here would delete every RRset at the name, which is
+// what the old per-type A delete accidentally did.
+func rrsetSelector(recordName string, rrtype uint16) dns.RR {
+	return &dns.ANY{Hdr: dns.RR_Header{
+		Name:   dns.Fqdn(recordName),
+		Rrtype: rrtype,
+		Class:  dns.ClassINET,
+	}}
+}
+
+// Rfc2136Update is one RFC 2136 update message under construction. The
+// prerequisites and changes collected on it are sent together by Send and
+// applied by the server all-or-nothing: if a prerequisite does not hold or a
+// change fails, nothing changes.
+type Rfc2136Update struct {
+	m *dns.Msg
+}
+
+// NewRfc2136Update starts an update message for zoneName.
+func NewRfc2136Update(zoneName string) *Rfc2136Update {
 	m := new(dns.Msg)
-	m.SetUpdate(zoneName)
-
-	// Remove all AAAA records for the specified name.
-	rr := &dns.AAAA{
-		Hdr: dns.RR_Header{
-			Name:   dns.Fqdn(recordName),
-			Rrtype: dns.TypeAAAA,
-			Class:  dns.ClassANY, // ClassANY indicates "delete all records of this type"
-			Ttl:    0,            // TTL 0 is for deletion
-		},
+	m.SetUpdate(dns.Fqdn(zoneName))
+	return &Rfc2136Update{m: m}
+}
+
+// RequireNameExists requires at least one record at recordName.
+func (u *Rfc2136Update) RequireNameExists(recordName string) {
+	u.m.NameUsed([]dns.RR{rrsetSelector(recordName, dns.TypeANY)})
+}
+
+// RequireNameAbsent requires that there is no record at recordName.
+func (u *Rfc2136Update) RequireNameAbsent(recordName string) {
+	u.m.NameNotUsed([]dns.RR{rrsetSelector(recordName, dns.TypeANY)})
+}
+
+// RequireRRsetExists requires the RRset (recordName, rrtype), whatever its values.
+func (u *Rfc2136Update) RequireRRsetExists(recordName string, rrtype uint16) {
+	u.m.RRsetUsed([]dns.RR{rrsetSelector(recordName, rrtype)})
+}
+
+// RequireRRsetAbsent requires that there is no RRset (recordName, rrtype).
+func (u *Rfc2136Update) RequireRRsetAbsent(recordName string, rrtype uint16) {
+	u.m.RRsetNotUsed([]dns.RR{rrsetSelector(recordName, rrtype)})
+}
+
+// RequireRRsetEquals requires the RRset of rrs to hold exactly these values,
+// which is what compare-and-swap needs. All rrs must share name and type.
+func (u *Rfc2136Update) RequireRRsetEquals(rrs []dns.RR) {
+	u.m.Used(rrs)
+}
+
+// Add adds records, see Rfc2136AddRecords.
+func (u *Rfc2136Update) Add(rrs []dns.RR) {
+	u.m.Insert(rrs)
+}
+
+// DeleteRRset deletes the RRset (recordName, rrtype), see Rfc2136DeleteRRset.
+func (u *Rfc2136Update) DeleteRRset(recordName string, rrtype uint16) {
+	u.m.RemoveRRset([]dns.RR{rrsetSelector(recordName, rrtype)})
+}
+
+// DeleteRecords deletes individual records, see Rfc2136DeleteRecords.
+func (u *Rfc2136Update) DeleteRecords(rrs []dns.RR) {
+	u.m.Remove(rrs)
+}
+
+// Send signs and sends the update. tsigName, tsigAlg, tsigSecret, serverAddr:
+// Same as Rfc2136AddRecords. When the server refuses the update the response
+// is returned along with the error, so callers can tell a failed prerequisite
+// (see IsPrerequisiteFailure) from other errors.
+func (u *Rfc2136Update) Send(tsigName, tsigAlg, tsigSecret, serverAddr string) (*dns.Msg, error) {
+	return sendDNSUpdate(tsigName, tsigAlg, tsigSecret, serverAddr, u.m)
+}
+
+// IsPrerequisiteFailure reports whether a response refuses an update because
+// one of its prerequisites did not hold (RFC 2136 section 3.2).
+func IsPrerequisiteFailure(msg *dns.Msg) bool {
+	if msg == nil {
+		return false
 	}
-	m.RemoveRRset([]dns.RR{rr})
+	switch msg.Rcode {
+	case dns.RcodeYXDomain, dns.RcodeNameError, dns.RcodeYXRrset, dns.RcodeNXRrset:
+		return true
+	}
+	return false
+}
 
-	return sendDNSUpdate(tsigName, tsigAlg, tsigSecret, serverAddr, m)
+// Apply returns the records a zone that holds current would hold after the
+// update, applying its changes in order as RFC 2136 section 3.4.2 does. The
+// prerequisites are not checked. It lets callers judge an update (e.g. against
+// a size limit) before sending it.
+func (u *Rfc2136Update) Apply(current []dns.RR) []dns.RR {
+	out := append([]dns.RR(nil), current...)
+	remove := func(match func(dns.RR) bool) {
+		kept := out[:0]
+		for _, rr := range out {
+			if !match(rr) {
+				kept = append(kept, rr)
+			}
+		}
+		out = kept
+	}
+
+	for _, ch := range u.m.Ns {
+		h := ch.Header()
+		switch {
+		case h.Class == dns.ClassANY && h.Rrtype == dns.TypeANY:
+			remove(func(rr dns.RR) bool { return strings.EqualFold(rr.Header().Name, h.Name) })
+		case h.Class == dns.ClassANY:
+			remove(func(rr dns.RR) bool {
+				return strings.EqualFold(rr.Header().Name, h.Name) && rr.Header().Rrtype == h.Rrtype
+			})
+		case h.Class == dns.ClassNONE:
+			key := RecordKey(ch)
+			remove(func(rr dns.RR) bool { return RecordKey(rr) == key })
+		default:
+			key := RecordKey(ch)
+			remove(func(rr dns.RR) bool { return RecordKey(rr) == key })
+			out = append(out, ch)
+		}
+	}
+	return out
 }
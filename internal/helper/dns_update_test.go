@@ -0,0 +1,109 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// Prerequisites belong in the prerequisite section (Answer) and changes in the
+// update section (Ns), each with the class RFC 2136 gives its meaning.
+func TestRfc2136UpdateSections(t *testing.T) {
+	rr, err := NewRecord("www.example.com.", "A", "192.0.2.1", 60)
+	if err != nil {
+		t.Fatalf("NewRecord failed: %v", err)
+	}
+	old, err := NewRecord("www.example.com.", "A", "192.0.2.9", 60)
+	if err != nil {
+		t.Fatalf("NewRecord failed: %v", err)
+	}
+
+	u := NewRfc2136Update("example.com")
+	u.RequireNameAbsent("new.example.com.")
+	u.RequireRRsetEquals([]dns.RR{old})
+	u.DeleteRRset("www.example.com.", dns.TypeA)
+	u.Add([]dns.RR{rr})
+
+	if len(u.m.Answer) != 2 || len(u.m.Ns) != 2 {
+		t.Fatalf("expected 2 prerequisites and 2 updates, got %d and %d", len(u.m.Answer), len(u.m.Ns))
+	}
+
+	checks := []struct {
+		what   string
+		rr     dns.RR
+		rrtype uint16
+		class  uint16
+	}{
+		{"name absent", u.m.Answer[0], dns.TypeANY, dns.ClassNONE},
+		{"rrset equals", u.m.Answer[1], dns.TypeA, dns.ClassINET},
+		{"delete rrset", u.m.Ns[0], dns.TypeA, dns.ClassANY},
+		{"add", u.m.Ns[1], dns.TypeA, dns.ClassINET},
+	}
+	for _, c := range checks {
+		h := c.rr.Header()
+		if h.Rrtype != c.rrtype || h.Class != c.class {
+			t.Errorf("%s: expected type %s class %s, got %s %s", c.what,
+				dns.TypeToString[c.rrtype], dns.ClassToString[c.class], dns.TypeToString[h.Rrtype], dns.ClassToString[h.Class])
+		}
+	}
+}
+
+func TestIsPrerequisiteFailure(t *testing.T) {
+	for rcode, want := range map[int]bool{
+		dns.RcodeNXRrset:  true,
+		dns.RcodeYXRrset:  true,
+		dns.RcodeYXDomain: true,
+		dns.RcodeRefused:  false,
+		dns.RcodeNotAuth:  false,
+	} {
+		if got := IsPrerequisiteFailure(&dns.Msg{MsgHdr: dns.MsgHdr{Rcode: rcode}}); got != want {
+			t.Errorf("rcode %s: expected %v, got %v", dns.RcodeToString[rcode], want, got)
+		}
+	}
+	if IsPrerequisiteFailure(nil) {
+		t.Error("expected no response to not be a prerequisite failure")
+	}
+}
+
+// Apply must give what the server ends up with, so a size limit can be judged
+// before the update is sent.
+func TestRfc2136UpdateApply(t *testing.T) {
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("bad test record %q: %v", s, err)
+		}
+		return r
+	}
+	current := []dns.RR{
+		rr("www.example.com. 60 IN A 192.0.2.1"),
+		rr("www.example.com. 60 IN A 192.0.2.2"),
+		rr("mail.example.com. 60 IN A 192.0.2.3"),
+		rr("example.com. 60 IN TXT \"hello\""),
+	}
+
+	u := NewRfc2136Update("example.com")
+	u.DeleteRRset("www.example.com.", dns.TypeA)
+	u.Add([]dns.RR{rr("www.example.com. 60 IN A 192.0.2.9"), rr("example.com. 300 IN TXT \"hello\"")})
+	u.DeleteRecords([]dns.RR{rr("mail.example.com. 60 IN A 192.0.2.3")})
+
+	got := map[string]bool{}
+	for _, r := range u.Apply(current) {
+		got[RecordKey(r)] = true
+	}
+	want := []string{
+		"www.example.com. A 192.0.2.9",
+		"example.com. TXT \"hello\"",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d records, got %v", len(want), got)
+	}
+	for _, k := range want {
+		if !got[k] {
+			t.Errorf("expected %q, got %v", k, got)
+		}
+	}
+	if len(current) != 4 {
+		t.Error("Apply must not change the records it is given")
+	}
+}
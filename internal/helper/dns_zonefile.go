@@ -0,0 +1,113 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ZoneTransfer fetches all records of a zone with a TSIG-signed AXFR. The SOA
+// that closes the transfer is dropped, so each record is returned once.
+// tsigName, tsigAlg, tsigSecret, serverAddr, zoneName: Same as Rfc2136AddRecords.
+func ZoneTransfer(tsigName, tsigAlg, tsigSecret, serverAddr, zoneName string) ([]dns.RR, error) {
+	msg := new(dns.Msg)
+	msg.SetAxfr(dns.Fqdn(zoneName))
+	msg.SetTsig(dns.Fqdn(tsigName), dns.Fqdn(tsigAlg), 300, time.Now().Unix())
+
+	tr := new(dns.Transfer)
+	tr.TsigSecret = map[string]string{dns.Fqdn(tsigName): tsigSecret}
+
+	envChan, err := tr.In(msg, serverAddr)
+	if err != nil {
+		return nil, fmt.Errorf("ZoneTransfer: failed to start AXFR: %w", err)
+	}
+
+	var rrs []dns.RR
+	for env := range envChan {
+		if env.Error != nil {
+			return nil, fmt.Errorf("ZoneTransfer: AXFR failed: %w", env.Error)
+		}
+		rrs = append(rrs, env.RR...)
+	}
+
+	if n := len(rrs); n > 1 && rrs[n-1].Header().Rrtype == dns.TypeSOA {
+		rrs = rrs[:n-1]
+	}
+	return rrs, nil
+}
+
+// WriteZoneFile writes records as an RFC 1035 master file (BIND zone file) with
+// an $ORIGIN line. Names stay absolute, so the file reads the same wherever it
+// is loaded.
+func WriteZoneFile(w io.Writer, zoneName string, rrs []dns.RR) error {
+	if _, err := fmt.Fprintf(w, "$ORIGIN %s\n", dns.Fqdn(zoneName)); err != nil {
+		return err
+	}
+	for _, rr := range rrs {
+		if _, err := fmt.Fprintln(w, rr.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseZoneFile reads an RFC 1035 master file for zoneName. Relative names are
+// taken relative to the zone, records without a TTL get defaultTTL. $INCLUDE is
+// refused: the file comes from a client, not from this host.
+func ParseZoneFile(r io.Reader, zoneName string, defaultTTL uint32) ([]dns.RR, error) {
+	zp := dns.NewZoneParser(r, dns.Fqdn(zoneName), "")
+	zp.SetDefaultTTL(defaultTTL)
+
+	var rrs []dns.RR
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, fmt.Errorf("ParseZoneFile: %w", err)
+	}
+	return rrs, nil
+}
+
+// RecordKey identifies a record by name, type and data (not TTL), the way a
+// server tells two records of an RRset apart.
+func RecordKey(rr dns.RR) string {
+	h := rr.Header()
+	return strings.ToLower(h.Name) + " " + dns.TypeToString[h.Rrtype] + " " +
+		strings.TrimSpace(strings.TrimPrefix(rr.String(), h.String()))
+}
+
+// DiffRecords returns what turns current into desired: the records to add and
+// the ones to remove. A record whose TTL changes is in both. Both results are
+// sorted by RecordKey, so the diff reads the same on every call.
+func DiffRecords(current, desired []dns.RR) (add, remove []dns.RR) {
+	index := func(rrs []dns.RR) map[string]dns.RR {
+		m := make(map[string]dns.RR, len(rrs))
+		for _, rr := range rrs {
+			m[RecordKey(rr)] = rr
+		}
+		return m
+	}
+	have, want := index(current), index(desired)
+
+	for k, rr := range want {
+		if old, ok := have[k]; !ok || old.Header().Ttl != rr.Header().Ttl {
+			add = append(add, rr)
+		}
+	}
+	for k, rr := range have {
+		if nw, ok := want[k]; !ok || nw.Header().Ttl != rr.Header().Ttl {
+			remove = append(remove, rr)
+		}
+	}
+
+	byKey := func(rrs []dns.RR) {
+		sort.Slice(rrs, func(i, j int) bool { return RecordKey(rrs[i]) < RecordKey(rrs[j]) })
+	}
+	byKey(add)
+	byKey(remove)
+	return add, remove
+}
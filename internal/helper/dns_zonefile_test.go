@@ -0,0 +1,80 @@
+package helper
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testZoneFile = `$TTL 300
+@       IN SOA ns1.example.com. hostmaster.example.com. 1 10800 3600 604800 300
+www         IN A     192.0.2.1
+www   60    IN A     192.0.2.2
+mail        IN MX    10 mail.example.com.
+`
+
+func TestParseZoneFileResolvesRelativeNamesAndTTLs(t *testing.T) {
+	rrs, err := ParseZoneFile(strings.NewReader(testZoneFile), "example.com", 3600)
+	if err != nil {
+		t.Fatalf("ParseZoneFile failed: %v", err)
+	}
+	if len(rrs) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(rrs))
+	}
+	if h := rrs[1].Header(); h.Name != "www.example.com." || h.Ttl != 300 {
+		t.Errorf("expected www.example.com. with the $TTL of 300, got %s %d", h.Name, h.Ttl)
+	}
+	if h := rrs[2].Header(); h.Ttl != 60 {
+		t.Errorf("expected the explicit TTL of 60, got %d", h.Ttl)
+	}
+
+	if _, err := ParseZoneFile(strings.NewReader("$INCLUDE /etc/passwd\n"), "example.com", 3600); err == nil {
+		t.Error("expected $INCLUDE to be refused")
+	}
+}
+
+// An export must parse back to the same records, or it is no backup.
+func TestZoneFileRoundTrip(t *testing.T) {
+	rrs, err := ParseZoneFile(strings.NewReader(testZoneFile), "example.com", 3600)
+	if err != nil {
+		t.Fatalf("ParseZoneFile failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteZoneFile(&buf, "example.com", rrs); err != nil {
+		t.Fatalf("WriteZoneFile failed: %v", err)
+	}
+	again, err := ParseZoneFile(&buf, "example.com", 3600)
+	if err != nil {
+		t.Fatalf("parsing the export failed: %v", err)
+	}
+
+	if add, remove := DiffRecords(rrs, again); len(add) != 0 || len(remove) != 0 {
+		t.Errorf("expected no diff after a round trip, got add %v remove %v", add, remove)
+	}
+}
+
+func TestDiffRecords(t *testing.T) {
+	current, _ := ParseZoneFile(strings.NewReader(`
+www  300 IN A 192.0.2.1
+www  300 IN A 192.0.2.2
+old  300 IN TXT "bye"
+`), "example.com", 3600)
+	desired, _ := ParseZoneFile(strings.NewReader(`
+www  300 IN A 192.0.2.1
+www  60  IN A 192.0.2.2
+new  300 IN TXT "hi"
+`), "example.com", 3600)
+
+	add, remove := DiffRecords(current, desired)
+	if len(add) != 2 || len(remove) != 2 {
+		t.Fatalf("expected 2 adds and 2 removes, got %v and %v", add, remove)
+	}
+	// Sorted by key: new.example.com. before www.example.com.
+	if add[0].Header().Name != "new.example.com." || add[1].Header().Ttl != 60 {
+		t.Errorf("unexpected adds %v", add)
+	}
+	if remove[0].Header().Name != "old.example.com." || remove[1].Header().Ttl != 300 {
+		t.Errorf("unexpected removes %v", remove)
+	}
+}
@@ -23,10 +23,28 @@ func Sha1Hash(input string) string {
 
 }
 
+// TSIGKeyLengths maps the TSIG algorithms keys can be generated for to their
+// key length in bytes: the output size of the hash, as RFC 8945 recommends.
+var TSIGKeyLengths = map[string]int{
+	"hmac-sha1":   20,
+	"hmac-sha224": 28,
+	"hmac-sha256": 32,
+	"hmac-sha384": 48,
+	"hmac-sha512": 64,
+}
+
 // GenerateTSIGKeyHMACSHA512 generates a random HMAC-SHA512 key suitable for TSIG and encodes it with Base64.
 func GenerateTSIGKeyHMACSHA512() (string, error) {
-	// Define the desired length of the key (in bytes). For HMAC-SHA512, a key length of at least 32 bytes (256 bits) is recommended.
-	keyLength := 64
+	return GenerateTSIGKey("hmac-sha512")
+}
+
+// GenerateTSIGKey generates a random key for the TSIG algorithm (e.g.
+// "hmac-sha256", see TSIGKeyLengths) and encodes it with Base64.
+func GenerateTSIGKey(algorithm string) (string, error) {
+	keyLength, ok := TSIGKeyLengths[algorithm]
+	if !ok {
+		return "", fmt.Errorf("unsupported TSIG algorithm %q", algorithm)
+	}
 
 	// Create a byte slice for the key.
 	key := make([]byte, keyLength)
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/dop251/goja"
@@ -78,15 +79,19 @@ func (p *JavaScriptEngine) createRuleWrapper() func(goja.FunctionCall) goja.Valu
 
 		// Extract fields from the JavaScript object
 		req := PolicyRuleRequest{
-			ZonePattern:      toString(obj.Get("zone_pattern")),
-			ZoneSoa:          toString(obj.Get("zone_soa")),
-			TargetUserFilter: toString(obj.Get("target_user_filter")),
-			AllowSubdomains:  toBool(obj.Get("allow_subdomains")),
-			SharingAllowed:   toBool(obj.Get("sharing_allowed")),
-			Description:      toString(obj.Get("description")),
+			ZonePattern:       toString(obj.Get("zone_pattern")),
+			ZoneSoa:           toString(obj.Get("zone_soa")),
+			TargetUserFilter:  toString(obj.Get("target_user_filter")),
+			AllowSubdomains:   toBool(obj.Get("allow_subdomains")),
+			SharingAllowed:    toBool(obj.Get("sharing_allowed")),
+			Dnssec:            toBool(obj.Get("dnssec")),
+			RecordConstraints: toRecordConstraints(obj),
+			ZoneQuotas:        toZoneQuotas(obj),
+			LeaseDays:         toUint32(obj.Get("lease_days")),
+			Description:       toString(obj.Get("description")),
 		}
 
-		result, err := p.app.PolicyCreateRule(req)
+		result, err := p.app.PolicyCreateRule(context.Background(), req)
 		if err != nil {
 			return p.vm.NewGoError(err)
 		}
@@ -110,15 +115,19 @@ func (p *JavaScriptEngine) updateRuleWrapper() func(goja.FunctionCall) goja.Valu
 
 		// Extract fields from the JavaScript object
 		req := PolicyRuleRequest{
-			ZonePattern:      toString(obj.Get("zone_pattern")),
-			ZoneSoa:          toString(obj.Get("zone_soa")),
-			TargetUserFilter: toString(obj.Get("target_user_filter")),
-			AllowSubdomains:  toBool(obj.Get("allow_subdomains")),
-			SharingAllowed:   toBool(obj.Get("sharing_allowed")),
-			Description:      toString(obj.Get("description")),
+			ZonePattern:       toString(obj.Get("zone_pattern")),
+			ZoneSoa:           toString(obj.Get("zone_soa")),
+			TargetUserFilter:  toString(obj.Get("target_user_filter")),
+			AllowSubdomains:   toBool(obj.Get("allow_subdomains")),
+			SharingAllowed:    toBool(obj.Get("sharing_allowed")),
+			Dnssec:            toBool(obj.Get("dnssec")),
+			RecordConstraints: toRecordConstraints(obj),
+			ZoneQuotas:        toZoneQuotas(obj),
+			LeaseDays:         toUint32(obj.Get("lease_days")),
+			Description:       toString(obj.Get("description")),
 		}
 
-		result, err := p.app.PolicyUpdateRule(id, req)
+		result, err := p.app.PolicyUpdateRule(context.Background(), id, req)
 		if err != nil {
 			return p.vm.NewGoError(err)
 		}
@@ -136,7 +145,7 @@ func (p *JavaScriptEngine) deleteRuleWrapper() func(goja.FunctionCall) goja.Valu
 
 		id := call.Arguments[0].ToInteger()
 
-		err := p.app.PolicyDeleteRule(id)
+		err := p.app.PolicyDeleteRule(context.Background(), id)
 		if err != nil {
 			return p.vm.NewGoError(err)
 		}
@@ -257,6 +266,33 @@ func toBool(val goja.Value) bool {
 	return val.ToBoolean()
 }
 
+func toUint32(val goja.Value) uint32 {
+	if val == nil {
+		return 0
+	}
+	return uint32(val.ToInteger())
+}
+
+// toRecordConstraints reads the record constraint properties of a rule object.
+func toRecordConstraints(obj *goja.Object) RecordConstraints {
+	return RecordConstraints{
+		AllowedRecordTypes:  toString(obj.Get("allowed_record_types")),
+		AllowedNamePatterns: toString(obj.Get("allowed_name_patterns")),
+		AllowedNetworks:     toString(obj.Get("allowed_networks")),
+		MinTTL:              toUint32(obj.Get("min_ttl")),
+		MaxTTL:              toUint32(obj.Get("max_ttl")),
+	}
+}
+
+// toZoneQuotas reads the quota properties of a rule object.
+func toZoneQuotas(obj *goja.Object) ZoneQuotas {
+	return ZoneQuotas{
+		MaxZonesPerUser:   toUint32(obj.Get("max_zones_per_user")),
+		MaxSubzoneDepth:   toUint32(obj.Get("max_subzone_depth")),
+		MaxRecordsPerZone: toUint32(obj.Get("max_records_per_zone")),
+	}
+}
+
 // jsObjectToUserClaims converts a JavaScript object to UserClaims struct
 func (p *JavaScriptEngine) jsObjectToUserClaims(obj *goja.Object) *UserClaims {
 	return &UserClaims{
@@ -277,6 +313,16 @@ func (p *JavaScriptEngine) policyRuleToJSObject(rule *PolicyRule) goja.Value {
 	obj.Set("target_user_filter", rule.TargetUserFilter)
 	obj.Set("allow_subdomains", rule.AllowSubdomains)
 	obj.Set("sharing_allowed", rule.SharingAllowed)
+	obj.Set("dnssec", rule.Dnssec)
+	obj.Set("allowed_record_types", rule.AllowedRecordTypes)
+	obj.Set("allowed_name_patterns", rule.AllowedNamePatterns)
+	obj.Set("allowed_networks", rule.AllowedNetworks)
+	obj.Set("min_ttl", rule.MinTTL)
+	obj.Set("max_ttl", rule.MaxTTL)
+	obj.Set("max_zones_per_user", rule.MaxZonesPerUser)
+	obj.Set("max_subzone_depth", rule.MaxSubzoneDepth)
+	obj.Set("max_records_per_zone", rule.MaxRecordsPerZone)
+	obj.Set("lease_days", rule.LeaseDays)
 	obj.Set("description", rule.Description)
 	obj.Set("created_at", rule.CreatedAt.String())
 	return obj
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// KeyRotation is an owner's key in a graceful rotation: the new key is issued
+// next to the old one, and both are valid until CutoffAt, when the old one is
+// deleted.
+type KeyRotation struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt time.Time `json:"started_at"`
+	// Zone is lower case without trailing dot.
+	Zone       string    `gorm:"type:varchar(255);index" json:"zone"`
+	Username   string    `gorm:"type:varchar(255);index" json:"owner"`
+	OldKeyname string    `gorm:"type:varchar(255)" json:"old_keyname"`
+	NewKeyname string    `gorm:"type:varchar(255)" json:"new_keyname"`
+	CutoffAt   time.Time `gorm:"index" json:"cutoff_at"`
+}
+
+// KeyRotationStatus is the rotation state of a zone.
+type KeyRotationStatus struct {
+	Zone       string `json:"zone"`
+	InProgress bool   `json:"in_progress"`
+	// CutoffAt is when the old keys are deleted, unset when none are left.
+	CutoffAt  *time.Time    `json:"cutoff_at,omitempty"`
+	Rotations []KeyRotation `json:"rotations"`
+}
+
+// KeyRotationCreate stores a rotation.
+func (s *Storage) KeyRotationCreate(rotation *KeyRotation) error {
+	if err := s.db.Create(rotation).Error; err != nil {
+		return fmt.Errorf("storage.KeyRotationCreate: %w", err)
+	}
+	return nil
+}
+
+// KeyRotationList returns the rotations of zone in progress, only those of
+// username unless it is empty.
+func (s *Storage) KeyRotationList(zone, username string) ([]KeyRotation, error) {
+	rotations := []KeyRotation{}
+	q := s.db.Where("zone = ?", auditZone(zone))
+	if username != "" {
+		q = q.Where("username = ?", username)
+	}
+	if err := q.Order("id asc").Find(&rotations).Error; err != nil {
+		return nil, fmt.Errorf("storage.KeyRotationList: %w", err)
+	}
+	return rotations, nil
+}
+
+// KeyRotationListDue returns the rotations whose cutoff has passed at now.
+func (s *Storage) KeyRotationListDue(now time.Time) ([]KeyRotation, error) {
+	var rotations []KeyRotation
+	if err := s.db.Where("cutoff_at <= ?", now).Find(&rotations).Error; err != nil {
+		return nil, fmt.Errorf("storage.KeyRotationListDue: %w", err)
+	}
+	return rotations, nil
+}
+
+// KeyRotationDelete forgets the rotations of zone, only those of username
+// unless it is empty.
+func (s *Storage) KeyRotationDelete(zone, username string) error {
+	q := s.db.Where("zone = ?", auditZone(zone))
+	if username != "" {
+		q = q.Where("username = ?", username)
+	}
+	if err := q.Delete(&KeyRotation{}).Error; err != nil {
+		return fmt.Errorf("storage.KeyRotationDelete: %w", err)
+	}
+	return nil
+}
+
+// StartKeyRotation issues every given owner the next generation of their key
+// next to the current one, with algorithm, or the zone's current one when it
+// is empty. It returns the owners' old and new key names; an owner without a
+// key gets one and has no old key.
+func (p *PowerDnsClient) StartKeyRotation(ctx context.Context, zone string, owners []string, algorithm string) ([]KeyRotation, error) {
+	zoneFQDN := dns.Fqdn(zone)
+	if algorithm == "" {
+		algorithm = p.zoneKeyAlgorithm(ctx, zoneFQDN)
+	}
+	grants, err := p.ZoneUserKeyGrants(ctx, zoneFQDN)
+	if err != nil {
+		return nil, fmt.Errorf("StartKeyRotation: %w", err)
+	}
+
+	rotations := make([]KeyRotation, 0, len(owners))
+	for _, owner := range owners {
+		rotation := KeyRotation{Zone: auditZone(zone), Username: owner, NewKeyname: p.keyNameFor(owner, zone)}
+		if keys := p.ownerKeys(grants, owner, zone); len(keys) > 0 {
+			_, gen := keyGeneration(keys[0])
+			rotation.OldKeyname, rotation.NewKeyname = keys[0], p.ownerKeyName(owner, zone, gen+1)
+		}
+		if err := p.addUserKey(ctx, zoneFQDN, rotation.NewKeyname, algorithm); err != nil {
+			return rotations, fmt.Errorf("StartKeyRotation: %w", err)
+		}
+		rotations = append(rotations, rotation)
+	}
+	return rotations, nil
+}
+
+// keyRotationGrace is how long the old keys stay valid in a graceful rotation.
+func (app *AppData) keyRotationGrace() time.Duration {
+	return time.Duration(app.Config.ZoneDefaults.KeyRotationGraceSeconds) * time.Second
+}
+
+// zoneKeyRotationGraceful issues the owners of zone new keys next to their old
+// ones, which are deleted after the grace period.
+func (app *AppData) zoneKeyRotationGraceful(ctx context.Context, caller *UserClaims, zone string, owners []string, algorithm string) (int, any, error) {
+	pending, err := app.Storage.KeyRotationList(zone, "")
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the rotation state", fmt.Errorf("app.ZoneRotateKeys: %w", err))
+	}
+	if len(pending) > 0 {
+		return errorResult(http.StatusConflict, fmt.Sprintf("A key rotation is in progress until %s; wait for it or rotate immediately", pending[0].CutoffAt.Format(time.RFC3339)), nil)
+	}
+
+	cutoff := time.Now().Add(app.keyRotationGrace()).UTC()
+	rotations, err := app.PowerDns.StartKeyRotation(ctx, zone, owners, algorithm)
+	for i := range rotations {
+		if rotations[i].OldKeyname == "" {
+			continue
+		}
+		// Stored even when a later owner failed, so their old keys still go.
+		rotations[i].CutoffAt = cutoff
+		if err := app.Storage.KeyRotationCreate(&rotations[i]); err != nil {
+			return errorResult(http.StatusInternalServerError, "Failed to store the rotation", fmt.Errorf("app.ZoneRotateKeys: %w", err))
+		}
+	}
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to rotate keys", fmt.Errorf("app.ZoneRotateKeys: %w", err))
+	}
+
+	app.Log.Infof("app.ZoneRotateKeys: %s started rotating %d key(s) for %s, cutoff %s", caller.PreferredUsername, len(owners), zone, cutoff)
+	app.audit(ctx, AuditZoneKeysRotate, zone, zone, nil, gin.H{"owners": owners, "algorithm": algorithm, "cutoff_at": cutoff})
+	app.emit(ctx, EventZoneKeysRotated, zone, gin.H{"zone": auditZone(zone), "owners": owners, "algorithm": algorithm, "cutoff_at": cutoff})
+	return app.ZoneKeyRotationStatus(ctx, nil, zone)
+}
+
+// ZoneKeyRotationStatus returns the rotation state of zone. A nil caller skips
+// the ownership check (internal callers).
+func (app *AppData) ZoneKeyRotationStatus(ctx context.Context, caller *UserClaims, zone string) (int, any, error) {
+	if caller != nil {
+		if status, resp, err := app.requireOwner(caller.PreferredUsername, zone); err != nil {
+			return status, resp, fmt.Errorf("app.ZoneKeyRotationStatus: %w", err)
+		}
+	}
+	rotations, err := app.Storage.KeyRotationList(zone, "")
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the rotation state", fmt.Errorf("app.ZoneKeyRotationStatus: %w", err))
+	}
+	status := KeyRotationStatus{Zone: auditZone(zone), InProgress: len(rotations) > 0, Rotations: rotations}
+	if len(rotations) > 0 {
+		status.CutoffAt = &rotations[0].CutoffAt
+	}
+	return http.StatusOK, status, nil
+}
+
+// finishKeyRotations deletes the old keys of rotations past their cutoff.
+func (app *AppData) finishKeyRotations(ctx context.Context) {
+	rotations, err := app.Storage.KeyRotationListDue(time.Now())
+	if err != nil {
+		app.Log.Warnf("app.finishKeyRotations: %v", err)
+		return
+	}
+	for _, rotation := range rotations {
+		if err := app.PowerDns.DeleteZoneKey(ctx, rotation.Zone, rotation.OldKeyname); err != nil {
+			app.Log.Warnf("app.finishKeyRotations: %v", err)
+			continue
+		}
+		if err := app.Storage.KeyRotationDelete(rotation.Zone, rotation.Username); err != nil {
+			app.Log.Warnf("app.finishKeyRotations: %v", err)
+			continue
+		}
+		app.Log.Infof("app.finishKeyRotations: old key %s of %s on %s deleted", rotation.OldKeyname, rotation.Username, rotation.Zone)
+		app.audit(ctx, AuditZoneKeysRetire, rotation.Zone, rotation.Zone, rotation, gin.H{"owner": rotation.Username, "keyname": rotation.NewKeyname})
+	}
+}
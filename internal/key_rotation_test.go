@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// A graceful rotation keeps the old key valid next to the new one until the
+// cutoff, and only then deletes it.
+func TestGracefulKeyRotation(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.ZoneDefaults.KeyRotationGraceSeconds = 3600
+	fake := useFakePdns(t, app)
+	ctx := context.Background()
+	alice := &UserClaims{Email: "alice@dhbw.de", PreferredUsername: "alice@dhbw.de"}
+	const zone = "alice.users.example.com"
+	const updaters = zone + ". TSIG-ALLOW-DNSUPDATE"
+
+	if status, _, err := app.ZoneCreate(ctx, alice.PreferredUsername, ZoneResponse{Zone: zone, ZoneSOA: "users.example.com"}, ""); status != http.StatusCreated {
+		t.Fatalf("ZoneCreate: %d %v", status, err)
+	}
+	oldKey := app.PowerDns.keyNameFor(alice.PreferredUsername, zone)
+
+	status, resp, err := app.ZoneRotateKeys(ctx, alice, zone, "", false)
+	state, _ := resp.(KeyRotationStatus)
+	if status != http.StatusOK || !state.InProgress || len(state.Rotations) != 1 || state.CutoffAt == nil {
+		t.Fatalf("ZoneRotateKeys: %d %+v %v", status, resp, err)
+	}
+	newKey := state.Rotations[0].NewKeyname
+	if state.Rotations[0].OldKeyname != oldKey || newKey != oldKey+"-2" {
+		t.Fatalf("expected %s to be followed by its second generation, got %+v", oldKey, state.Rotations[0])
+	}
+	if !slices.Contains(fake.metadata[updaters], oldKey) || !slices.Contains(fake.metadata[updaters], newKey) {
+		t.Errorf("expected both keys to be granted during the grace period, got %v", fake.metadata[updaters])
+	}
+	if key, err := app.userZoneKey(ctx, alice.PreferredUsername, zone); err != nil || key.Keyname != newKey {
+		t.Errorf("expected the owner to be handed the new key, got %+v %v", key, err)
+	}
+	if drift, err := app.PowerDns.CheckZone(ctx, zone, []string{alice.PreferredUsername}); err != nil || !drift.Empty() {
+		t.Errorf("expected no drift during the rotation, got %+v %v", drift, err)
+	}
+	if report, err := app.reverseDrift(ctx); err != nil || len(report.DanglingGrants) != 0 || len(report.UnreferencedKeys) != 0 {
+		t.Errorf("expected no reverse drift during the rotation, got %+v %v", report, err)
+	}
+	if status, _, _ := app.ZoneRotateKeys(ctx, alice, zone, "", false); status != http.StatusConflict {
+		t.Errorf("expected a second rotation to conflict, got %d", status)
+	}
+
+	// Nothing happens before the cutoff.
+	app.finishKeyRotations(ctx)
+	if _, ok := fake.keys[oldKey]; !ok {
+		t.Fatalf("expected the old key to survive until the cutoff")
+	}
+	if err := app.Storage.db.Model(&KeyRotation{}).Where("1 = 1").Update("cutoff_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	app.finishKeyRotations(ctx)
+	if _, ok := fake.keys[oldKey]; ok || slices.Contains(fake.metadata[updaters], oldKey) {
+		t.Errorf("expected the old key to be deleted after the cutoff, got %v", fake.metadata[updaters])
+	}
+	if _, resp, _ := app.ZoneKeyRotationStatus(ctx, alice, zone); resp.(KeyRotationStatus).InProgress {
+		t.Errorf("expected the rotation to be finished, got %+v", resp)
+	}
+
+	_, resp, _ = app.ZoneRotateKeys(ctx, alice, zone, "", false)
+	if state := resp.(KeyRotationStatus); len(state.Rotations) != 1 || state.Rotations[0].NewKeyname != oldKey+"-3" {
+		t.Errorf("expected the next rotation to issue the third generation, got %+v", resp)
+	}
+}
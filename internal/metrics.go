@@ -0,0 +1,293 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsNamespace prefixes every metric of this service.
+const metricsNamespace = "dynamic_zones"
+
+// How often the orphaned zones are counted for the metrics: a count evaluates
+// the policy for every zone, too much for every scrape.
+const orphanCountInterval = 5 * time.Minute
+
+// The instruments below are updated wherever the measured thing happens and
+// live for the whole process. What depends on one AppData — zone and token
+// counts, orphaned zones, the DB pool — is collected per scrape by
+// appCollector instead, see metricsHandler; the orphaned zones are counted
+// by RunOrphanCount.
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	powerDnsRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "powerdns_requests_total",
+		Help:      "Calls to the PowerDNS API by operation and status code (\"error\" when no response arrived).",
+	}, []string{"operation", "code"})
+
+	powerDnsErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "powerdns_errors_total",
+		Help:      "Calls to the PowerDNS API that failed without a response or with a 5xx status, by operation.",
+	}, []string{"operation"})
+
+	upstreamUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_update_checks_total",
+		Help:      "Checks of the upstream DNS record of this nameserver by result (success, failure).",
+	}, []string{"result"})
+
+	reconcileRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_repairs_total",
+		Help:      "Zones the reconciler re-created in PowerDNS by result (success, failure).",
+	}, []string{"result"})
+
+	rfc2136Updates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rfc2136_updates_total",
+		Help:      "RFC 2136 updates the API sent to the nameserver by result (success, failure) and response code (\"none\" when no response arrived).",
+	}, []string{"result", "rcode"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		powerDnsRequests,
+		powerDnsErrors,
+		upstreamUpdates,
+		reconcileRepairs,
+		rfc2136Updates,
+	)
+}
+
+// resultLabel turns an error into the result label of a counter.
+func resultLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// countUpdate counts an RFC 2136 update the API sent, answered with msg (nil
+// when no answer arrived) and err.
+func countUpdate(msg *dns.Msg, err error) {
+	rcode := "none"
+	if msg != nil {
+		rcode = dns.RcodeToString[msg.Rcode]
+	}
+	rfc2136Updates.WithLabelValues(resultLabel(err), rcode).Inc()
+}
+
+// MetricsMiddleware records the latency and status of every request. Requests
+// that match no route share the route label "unmatched", so scanners probing
+// random paths cannot grow the label set.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// powerDnsOperation names a PowerDNS API call by method and the collections of
+// its path, leaving out the IDs: PATCH /api/v1/servers/localhost/zones/a.com./
+// is "PATCH zones", GET .../zones/a.com./metadata/X is "GET zones/metadata".
+func powerDnsOperation(r *http.Request) string {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var collections []string
+	for i := 0; i < len(segments); i += 2 {
+		if segments[i] != "servers" {
+			collections = append(collections, segments[i])
+		}
+	}
+	if len(collections) == 0 {
+		return r.Method + " servers"
+	}
+	return r.Method + " " + strings.Join(collections, "/")
+}
+
+// instrumentedTransport counts the calls the PowerDNS client makes.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t instrumentedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	operation := powerDnsOperation(r)
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		powerDnsRequests.WithLabelValues(operation, "error").Inc()
+		powerDnsErrors.WithLabelValues(operation).Inc()
+		return resp, err
+	}
+	powerDnsRequests.WithLabelValues(operation, strconv.Itoa(resp.StatusCode)).Inc()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		powerDnsErrors.WithLabelValues(operation).Inc()
+	}
+	return resp, nil
+}
+
+// newInstrumentedHTTPClient returns the HTTP client of the PowerDNS API client.
+func newInstrumentedHTTPClient() *http.Client {
+	return &http.Client{Transport: instrumentedTransport{next: http.DefaultTransport}}
+}
+
+// orphanCount is the last count of the orphaned zones, see RunOrphanCount.
+type orphanCount struct {
+	mu    sync.Mutex
+	n     int
+	known bool
+}
+
+// get returns the count, and false while there is none.
+func (o *orphanCount) get() (int, bool) {
+	if o == nil {
+		return 0, false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.n, o.known
+}
+
+// refreshOrphanCount counts the orphaned zones. A failed count leaves the
+// metric out until the next one succeeds.
+func (app *AppData) refreshOrphanCount() {
+	if app.orphans == nil {
+		return
+	}
+	orphaned, err := app.OrphanedZones()
+	app.orphans.mu.Lock()
+	defer app.orphans.mu.Unlock()
+	if err != nil {
+		app.Log.Warnf("app.refreshOrphanCount: %v", err)
+		app.orphans.known = false
+		return
+	}
+	app.orphans.n, app.orphans.known = len(orphaned), true
+}
+
+// RunOrphanCount counts the orphaned zones for the metrics every
+// orphanCountInterval until ctx ends.
+func (app *AppData) RunOrphanCount(ctx context.Context) {
+	ticker := time.NewTicker(orphanCountInterval)
+	defer ticker.Stop()
+	for {
+		app.refreshOrphanCount()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// appCollector reports what is stored, computed when Prometheus scrapes.
+type appCollector struct {
+	app *AppData
+
+	zones    *prometheus.Desc
+	tokens   *prometheus.Desc
+	orphaned *prometheus.Desc
+	up       *prometheus.Desc
+}
+
+func newAppCollector(app *AppData) *appCollector {
+	return &appCollector{
+		app:      app,
+		zones:    prometheus.NewDesc(metricsNamespace+"_zones", "Zones in the database.", nil, nil),
+		tokens:   prometheus.NewDesc(metricsNamespace+"_api_tokens", "Unexpired API tokens in the database.", nil, nil),
+		orphaned: prometheus.NewDesc(metricsNamespace+"_orphaned_zones", "Zones that no current policy grants to their owner.", nil, nil),
+		up:       prometheus.NewDesc(metricsNamespace+"_database_up", "Whether the last scrape could read the database (1) or not (0).", nil, nil),
+	}
+}
+
+func (c *appCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.zones
+	ch <- c.tokens
+	ch <- c.orphaned
+	ch <- c.up
+}
+
+// Collect leaves out a count it cannot read rather than reporting 0, which
+// would look like every zone was gone; database_up says why it is missing.
+func (c *appCollector) Collect(ch chan<- prometheus.Metric) {
+	up := 1.0
+
+	if n, err := c.app.Storage.CountZones(); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.zones, prometheus.GaugeValue, float64(n))
+	} else {
+		c.app.Log.Warnf("app.appCollector: %v", err)
+		up = 0
+	}
+
+	if n, err := c.app.Storage.CountTokens(); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.tokens, prometheus.GaugeValue, float64(n))
+	} else {
+		c.app.Log.Warnf("app.appCollector: %v", err)
+		up = 0
+	}
+
+	if n, ok := c.app.orphans.get(); ok {
+		ch <- prometheus.MustNewConstMetric(c.orphaned, prometheus.GaugeValue, float64(n))
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up)
+}
+
+// requireMetricsToken lets only requests with the bearer token through.
+func requireMetricsToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "a valid metrics token is required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// metricsHandler serves the process-wide metrics together with those of app.
+// The per-app collectors get a registry of their own, so setting up a second
+// web server (as the tests do) does not register them twice.
+func metricsHandler(app *AppData) gin.HandlerFunc {
+	appRegistry := prometheus.NewRegistry()
+	appRegistry.MustRegister(newAppCollector(app))
+	if sqlDB, err := app.Storage.db.DB(); err == nil {
+		appRegistry.MustRegister(collectors.NewDBStatsCollector(sqlDB, metricsNamespace))
+	} else {
+		app.Log.Warnf("app.metricsHandler: no database pool statistics: %v", err)
+	}
+
+	handler := promhttp.HandlerFor(prometheus.Gatherers{metricsRegistry, appRegistry}, promhttp.HandlerOpts{})
+	return gin.WrapH(handler)
+}
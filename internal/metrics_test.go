@@ -0,0 +1,82 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+func TestPowerDnsOperationLeavesOutIDs(t *testing.T) {
+	cases := map[string]string{
+		"GET /api/v1/servers/localhost/zones":                              "GET zones",
+		"PATCH /api/v1/servers/localhost/zones/example.com.":               "PATCH zones",
+		"PUT /api/v1/servers/localhost/zones/example.com./metadata/X-TEST": "PUT zones/metadata",
+		"PUT /api/v1/servers/localhost/zones/example.com./rectify":         "PUT zones/rectify",
+		"DELETE /api/v1/servers/localhost/tsigkeys/key.":                   "DELETE tsigkeys",
+		"GET /api/v1/servers/localhost":                                    "GET servers",
+	}
+	for in, want := range cases {
+		method, path, _ := strings.Cut(in, " ")
+		r := httptest.NewRequest(method, path, nil)
+		if got := powerDnsOperation(r); got != want {
+			t.Errorf("%s: expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+// The scrape needs the metrics token and reports what is stored, counting a
+// shared zone once; without any policy every zone is orphaned.
+func TestMetricsReportStoredZones(t *testing.T) {
+	app := newTestApp(t)
+	app.orphans = &orphanCount{}
+	addZone(t, app, "alice@dhbw.de", "alice.users.dhbw.site")
+	addZone(t, app, "bob@dhbw.de", "alice.users.dhbw.site")
+	addZone(t, app, "bob@dhbw.de", "bob.users.dhbw.site")
+	app.refreshOrphanCount()
+	countUpdate(&dns.Msg{MsgHdr: dns.MsgHdr{Rcode: dns.RcodeRefused}}, errors.New("refused"))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MetricsMiddleware())
+	router.GET("/metrics", requireMetricsToken("s3cret"), metricsHandler(app))
+	scrape := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if w := scrape(token); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected a scrape with token %q to be refused, got %d", token, w.Code)
+		}
+	}
+	scrape("s3cret")
+	w := scrape("s3cret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"dynamic_zones_zones 2\n",
+		"dynamic_zones_orphaned_zones 3\n",
+		"dynamic_zones_api_tokens 0\n",
+		"dynamic_zones_database_up 1\n",
+		`go_sql_max_open_connections{db_name="dynamic_zones"} 10`,
+		`dynamic_zones_http_request_duration_seconds_count{code="200",method="GET",route="/metrics"}`,
+		`dynamic_zones_rfc2136_updates_total{rcode="REFUSED",result="failure"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the scrape", want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Values of NotifyConfig.Backend.
+const (
+	NotifyBackendLog     = "log"
+	NotifyBackendSmtp    = "smtp"
+	NotifyBackendWebhook = "webhook"
+)
+
+// Values of Notification.Kind.
+const (
+	NotifyTokenExpiry  = "token.expiry"
+	NotifyLeaseExpiry  = "zone.lease.expiry"
+	NotifyZoneDisabled = "zone.lease.disabled"
+	NotifyZoneDeleted  = "zone.lease.deleted"
+)
+
+// Notification is a message to a user of the service.
+type Notification struct {
+	Kind string `json:"kind"`
+	// Recipient is the user's name, which is their e-mail address.
+	Recipient string `json:"recipient"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	// Data is the object the notification is about, for webhook receivers.
+	Data any `json:"data,omitempty"`
+}
+
+// Notifier delivers notifications to users.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// NewNotifier returns the notifier configured by cfg.
+func NewNotifier(cfg NotifyConfig, log *zap.SugaredLogger) Notifier {
+	switch cfg.Backend {
+	case NotifyBackendSmtp:
+		return &SmtpNotifier{Addr: cfg.SmtpAddr, From: cfg.SmtpFrom, Username: cfg.SmtpUsername, Password: cfg.SmtpPassword}
+	case NotifyBackendWebhook:
+		return &WebhookNotifier{URL: cfg.WebhookURL, Client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	return &LogNotifier{Log: log}
+}
+
+// LogNotifier only logs notifications: the stand-in when nothing is set up.
+type LogNotifier struct {
+	Log *zap.SugaredLogger
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, msg Notification) error {
+	n.Log.Infof("Notification (%s) to %s: %s", msg.Kind, msg.Recipient, msg.Subject)
+	return nil
+}
+
+// SmtpNotifier mails notifications to their recipient.
+type SmtpNotifier struct {
+	// Addr is the host:port of the mail server.
+	Addr string
+	From string
+	// Username and Password authenticate with PLAIN when set.
+	Username string
+	Password string
+}
+
+func (n *SmtpNotifier) Notify(ctx context.Context, msg Notification) error {
+	if !strings.Contains(msg.Recipient, "@") {
+		return fmt.Errorf("SmtpNotifier: recipient %q is not an e-mail address", msg.Recipient)
+	}
+	var auth smtp.Auth
+	if n.Username != "" {
+		host, _, _ := net.SplitHostPort(n.Addr)
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		n.From, msg.Recipient, msg.Subject, msg.Body)
+	if err := smtp.SendMail(n.Addr, auth, n.From, []string{msg.Recipient}, []byte(body)); err != nil {
+		return fmt.Errorf("SmtpNotifier: %w", err)
+	}
+	return nil
+}
+
+// WebhookNotifier posts notifications as JSON to a URL, e.g. a chat bridge
+// that knows how to reach the recipient.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, msg Notification) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("WebhookNotifier: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("WebhookNotifier: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("WebhookNotifier: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("WebhookNotifier: %s answered %s", n.URL, resp.Status)
+	}
+	return nil
+}
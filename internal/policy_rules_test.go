@@ -1,6 +1,9 @@
 package app
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 // A rule may only hand out names below its own SOA — that is what keeps a
 // delegate inside the subtree they were delegated (see validatePatternWithinSoa).
@@ -33,3 +36,25 @@ func TestPolicyRuleMustStayWithinItsSoa(t *testing.T) {
 		})
 	}
 }
+
+// Every field of a rule can be changed after it was created, also the lease.
+func TestPolicyUpdateRuleKeepsLeaseDays(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	req := PolicyRuleRequest{ZonePattern: "%u.users.example.com", ZoneSoa: "users.example.com", TargetUserFilter: "*", LeaseDays: 10}
+	rule, err := app.PolicyCreateRule(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.LeaseDays, req.MinTTL = 99, 60
+	if _, err := app.PolicyUpdateRule(ctx, int64(rule.ID), req); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := app.Storage.PolicyGetByID(rule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LeaseDays != 99 || stored.MinTTL != 60 {
+		t.Errorf("expected lease_days 99 and min_ttl 60, got %d and %d", stored.LeaseDays, stored.MinTTL)
+	}
+}
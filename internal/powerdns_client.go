@@ -2,7 +2,12 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/farberg/dynamic-zones/internal/helper"
@@ -15,6 +20,9 @@ import (
 const PowerdnsKey = "DYNAMIC_ZONES_pdns_client"
 const userKeyPrefix = "user-key-"
 
+// defaultUserTsigAlg is the algorithm of user keys unless configured otherwise.
+const defaultUserTsigAlg = "hmac-sha512"
+
 type ZoneKey struct {
 	Keyname   string `json:"keyname"`
 	Algorithm string `json:"algorithm"`
@@ -24,6 +32,8 @@ type ZoneKey struct {
 type ZoneDataResponse struct {
 	Zone     string    `json:"zone"`
 	ZoneKeys []ZoneKey `json:"zone_keys"`
+	// NamedKeys are the caller's named keys, without their secrets.
+	NamedKeys []NamedKey `json:"named_keys,omitempty"`
 }
 
 func InjectPdnsMiddleware(client *powerdns.Client) gin.HandlerFunc {
@@ -43,19 +53,30 @@ type PowerDnsClient struct {
 	defaultAdminTsigKeyName string
 	defaultAdminTsigKey     string
 	defaultAdminTsigAlg     string
+	// userTsigAlg is the algorithm of new user keys when no other is asked
+	// for and the zone has no key to follow.
+	userTsigAlg string
+	// apiKey and httpClient are what powerdns uses, for the cryptokey calls
+	// it does not offer (see cryptokeysDo).
+	apiKey     string
+	httpClient *http.Client
 }
 
 func NewPowerDnsClient(url, vhost, apiKey string, defaultTtlSecs uint32, zoneNsNames []string,
-	defaultAdminTsigKeyName, defaultAdminTsigKey, defaultAdminTsigAlg string,
+	defaultAdminTsigKeyName, defaultAdminTsigKey, defaultAdminTsigAlg, userTsigAlg string,
 	defaultUserZoneRecords []DefaultRecord,
 	defaultSoaZoneRecords []DefaultRecord,
 	log *zap.SugaredLogger) (*PowerDnsClient, error) {
-	pdns := powerdns.New(url, vhost, powerdns.WithAPIKey(apiKey))
+	httpClient := newInstrumentedHTTPClient()
+	pdns := powerdns.New(url, vhost, powerdns.WithAPIKey(apiKey), powerdns.WithHTTPClient(httpClient))
 
 	if pdns == nil {
 		log.Fatalf("app.setupPowerDns: Failed to create PowerDNS client")
 		return nil, fmt.Errorf("failed to create PowerDNS client")
 	}
+	if userTsigAlg == "" {
+		userTsigAlg = defaultUserTsigAlg
+	}
 
 	return &PowerDnsClient{
 		powerdns:                pdns,
@@ -67,6 +88,9 @@ func NewPowerDnsClient(url, vhost, apiKey string, defaultTtlSecs uint32, zoneNsN
 		defaultAdminTsigKeyName: defaultAdminTsigKeyName,
 		defaultAdminTsigKey:     defaultAdminTsigKey,
 		defaultAdminTsigAlg:     defaultAdminTsigAlg,
+		userTsigAlg:             userTsigAlg,
+		apiKey:                  apiKey,
+		httpClient:              httpClient,
 	}, nil
 
 }
@@ -79,37 +103,93 @@ func (p *PowerDnsClient) isUserKey(keyname string) bool {
 	return len(keyname) > len(userKeyPrefix) && keyname[:len(userKeyPrefix)] == userKeyPrefix
 }
 
+// ownerKeyName returns the name of generation gen of user's key on zone. The
+// first generation is keyNameFor; a graceful rotation appends "-<gen>", so the
+// old and the new key can be valid side by side.
+func (p *PowerDnsClient) ownerKeyName(user, zone string, gen int) string {
+	if gen <= 1 {
+		return p.keyNameFor(user, zone)
+	}
+	return fmt.Sprintf("%s-%d", p.keyNameFor(user, zone), gen)
+}
+
+// keyGeneration splits a user key name into the name of its first generation
+// and its generation. The hex part of a user key holds no "-".
+func keyGeneration(keyname string) (string, int) {
+	keyname = strings.TrimSuffix(keyname, ".")
+	if i := strings.LastIndex(keyname, "-"); i >= len(userKeyPrefix) {
+		if gen, err := strconv.Atoi(keyname[i+1:]); err == nil && gen > 1 {
+			return keyname[:i], gen
+		}
+	}
+	return keyname, 1
+}
+
+// ownerKeys returns the keys of user on zone among keynames, newest first.
+func (p *PowerDnsClient) ownerKeys(keynames []string, user, zone string) []string {
+	base := p.keyNameFor(user, zone)
+	keys := make([]string, 0, 1)
+	for _, keyname := range keynames {
+		if b, _ := keyGeneration(keyname); b == base {
+			keys = append(keys, strings.TrimSuffix(keyname, "."))
+		}
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		_, genA := keyGeneration(a)
+		_, genB := keyGeneration(b)
+		return genB - genA
+	})
+	return keys
+}
+
+// currentOwnerKey returns the newest key of user that zone grants updates, or
+// keyNameFor if it grants none.
+func (p *PowerDnsClient) currentOwnerKey(ctx context.Context, zone, user string) (string, error) {
+	grants, err := p.ZoneUserKeyGrants(ctx, zone)
+	if err != nil {
+		return "", fmt.Errorf("currentOwnerKey: %w", err)
+	}
+	if keys := p.ownerKeys(grants, user, zone); len(keys) > 0 {
+		return keys[0], nil
+	}
+	return p.keyNameFor(user, zone), nil
+}
+
 // GetZone returns the zone's user TSIG keys. When forUser is non-empty, ONLY that
-// user's own key (keyNameFor(forUser, zone)) is returned — so a co-owner never
+// user's own current key (see ownerKeyName) is returned — so a co-owner never
 // sees another owner's key, which is what makes owner removal an effective
 // revocation. An empty forUser returns all user keys (internal/admin callers).
 func (p *PowerDnsClient) GetZone(ctx context.Context, zone string, forUser string) (*ZoneDataResponse, error) {
 	// Get zone metadata from PowerDNS
-	zonemeta, err := p.powerdns.Metadata.Get(ctx, zone, powerdns.MetadataTSIGAllowDNSUpdate)
+	grants, err := p.updateGrants(ctx, zone)
 	if err != nil {
 		p.log.Errorf("Failed to get metadata for zone %s: %v", zone, err)
 		return nil, fmt.Errorf("failed to get metadata from PowerDNS: %v", err)
 	}
 
-	// Scope to the caller's own key when a user is given.
+	// Scope to the caller's own key when a user is given; during a graceful
+	// rotation that is the new one.
 	wantKey := ""
 	if forUser != "" {
 		wantKey = p.keyNameFor(forUser, zone)
+		if keys := p.ownerKeys(grants, forUser, zone); len(keys) > 0 {
+			wantKey = keys[0]
+		}
 	}
 
 	// Generate the response
 	response := ZoneDataResponse{
 		Zone:     zone,
-		ZoneKeys: make([]ZoneKey, 0, len(zonemeta.Metadata)),
+		ZoneKeys: make([]ZoneKey, 0, len(grants)),
 	}
 
 	// Get keys listed in the metadata
-	for _, keyname := range zonemeta.Metadata {
+	for _, keyname := range grants {
 		if !p.isUserKey(keyname) {
 			p.log.Debugf("Skipping non-user TSIG key '%s' for zone '%s'", keyname, zone)
 			continue
 		}
-		if wantKey != "" && keyname != wantKey {
+		if wantKey != "" && strings.TrimSuffix(keyname, ".") != wantKey {
 			continue // only the caller's own key
 		}
 
@@ -129,6 +209,31 @@ func (p *PowerDnsClient) GetZone(ctx context.Context, zone string, forUser strin
 	return &response, nil
 }
 
+// updateGrants returns the zone's TSIG-ALLOW-DNSUPDATE metadata together with
+// the grants a suspension withholds (see SuspendZoneUpdates).
+func (p *PowerDnsClient) updateGrants(ctx context.Context, zone string) ([]string, error) {
+	grants := make([]string, 0)
+	for _, kind := range []powerdns.MetadataKind{powerdns.MetadataTSIGAllowDNSUpdate, metadataSuspendedUpdates} {
+		metadata, err := p.powerdns.Metadata.Get(ctx, zone, kind)
+		if err != nil {
+			return nil, fmt.Errorf("getting metadata %s failed: %v", kind, err)
+		}
+		if metadata != nil {
+			grants = append(grants, metadata.Metadata...)
+		}
+	}
+	return grants, nil
+}
+
+// revokeUpdateGrant drops keyname from the zone's TSIG-ALLOW-DNSUPDATE
+// metadata and from the grants a suspension withholds.
+func (p *PowerDnsClient) revokeUpdateGrant(ctx context.Context, zone, keyname string) error {
+	if err := p.removeValueFromMetadata(ctx, zone, powerdns.MetadataTSIGAllowDNSUpdate, keyname); err != nil {
+		return err
+	}
+	return p.removeValueFromMetadata(ctx, zone, metadataSuspendedUpdates, keyname)
+}
+
 // removeValueFromMetadata rewrites a zone's metadata list of `kind`, dropping `value`.
 func (p *PowerDnsClient) removeValueFromMetadata(ctx context.Context, zone string, kind powerdns.MetadataKind, value string) error {
 	existing, err := p.powerdns.Metadata.Get(ctx, zone, kind)
@@ -147,48 +252,110 @@ func (p *PowerDnsClient) removeValueFromMetadata(ctx context.Context, zone strin
 	return err
 }
 
+// addValueToMetadata rewrites a zone's metadata list of `kind`, adding `value`
+// unless it is there already.
+func (p *PowerDnsClient) addValueToMetadata(ctx context.Context, zone string, kind powerdns.MetadataKind, value string) error {
+	existing, err := p.powerdns.Metadata.Get(ctx, zone, kind)
+	if err != nil {
+		return fmt.Errorf("getting metadata %s failed: %v", kind, err)
+	}
+	final := make([]string, 0)
+	if existing != nil && existing.Metadata != nil {
+		final = append(final, existing.Metadata...)
+	}
+	if !slices.Contains(final, value) {
+		final = append(final, value)
+	}
+	_, err = p.powerdns.Metadata.Set(ctx, zone, kind, final)
+	return err
+}
+
 // AddOwnerKey ensures `user` has their own TSIG key on `zone` (generating one if
-// absent). Idempotent — re-adding an existing owner keeps their key.
+// absent, with the algorithm of the zone's other keys). Idempotent — re-adding
+// an existing owner keeps their key.
 func (p *PowerDnsClient) AddOwnerKey(ctx context.Context, zone, user string) error {
 	zoneFQDN := dns.Fqdn(zone)
-	keyname := p.keyNameFor(user, zone)
+	keyname, err := p.currentOwnerKey(ctx, zone, user)
+	if err != nil {
+		return fmt.Errorf("AddOwnerKey: %w", err)
+	}
 
 	// Reuse the existing key if it is already present.
 	if existing, err := p.powerdns.TSIGKeys.Get(ctx, keyname); err == nil && existing != nil && existing.Key != nil && existing.Algorithm != nil {
 		return p.addKeyToZone(ctx, zoneFQDN, keyname, *existing.Algorithm, *existing.Key)
 	}
 
-	key, err := helper.GenerateTSIGKeyHMACSHA512()
+	if err := p.addUserKey(ctx, zoneFQDN, keyname, p.zoneKeyAlgorithm(ctx, zoneFQDN)); err != nil {
+		return fmt.Errorf("AddOwnerKey: %w", err)
+	}
+	return nil
+}
+
+// addUserKey generates a key with algorithm and grants it on zone.
+func (p *PowerDnsClient) addUserKey(ctx context.Context, zoneFQDN, keyname, algorithm string) error {
+	key, err := helper.GenerateTSIGKey(algorithm)
 	if err != nil {
-		return fmt.Errorf("AddOwnerKey: failed to generate TSIG key: %w", err)
+		return fmt.Errorf("failed to generate TSIG key: %w", err)
 	}
-	return p.addKeyToZone(ctx, zoneFQDN, keyname, "hmac-sha512", key)
+	return p.addKeyToZone(ctx, zoneFQDN, keyname, algorithm, key)
 }
 
-// RemoveOwnerKey deletes `user`'s TSIG key from `zone`: it is dropped from the
-// update and AXFR metadata and the key object is deleted, so it stops validating
-// immediately. Other owners' keys are untouched.
+// zoneKeyAlgorithm returns the algorithm of the first user key granted on zone,
+// or the configured one if there is none, so the owners of a zone share one.
+func (p *PowerDnsClient) zoneKeyAlgorithm(ctx context.Context, zoneFQDN string) string {
+	grants, err := p.ZoneUserKeyGrants(ctx, zoneFQDN)
+	if err != nil {
+		p.log.Debugf("No key grants readable on %s (%v), using %s", zoneFQDN, err, p.userTsigAlg)
+		return p.userTsigAlg
+	}
+	for _, keyname := range grants {
+		if key, err := p.powerdns.TSIGKeys.Get(ctx, keyname); err == nil && key.Algorithm != nil {
+			if algorithm := strings.TrimSuffix(*key.Algorithm, "."); helper.TSIGKeyLengths[algorithm] != 0 {
+				return algorithm
+			}
+		}
+	}
+	return p.userTsigAlg
+}
+
+// RemoveOwnerKey deletes `user`'s TSIG keys from `zone` — both of them during a
+// graceful rotation: they are dropped from the update and AXFR metadata and the
+// key objects are deleted, so they stop validating immediately. Other owners'
+// keys are untouched.
 func (p *PowerDnsClient) RemoveOwnerKey(ctx context.Context, zone, user string) error {
 	zoneFQDN := dns.Fqdn(zone)
-	keyname := p.keyNameFor(user, zone)
+	keynames := []string{p.keyNameFor(user, zone)}
+	if grants, err := p.ZoneUserKeyGrants(ctx, zoneFQDN); err == nil {
+		if keys := p.ownerKeys(grants, user, zone); len(keys) > 0 {
+			keynames = keys
+		}
+	}
 
-	_ = p.removeValueFromMetadata(ctx, zoneFQDN, powerdns.MetadataTSIGAllowDNSUpdate, keyname)
-	_ = p.removeValueFromMetadata(ctx, zoneFQDN, powerdns.MetadataTSIGAllowAXFR, keyname)
+	for i, keyname := range keynames {
+		_ = p.revokeUpdateGrant(ctx, zoneFQDN, keyname)
+		_ = p.removeValueFromMetadata(ctx, zoneFQDN, powerdns.MetadataTSIGAllowAXFR, keyname)
 
-	if err := p.powerdns.TSIGKeys.Delete(ctx, keyname); err != nil {
-		return fmt.Errorf("RemoveOwnerKey: failed to delete TSIG key '%s': %w", keyname, err)
+		// Only the current key must exist; an old one may be gone already.
+		if err := p.powerdns.TSIGKeys.Delete(ctx, keyname); err != nil && (i == 0 || !isPdnsNotFound(err)) {
+			return fmt.Errorf("RemoveOwnerKey: failed to delete TSIG key '%s': %w", keyname, err)
+		}
 	}
 	return nil
 }
 
 // RotateZoneKeys regenerates the TSIG key of every given owner (delete + create),
-// e.g. after a suspected key compromise. All owners must re-fetch their key.
-func (p *PowerDnsClient) RotateZoneKeys(ctx context.Context, zone string, owners []string) error {
+// e.g. after a suspected key compromise. The new keys use algorithm, or keep the
+// zone's current one when it is empty. All owners must re-fetch their key.
+func (p *PowerDnsClient) RotateZoneKeys(ctx context.Context, zone string, owners []string, algorithm string) error {
+	zoneFQDN := dns.Fqdn(zone)
+	if algorithm == "" {
+		algorithm = p.zoneKeyAlgorithm(ctx, zoneFQDN)
+	}
 	for _, owner := range owners {
 		if err := p.RemoveOwnerKey(ctx, zone, owner); err != nil {
 			return fmt.Errorf("RotateZoneKeys: %w", err)
 		}
-		if err := p.AddOwnerKey(ctx, zone, owner); err != nil {
+		if err := p.addUserKey(ctx, zoneFQDN, p.keyNameFor(owner, zone), algorithm); err != nil {
 			return fmt.Errorf("RotateZoneKeys: %w", err)
 		}
 	}
@@ -199,13 +366,13 @@ func (p *PowerDnsClient) DeleteZone(ctx context.Context, zone string, delete_all
 
 	if delete_all_keys {
 		// Get the TSIG key name from the zone metadata
-		metadata, err := p.powerdns.Metadata.Get(ctx, zone, powerdns.MetadataTSIGAllowDNSUpdate)
+		grants, err := p.updateGrants(ctx, zone)
 		if err != nil {
 			return fmt.Errorf("error getting metadata kind 'powerdns.MetadataTSIGAllowDNSUpdate' for zone %s: %v", zone, err)
 		}
 
 		// Delete the TSIG key if it's a user key
-		for _, keyname := range metadata.Metadata {
+		for _, keyname := range grants {
 			if !p.isUserKey(keyname) {
 				p.log.Debugf("Skipping non-user TSIG key deletion '%s' for zone '%s'", keyname, zone)
 				continue
@@ -226,7 +393,10 @@ func (p *PowerDnsClient) DeleteZone(ctx context.Context, zone string, delete_all
 	return nil
 }
 
-func (p *PowerDnsClient) EnsureIntermediateZoneExists(ctx context.Context, zone, nextChildZone string) error {
+// EnsureIntermediateZoneExists creates zone unless it exists and delegates
+// nextChildZone to this nameserver. With dnssec, the zone is signed, also when
+// it existed unsigned before.
+func (p *PowerDnsClient) EnsureIntermediateZoneExists(ctx context.Context, zone, nextChildZone string, dnssec bool) error {
 	// zone name as FQDN
 	zoneFQDN := dns.Fqdn(zone)
 
@@ -239,7 +409,7 @@ func (p *PowerDnsClient) EnsureIntermediateZoneExists(ctx context.Context, zone,
 
 		// Create zone via API with SOA + NS. Intermediate/base (SOA) zones get the
 		// SOA default records (e.g. the enforced CAA) — the user cannot write here.
-		zoneDef := p.prepareZoneForCreation(zoneFQDN, p.defaultSoaZoneRecords)
+		zoneDef := p.prepareZoneForCreation(zoneFQDN, p.defaultSoaZoneRecords, dnssec)
 		_, err = p.powerdns.Zones.Add(ctx, zoneDef)
 
 		if err != nil {
@@ -247,6 +417,12 @@ func (p *PowerDnsClient) EnsureIntermediateZoneExists(ctx context.Context, zone,
 		}
 	}
 
+	if dnssec {
+		if err := p.SignZone(ctx, zoneFQDN); err != nil {
+			return fmt.Errorf("EnsureIntermediateZoneExists: %w", err)
+		}
+	}
+
 	// Make sure the access rights for intermediate zone are set correctly
 	if p.defaultAdminTsigKeyName != "" && p.defaultAdminTsigKey != "" && p.defaultAdminTsigAlg != "" {
 		p.addKeyToZone(ctx, zoneFQDN, p.defaultAdminTsigKeyName, p.defaultAdminTsigAlg, p.defaultAdminTsigKey)
@@ -275,7 +451,9 @@ func (p *PowerDnsClient) EnsureIntermediateZoneExists(ctx context.Context, zone,
 	return nil
 }
 
-func (p *PowerDnsClient) CreateUserZone(ctx context.Context, user, zone string, force bool) (*ZoneDataResponse, error) {
+// CreateUserZone creates zone for user with a key of algorithm (the configured
+// one when empty). With force, a zone and key of the same name are replaced.
+func (p *PowerDnsClient) CreateUserZone(ctx context.Context, user, zone string, force, dnssec bool, algorithm string) (*ZoneDataResponse, error) {
 	// zone name as FQDN
 	zoneFQDN := dns.Fqdn(zone)
 
@@ -291,13 +469,19 @@ func (p *PowerDnsClient) CreateUserZone(ctx context.Context, user, zone string,
 	// Create zone via API with SOA + NS. User (leaf) zones get the user default
 	// records only — NOT the SOA records (e.g. CAA), which live in the base zone
 	// so the user's zone TSIG key cannot delete or override them.
-	zoneDef := p.prepareZoneForCreation(zoneFQDN, p.defaultUserZoneRecords)
+	zoneDef := p.prepareZoneForCreation(zoneFQDN, p.defaultUserZoneRecords, dnssec)
 	p.log.Debugf("Creating zone with definition: %+v", zoneDef)
 	_, err := p.powerdns.Zones.Add(ctx, zoneDef)
 	if err != nil {
 		return nil, fmt.Errorf("error creating zone: %v, definition: %+v", err, zoneDef)
 	}
 
+	if dnssec {
+		if err := p.SignZone(ctx, zoneFQDN); err != nil {
+			return nil, fmt.Errorf("failed to sign zone: %w", err)
+		}
+	}
+
 	// Add the admin TSIG key to the zone
 	if p.defaultAdminTsigKeyName != "" && p.defaultAdminTsigKey != "" && p.defaultAdminTsigAlg != "" {
 		p.log.Debugf("Adding admin TSIG key '%s' to zone '%s'", p.defaultAdminTsigKeyName, zoneFQDN)
@@ -308,14 +492,11 @@ func (p *PowerDnsClient) CreateUserZone(ctx context.Context, user, zone string,
 		}
 	}
 
-	// Generate a TSIG key
-	key, err := helper.GenerateTSIGKeyHMACSHA512()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate TSIG key: %v", err)
+	// Generate a TSIG key and assign it to the zone
+	if algorithm == "" {
+		algorithm = p.userTsigAlg
 	}
-
-	// Create (if required) and assign the TSIG key to the zone
-	err = p.addKeyToZone(ctx, zoneFQDN, keyname, "hmac-sha512", key)
+	err = p.addUserKey(ctx, zoneFQDN, keyname, algorithm)
 	if err != nil {
 		return nil, fmt.Errorf("failed to add TSIG key to zone: %v", err)
 	}
@@ -323,6 +504,198 @@ func (p *PowerDnsClient) CreateUserZone(ctx context.Context, user, zone string,
 	return p.GetZone(ctx, zone, user)
 }
 
+// isPdnsNotFound reports whether err is PowerDNS answering that the zone or
+// key does not exist, as opposed to PowerDNS not answering at all.
+func isPdnsNotFound(err error) bool {
+	var pdnsErr *powerdns.Error
+	return errors.As(err, &pdnsErr) && pdnsErr.StatusCode == http.StatusNotFound
+}
+
+// ZoneDrift is what a stored zone lacks in PowerDNS. It only lists what
+// RepairZone can add back; records are never compared.
+type ZoneDrift struct {
+	// ZoneMissing: PowerDNS does not know the zone at all.
+	ZoneMissing bool `json:"zone_missing,omitempty"`
+	// MissingKeys are the owners whose TSIG key object is gone.
+	MissingKeys []string `json:"missing_keys,omitempty"`
+	// MissingMetadata lists "KIND value" entries the zone should carry.
+	MissingMetadata []string `json:"missing_metadata,omitempty"`
+}
+
+// Empty reports whether the zone is as it should be.
+func (d *ZoneDrift) Empty() bool {
+	return !d.ZoneMissing && len(d.MissingKeys) == 0 && len(d.MissingMetadata) == 0
+}
+
+// CheckZone compares a stored zone with PowerDNS: the zone must exist, every
+// owner must have a TSIG key that may update and transfer it, and dynamic
+// updates must be allowed from anywhere (the keys restrict them). An error
+// means the check itself failed, not that something is missing.
+func (p *PowerDnsClient) CheckZone(ctx context.Context, zone string, owners []string) (*ZoneDrift, error) {
+	zoneFQDN := dns.Fqdn(zone)
+	drift := &ZoneDrift{}
+
+	if _, err := p.powerdns.Zones.Get(ctx, zoneFQDN); err != nil {
+		if isPdnsNotFound(err) {
+			drift.ZoneMissing = true
+			return drift, nil
+		}
+		return nil, fmt.Errorf("CheckZone: failed to get zone %s: %w", zoneFQDN, err)
+	}
+
+	grants, err := p.ZoneUserKeyGrants(ctx, zoneFQDN)
+	if err != nil {
+		return nil, fmt.Errorf("CheckZone: %w", err)
+	}
+
+	want := map[powerdns.MetadataKind][]string{
+		powerdns.MetadataAllowDNSUpdateFrom: {"0.0.0.0/0", "::/0"},
+	}
+	keynames := make([]string, 0, len(owners)+1)
+	for _, owner := range owners {
+		keyname := p.keyNameFor(owner, zone)
+		if keys := p.ownerKeys(grants, owner, zone); len(keys) > 0 {
+			keyname = keys[0]
+		}
+		keynames = append(keynames, keyname)
+
+		if _, err := p.powerdns.TSIGKeys.Get(ctx, keyname); err != nil {
+			if !isPdnsNotFound(err) {
+				return nil, fmt.Errorf("CheckZone: failed to get TSIG key '%s': %w", keyname, err)
+			}
+			drift.MissingKeys = append(drift.MissingKeys, owner)
+		}
+	}
+	if p.defaultAdminTsigKeyName != "" && p.defaultAdminTsigKey != "" && p.defaultAdminTsigAlg != "" {
+		keynames = append(keynames, p.defaultAdminTsigKeyName)
+	}
+	want[powerdns.MetadataTSIGAllowDNSUpdate] = keynames
+	want[powerdns.MetadataTSIGAllowAXFR] = keynames
+
+	for _, kind := range []powerdns.MetadataKind{powerdns.MetadataTSIGAllowDNSUpdate, powerdns.MetadataTSIGAllowAXFR, powerdns.MetadataAllowDNSUpdateFrom} {
+		var values []string
+		if kind == powerdns.MetadataTSIGAllowDNSUpdate {
+			// A grant a suspension withholds is not missing.
+			values, err = p.updateGrants(ctx, zoneFQDN)
+		} else {
+			var existing *powerdns.Metadata
+			if existing, err = p.powerdns.Metadata.Get(ctx, zoneFQDN, kind); existing != nil {
+				values = existing.Metadata
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CheckZone: failed to get metadata %s of %s: %w", kind, zoneFQDN, err)
+		}
+		have := make(map[string]bool)
+		for _, v := range values {
+			have[v] = true
+		}
+		for _, v := range want[kind] {
+			if !have[v] {
+				drift.MissingMetadata = append(drift.MissingMetadata, string(kind)+" "+v)
+			}
+		}
+	}
+	return drift, nil
+}
+
+// RepairZone adds back what CheckZone found missing: a missing zone is created
+// with its default records, then every owner gets their key (an existing key
+// is kept, a missing one generated) and the metadata that lets it update and
+// transfer the zone. Nothing is deleted, so an existing zone keeps its records.
+func (p *PowerDnsClient) RepairZone(ctx context.Context, zone string, owners []string, drift *ZoneDrift) error {
+	zoneFQDN := dns.Fqdn(zone)
+
+	if drift.ZoneMissing {
+		zoneDef := p.prepareZoneForCreation(zoneFQDN, p.defaultUserZoneRecords, false)
+		if _, err := p.powerdns.Zones.Add(ctx, zoneDef); err != nil {
+			return fmt.Errorf("RepairZone: failed to create zone %s: %w", zoneFQDN, err)
+		}
+	}
+
+	if p.defaultAdminTsigKeyName != "" && p.defaultAdminTsigKey != "" && p.defaultAdminTsigAlg != "" {
+		if err := p.addKeyToZone(ctx, zoneFQDN, p.defaultAdminTsigKeyName, p.defaultAdminTsigAlg, p.defaultAdminTsigKey); err != nil {
+			return fmt.Errorf("RepairZone: failed to add admin TSIG key: %w", err)
+		}
+	}
+	for _, owner := range owners {
+		if err := p.AddOwnerKey(ctx, zone, owner); err != nil {
+			return fmt.Errorf("RepairZone: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListZoneNames returns the names of all zones in PowerDNS, without trailing dot.
+func (p *PowerDnsClient) ListZoneNames(ctx context.Context) ([]string, error) {
+	zones, err := p.powerdns.Zones.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListZoneNames: %w", err)
+	}
+	names := make([]string, 0, len(zones))
+	for _, z := range zones {
+		if z.Name != nil {
+			names = append(names, strings.TrimSuffix(*z.Name, "."))
+		}
+	}
+	return names, nil
+}
+
+// ListUserKeyNames returns the names of all user TSIG keys in PowerDNS.
+func (p *PowerDnsClient) ListUserKeyNames(ctx context.Context) ([]string, error) {
+	keys, err := p.powerdns.TSIGKeys.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListUserKeyNames: %w", err)
+	}
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k.Name != nil && p.isUserKey(*k.Name) {
+			names = append(names, strings.TrimSuffix(*k.Name, "."))
+		}
+	}
+	return names, nil
+}
+
+// ZoneUserKeyGrants returns the user keys the zone's TSIG-ALLOW-DNSUPDATE
+// metadata lets update it, including those a suspension withholds.
+func (p *PowerDnsClient) ZoneUserKeyGrants(ctx context.Context, zone string) ([]string, error) {
+	metadata, err := p.updateGrants(ctx, dns.Fqdn(zone))
+	if err != nil {
+		return nil, fmt.Errorf("ZoneUserKeyGrants: %w", err)
+	}
+	grants := make([]string, 0)
+	for _, keyname := range metadata {
+		if p.isUserKey(keyname) {
+			grants = append(grants, strings.TrimSuffix(keyname, "."))
+		}
+	}
+	return grants, nil
+}
+
+// RevokeKeyGrant drops keyname from the zone's update and AXFR metadata. The
+// key itself is left alone.
+func (p *PowerDnsClient) RevokeKeyGrant(ctx context.Context, zone, keyname string) error {
+	zoneFQDN := dns.Fqdn(zone)
+	if err := p.revokeUpdateGrant(ctx, zoneFQDN, keyname); err != nil {
+		return fmt.Errorf("RevokeKeyGrant: %w", err)
+	}
+	if err := p.removeValueFromMetadata(ctx, zoneFQDN, powerdns.MetadataTSIGAllowAXFR, keyname); err != nil {
+		return fmt.Errorf("RevokeKeyGrant: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserKey deletes a user TSIG key object.
+func (p *PowerDnsClient) DeleteUserKey(ctx context.Context, keyname string) error {
+	if !p.isUserKey(keyname) {
+		return fmt.Errorf("DeleteUserKey: '%s' is not a user key", keyname)
+	}
+	if err := p.powerdns.TSIGKeys.Delete(ctx, keyname); err != nil {
+		return fmt.Errorf("DeleteUserKey: failed to delete TSIG key '%s': %w", keyname, err)
+	}
+	return nil
+}
+
 func (p *PowerDnsClient) addKeyToZone(ctx context.Context, zone, keyname, algorithm, key string) error {
 	var tsigkey *powerdns.TSIGKey
 
@@ -360,37 +733,8 @@ func (p *PowerDnsClient) addKeyToZone(ctx context.Context, zone, keyname, algori
 		}
 	}
 
-	// --- helper to append a metadata entry safely without losing the old ones ---
-	appendMetadata := func(kind powerdns.MetadataKind, value string) error {
-		// Get existing metadata (may be nil)
-		existing, err := p.powerdns.Metadata.Get(ctx, zone, kind)
-		if err != nil {
-			return fmt.Errorf("getting metadata %s failed: %v", kind, err)
-		}
-
-		// Build a unique-set list
-		final := make([]string, 0)
-		existingSet := make(map[string]bool)
-
-		// Add existing values
-		if existing != nil && existing.Metadata != nil {
-			for _, v := range existing.Metadata {
-				existingSet[v] = true
-				final = append(final, v)
-			}
-		}
-
-		// Append only if not present
-		if !existingSet[value] {
-			final = append(final, value)
-		}
-
-		_, err = p.powerdns.Metadata.Set(ctx, zone, kind, final)
-		return err
-	}
-
 	// Allow the TSIG key to perform AXFR
-	if err := appendMetadata(powerdns.MetadataTSIGAllowAXFR, *tsigkey.Name); err != nil {
+	if err := p.addValueToMetadata(ctx, zone, powerdns.MetadataTSIGAllowAXFR, *tsigkey.Name); err != nil {
 		return fmt.Errorf("powerdns.CreateZone: Error setting ALLOW-AXFR-TSIG metadata: %v", err)
 	}
 
@@ -399,15 +743,26 @@ func (p *PowerDnsClient) addKeyToZone(ctx context.Context, zone, keyname, algori
 	// that first a dynamic update has to be allowed either by the global allow-dnsupdate-from setting,
 	// or by a per-zone ALLOW-DNSUPDATE-FROM metadata setting.
 	// Secondly, if a zone has a TSIG-ALLOW-DNSUPDATE metadata setting, that must match too.
-	if err := appendMetadata(powerdns.MetadataAllowDNSUpdateFrom, "0.0.0.0/0"); err != nil {
+	if err := p.addValueToMetadata(ctx, zone, powerdns.MetadataAllowDNSUpdateFrom, "0.0.0.0/0"); err != nil {
 		return fmt.Errorf("powerdns.CreateZone: Error setting AllowDNSUpdateFrom metadata: %v", err)
 	}
-	if err := appendMetadata(powerdns.MetadataAllowDNSUpdateFrom, "::/0"); err != nil {
+	if err := p.addValueToMetadata(ctx, zone, powerdns.MetadataAllowDNSUpdateFrom, "::/0"); err != nil {
 		return fmt.Errorf("powerdns.CreateZone: Error setting AllowDNSUpdateFrom metadata: %v", err)
 	}
 
-	// Allow the TSIG key to perform dynamic updates
-	if err := appendMetadata(powerdns.MetadataTSIGAllowDNSUpdate, *tsigkey.Name); err != nil {
+	// Allow the TSIG key to perform dynamic updates; while the zone is
+	// suspended, a user key's grant is withheld with the others.
+	kind := powerdns.MetadataTSIGAllowDNSUpdate
+	if p.isUserKey(*tsigkey.Name) {
+		suspended, err := p.ZoneUpdatesSuspended(ctx, zone)
+		if err != nil {
+			return fmt.Errorf("powerdns.CreateZone: %w", err)
+		}
+		if suspended {
+			kind = metadataSuspendedUpdates
+		}
+	}
+	if err := p.addValueToMetadata(ctx, zone, kind, *tsigkey.Name); err != nil {
 		return fmt.Errorf("powerdns.CreateZone: Error setting TSIG dynamic update metadata: %v", err)
 	}
 
@@ -418,7 +773,8 @@ func (p *PowerDnsClient) addKeyToZone(ctx context.Context, zone, keyname, algori
 // default records). `records` differs by zone kind: leaf/user zones get
 // defaultUserZoneRecords, SOA/base (intermediate) zones get defaultSoaZoneRecords
 // — so e.g. the enforced CAA lives only in the base zone the user cannot write.
-func (p *PowerDnsClient) prepareZoneForCreation(zoneFQDN string, records []DefaultRecord) *powerdns.Zone {
+// With dnssec, PowerDNS is asked to sign the zone; SignZone makes sure it is.
+func (p *PowerDnsClient) prepareZoneForCreation(zoneFQDN string, records []DefaultRecord, dnssec bool) *powerdns.Zone {
 	// Build your SOA serial in YYYYMMDDnn
 	serial := time.Now().Format("20060102") + "01"
 	soaNameserver := dns.Fqdn(p.zoneNsNames[0])
@@ -478,11 +834,12 @@ func (p *PowerDnsClient) prepareZoneForCreation(zoneFQDN string, records []Defau
 	// "DEFAULT" is a valid value for SOA-EDIT-API only, and pdns logged
 	// "SOA-EDIT type 'DEFAULT' for zone <x> is unknown." on every zone access
 	// (~2400 lines/h on prod) when we set it as SOA-EDIT. SOA-EDIT affects
-	// DNSSEC-signed zones only anyway, and we create zones unsigned.
+	// DNSSEC-signed zones only, and SOA-EDIT-API already bumps the serial of
+	// those on every API change.
 	zoneDef := powerdns.Zone{
 		Name:        powerdns.String(zoneFQDN),
 		Kind:        powerdns.ZoneKindPtr(powerdns.NativeZoneKind),
-		DNSsec:      powerdns.Bool(false),
+		DNSsec:      powerdns.Bool(dnssec),
 		SOAEditAPI:  powerdns.String("DEFAULT"),
 		APIRectify:  powerdns.Bool(true),
 		Nameservers: p.zoneNsNames,
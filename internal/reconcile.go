@@ -2,94 +2,284 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How many runs the reconciler remembers for GET /v1/admin/reconcile.
+const reconcileKeepRuns = 20
+
+// Values of ReconcileRun.Trigger.
+const (
+	ReconcileTriggerSchedule = "schedule"
+	ReconcileTriggerManual   = "manual"
+)
 
-	"go.uber.org/zap"
+// Values of ReconcileFinding.Action.
+const (
+	// ReconcileActionReported: a dry run, nothing was changed.
+	ReconcileActionReported = "reported"
+	ReconcileActionRepaired = "repaired"
+	ReconcileActionFailed   = "failed"
 )
 
-type MissingOrInvalidZoneInPdns struct {
-	Zone              Zone
-	invalidInPowerDNS bool
+// errReconcileRunning is returned by Run while another run is in progress.
+var errReconcileRunning = errors.New("a reconcile run is already in progress")
+
+// ReconcileFinding is one stored zone that PowerDNS did not hold as it should.
+type ReconcileFinding struct {
+	Zone   string   `json:"zone"`
+	Owners []string `json:"owners"`
+	ZoneDrift
+	Action string `json:"action" enums:"reported,repaired,failed"`
+	// Note explains a partial repair, e.g. why a parent delegation was not restored.
+	Note  string `json:"note,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ReconcileRun is the result of one pass over all stored zones.
+type ReconcileRun struct {
+	ID      int    `json:"id"`
+	Trigger string `json:"trigger" enums:"schedule,manual"`
+	// Actor started a manual run.
+	Actor      string    `json:"actor,omitempty"`
+	DryRun     bool      `json:"dry_run"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// ZonesChecked counts the stored zones compared with PowerDNS.
+	ZonesChecked int                `json:"zones_checked"`
+	Findings     []ReconcileFinding `json:"findings"`
+	// Error is set when the run stopped early, e.g. the database was unreachable.
+	Error string `json:"error,omitempty"`
+}
+
+// Reconciler compares the stored zones with PowerDNS, on a schedule and on
+// demand, and adds back zones, TSIG keys and metadata that went missing there
+// (a restored PowerDNS backup, a zone deleted by hand). It never deletes:
+// a zone that exists keeps its records. Runs are kept in memory only.
+type Reconciler struct {
+	app      *AppData
+	interval time.Duration
+	dryRun   bool
+
+	mu      sync.Mutex
+	running bool
+	lastID  int
+	runs    []ReconcileRun // newest first
+}
+
+// NewReconciler returns the reconciler configured by app.Config.Reconcile.
+func NewReconciler(app *AppData) *Reconciler {
+	return &Reconciler{
+		app:      app,
+		interval: time.Duration(app.Config.Reconcile.IntervalSeconds) * time.Second,
+		dryRun:   app.Config.Reconcile.DryRun,
+	}
 }
 
-func Reconcile(ctx context.Context, db *Storage, powerdns *PowerDnsClient, nameservers []string, defaultTTL uint32, log *zap.SugaredLogger) error {
-	// Handle invalid and missing zones in PowerDNS
-	{
-		// Create channels for missing and invalid zones
-		ch := make(chan MissingOrInvalidZoneInPdns, 100)
-
-		// Start goroutines to check for missing and invalid zones
-		go MissingOrInvalidZonesInPdns(ctx, db, powerdns, ch, log)
-
-		// Collect results from channels
-		for {
-			select {
-			case todo := <-ch:
-				log.Debugf("Reconcile: Handling invalid (= %v) or missing zone '%s' in PowerDNS", todo.Zone.Zone, todo.invalidInPowerDNS)
-
-				// Delete zone (and keys) before re-creating it because it is invalid
-				if todo.invalidInPowerDNS {
-					err := powerdns.DeleteZone(ctx, todo.Zone.Zone, true)
-					if err != nil {
-						log.Warnf("Reconcile: Failed to delete invalid zone '%s' in PowerDNS: %v", todo.Zone, err)
-						continue
-					}
-					log.Debugf("Reconcile: Deleted invalid zone '%s' in PowerDNS", todo.Zone)
-				}
-
-				// Create Zone in PowerDNS as it is missing or invalid and has been deleted above
-				_, err := powerdns.CreateUserZone(ctx, todo.Zone.Username, todo.Zone.Zone, true)
-				if err != nil {
-					log.Warnf("Reconcile: Failed to re-create zone '%s' invalid in PowerDNS: %v", todo.Zone, err)
-					continue
-				}
-				log.Debugf("Reconcile: Re-created zone '%s' that was invalid in PowerDNS", todo.Zone)
-
-			default:
-				return nil
+// RunPeriodically runs the reconciler every interval until ctx ends. The first
+// run waits one interval, so a restart does not hit PowerDNS for every zone.
+func (r *Reconciler) RunPeriodically(ctx context.Context) {
+	log := r.app.Log
+	if r.interval <= 0 {
+		log.Info("Reconciler: no interval configured — scheduled reconcile runs are disabled.")
+		return
+	}
+	log.Infof("Reconciler: running every %s (dry run: %v)", r.interval, r.dryRun)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Run(ctx, ReconcileTriggerSchedule, r.dryRun); err != nil {
+				log.Warnf("Reconciler: %v", err)
 			}
 		}
+	}
+}
 
+// Run makes one pass over all stored zones and returns its result. Only one
+// run happens at a time; a second caller gets errReconcileRunning.
+func (r *Reconciler) Run(ctx context.Context, trigger string, dryRun bool) (*ReconcileRun, error) {
+	r.mu.Lock()
+	if r.running {
+		r.mu.Unlock()
+		return nil, errReconcileRunning
+	}
+	r.running = true
+	r.lastID++
+	run := ReconcileRun{ID: r.lastID, Trigger: trigger, DryRun: dryRun, StartedAt: time.Now(), Findings: []ReconcileFinding{}}
+	r.mu.Unlock()
+
+	if trigger == ReconcileTriggerManual {
+		run.Actor = auditActorFrom(ctx).Actor
+	}
+	if err := r.reconcile(ctx, &run); err != nil {
+		run.Error = err.Error()
 	}
+	run.FinishedAt = time.Now()
 
+	r.app.Log.Infof("Reconciler: run %d (%s, dry run: %v) checked %d zones, %d with drift, error: %q",
+		run.ID, run.Trigger, run.DryRun, run.ZonesChecked, len(run.Findings), run.Error)
+
+	r.mu.Lock()
+	r.running = false
+	r.runs = append([]ReconcileRun{run}, r.runs...)
+	if len(r.runs) > reconcileKeepRuns {
+		r.runs = r.runs[:reconcileKeepRuns]
+	}
+	r.mu.Unlock()
+	return &run, nil
+}
+
+// Runs returns the remembered runs, newest first, and whether one is in progress.
+func (r *Reconciler) Runs() ([]ReconcileRun, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ReconcileRun{}, r.runs...), r.running
 }
 
-func MissingOrInvalidZonesInPdns(ctx context.Context, db *Storage, powerdns *PowerDnsClient, out chan<- MissingOrInvalidZoneInPdns, log *zap.SugaredLogger) {
-	// Create a channel to receive zones from the database
-	ch := make(chan Zone, 100)
+// reconcile checks every stored zone, with all of its owners, and repairs
+// what is missing unless run is a dry run. A zone that cannot be checked is
+// recorded as failed and the run goes on with the next one.
+func (r *Reconciler) reconcile(ctx context.Context, run *ReconcileRun) error {
+	rows, err := r.app.Storage.ListAllZones()
+	if err != nil {
+		return fmt.Errorf("reconcile: %w", err)
+	}
 
-	// Close channels when done
-	defer close(out)
+	// ListAllZones is ordered by zone, so the owners of a zone are adjacent.
+	var zones []string
+	owners := make(map[string][]string)
+	for _, row := range rows {
+		if _, seen := owners[row.Zone]; !seen {
+			zones = append(zones, row.Zone)
+		}
+		owners[row.Zone] = append(owners[row.Zone], row.Username)
+	}
 
-	// Start a goroutine to fetch zones from the database
-	go func() {
-		if err := db.GetAllZones(ctx, ch); err != nil {
-			log.Errorf("Failed to fetch zones from database: %v", err)
+	for _, zone := range zones {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("reconcile: stopped after %d zones: %w", run.ZonesChecked, err)
 		}
-	}()
-
-	// Process zones from the channel
-	for zone := range ch {
-		// Check if the zone exists in PowerDNS. Empty forUser -> return all keys:
-		// this is the internal reconcile loop (no caller to scope to), it only needs
-		// to know whether the zone/keys exist, not a specific owner's key.
-		pdnsZone, err := powerdns.GetZone(ctx, zone.Zone, "")
+		run.ZonesChecked++
+
+		finding := ReconcileFinding{Zone: zone, Owners: owners[zone]}
+		drift, err := r.app.PowerDns.CheckZone(ctx, zone, owners[zone])
 		if err != nil {
-			out <- MissingOrInvalidZoneInPdns{Zone: zone, invalidInPowerDNS: false}
+			finding.Action, finding.Error = ReconcileActionFailed, err.Error()
+			run.Findings = append(run.Findings, finding)
 			continue
 		}
-
-		// Check if the zone is invalid in PowerDNS
-		if len(pdnsZone.ZoneKeys) == 0 {
-			out <- MissingOrInvalidZoneInPdns{Zone: zone, invalidInPowerDNS: true}
+		if drift.Empty() {
 			continue
 		}
+		finding.ZoneDrift = *drift
 
-		for _, key := range pdnsZone.ZoneKeys {
-			if key.Keyname == "" || key.Algorithm == "" || key.Key == "" {
-				out <- MissingOrInvalidZoneInPdns{Zone: zone, invalidInPowerDNS: true}
-				break
+		if run.DryRun {
+			finding.Action = ReconcileActionReported
+		} else {
+			finding.Note, err = r.repair(ctx, zone, owners[zone], drift)
+			reconcileRepairs.WithLabelValues(resultLabel(err)).Inc()
+			if err != nil {
+				finding.Action, finding.Error = ReconcileActionFailed, err.Error()
+			} else {
+				finding.Action = ReconcileActionRepaired
+				r.app.audit(ctx, AuditZoneRepair, zone, zone, nil, drift)
 			}
 		}
+		run.Findings = append(run.Findings, finding)
+	}
+	return nil
+}
+
+// repair adds back what drift lists. A zone that was missing also gets the
+// delegation from its parent restored, as far as a policy still grants it to
+// one of its owners, and is signed again if that policy asks for DNSSEC; the
+// returned note says when that was not possible.
+func (r *Reconciler) repair(ctx context.Context, zone string, owners []string, drift *ZoneDrift) (string, error) {
+	note := ""
+	var def *ZoneResponse
+	if drift.ZoneMissing {
+		note = "the zone was re-created with its default records; records written to it before are lost"
+		for _, owner := range owners {
+			allowed, d, err := r.app.PolicyIsZoneAllowedForUser(zone, &UserClaims{Email: owner, PreferredUsername: owner})
+			if err != nil {
+				return "", fmt.Errorf("reconcile: %w", err)
+			}
+			if !allowed {
+				continue
+			}
+			if err := r.app.ensureIntermediateZones(ctx, zone, getAuthoritativeZones(zone, d.ZoneSOA), d.Dnssec); err != nil {
+				return "", fmt.Errorf("reconcile: %w", err)
+			}
+			def = d
+			break
+		}
+		if def == nil {
+			note += "; no policy grants it to its owners anymore, so the delegation from its parent was not restored"
+		}
+	}
+
+	if err := r.app.PowerDns.RepairZone(ctx, zone, owners, drift); err != nil {
+		return note, err
+	}
+	// A re-created zone has new keys, the parent needs their DS.
+	if def != nil && def.Dnssec {
+		if err := r.app.PowerDns.SignZone(ctx, zone); err != nil {
+			return note, fmt.Errorf("reconcile: %w", err)
+		}
+		if err := r.app.PowerDns.PublishDS(ctx, parentZone(zone), zone); err != nil {
+			return note, fmt.Errorf("reconcile: %w", err)
+		}
+	}
+	if len(drift.MissingKeys) > 0 {
+		r.app.Log.Warnf("Reconciler: generated new TSIG keys for %v on %s; they must fetch them again", drift.MissingKeys, zone)
 	}
+	return note, nil
+}
+
+// ReconcileStatusResponse is the body of GET /v1/admin/reconcile.
+type ReconcileStatusResponse struct {
+	// IntervalSeconds between scheduled runs, 0 when they are disabled.
+	IntervalSeconds int  `json:"interval_seconds"`
+	DryRun          bool `json:"dry_run"`
+	Running         bool `json:"running"`
+	// Runs are the most recent runs, newest first.
+	Runs []ReconcileRun `json:"runs"`
+}
 
+// ReconcileStatus returns the schedule and the recent runs.
+func (app *AppData) ReconcileStatus() (int, any, error) {
+	if app.Reconciler == nil {
+		return errorResult(http.StatusServiceUnavailable, "The reconciler is not running", fmt.Errorf("app.ReconcileStatus: no reconciler"))
+	}
+	runs, running := app.Reconciler.Runs()
+	return http.StatusOK, ReconcileStatusResponse{
+		IntervalSeconds: int(app.Reconciler.interval.Seconds()),
+		DryRun:          app.Reconciler.dryRun,
+		Running:         running,
+		Runs:            runs,
+	}, nil
+}
+
+// ReconcileNow runs the reconciler and returns the run.
+func (app *AppData) ReconcileNow(ctx context.Context, dryRun bool) (int, any, error) {
+	if app.Reconciler == nil {
+		return errorResult(http.StatusServiceUnavailable, "The reconciler is not running", fmt.Errorf("app.ReconcileNow: no reconciler"))
+	}
+	run, err := app.Reconciler.Run(ctx, ReconcileTriggerManual, dryRun)
+	if errors.Is(err, errReconcileRunning) {
+		return errorResult(http.StatusConflict, "A reconcile run is already in progress", fmt.Errorf("app.ReconcileNow: %w", err))
+	}
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Reconcile failed", fmt.Errorf("app.ReconcileNow: %w", err))
+	}
+	return http.StatusOK, run, nil
 }
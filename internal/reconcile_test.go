@@ -1,8 +1,17 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/joeig/go-powerdns/v3"
 )
 
 func TestMissingZonesInPdns(t *testing.T) {
@@ -22,3 +31,218 @@ func TestMissingZonesInPdns(t *testing.T) {
 	time.Sleep(5 * time.Second)
 
 }
+
+// fakePdns is the part of the PowerDNS API the reconciler and DNSSEC use.
+type fakePdns struct {
+	mu         sync.Mutex
+	zones      map[string]bool
+	metadata   map[string][]string // "zone kind" -> values
+	keys       map[string]powerdns.TSIGKey
+	cryptokeys map[string][]powerdns.Cryptokey
+	rrsets     map[string][]string // "zone name type" -> contents
+	disabled   map[string]bool     // "zone name type" -> records disabled
+	serials    map[string]uint32
+	lastKeyID  uint64
+	deletes    int
+	failDelete bool // zone deletions fail
+}
+
+func (f *fakePdns) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	notFound := func() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(powerdns.Error{Message: "Not Found"})
+	}
+	reply := func(v any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	p := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/servers/localhost/"), "/")
+	switch {
+	case len(p) == 4 && p[2] == "cryptokeys" && r.Method == http.MethodDelete:
+		keys := f.cryptokeys[p[1]][:0]
+		for _, k := range f.cryptokeys[p[1]] {
+			if fmt.Sprint(*k.ID) != p[3] {
+				keys = append(keys, k)
+			}
+		}
+		f.cryptokeys[p[1]] = keys
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && p[0] == "zones" && f.failDelete:
+		w.WriteHeader(http.StatusInternalServerError)
+	case r.Method == http.MethodDelete:
+		f.deletes++
+		if p[0] == "zones" {
+			delete(f.zones, p[1])
+		} else {
+			delete(f.keys, p[1])
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case p[0] == "zones" && len(p) == 1 && r.Method == http.MethodGet:
+		zones := []powerdns.Zone{}
+		for name := range f.zones {
+			zones = append(zones, powerdns.Zone{Name: powerdns.String(name)})
+		}
+		reply(zones)
+	case p[0] == "tsigkeys" && len(p) == 1 && r.Method == http.MethodGet:
+		keys := []powerdns.TSIGKey{}
+		for _, k := range f.keys {
+			keys = append(keys, k)
+		}
+		reply(keys)
+	case p[0] == "zones" && len(p) == 1 && r.Method == http.MethodPost:
+		var z powerdns.Zone
+		_ = json.NewDecoder(r.Body).Decode(&z)
+		f.zones[*z.Name] = true
+		w.WriteHeader(http.StatusCreated)
+		reply(z)
+	case p[0] == "zones" && !f.zones[p[1]]:
+		notFound()
+	case p[0] == "zones" && len(p) == 2 && r.Method == http.MethodPatch:
+		var z powerdns.Zone
+		_ = json.NewDecoder(r.Body).Decode(&z)
+		for _, rrset := range z.RRsets {
+			key := p[1] + " " + *rrset.Name + " " + string(*rrset.Type)
+			delete(f.rrsets, key)
+			f.disabled[key] = false
+			for _, rec := range rrset.Records {
+				f.rrsets[key] = append(f.rrsets[key], *rec.Content)
+				f.disabled[key] = rec.Disabled != nil && *rec.Disabled
+			}
+		}
+		f.serials[p[1]]++
+		w.WriteHeader(http.StatusNoContent)
+	case p[0] == "zones" && len(p) == 2:
+		zone := powerdns.Zone{Name: &p[1], Serial: powerdns.Uint32(f.serials[p[1]])}
+		for key, contents := range f.rrsets {
+			parts := strings.Split(key, " ")
+			if parts[0] != p[1] {
+				continue
+			}
+			rrset := powerdns.RRset{Name: powerdns.String(parts[1]), Type: powerdns.RRTypePtr(powerdns.RRType(parts[2]))}
+			for _, content := range contents {
+				rrset.Records = append(rrset.Records, powerdns.Record{Content: powerdns.String(content), Disabled: powerdns.Bool(f.disabled[key])})
+			}
+			zone.RRsets = append(zone.RRsets, rrset)
+		}
+		reply(zone)
+	case p[0] == "zones" && p[2] == "cryptokeys" && r.Method == http.MethodPost:
+		var req cryptokeyRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.lastKeyID++
+		id := f.lastKeyID
+		f.cryptokeys[p[1]] = append(f.cryptokeys[p[1]], powerdns.Cryptokey{ID: &id, KeyType: &req.KeyType, Active: &req.Active,
+			DS: []string{fmt.Sprintf("%d 13 1 5A1D", id), fmt.Sprintf("%d 13 2 C0FFEE", id)}})
+		w.WriteHeader(http.StatusCreated)
+		reply(f.cryptokeys[p[1]][len(f.cryptokeys[p[1]])-1])
+	case p[0] == "zones" && p[2] == "cryptokeys" && r.Method == http.MethodPut:
+		var req cryptokeyRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		for _, k := range f.cryptokeys[p[1]] {
+			if fmt.Sprint(*k.ID) == p[3] {
+				*k.Active = req.Active
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case p[0] == "zones" && p[2] == "cryptokeys":
+		reply(append([]powerdns.Cryptokey{}, f.cryptokeys[p[1]]...))
+	case p[0] == "zones" && p[2] == "metadata" && r.Method == http.MethodPut:
+		var m powerdns.Metadata
+		_ = json.NewDecoder(r.Body).Decode(&m)
+		f.metadata[p[1]+" "+p[3]] = m.Metadata
+		reply(m)
+	case p[0] == "zones" && p[2] == "metadata":
+		reply(powerdns.Metadata{Metadata: f.metadata[p[1]+" "+p[3]]})
+	case p[0] == "tsigkeys" && r.Method == http.MethodPost:
+		var k powerdns.TSIGKey
+		_ = json.NewDecoder(r.Body).Decode(&k)
+		f.keys[*k.Name] = k
+		w.WriteHeader(http.StatusCreated)
+		reply(k)
+	case p[0] == "tsigkeys":
+		if k, ok := f.keys[p[1]]; ok {
+			reply(k)
+		} else {
+			notFound()
+		}
+	default:
+		notFound()
+	}
+}
+
+// useFakePdns points app at a fresh fakePdns.
+func useFakePdns(t *testing.T, app *AppData) *fakePdns {
+	t.Helper()
+	fake := &fakePdns{zones: map[string]bool{}, metadata: map[string][]string{}, keys: map[string]powerdns.TSIGKey{},
+		cryptokeys: map[string][]powerdns.Cryptokey{}, rrsets: map[string][]string{}, disabled: map[string]bool{}, serials: map[string]uint32{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	pdns, err := NewPowerDnsClient(server.URL, "localhost", "key", 3600, []string{"ns.example.com"}, "", "", "", "", nil, nil, app.Log)
+	if err != nil {
+		t.Fatalf("NewPowerDnsClient failed: %v", err)
+	}
+	app.PowerDns = pdns
+	return fake
+}
+
+// A repair adds back the missing zone, key and metadata, and deletes nothing:
+// the owner who still has a key keeps it.
+func TestReconcileRepairsWithoutDeleting(t *testing.T) {
+	app := newTestApp(t)
+	addZone(t, app, "alice@dhbw.de", "a.example.com")
+	addZone(t, app, "bob@dhbw.de", "a.example.com")
+	addZone(t, app, "alice@dhbw.de", "b.example.com")
+
+	fake := useFakePdns(t, app)
+	pdns := app.PowerDns
+	app.Reconciler = NewReconciler(app)
+
+	// a.example.com exists with alice's key only, b.example.com is gone.
+	aliceKey := pdns.keyNameFor("alice@dhbw.de", "a.example.com")
+	fake.zones["a.example.com."] = true
+	fake.keys[aliceKey] = powerdns.TSIGKey{Name: &aliceKey, Algorithm: powerdns.String("hmac-sha512"), Key: powerdns.String("YWxpY2U=")}
+	for _, kind := range []string{"TSIG-ALLOW-DNSUPDATE", "TSIG-ALLOW-AXFR"} {
+		fake.metadata["a.example.com. "+kind] = []string{aliceKey}
+	}
+	fake.metadata["a.example.com. ALLOW-DNSUPDATE-FROM"] = []string{"0.0.0.0/0", "::/0"}
+
+	run, err := app.Reconciler.Run(context.Background(), ReconcileTriggerManual, true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if len(run.Findings) != 2 || run.Findings[0].Action != ReconcileActionReported || len(run.Findings[0].MissingKeys) != 1 || !run.Findings[1].ZoneMissing {
+		t.Fatalf("unexpected dry run findings %+v", run.Findings)
+	}
+	if fake.zones["b.example.com."] || len(fake.keys) != 1 {
+		t.Fatal("expected a dry run to change nothing")
+	}
+
+	run, err = app.Reconciler.Run(context.Background(), ReconcileTriggerManual, false)
+	if err != nil {
+		t.Fatalf("repair run failed: %v", err)
+	}
+	for _, f := range run.Findings {
+		if f.Action != ReconcileActionRepaired {
+			t.Errorf("expected %s to be repaired, got %+v", f.Zone, f)
+		}
+	}
+	if fake.deletes != 0 {
+		t.Errorf("expected no deletes, got %d", fake.deletes)
+	}
+	if !fake.zones["b.example.com."] || len(fake.keys) != 3 || *fake.keys[aliceKey].Key != "YWxpY2U=" {
+		t.Errorf("unexpected state after repair: zones %v, %d keys", fake.zones, len(fake.keys))
+	}
+
+	run, _ = app.Reconciler.Run(context.Background(), ReconcileTriggerSchedule, false)
+	if run.ZonesChecked != 2 || len(run.Findings) != 0 {
+		t.Errorf("expected a clean run after the repair, got %+v", run)
+	}
+	if runs, _ := app.Reconciler.Runs(); len(runs) != 3 || runs[0].ID != 3 {
+		t.Errorf("expected 3 runs, newest first, got %d", len(runs))
+	}
+}
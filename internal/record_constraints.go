@@ -0,0 +1,170 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+
+	"github.com/farberg/dynamic-zones/internal/helper"
+	"github.com/miekg/dns"
+)
+
+// RecordConstraints limit what may be written into the zones a policy rule
+// governs (including subzones delegated under them). Every field is optional;
+// an empty one does not restrict anything, so existing rules keep working.
+//
+// They are enforced by this service, on the API path: the record and batch
+// endpoints, zone import, declarative records, DynDNS and rollback refuse
+// records that break them, as they do for the record quota. PowerDNS cannot
+// check them: its Lua update policy only sees name and type and replaces the
+// TSIG-ALLOW-DNSUPDATE check zone keys rely on. So the zone keys of a
+// constrained zone lose their update grants, and the API signs the updates it
+// has checked with the admin key (see directUpdatesWithheld); without an
+// admin key the grants stay, and the constraints hold on the API path only.
+type RecordConstraints struct {
+	// AllowedRecordTypes is a comma-separated list of types, e.g. "A,AAAA,TXT".
+	AllowedRecordTypes string `gorm:"type:varchar(255);default:null" json:"allowed_record_types,omitempty"`
+	// AllowedNamePatterns is a comma-separated list of glob patterns for record
+	// names relative to the zone, "@" being the apex, e.g. "@,*.k8s,_acme-challenge".
+	AllowedNamePatterns string `gorm:"type:varchar(1024);default:null" json:"allowed_name_patterns,omitempty"`
+	// AllowedNetworks is a comma-separated list of CIDRs that A and AAAA values
+	// must lie in, e.g. "10.0.0.0/8,fd00::/8".
+	AllowedNetworks string `gorm:"type:varchar(1024);default:null" json:"allowed_networks,omitempty"`
+	// MinTTL and MaxTTL bound record TTLs in seconds; 0 means no bound.
+	MinTTL uint32 `gorm:"not null;default:0" json:"min_ttl,omitempty"`
+	MaxTTL uint32 `gorm:"not null;default:0" json:"max_ttl,omitempty"`
+}
+
+// Empty reports whether rc restricts nothing.
+func (rc *RecordConstraints) Empty() bool {
+	return rc == nil || *rc == RecordConstraints{}
+}
+
+// splitList splits a comma-separated list, dropping blank entries.
+func splitList(list string) []string {
+	var out []string
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Validate checks that the constraints can be applied.
+func (rc *RecordConstraints) Validate() error {
+	for _, t := range splitList(rc.AllowedRecordTypes) {
+		if !helper.IsSupportedRecordType(t) {
+			return fmt.Errorf("allowed_record_types: %q is not a supported type (supported: %s)", t, strings.Join(helper.SupportedRecordTypes, ", "))
+		}
+	}
+	for _, p := range splitList(rc.AllowedNamePatterns) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("allowed_name_patterns: %q is not a valid pattern", p)
+		}
+	}
+	for _, n := range splitList(rc.AllowedNetworks) {
+		if _, _, err := net.ParseCIDR(n); err != nil {
+			return fmt.Errorf("allowed_networks: %q is not a CIDR", n)
+		}
+	}
+	if rc.MaxTTL != 0 && rc.MinTTL > rc.MaxTTL {
+		return fmt.Errorf("min_ttl %d is above max_ttl %d", rc.MinTTL, rc.MaxTTL)
+	}
+	return nil
+}
+
+// relativeRecordName returns a record name relative to its zone, "@" for the apex.
+func relativeRecordName(name, zoneFQDN string) string {
+	name = strings.ToLower(dns.Fqdn(name))
+	zoneFQDN = strings.ToLower(dns.Fqdn(zoneFQDN))
+	if name == zoneFQDN {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+zoneFQDN)
+}
+
+// Check reports why rr may not be written into zoneFQDN, or nil if it may.
+func (rc *RecordConstraints) Check(zoneFQDN string, rr dns.RR) error {
+	if rc == nil {
+		return nil
+	}
+	h := rr.Header()
+	recordType := dns.TypeToString[h.Rrtype]
+
+	if types := splitList(rc.AllowedRecordTypes); len(types) > 0 {
+		allowed := false
+		for _, t := range types {
+			allowed = allowed || strings.EqualFold(t, recordType)
+		}
+		if !allowed {
+			return fmt.Errorf("policy: type %s is not allowed in this zone (allowed: %s)", recordType, strings.Join(types, ", "))
+		}
+	}
+
+	if patterns := splitList(rc.AllowedNamePatterns); len(patterns) > 0 {
+		rel := relativeRecordName(h.Name, zoneFQDN)
+		allowed := false
+		for _, p := range patterns {
+			ok, _ := path.Match(strings.ToLower(p), rel)
+			allowed = allowed || ok
+		}
+		if !allowed {
+			return fmt.Errorf("policy: name %q is not allowed in this zone (allowed: %s)", rel, strings.Join(patterns, ", "))
+		}
+	}
+
+	if networks := splitList(rc.AllowedNetworks); len(networks) > 0 {
+		var ip net.IP
+		switch t := rr.(type) {
+		case *dns.A:
+			ip = t.A
+		case *dns.AAAA:
+			ip = t.AAAA
+		}
+		if ip != nil {
+			allowed := false
+			for _, n := range networks {
+				if _, cidr, err := net.ParseCIDR(n); err == nil && cidr.Contains(ip) {
+					allowed = true
+				}
+			}
+			if !allowed {
+				return fmt.Errorf("policy: address %s is not in an allowed network (allowed: %s)", ip, strings.Join(networks, ", "))
+			}
+		}
+	}
+
+	if h.Ttl < rc.MinTTL {
+		return fmt.Errorf("policy: TTL %d is below the minimum of %d", h.Ttl, rc.MinTTL)
+	}
+	if rc.MaxTTL != 0 && h.Ttl > rc.MaxTTL {
+		return fmt.Errorf("policy: TTL %d is above the maximum of %d", h.Ttl, rc.MaxTTL)
+	}
+	return nil
+}
+
+// CheckAll is Check for several records, stopping at the first violation.
+func (rc *RecordConstraints) CheckAll(zoneFQDN string, rrs []dns.RR) error {
+	for _, rr := range rrs {
+		if err := rc.Check(zoneFQDN, rr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zoneLimits returns the record constraints and quotas of the rule governing
+// zone, both nil when no rule governs it anymore (an orphaned zone keeps
+// working as it is).
+func (app *AppData) zoneLimits(zone string) (*RecordConstraints, *ZoneQuotas, error) {
+	def, err := app.zoneGoverningDef(strings.TrimSuffix(zone, "."))
+	if err != nil {
+		return nil, nil, fmt.Errorf("app.zoneLimits: %w", err)
+	}
+	if def == nil {
+		return nil, nil, nil
+	}
+	return &def.RecordConstraints, &def.ZoneQuotas, nil
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// A student zone: no NS (no re-delegation), addresses only from the lab
+// network, and no TTLs short enough to hammer the resolvers.
+func TestRecordConstraintsCheck(t *testing.T) {
+	rc := &RecordConstraints{
+		AllowedRecordTypes:  "A, AAAA, TXT, CNAME",
+		AllowedNamePatterns: "@,*.k8s,_acme-challenge*",
+		AllowedNetworks:     "10.0.0.0/8",
+		MinTTL:              60,
+	}
+	if err := rc.Validate(); err != nil {
+		t.Fatalf("expected valid constraints, got %v", err)
+	}
+
+	cases := []struct {
+		record  string
+		allowed bool
+	}{
+		{"alice.students.example. 300 IN A 10.1.2.3", true},
+		{"web.k8s.alice.students.example. 300 IN A 10.1.2.4", true},
+		{"_acme-challenge.alice.students.example. 60 IN TXT \"token\"", true},
+		{"alice.students.example. 300 IN NS ns1.elsewhere.example.", false},
+		{"alice.students.example. 300 IN A 192.0.2.1", false},
+		{"alice.students.example. 30 IN A 10.1.2.3", false},
+		{"www.alice.students.example. 300 IN A 10.1.2.3", false},
+	}
+	for _, tc := range cases {
+		rr, err := dns.NewRR(tc.record)
+		if err != nil {
+			t.Fatalf("bad test record %q: %v", tc.record, err)
+		}
+		err = rc.Check("alice.students.example.", rr)
+		if tc.allowed && err != nil {
+			t.Errorf("expected %q to be allowed, got %v", tc.record, err)
+		}
+		if !tc.allowed && err == nil {
+			t.Errorf("expected %q to be refused", tc.record)
+		}
+	}
+
+	var unrestricted *RecordConstraints
+	rr, _ := dns.NewRR("alice.students.example. 1 IN NS ns1.elsewhere.example.")
+	if err := unrestricted.Check("alice.students.example.", rr); err != nil {
+		t.Errorf("expected no constraints to allow anything, got %v", err)
+	}
+}
+
+func TestRecordConstraintsValidate(t *testing.T) {
+	for _, rc := range []RecordConstraints{
+		{AllowedRecordTypes: "A,SOA"},
+		{AllowedNamePatterns: "[k8s"},
+		{AllowedNetworks: "10.0.0.1"},
+		{MinTTL: 600, MaxTTL: 60},
+	} {
+		if err := rc.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", rc)
+		}
+	}
+}
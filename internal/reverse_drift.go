@@ -0,0 +1,347 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DanglingKeyGrant is a user key a zone's metadata lets update the zone
+// although it is not the key of any of the zone's owners.
+type DanglingKeyGrant struct {
+	Zone    string `json:"zone"`
+	Keyname string `json:"keyname"`
+}
+
+// ReverseDriftReport is what PowerDNS holds that the database does not know
+// about: the opposite direction of the reconciler.
+type ReverseDriftReport struct {
+	// ManagedSuffixes are the SOAs of the policy rules; only zones at or below
+	// them are scanned, anything else in PowerDNS is not this service's.
+	ManagedSuffixes []string `json:"managed_suffixes"`
+	// UnownedZones are zones below a managed suffix without any owner, and
+	// which are not one of the intermediate zones the service creates itself.
+	UnownedZones []string `json:"unowned_zones"`
+	// DanglingGrants are user keys in TSIG-ALLOW-DNSUPDATE that belong to no owner of the zone.
+	DanglingGrants []DanglingKeyGrant `json:"dangling_grants"`
+	// UnreferencedKeys are user keys that belong to no stored zone and owner.
+	UnreferencedKeys []string `json:"unreferenced_keys"`
+}
+
+// AdoptZoneRequest is the body of POST /v1/admin/drift/zones/{zone}/adopt.
+type AdoptZoneRequest struct {
+	Owners []string `json:"owners" binding:"required,min=1"`
+}
+
+// driftInventory is what the database says PowerDNS should hold.
+type driftInventory struct {
+	suffixes []string
+	// owners of each stored zone, by lower-case zone name
+	owners map[string][]string
+	// expected holds the name of every key a stored zone and owner should have,
+	// named keys included
+	expected map[string]bool
+	// expectedOn holds "zone keyname" for every key a zone should grant
+	expectedOn map[string]bool
+}
+
+// driftInventory reads the policy suffixes and the stored zones.
+func (app *AppData) driftInventory() (*driftInventory, error) {
+	rules, err := app.Storage.PolicyGetAll()
+	if err != nil {
+		return nil, err
+	}
+	inv := &driftInventory{owners: map[string][]string{}, expected: map[string]bool{}, expectedOn: map[string]bool{}}
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		if soa := auditZone(rule.ZoneSoa); soa != "" && !seen[soa] {
+			seen[soa] = true
+			inv.suffixes = append(inv.suffixes, soa)
+		}
+	}
+	sort.Strings(inv.suffixes)
+
+	rows, err := app.Storage.ListAllZones()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		zone := auditZone(row.Zone)
+		keyname := app.PowerDns.keyNameFor(row.Username, row.Zone)
+		inv.owners[zone] = append(inv.owners[zone], row.Username)
+		inv.expected[keyname] = true
+		inv.expectedOn[zone+" "+keyname] = true
+	}
+
+	namedKeys, err := app.Storage.NamedKeyListAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range namedKeys {
+		inv.expected[key.Keyname] = true
+		inv.expectedOn[key.Zone+" "+key.Keyname] = true
+	}
+	return inv, nil
+}
+
+// knows reports whether a stored zone and owner needs keyname. Every
+// generation of an owner's key counts, so a graceful rotation is no drift.
+func (inv *driftInventory) knows(keyname string) bool {
+	base, _ := keyGeneration(keyname)
+	return inv.expected[base]
+}
+
+// grants reports whether zone should grant keyname, any generation of it.
+func (inv *driftInventory) grants(zone, keyname string) bool {
+	base, _ := keyGeneration(keyname)
+	return inv.expectedOn[zone+" "+base]
+}
+
+// managed reports whether zone is at or below one of the managed suffixes.
+func (inv *driftInventory) managed(zone string) bool {
+	for _, suffix := range inv.suffixes {
+		if zone == suffix || isSubdomainOf(zone, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// infrastructure reports whether zone is one the service keeps without an
+// owner: a managed suffix itself, or an intermediate zone above a stored zone.
+func (inv *driftInventory) infrastructure(zone string) bool {
+	for _, suffix := range inv.suffixes {
+		if zone == suffix {
+			return true
+		}
+	}
+	for stored := range inv.owners {
+		if isSubdomainOf(stored, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// reverseDrift scans PowerDNS for zones, grants and keys the database does
+// not account for. It reads the metadata of every managed zone, so it is an
+// on-demand admin tool rather than something to run on a schedule.
+func (app *AppData) reverseDrift(ctx context.Context) (*ReverseDriftReport, error) {
+	inv, err := app.driftInventory()
+	if err != nil {
+		return nil, fmt.Errorf("app.reverseDrift: %w", err)
+	}
+	pdnsZones, err := app.PowerDns.ListZoneNames(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("app.reverseDrift: %w", err)
+	}
+	sort.Strings(pdnsZones)
+
+	report := &ReverseDriftReport{
+		ManagedSuffixes:  inv.suffixes,
+		UnownedZones:     []string{},
+		DanglingGrants:   []DanglingKeyGrant{},
+		UnreferencedKeys: []string{},
+	}
+	for _, name := range pdnsZones {
+		zone := auditZone(name)
+		if !inv.managed(zone) {
+			continue
+		}
+		if _, stored := inv.owners[zone]; !stored && !inv.infrastructure(zone) {
+			// Its grants go with it when it is adopted or collected.
+			report.UnownedZones = append(report.UnownedZones, zone)
+			continue
+		}
+
+		grants, err := app.PowerDns.ZoneUserKeyGrants(ctx, zone)
+		if err != nil {
+			return nil, fmt.Errorf("app.reverseDrift: %w", err)
+		}
+		for _, keyname := range grants {
+			if !inv.grants(zone, keyname) {
+				report.DanglingGrants = append(report.DanglingGrants, DanglingKeyGrant{Zone: zone, Keyname: keyname})
+			}
+		}
+	}
+
+	keys, err := app.PowerDns.ListUserKeyNames(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("app.reverseDrift: %w", err)
+	}
+	sort.Strings(keys)
+	for _, keyname := range keys {
+		if !inv.knows(keyname) {
+			report.UnreferencedKeys = append(report.UnreferencedKeys, keyname)
+		}
+	}
+	return report, nil
+}
+
+// ReverseDrift returns the reverse drift report.
+func (app *AppData) ReverseDrift(ctx context.Context) (int, any, error) {
+	report, err := app.reverseDrift(ctx)
+	if err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to scan PowerDNS", err)
+	}
+	return http.StatusOK, report, nil
+}
+
+// checkUnownedZone reports whether zone is one adopt and collect may act on:
+// managed, in PowerDNS, without owner and not an intermediate zone.
+func (app *AppData) checkUnownedZone(ctx context.Context, zone string) (int, string, error) {
+	inv, err := app.driftInventory()
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to read the stored zones", err
+	}
+	if !inv.managed(zone) {
+		return http.StatusBadRequest, "The zone is not below the SOA of any policy rule", fmt.Errorf("%s not managed", zone)
+	}
+	if _, stored := inv.owners[zone]; stored {
+		return http.StatusConflict, "The zone has owners", fmt.Errorf("%s has owners", zone)
+	}
+	if inv.infrastructure(zone) {
+		return http.StatusConflict, "The zone is a SOA or intermediate zone the service maintains", fmt.Errorf("%s is infrastructure", zone)
+	}
+	drift, err := app.PowerDns.CheckZone(ctx, zone, nil)
+	if err != nil {
+		return http.StatusBadGateway, "Failed to look up the zone in PowerDNS", err
+	}
+	if drift.ZoneMissing {
+		return http.StatusNotFound, "The zone does not exist in PowerDNS", fmt.Errorf("%s not in PowerDNS", zone)
+	}
+	return http.StatusOK, "", nil
+}
+
+// AdoptZone makes owners the owners of a zone that exists in PowerDNS but not
+// in the database. Each owner gets their own key; keys the zone granted
+// before remain and show up as dangling grants until revoked.
+func (app *AppData) AdoptZone(ctx context.Context, zone string, owners []string) (int, any, error) {
+	zone = auditZone(zone)
+	if status, msg, err := app.checkUnownedZone(ctx, zone); err != nil {
+		return errorResult(status, msg, fmt.Errorf("app.AdoptZone: %w", err))
+	}
+
+	refreshTime := time.Now().Add(time.Duration(app.RefreshTime) * time.Second)
+	adopted := make([]string, 0, len(owners))
+	for _, owner := range owners {
+		owner = strings.TrimSpace(owner)
+		if owner == "" {
+			continue
+		}
+		if err := app.PowerDns.AddOwnerKey(ctx, zone, owner); err != nil {
+			return errorResult(http.StatusBadGateway, "Failed to create the TSIG key of "+owner, fmt.Errorf("app.AdoptZone: %w", err))
+		}
+		if _, err := app.Storage.CreateZone(owner, zone, refreshTime); err != nil {
+			return errorResult(http.StatusInternalServerError, "Failed to store the zone", fmt.Errorf("app.AdoptZone: %w", err))
+		}
+		adopted = append(adopted, owner)
+	}
+	if len(adopted) == 0 {
+		return errorResult(http.StatusBadRequest, "At least one owner is required", fmt.Errorf("app.AdoptZone: no owners"))
+	}
+	if err := app.syncZoneUpdateGrants(ctx, zone); err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to withhold the update grants of the zone", fmt.Errorf("app.AdoptZone: %w", err))
+	}
+
+	app.audit(ctx, AuditZoneAdopt, zone, zone, nil, gin.H{"owners": adopted})
+	return http.StatusOK, gin.H{"zone": zone, "owners": adopted}, nil
+}
+
+// CollectZone deletes an unowned zone from PowerDNS, and with it the user keys
+// it granted that no stored zone needs.
+func (app *AppData) CollectZone(ctx context.Context, zone string) (int, any, error) {
+	zone = auditZone(zone)
+	if status, msg, err := app.checkUnownedZone(ctx, zone); err != nil {
+		return errorResult(status, msg, fmt.Errorf("app.CollectZone: %w", err))
+	}
+	grants, err := app.PowerDns.ZoneUserKeyGrants(ctx, zone)
+	if err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to read the zone's keys", fmt.Errorf("app.CollectZone: %w", err))
+	}
+	inv, err := app.driftInventory()
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the stored zones", fmt.Errorf("app.CollectZone: %w", err))
+	}
+
+	if err := app.PowerDns.DeleteZone(ctx, zone, false); err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to delete the zone", fmt.Errorf("app.CollectZone: %w", err))
+	}
+	deleted := make([]string, 0, len(grants))
+	for _, keyname := range grants {
+		if inv.knows(keyname) {
+			continue
+		}
+		if err := app.PowerDns.DeleteUserKey(ctx, keyname); err != nil {
+			app.Log.Warnf("app.CollectZone: %v", err)
+			continue
+		}
+		deleted = append(deleted, keyname)
+	}
+
+	app.audit(ctx, AuditZoneCollect, zone, zone, gin.H{"keys": grants}, nil)
+	return http.StatusOK, gin.H{"zone": zone, "deleted_keys": deleted}, nil
+}
+
+// RevokeDanglingGrant drops a dangling grant from the zone's metadata.
+func (app *AppData) RevokeDanglingGrant(ctx context.Context, zone, keyname string) (int, any, error) {
+	zone = auditZone(zone)
+	inv, err := app.driftInventory()
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the stored zones", fmt.Errorf("app.RevokeDanglingGrant: %w", err))
+	}
+	if !inv.managed(zone) || !app.PowerDns.isUserKey(keyname) {
+		return errorResult(http.StatusBadRequest, "Only user keys on managed zones can be revoked here", fmt.Errorf("app.RevokeDanglingGrant: %s on %s", keyname, zone))
+	}
+	if inv.grants(zone, keyname) {
+		return errorResult(http.StatusConflict, "The key belongs to an owner of the zone; remove the owner instead", fmt.Errorf("app.RevokeDanglingGrant: %s owned on %s", keyname, zone))
+	}
+	if err := app.PowerDns.RevokeKeyGrant(ctx, zone, keyname); err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to revoke the key", fmt.Errorf("app.RevokeDanglingGrant: %w", err))
+	}
+
+	app.audit(ctx, AuditZoneGrantRevoke, zone+"/grants/"+keyname, zone, gin.H{"keyname": keyname}, nil)
+	return http.StatusNoContent, nil, nil
+}
+
+// DeleteUnreferencedKey deletes a user key no stored zone and owner needs,
+// after revoking it on every managed zone that still grants it.
+func (app *AppData) DeleteUnreferencedKey(ctx context.Context, keyname string) (int, any, error) {
+	inv, err := app.driftInventory()
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the stored zones", fmt.Errorf("app.DeleteUnreferencedKey: %w", err))
+	}
+	if !app.PowerDns.isUserKey(keyname) {
+		return errorResult(http.StatusBadRequest, "Only user keys can be deleted here", fmt.Errorf("app.DeleteUnreferencedKey: %s", keyname))
+	}
+	if inv.knows(keyname) {
+		return errorResult(http.StatusConflict, "The key belongs to a zone owner", fmt.Errorf("app.DeleteUnreferencedKey: %s referenced", keyname))
+	}
+
+	report, err := app.reverseDrift(ctx)
+	if err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to scan PowerDNS", fmt.Errorf("app.DeleteUnreferencedKey: %w", err))
+	}
+	for _, grant := range report.DanglingGrants {
+		if grant.Keyname != keyname {
+			continue
+		}
+		if err := app.PowerDns.RevokeKeyGrant(ctx, grant.Zone, keyname); err != nil {
+			return errorResult(http.StatusBadGateway, "Failed to revoke the key on "+grant.Zone, fmt.Errorf("app.DeleteUnreferencedKey: %w", err))
+		}
+	}
+	if err := app.PowerDns.DeleteUserKey(ctx, keyname); err != nil {
+		if isPdnsNotFound(err) {
+			return errorResult(http.StatusNotFound, "No such key", fmt.Errorf("app.DeleteUnreferencedKey: %w", err))
+		}
+		return errorResult(http.StatusBadGateway, "Failed to delete the key", fmt.Errorf("app.DeleteUnreferencedKey: %w", err))
+	}
+
+	app.audit(ctx, AuditTsigKeyDelete, "tsigkey/"+keyname, "", gin.H{"keyname": keyname}, nil)
+	return http.StatusNoContent, nil, nil
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+// The SOA and intermediate zones are the service's own; an unknown zone below
+// them is reported, adopted with a key per owner, and its stale key then shows
+// up as a dangling grant.
+func TestReverseDriftFindsAndAdoptsUnownedZones(t *testing.T) {
+	app := newTestApp(t)
+	if _, err := app.Storage.PolicyCreate(&PolicyRule{ZonePattern: "%u.users.example.com", ZoneSoa: "example.com", TargetUserFilter: "*"}); err != nil {
+		t.Fatalf("PolicyCreate failed: %v", err)
+	}
+	addZone(t, app, "alice@dhbw.de", "alice.users.example.com")
+	fake := useFakePdns(t, app)
+	ctx := context.Background()
+
+	stale := "user-key-stale"
+	for _, zone := range []string{"example.com.", "users.example.com.", "alice.users.example.com.", "lost.users.example.com.", "other.org."} {
+		fake.zones[zone] = true
+	}
+	fake.keys[stale] = powerdns.TSIGKey{Name: powerdns.String(stale), Algorithm: powerdns.String("hmac-sha512"), Key: powerdns.String("c3RhbGU=")}
+	fake.metadata["lost.users.example.com. TSIG-ALLOW-DNSUPDATE"] = []string{stale}
+
+	report, err := app.reverseDrift(ctx)
+	if err != nil {
+		t.Fatalf("reverseDrift failed: %v", err)
+	}
+	if len(report.UnownedZones) != 1 || report.UnownedZones[0] != "lost.users.example.com" {
+		t.Errorf("expected only lost.users.example.com to be unowned, got %v", report.UnownedZones)
+	}
+	if len(report.UnreferencedKeys) != 1 || report.UnreferencedKeys[0] != stale {
+		t.Errorf("expected the stale key to be unreferenced, got %v", report.UnreferencedKeys)
+	}
+
+	if status, _, err := app.AdoptZone(ctx, "users.example.com", []string{"bob@dhbw.de"}); status != http.StatusConflict {
+		t.Errorf("expected an intermediate zone not to be adoptable, got %d (%v)", status, err)
+	}
+	if status, _, err := app.AdoptZone(ctx, "lost.users.example.com", []string{"bob@dhbw.de"}); err != nil {
+		t.Fatalf("AdoptZone failed: %d %v", status, err)
+	}
+	if owns, _ := app.Storage.IsZoneOwner("bob@dhbw.de", "lost.users.example.com"); !owns {
+		t.Error("expected bob to own the adopted zone")
+	}
+
+	report, err = app.reverseDrift(ctx)
+	if err != nil {
+		t.Fatalf("reverseDrift failed: %v", err)
+	}
+	if len(report.UnownedZones) != 0 || len(report.DanglingGrants) != 1 || report.DanglingGrants[0].Keyname != stale {
+		t.Fatalf("expected only the stale grant after adopting, got %+v", report)
+	}
+
+	if status, _, err := app.DeleteUnreferencedKey(ctx, stale); status != http.StatusNoContent {
+		t.Fatalf("DeleteUnreferencedKey failed: %d %v", status, err)
+	}
+	if _, ok := fake.keys[stale]; ok || len(fake.metadata["lost.users.example.com. TSIG-ALLOW-DNSUPDATE"]) != 1 {
+		t.Errorf("expected the stale key to be gone and bob's grant to stay, got %v", fake.metadata["lost.users.example.com. TSIG-ALLOW-DNSUPDATE"])
+	}
+}
@@ -0,0 +1,369 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAdminApiGroup adds the super-admin operations under /v1/admin.
+func CreateAdminApiGroup(v1 *gin.RouterGroup, app *AppData) *gin.RouterGroup {
+	group := v1.Group("/admin")
+	group.Use(requireSuperAdmin(app))
+
+	group.GET("/reconcile", getReconcileStatus(app))
+	group.POST("/reconcile", runReconcile(app))
+
+	group.GET("/drift", getReverseDrift(app))
+	group.POST("/drift/zones/:zone/adopt", adoptZone(app))
+	group.DELETE("/drift/zones/:zone", collectZone(app))
+	group.DELETE("/drift/zones/:zone/grants/:keyname", revokeDanglingGrant(app))
+	group.DELETE("/drift/keys/:keyname", deleteUnreferencedKey(app))
+
+	group.GET("/webhooks", listWebhooks(app))
+	group.POST("/webhooks", createWebhook(app))
+	group.PUT("/webhooks/:id", updateWebhook(app))
+	group.DELETE("/webhooks/:id", deleteWebhook(app))
+	group.GET("/webhooks/:id/deliveries", listWebhookDeliveries(app))
+
+	return group
+}
+
+// requireSuperAdmin refuses everyone but super-admins.
+func requireSuperAdmin(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		if !isSuperAdmin(app, user) {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: "Only super admins can use the admin API"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// getReconcileStatus returns the reconciler schedule and its recent runs.
+// @Summary Get reconcile runs
+// @Description Returns the reconcile schedule and the most recent runs, newest first. A run compares every stored zone with PowerDNS and lists what PowerDNS lacks: the zone itself, owners' TSIG keys, or the metadata that lets a key update and transfer the zone. Super-admins only.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} ReconcileStatusResponse "Schedule and recent runs"
+// @Failure 403 {object} ErrorResponse "Caller is not a super admin"
+// @Failure 503 {object} ErrorResponse "The reconciler is not running"
+// @Security ApiKeyAuth
+// @ID getReconcileStatus
+// @Router /v1/admin/reconcile [get]
+func getReconcileStatus(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, resp, err := app.ReconcileStatus()
+		if err != nil {
+			app.Log.Error("getReconcileStatus failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// runReconcile runs the reconciler now.
+// @Summary Run the reconciler
+// @Description Compares every stored zone with PowerDNS now and adds back missing zones, TSIG keys and metadata. Existing zones keep their records; a missing zone is re-created with its default records. With dry_run=true only the drift is reported. Super-admins only.
+// @Tags admin
+// @Produce json
+// @Param dry_run query bool false "Only report drift, change nothing"
+// @Success 200 {object} ReconcileRun "The run"
+// @Failure 403 {object} ErrorResponse "Caller is not a super admin"
+// @Failure 409 {object} ErrorResponse "A run is already in progress"
+// @Failure 503 {object} ErrorResponse "The reconciler is not running"
+// @Security ApiKeyAuth
+// @ID runReconcile
+// @Router /v1/admin/reconcile [post]
+func runReconcile(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun := c.Query("dry_run") == "true"
+
+		// A client giving up must not leave a run half done.
+		ctx := context.WithoutCancel(c.Request.Context())
+		status, resp, err := app.ReconcileNow(ctx, dryRun)
+		if err != nil {
+			app.Log.Error("runReconcile failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// getReverseDrift scans PowerDNS for what the database does not know about.
+// @Summary Scan for reverse drift
+// @Description Lists what PowerDNS holds below the SOAs of the policy rules that the database does not account for: zones without any owner (created directly in PowerDNS, or left behind by a database restore), user keys a zone grants although they belong to none of its owners, and user keys that belong to no stored zone at all. The SOA and intermediate zones the service creates itself are not reported. Reads the metadata of every managed zone. Super-admins only.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} ReverseDriftReport "Reverse drift"
+// @Failure 403 {object} ErrorResponse "Caller is not a super admin"
+// @Failure 502 {object} ErrorResponse "PowerDNS could not be scanned"
+// @Security ApiKeyAuth
+// @ID getReverseDrift
+// @Router /v1/admin/drift [get]
+func getReverseDrift(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, resp, err := app.ReverseDrift(c.Request.Context())
+		if err != nil {
+			app.Log.Error("getReverseDrift failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// adoptZone gives an unowned zone owners.
+// @Summary Adopt an unowned zone
+// @Description Stores a zone that exists in PowerDNS without an owner and gives each owner their own TSIG key. Records are kept. Keys the zone granted before stay until revoked as dangling grants. Super-admins only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param zone path string true "Name of the zone"
+// @Param request body AdoptZoneRequest true "Owners"
+// @Success 200 {object} map[string]any "Zone and owners"
+// @Failure 400 {object} ErrorResponse "Invalid request or zone outside the managed SOAs"
+// @Failure 403 {object} ErrorResponse "Caller is not a super admin"
+// @Failure 404 {object} ErrorResponse "Zone not in PowerDNS"
+// @Failure 409 {object} ErrorResponse "Zone has owners or is maintained by the service"
+// @Failure 502 {object} ErrorResponse "PowerDNS failed"
+// @Security ApiKeyAuth
+// @ID adoptZone
+// @Router /v1/admin/drift/zones/{zone}/adopt [post]
+func adoptZone(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req AdoptZoneRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request: " + err.Error()})
+			return
+		}
+		status, resp, err := app.AdoptZone(c.Request.Context(), c.Param("zone"), req.Owners)
+		if err != nil {
+			app.Log.Error("adoptZone failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// collectZone deletes an unowned zone.
+// @Summary Garbage-collect an unowned zone
+// @Description Deletes a zone without owner from PowerDNS with all of its records, and the user keys it granted that no stored zone needs. Super-admins only.
+// @Tags admin
+// @Produce json
+// @Param zone path string true "Name of the zone"
+// @Success 200 {object} map[string]any "Zone and deleted keys"
+// @Failure 400 {object} ErrorResponse "Zone outside the managed SOAs"
+// @Failure 403 {object} ErrorResponse "Caller is not a super admin"
+// @Failure 404 {object} ErrorResponse "Zone not in PowerDNS"
+// @Failure 409 {object} ErrorResponse "Zone has owners or is maintained by the service"
+// @Failure 502 {object} ErrorResponse "PowerDNS failed"
+// @Security ApiKeyAuth
+// @ID collectZone
+// @Router /v1/admin/drift/zones/{zone} [delete]
+func collectZone(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, resp, err := app.CollectZone(c.Request.Context(), c.Param("zone"))
+		if err != nil {
+			app.Log.Error("collectZone failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// revokeDanglingGrant revokes a key a zone grants to none of its owners.
+// @Summary Revoke a dangling key grant
+// @Description Removes a user key from a zone's TSIG-ALLOW-DNSUPDATE and TSIG-ALLOW-AXFR metadata when it is not the key of an owner of the zone. The key itself is not deleted. Super-admins only.
+// @Tags admin
+// @Param zone path string true "Name of the zone"
+// @Param keyname path string true "Name of the TSIG key"
+// @Success 204 "Grant revoked"
+// @Failure 400 {object} ErrorResponse "Not a user key or zone outside the managed SOAs"
+// @Failure 403 {object} ErrorResponse "Caller is not a super admin"
+// @Failure 409 {object} ErrorResponse "The key belongs to an owner of the zone"
+// @Failure 502 {object} ErrorResponse "PowerDNS failed"
+// @Security ApiKeyAuth
+// @ID revokeDanglingGrant
+// @Router /v1/admin/drift/zones/{zone}/grants/{keyname} [delete]
+func revokeDanglingGrant(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, resp, err := app.RevokeDanglingGrant(c.Request.Context(), c.Param("zone"), c.Param("keyname"))
+		if err != nil {
+			app.Log.Error("revokeDanglingGrant failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// deleteUnreferencedKey deletes a user key no zone owner needs.
+// @Summary Delete an unreferenced key
+// @Description Deletes a user TSIG key that belongs to no stored zone and owner, after revoking it on every managed zone that still grants it. Super-admins only.
+// @Tags admin
+// @Param keyname path string true "Name of the TSIG key"
+// @Success 204 "Key deleted"
+// @Failure 400 {object} ErrorResponse "Not a user key"
+// @Failure 403 {object} ErrorResponse "Caller is not a super admin"
+// @Failure 404 {object} ErrorResponse "No such key"
+// @Failure 409 {object} ErrorResponse "The key belongs to a zone owner"
+// @Failure 502 {object} ErrorResponse "PowerDNS failed"
+// @Security ApiKeyAuth
+// @ID deleteUnreferencedKey
+// @Router /v1/admin/drift/keys/{keyname} [delete]
+func deleteUnreferencedKey(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, resp, err := app.DeleteUnreferencedKey(c.Request.Context(), c.Param("keyname"))
+		if err != nil {
+			app.Log.Error("deleteUnreferencedKey failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// webhookID parses the :id parameter, answering 400 when it is not a number.
+func webhookID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid webhook ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// listWebhooks lists the outgoing webhooks.
+// @Summary List webhooks
+// @Description Lists the outgoing webhooks, without their secrets. Super-admins only.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} Webhook "Webhooks"
+// @Failure 403 {object} ErrorResponse "Caller is not a super admin"
+// @Security ApiKeyAuth
+// @ID listWebhooks
+// @Router /v1/admin/webhooks [get]
+func listWebhooks(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, resp, err := app.WebhookListAll()
+		if err != nil {
+			app.Log.Error("listWebhooks failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// createWebhook adds an outgoing webhook.
+// @Summary Create a webhook
+// @Description Adds a URL that events are POSTed to as JSON: zone.create, zone.delete, zone.orphaned, zone.owner.add, zone.owner.remove, zone.keys.rotate and policy.rule.create/update/delete. events limits them, each exact or a prefix ending in "."; empty sends all. Every delivery is signed in the X-Dynamic-Zones-Signature header with "sha256=" and the hex HMAC-SHA256 of the body keyed with the secret, which is generated unless given and only returned here. Failed deliveries are retried with exponential backoff. Super-admins only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body WebhookRequest true "Webhook"
+// @Success 201 {object} WebhookCreated "The webhook and its secret"
+// @Failure 400 {object} ErrorResponse "Invalid URL or events"
+// @Failure 403 {object} ErrorResponse "Caller is not a super admin"
+// @Security ApiKeyAuth
+// @ID createWebhook
+// @Router /v1/admin/webhooks [post]
+func createWebhook(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req WebhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request: " + err.Error()})
+			return
+		}
+		status, resp, err := app.WebhookAdd(c.Request.Context(), req)
+		if err != nil {
+			app.Log.Error("createWebhook failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// updateWebhook changes an outgoing webhook.
+// @Summary Change a webhook
+// @Description Replaces the URL, events, description and enabled flag of a webhook. An empty secret keeps the current one. Deliveries queued for a disabled webhook fail. Super-admins only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param request body WebhookRequest true "Webhook"
+// @Success 200 {object} Webhook "The webhook"
+// @Failure 400 {object} ErrorResponse "Invalid URL or events"
+// @Failure 403 {object} ErrorResponse "Caller is not a super admin"
+// @Failure 404 {object} ErrorResponse "No such webhook"
+// @Security ApiKeyAuth
+// @ID updateWebhook
+// @Router /v1/admin/webhooks/{id} [put]
+func updateWebhook(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+		var req WebhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request: " + err.Error()})
+			return
+		}
+		status, resp, err := app.WebhookChange(c.Request.Context(), id, req)
+		if err != nil {
+			app.Log.Error("updateWebhook failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// deleteWebhook deletes an outgoing webhook.
+// @Summary Delete a webhook
+// @Description Deletes a webhook with its queued and past deliveries. Super-admins only.
+// @Tags admin
+// @Param id path int true "Webhook ID"
+// @Success 204 "Webhook deleted"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 403 {object} ErrorResponse "Caller is not a super admin"
+// @Failure 404 {object} ErrorResponse "No such webhook"
+// @Security ApiKeyAuth
+// @ID deleteWebhook
+// @Router /v1/admin/webhooks/{id} [delete]
+func deleteWebhook(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+		status, resp, err := app.WebhookRemove(c.Request.Context(), id)
+		if err != nil {
+			app.Log.Error("deleteWebhook failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// listWebhookDeliveries lists the latest deliveries of a webhook.
+// @Summary List webhook deliveries
+// @Description Lists the latest deliveries to a webhook, newest first: pending ones with their next attempt, delivered and failed ones with the last error. Super-admins only.
+// @Tags admin
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param limit query int false "Maximum number of deliveries (default 100, at most 1000)"
+// @Success 200 {array} WebhookDelivery "Deliveries"
+// @Failure 400 {object} ErrorResponse "Invalid ID or limit"
+// @Failure 403 {object} ErrorResponse "Caller is not a super admin"
+// @Failure 404 {object} ErrorResponse "No such webhook"
+// @Security ApiKeyAuth
+// @ID listWebhookDeliveries
+// @Router /v1/admin/webhooks/{id}/deliveries [get]
+func listWebhookDeliveries(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit < 1 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and 1000"})
+			return
+		}
+		status, resp, err := app.WebhookDeliveries(id, limit)
+		if err != nil {
+			app.Log.Error("listWebhookDeliveries failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
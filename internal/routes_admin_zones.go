@@ -0,0 +1,288 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAdminZonesApiGroup adds the zone management of admins under
+// /v1/admin/zones. Super-admins manage every zone, delegated admins the zones
+// at or below the suffixes delegated to them.
+func CreateAdminZonesApiGroup(v1 *gin.RouterGroup, app *AppData) *gin.RouterGroup {
+	group := v1.Group("/admin/zones")
+	group.Use(requireZoneAdmin(app))
+
+	group.GET("", listAdminZones(app))
+	group.GET("/:zone", getAdminZone(app))
+	group.DELETE("/:zone", deleteAdminZone(app))
+	group.POST("/:zone/owners", addAdminZoneOwner(app))
+	group.DELETE("/:zone/owners/:owner", removeAdminZoneOwner(app))
+	group.POST("/:zone/transfer", transferAdminZone(app))
+	group.POST("/:zone/disable", setAdminZoneDisabled(app, true))
+	group.POST("/:zone/enable", setAdminZoneDisabled(app, false))
+	group.POST("/:zone/keys/rotate", rotateAdminZoneKeys(app))
+
+	return group
+}
+
+// requireZoneAdmin refuses everyone but super-admins and delegated admins.
+func requireZoneAdmin(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		scopes, err := app.auditScopes(user)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to check permissions"})
+			return
+		}
+		if scopes != nil && len(scopes) == 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: "Only super admins and delegated admins can manage zones"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ZoneTransferRequest is the body of POST /v1/admin/zones/{zone}/transfer.
+type ZoneTransferRequest struct {
+	Email string `json:"email" binding:"required" example:"bob@example.com"`
+}
+
+// listAdminZones lists the zones an admin manages.
+// @Summary List zones as an admin
+// @Description Lists every stored zone with all of its owners, sorted by name. Super-admins see every zone; delegated admins see the zones at or below the zone suffixes delegated to them.
+// @Tags admin
+// @Produce json
+// @Param q query string false "Only zones whose name contains this"
+// @Param owner query string false "Only zones with an owner whose name contains this"
+// @Param limit query int false "At most this many zones (default 100, max 1000)"
+// @Param offset query int false "Skip this many zones"
+// @Success 200 {object} AdminZonesResponse "Zones"
+// @Failure 400 {object} ErrorResponse "Invalid filter"
+// @Failure 403 {object} ErrorResponse "Caller is neither a super admin nor a delegated admin"
+// @Security ApiKeyAuth
+// @ID listAdminZones
+// @Router /v1/admin/zones [get]
+func listAdminZones(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		filter := AdminZoneFilter{Query: c.Query("q"), Owner: c.Query("owner"), Limit: adminZonesDefaultLimit}
+
+		var err error
+		if v := c.Query("limit"); v != "" {
+			if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 1 || filter.Limit > adminZonesMaxLimit {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid limit, expected 1 to " + strconv.Itoa(adminZonesMaxLimit)})
+				return
+			}
+		}
+		if v := c.Query("offset"); v != "" {
+			if filter.Offset, err = strconv.Atoi(v); err != nil || filter.Offset < 0 {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid offset"})
+				return
+			}
+		}
+
+		status, resp, err := app.AdminZoneList(c.Request.Context(), user, filter)
+		if err != nil {
+			app.Log.Error("listAdminZones failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// getAdminZone returns a zone with its owners and lease.
+// @Summary Get a zone as an admin
+// @Description Returns a stored zone with all of its owners, its lease and whether it is disabled. Super-admins and the delegated admins of the zone only.
+// @Tags admin
+// @Produce json
+// @Param zone path string true "Name of the zone"
+// @Success 200 {object} AdminZone "The zone"
+// @Failure 403 {object} ErrorResponse "Zone not delegated to the caller"
+// @Failure 404 {object} ErrorResponse "Zone not stored"
+// @Security ApiKeyAuth
+// @ID getAdminZone
+// @Router /v1/admin/zones/{zone} [get]
+func getAdminZone(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		status, resp, err := app.AdminZoneGet(c.Request.Context(), user, c.Param("zone"))
+		if err != nil {
+			app.Log.Error("getAdminZone failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// deleteAdminZone deletes a zone for all of its owners.
+// @Summary Delete a zone as an admin
+// @Description Deletes a zone for all of its owners, as an owner would: records and owners go to the trash, from where it can be restored. A zone with subzones is refused. Super-admins and the delegated admins of the zone only.
+// @Tags admin
+// @Param zone path string true "Name of the zone"
+// @Success 204 "Zone deleted"
+// @Failure 403 {object} ErrorResponse "Zone not delegated to the caller"
+// @Failure 404 {object} ErrorResponse "Zone not stored"
+// @Failure 409 {object} ErrorResponse "Zone still has subzones"
+// @Security ApiKeyAuth
+// @ID deleteAdminZone
+// @Router /v1/admin/zones/{zone} [delete]
+func deleteAdminZone(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		status, resp, err := app.AdminZoneDelete(c.Request.Context(), user, c.Param("zone"))
+		if err != nil {
+			app.Log.Error("deleteAdminZone failed: ", err)
+		}
+		if status == http.StatusNoContent {
+			c.Status(status)
+			return
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// addAdminZoneOwner adds an owner to a zone.
+// @Summary Add a zone owner as an admin
+// @Description Makes a user an owner of a zone (own row and TSIG key) and of the zones delegated below it, whether or not the zone may be shared or a rule grants it to them. Super-admins and the delegated admins of the zone only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param zone path string true "Name of the zone"
+// @Param request body AddOwnerRequest true "The new owner"
+// @Success 200 {object} map[string]any "The owners"
+// @Failure 400 {object} ErrorResponse "Invalid email"
+// @Failure 403 {object} ErrorResponse "Zone not delegated to the caller"
+// @Failure 404 {object} ErrorResponse "Zone not stored"
+// @Security ApiKeyAuth
+// @ID addAdminZoneOwner
+// @Router /v1/admin/zones/{zone}/owners [post]
+func addAdminZoneOwner(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		var req AddOwnerRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request: " + err.Error()})
+			return
+		}
+		status, resp, err := app.AdminZoneAddOwner(c.Request.Context(), user, c.Param("zone"), req.Email)
+		if err != nil {
+			app.Log.Error("addAdminZoneOwner failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// removeAdminZoneOwner removes an owner from a zone.
+// @Summary Remove a zone owner as an admin
+// @Description Takes a zone and the zones delegated below it from an owner: their row, TSIG key and named keys. The last owner cannot be removed; transfer or delete the zone instead. Super-admins and the delegated admins of the zone only.
+// @Tags admin
+// @Produce json
+// @Param zone path string true "Name of the zone"
+// @Param owner path string true "The owner"
+// @Success 200 {object} map[string]any "The owners"
+// @Failure 403 {object} ErrorResponse "Zone not delegated to the caller"
+// @Failure 404 {object} ErrorResponse "Zone not stored or not an owner"
+// @Failure 409 {object} ErrorResponse "The last owner"
+// @Security ApiKeyAuth
+// @ID removeAdminZoneOwner
+// @Router /v1/admin/zones/{zone}/owners/{owner} [delete]
+func removeAdminZoneOwner(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		status, resp, err := app.AdminZoneRemoveOwner(c.Request.Context(), user, c.Param("zone"), c.Param("owner"))
+		if err != nil {
+			app.Log.Error("removeAdminZoneOwner failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// transferAdminZone gives a zone a new sole owner.
+// @Summary Transfer a zone
+// @Description Makes a user the only owner of a zone: they get a TSIG key of the zone and the zones delegated below it, and all other owners lose theirs. Super-admins and the delegated admins of the zone only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param zone path string true "Name of the zone"
+// @Param request body ZoneTransferRequest true "The new owner"
+// @Success 200 {object} map[string]any "The owners"
+// @Failure 400 {object} ErrorResponse "Invalid email"
+// @Failure 403 {object} ErrorResponse "Zone not delegated to the caller"
+// @Failure 404 {object} ErrorResponse "Zone not stored"
+// @Security ApiKeyAuth
+// @ID transferAdminZone
+// @Router /v1/admin/zones/{zone}/transfer [post]
+func transferAdminZone(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		var req ZoneTransferRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request: " + err.Error()})
+			return
+		}
+		status, resp, err := app.AdminZoneTransfer(c.Request.Context(), user, c.Param("zone"), req.Email)
+		if err != nil {
+			app.Log.Error("transferAdminZone failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// setAdminZoneDisabled disables or enables the records of a zone.
+// @Summary Disable or enable a zone
+// @Description Disable suspends a zone: its records are disabled in PowerDNS until an admin enables them, and the owners cannot enable them by renewing. Enable lifts the suspension; the records of a zone whose lease expired stay disabled until it is renewed. Super-admins and the delegated admins of the zone only.
+// @Tags admin
+// @Produce json
+// @Param zone path string true "Name of the zone"
+// @Param action path string true "disable or enable" Enums(disable, enable)
+// @Success 200 {object} AdminZone "The zone"
+// @Failure 403 {object} ErrorResponse "Zone not delegated to the caller"
+// @Failure 404 {object} ErrorResponse "Zone not stored"
+// @Failure 502 {object} ErrorResponse "PowerDNS failed"
+// @Security ApiKeyAuth
+// @ID setAdminZoneDisabled
+// @Router /v1/admin/zones/{zone}/{action} [post]
+func setAdminZoneDisabled(app *AppData, disabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		status, resp, err := app.AdminZoneSetDisabled(c.Request.Context(), user, c.Param("zone"), disabled)
+		if err != nil {
+			app.Log.Error("setAdminZoneDisabled failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// rotateAdminZoneKeys rotates the TSIG keys of a zone on behalf of its owners.
+// @Summary Rotate zone keys as an admin
+// @Description Regenerates the TSIG key of one owner of a zone, or of all owners, as the owners' own rotation does: gracefully next to the old keys when a grace period is configured, at once with immediate. Super-admins and the delegated admins of the zone only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param zone path string true "Name of the zone"
+// @Param request body AdminZoneRotateRequest false "Owner, algorithm and mode"
+// @Success 200 {object} KeyRotationStatus "Rotation state (graceful), or the number of rotated keys (immediate)"
+// @Failure 400 {object} ErrorResponse "Algorithm not allowed"
+// @Failure 403 {object} ErrorResponse "Zone not delegated to the caller"
+// @Failure 404 {object} ErrorResponse "Zone not stored or not an owner"
+// @Failure 409 {object} ErrorResponse "A rotation is in progress"
+// @Security ApiKeyAuth
+// @ID rotateAdminZoneKeys
+// @Router /v1/admin/zones/{zone}/keys/rotate [post]
+func rotateAdminZoneKeys(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		var req AdminZoneRotateRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request: " + err.Error()})
+				return
+			}
+		}
+		status, resp, err := app.AdminZoneRotateKeys(c.Request.Context(), user, c.Param("zone"), req)
+		if err != nil {
+			app.Log.Error("rotateAdminZoneKeys failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -24,11 +25,15 @@ type TokensResponse struct {
 
 type CreateTokenRequest struct {
 	ReadOnly bool `json:"read_only"`
+	// TTLHours is the token's lifetime, the configured default when 0.
+	TTLHours int `json:"ttl_hours,omitempty"`
+	// Zones, scopes and addresses the token is limited to.
+	TokenScope
 }
 
 // getTokens retrieves all tokens for the authenticated user
 // @Summary List API tokens
-// @Description Retrieve all API tokens for the authenticated user
+// @Description Retrieve all API tokens for the authenticated user, with their zones, scopes, allowed addresses and when and from where they were last used
 // @Tags tokens
 // @Produce json
 // @Success 200 {object} TokensResponse
@@ -52,6 +57,8 @@ func getTokens(app *AppData) gin.HandlerFunc {
 			return
 		}
 
+		app.TokenUsage.Apply(tokens)
+
 		// Create tokenresponse
 		var tokenResponse TokensResponse
 		tokenResponse.Tokens = tokens
@@ -66,10 +73,13 @@ func getTokens(app *AppData) gin.HandlerFunc {
 
 // createToken creates a new API token for the authenticated user
 // @Summary Create a new API token
-// @Description Generate a new API token for the authenticated user with TTL defined in configuration
+// @Description Generate a new API token for the authenticated user with TTL defined in configuration, or ttl_hours up to the configured maximum. Optional comma-separated lists limit it: zones (each with its subzones), scopes (records:write, zones:create, tokens:manage, policy:read; a token with scopes may only read its zones and do what they name) and allowed_ips (addresses and CIDRs). A token created with a token inherits that token's limits and cannot outlive it.
 // @Tags tokens
+// @Accept json
 // @Produce json
+// @Param request body CreateTokenRequest false "Token options"
 // @Success 201 {object} Token
+// @Failure 400 {object} map[string]string "Invalid options, or wider than the calling token"
 // @Failure 500 {object} map[string]string "Failed to retrieve tokens"
 // @Security ApiKeyAuth
 // @ID createToken
@@ -78,7 +88,6 @@ func createToken(app *AppData) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		user := c.MustGet(UserDataKey).(*UserClaims)
-		ttl := time.Duration(app.Config.WebServer.ApiTokenTTLHours) * time.Hour
 
 		app.Log.Debug("-------------------------------------------------------------------------------")
 		app.Log.Debug("🚀 Create token called for user: ", user.PreferredUsername)
@@ -91,7 +100,25 @@ func createToken(app *AppData) gin.HandlerFunc {
 		}
 		app.Log.Debug("Create token request with readonly =", input.ReadOnly)
 
-		token, err := app.Storage.CreateToken(ctx, user.PreferredUsername, ttl, input.ReadOnly)
+		ttl, err := app.apiTokenTTL(input.TTLHours)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := input.TokenScope.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// A token cannot hand out more than it holds itself.
+		if parent := requestToken(c); parent != nil {
+			if err := input.TokenScope.Narrow(&parent.TokenScope); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			ttl = min(ttl, time.Until(parent.ExpiresAt))
+		}
+
+		token, err := app.Storage.CreateToken(ctx, user.PreferredUsername, ttl, input.ReadOnly, input.TokenScope)
 		if err != nil {
 			app.Log.Errorf("Error creating token for user %s: %v", user.PreferredUsername, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
@@ -99,6 +126,9 @@ func createToken(app *AppData) gin.HandlerFunc {
 		}
 
 		app.Log.Debugf("Created token for user: %s", user.PreferredUsername)
+		// The token's metadata only: TokenString is the credential.
+		app.audit(ctx, AuditTokenCreate, fmt.Sprintf("token/%d", token.ID), "", nil, gin.H{
+			"token_prefix": token.TokenPrefix, "read_only": token.ReadOnly, "scope": token.TokenScope, "expires_at": token.ExpiresAt})
 		c.JSON(http.StatusCreated, gin.H{"status": "success", "token": token})
 	}
 }
@@ -138,6 +168,9 @@ func deleteToken(app *AppData) gin.HandlerFunc {
 		}
 
 		app.Log.Debugf("Deleted token %d, returning %s", tokenId, returnValue)
+		if statusCode == http.StatusOK {
+			app.audit(ctx, AuditTokenDelete, fmt.Sprintf("token/%d", tokenId), "", nil, nil)
+		}
 		c.JSON(statusCode, returnValue)
 	}
 }
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page size of GET /v1/audit.
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+// AuditEventsResponse is the body of GET /v1/audit.
+type AuditEventsResponse struct {
+	Events []AuditEvent `json:"events"`
+}
+
+// CreateAuditApiGroup adds the /v1/audit endpoint to the API.
+func CreateAuditApiGroup(v1 *gin.RouterGroup, app *AppData) *gin.RouterGroup {
+	v1.GET("/audit", listAuditEvents(app))
+	return v1
+}
+
+// auditScopes returns the zone suffixes whose events user may read: nil (all)
+// for super-admins, the suffixes of their delegations for delegated admins,
+// and an empty list for everyone else.
+func (app *AppData) auditScopes(user *UserClaims) ([]string, error) {
+	if isSuperAdmin(app, user) {
+		return nil, nil
+	}
+	delegations, err := app.Storage.DelegationGetAll()
+	if err != nil {
+		return nil, err
+	}
+	scopes := make([]string, 0)
+	for _, d := range delegations {
+		if ok, _ := userCanAccessRule(user.Email, d.TargetUserFilter); ok {
+			scopes = append(scopes, d.ZoneSuffix)
+		}
+	}
+	return scopes, nil
+}
+
+// listAuditEvents lists audit events.
+// @Summary List audit events
+// @Description Lists recorded mutations, newest first: who (actor, auth method, API token ID) did what (action) to which object (target, zone), with the object before and after and the request ID. Super-admins see every event; delegated admins see the events at or below the zone suffixes delegated to them.
+// @Tags audit
+// @Produce json
+// @Param actor query string false "Only events of this actor"
+// @Param action query string false "Only this action, or actions starting with it when it ends in a dot (e.g. zone.)"
+// @Param zone query string false "Only events of this zone and the zones below it"
+// @Param since query string false "Only events at or after this time (RFC 3339)"
+// @Param until query string false "Only events before this time (RFC 3339)"
+// @Param limit query int false "At most this many events (default 100, max 1000)"
+// @Success 200 {object} AuditEventsResponse "Audit events"
+// @Failure 400 {object} ErrorResponse "Invalid filter"
+// @Failure 403 {object} ErrorResponse "Caller is neither a super admin nor a delegated admin"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @ID listAuditEvents
+// @Router /v1/audit [get]
+func listAuditEvents(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+
+		scopes, err := app.auditScopes(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to check permissions"})
+			return
+		}
+		if scopes != nil && len(scopes) == 0 {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Only super admins and delegated admins can read the audit log"})
+			return
+		}
+
+		filter := AuditFilter{
+			Actor:  c.Query("actor"),
+			Action: c.Query("action"),
+			Zone:   c.Query("zone"),
+			Limit:  auditDefaultLimit,
+			Scopes: scopes,
+		}
+		for param, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+			if v := c.Query(param); v != "" {
+				if *t, err = time.Parse(time.RFC3339, v); err != nil {
+					c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid " + param + ", expected RFC 3339 (e.g. 2025-11-04T12:00:00Z)"})
+					return
+				}
+			}
+		}
+		if v := c.Query("limit"); v != "" {
+			if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 1 || filter.Limit > auditMaxLimit {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid limit, expected 1 to " + strconv.Itoa(auditMaxLimit)})
+				return
+			}
+		}
+
+		events, err := app.Storage.AuditList(filter)
+		if err != nil {
+			app.Log.Errorf("listAuditEvents: %v", err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read the audit log"})
+			return
+		}
+		c.JSON(http.StatusOK, AuditEventsResponse{Events: events})
+	}
+}
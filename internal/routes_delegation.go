@@ -76,7 +76,7 @@ func createDelegation(app *AppData) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 			return
 		}
-		created, err := app.DelegationCreate(req)
+		created, err := app.DelegationCreate(c.Request.Context(), req)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -116,7 +116,7 @@ func updateDelegation(app *AppData) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 			return
 		}
-		updated, err := app.DelegationUpdate(id, req)
+		updated, err := app.DelegationUpdate(c.Request.Context(), id, req)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -149,7 +149,7 @@ func deleteDelegation(app *AppData) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delegation ID"})
 			return
 		}
-		if err := app.DelegationDelete(id); err != nil {
+		if err := app.DelegationDelete(c.Request.Context(), id); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
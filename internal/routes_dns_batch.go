@@ -0,0 +1,296 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/farberg/dynamic-zones/internal/helper"
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// maxBatchChanges bounds one batch. The whole batch is a single DNS message, and
+// a DNS message cannot grow beyond 64 KiB.
+const maxBatchChanges = 500
+
+// Actions of DNSRecordChange.Action.
+const (
+	RecordActionAdd    = "add"
+	RecordActionDelete = "delete"
+)
+
+// Conditions of DNSPrerequisite.Condition (RFC 2136 section 2.4).
+const (
+	PrerequisiteNameExists  = "name_exists"
+	PrerequisiteNameAbsent  = "name_absent"
+	PrerequisiteRRsetExists = "rrset_exists"
+	PrerequisiteRRsetAbsent = "rrset_absent"
+	PrerequisiteRRsetEquals = "rrset_equals"
+)
+
+// DNSRecordChange is one change of a batch. Add takes mode "replace" (default)
+// or "append", delete takes mode "rrset" (default) or "value" — the same as the
+// single record endpoints.
+type DNSRecordChange struct {
+	Action string   `json:"action" enums:"add,delete"`
+	Name   string   `json:"name,omitempty"`
+	Type   string   `json:"type"`
+	TTL    uint32   `json:"ttl,omitempty"`
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"`
+	// Data is a value as typed fields, see DNSRecordRequest.
+	Data *helper.RecordData `json:"data,omitempty"`
+	Mode string             `json:"mode,omitempty" enums:"replace,append,rrset,value"`
+}
+
+// DNSPrerequisite is a condition the zone has to meet for a batch to apply.
+// Type is needed for the rrset conditions, rrset_equals also takes the exact
+// values the RRset must hold.
+type DNSPrerequisite struct {
+	Condition string   `json:"condition" enums:"name_exists,name_absent,rrset_exists,rrset_absent,rrset_equals"`
+	Name      string   `json:"name,omitempty"`
+	Type      string   `json:"type,omitempty"`
+	Values    []string `json:"values,omitempty"`
+}
+
+// DNSBatchRequest is a list of record changes applied all-or-nothing.
+type DNSBatchRequest struct {
+	Zone          string            `json:"zone"`
+	Prerequisites []DNSPrerequisite `json:"prerequisites,omitempty"`
+	Changes       []DNSRecordChange `json:"changes"`
+
+	// Optional, see DNSRecordRequest.
+	KeyName      string `json:"key_name,omitempty"`
+	KeyAlgorithm string `json:"key_algorithm,omitempty"`
+	Key          string `json:"key,omitempty"`
+}
+
+// DNSBatchResponse lists what a batch changed.
+type DNSBatchResponse struct {
+	Status  string      `json:"status"`
+	Applied int         `json:"applied"`
+	Records []DNSRecord `json:"records"`
+}
+
+// recordRequest turns a change into the request of the single record endpoints,
+// so both validate values the same way.
+func (ch *DNSRecordChange) recordRequest(zone string) *DNSRecordRequest {
+	return &DNSRecordRequest{Zone: zone, Name: ch.Name, Type: ch.Type, TTL: ch.TTL, Value: ch.Value, Values: ch.Values, Data: ch.Data, Mode: ch.Mode}
+}
+
+// rrtypeOf parses a record type the record API can write.
+func rrtypeOf(recordType string) (uint16, error) {
+	recordType = strings.ToUpper(strings.TrimSpace(recordType))
+	if !helper.IsSupportedRecordType(recordType) {
+		return 0, fmt.Errorf("unsupported type %q (supported: %s)", recordType, strings.Join(helper.SupportedRecordTypes, ", "))
+	}
+	return dns.StringToType[recordType], nil
+}
+
+// addPrerequisite adds one prerequisite to the update.
+func addPrerequisite(u *helper.Rfc2136Update, zone string, p *DNSPrerequisite) error {
+	name := canonicalRecordName(p.Name, zone)
+
+	switch strings.ToLower(strings.TrimSpace(p.Condition)) {
+	case PrerequisiteNameExists:
+		u.RequireNameExists(name)
+		return nil
+	case PrerequisiteNameAbsent:
+		u.RequireNameAbsent(name)
+		return nil
+	}
+
+	rrtype, err := rrtypeOf(p.Type)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(p.Condition)) {
+	case PrerequisiteRRsetExists:
+		u.RequireRRsetExists(name, rrtype)
+	case PrerequisiteRRsetAbsent:
+		u.RequireRRsetAbsent(name, rrtype)
+	case PrerequisiteRRsetEquals:
+		rrs, err := requestRecords(name, &DNSRecordRequest{Type: p.Type, Values: p.Values})
+		if err != nil {
+			return err
+		}
+		u.RequireRRsetEquals(rrs)
+	default:
+		return fmt.Errorf("unsupported condition %q (supported: %s)", p.Condition, strings.Join([]string{
+			PrerequisiteNameExists, PrerequisiteNameAbsent, PrerequisiteRRsetExists, PrerequisiteRRsetAbsent, PrerequisiteRRsetEquals}, ", "))
+	}
+	return nil
+}
+
+// addChange adds one change to the update and returns the records it touches.
+// Added records must pass constraints (nil: unrestricted).
+func addChange(u *helper.Rfc2136Update, zone string, ch *DNSRecordChange, constraints *RecordConstraints) ([]DNSRecord, error) {
+	req := ch.recordRequest(zone)
+	name := canonicalRecordName(ch.Name, zone)
+	rrtype, err := rrtypeOf(ch.Type)
+	if err != nil {
+		return nil, err
+	}
+	mode := strings.ToLower(strings.TrimSpace(ch.Mode))
+
+	switch strings.ToLower(strings.TrimSpace(ch.Action)) {
+	case RecordActionAdd:
+		rrs, err := requestRecords(name, req)
+		if err != nil {
+			return nil, err
+		}
+		if err := constraints.CheckAll(zone, rrs); err != nil {
+			return nil, err
+		}
+		switch mode {
+		case "", RecordModeReplace:
+			u.DeleteRRset(name, rrtype)
+		case RecordModeAppend:
+		default:
+			return nil, fmt.Errorf("unsupported mode %q for add (supported: %s, %s)", ch.Mode, RecordModeReplace, RecordModeAppend)
+		}
+		u.Add(rrs)
+		return recordsOf(zone, rrs), nil
+
+	case RecordActionDelete:
+		switch mode {
+		case "", RecordModeRRset:
+			u.DeleteRRset(name, rrtype)
+			return []DNSRecord{{Zone: zone, Name: name, Type: dns.TypeToString[rrtype]}}, nil
+		case RecordModeValue:
+			rrs, err := requestRecords(name, req)
+			if err != nil {
+				return nil, err
+			}
+			records := recordsOf(zone, rrs)
+			u.DeleteRecords(rrs)
+			return records, nil
+		default:
+			return nil, fmt.Errorf("unsupported mode %q for delete (supported: %s, %s)", ch.Mode, RecordModeRRset, RecordModeValue)
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported action %q (supported: %s, %s)", ch.Action, RecordActionAdd, RecordActionDelete)
+}
+
+// buildBatchUpdate turns a batch into one update message. Errors name the
+// offending entry, as a batch of dozens of changes is otherwise hard to fix.
+func buildBatchUpdate(req *DNSBatchRequest, constraints *RecordConstraints) (*helper.Rfc2136Update, []DNSRecord, error) {
+	zone := dns.Fqdn(req.Zone)
+
+	if len(req.Changes) == 0 {
+		return nil, nil, fmt.Errorf("changes is empty")
+	}
+	if len(req.Changes) > maxBatchChanges {
+		return nil, nil, fmt.Errorf("a batch holds at most %d changes, got %d", maxBatchChanges, len(req.Changes))
+	}
+
+	u := helper.NewRfc2136Update(zone)
+	for i := range req.Prerequisites {
+		if err := addPrerequisite(u, zone, &req.Prerequisites[i]); err != nil {
+			return nil, nil, fmt.Errorf("prerequisites[%d]: %w", i, err)
+		}
+	}
+
+	var records []DNSRecord
+	for i := range req.Changes {
+		touched, err := addChange(u, zone, &req.Changes[i], constraints)
+		if err != nil {
+			return nil, nil, fmt.Errorf("changes[%d]: %w", i, err)
+		}
+		records = append(records, touched...)
+	}
+	return u, records, nil
+}
+
+// ------------------------------------
+// Batch DNS Records (RFC2136 UPDATE)
+// ------------------------------------
+
+// batchDNSRecords godoc
+// @Summary Apply several record changes at once
+// @Description Applies a list of adds and deletes as ONE RFC 2136 update: either all changes apply or none does. Optional prerequisites (name_exists, name_absent, rrset_exists, rrset_absent, rrset_equals) are checked by the nameserver in the same transaction, which allows compare-and-swap; if one does not hold, nothing changes and 412 is returned. TSIG credentials (key_name, key_algorithm, key) are optional; without them the caller's own key for the zone is used. A named key limits every change to its scope.
+// @Tags DNS
+// @Accept json
+// @Produce json
+// @Param request body DNSBatchRequest true "Changes to apply"
+// @Success 200 {object} DNSBatchResponse
+// @Failure 400 {object} ErrorResponse "Invalid request or incomplete TSIG credentials"
+// @Failure 403 {object} ErrorResponse "Not an owner of the zone, a change breaks the zone's policy or quota, or the named key is expired or out of scope"
+// @Failure 412 {object} ErrorResponse "A prerequisite did not hold"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @ID batchDnsRecords
+// @Router /v1/dns/records/batch [post]
+func batchDNSRecords(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+
+		var req DNSBatchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+			return
+		}
+
+		app.Log.Debug("-------------------------------------------------------------------------------")
+		app.Log.Infof("🚀 Batch called with %d changes, zone: %s by user: %s", len(req.Changes), req.Zone, user.PreferredUsername)
+		app.Log.Debug("-------------------------------------------------------------------------------")
+
+		if tsigErr := CheckTSIGRequestData(req.KeyName, req.KeyAlgorithm, req.Key); tsigErr != nil {
+			c.JSON(http.StatusBadRequest, tsigErr)
+			return
+		}
+
+		if !requireZoneOwner(app, c, user, req.Zone) || !requireWritableZone(app, c, req.Zone) {
+			return
+		}
+
+		keyName, keyAlgo, key, scope, ok := zoneTSIGCredentials(app, c, user, req.Zone, req.KeyName, req.KeyAlgorithm, req.Key)
+		if !ok {
+			return
+		}
+
+		constraints, quotas, ok := zoneLimitsFor(app, c, req.Zone)
+		if !ok {
+			return
+		}
+
+		u, records, err := buildBatchUpdate(&req, constraints)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		for _, r := range records {
+			if err := scope.Check(r.Zone, r.Name, r.Type); err != nil {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+		}
+		if status, err := checkRecordQuota(app, quotas, u, keyName, keyAlgo, key, req.Zone); err != nil {
+			c.JSON(status, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if keyName, keyAlgo, key, ok = updateCredentialsFor(app, c, req.Zone, keyName, keyAlgo, key); !ok {
+			return
+		}
+
+		msg, err := u.Send(keyName, keyAlgo, key, GetServerAddress(app))
+		countUpdate(msg, err)
+		if err != nil {
+			if helper.IsPrerequisiteFailure(msg) {
+				c.JSON(http.StatusPreconditionFailed, ErrorResponse{Error: fmt.Sprintf("prerequisite not met (%s), nothing was changed", dns.RcodeToString[msg.Rcode])})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		// The changes as requested: DNSRecordChange holds no credentials.
+		app.audit(c.Request.Context(), AuditRecordBatch, dns.Fqdn(req.Zone), req.Zone, nil, gin.H{"prerequisites": req.Prerequisites, "changes": req.Changes})
+		app.recordZoneVersion(c.Request.Context(), req.Zone, ZoneVersionAPI)
+
+		c.JSON(http.StatusOK, DNSBatchResponse{Status: "ok", Applied: len(req.Changes), Records: records})
+	}
+}
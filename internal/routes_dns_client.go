@@ -1,10 +1,10 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/farberg/dynamic-zones/internal/helper"
 	"github.com/gin-gonic/gin"
@@ -21,12 +21,22 @@ type DNSRecordRequest struct {
 	Zone  string `json:"zone"`
 	Name  string `json:"name,omitempty"`
 	Type  string `json:"type,omitempty"`
-	TTL   uint32 `json:"ttl,omitempty"`
+	TTL   uint32 `json:"ttl,omitempty"` // defaults to 3600
 	Value string `json:"value,omitempty"`
-
-	KeyName      string `json:"key_name"`
-	KeyAlgorithm string `json:"key_algorithm"`
-	Key          string `json:"key"`
+	// Values holds several values of the same RRset (round-robin A records,
+	// several TXT values); it is combined with Value.
+	Values []string `json:"values,omitempty"`
+	// Data is a value as typed fields, the same form DNSRecord returns; it is
+	// combined with Value and Values.
+	Data *helper.RecordData `json:"data,omitempty"`
+	// Mode is "replace" (default) or "append" for create, "rrset" (default) or
+	// "value" for delete. See the RecordMode constants.
+	Mode string `json:"mode,omitempty" enums:"replace,append,rrset,value"`
+
+	// Optional: without them the caller's own key for the zone is used.
+	KeyName      string `json:"key_name,omitempty"`
+	KeyAlgorithm string `json:"key_algorithm,omitempty"`
+	Key          string `json:"key,omitempty"`
 }
 
 // Response format
@@ -36,12 +46,38 @@ type DNSRecord struct {
 	Type  string `json:"type"`
 	TTL   uint32 `json:"ttl"`
 	Value string `json:"value"`
+	// Data is the record data as typed fields, for the types the record API
+	// writes. Unlike Value it round-trips: it can be sent back as is.
+	Data *helper.RecordData `json:"data,omitempty"`
 }
 
 type DNSRecordsResponse struct {
 	Records []DNSRecord `json:"records"`
 }
 
+// DNSRecordWriteResponse is the response of a record create or delete.
+type DNSRecordWriteResponse struct {
+	Status string `json:"status" example:"ok"`
+	// Action is what was done: upserted, appended or deleted.
+	Action string `json:"action" example:"upserted"`
+	// Record is the first of Records, kept for clients written before an
+	// RRset could hold several values.
+	Record  DNSRecord   `json:"record"`
+	Records []DNSRecord `json:"records"`
+}
+
+// Write modes of DNSRecordRequest.Mode.
+const (
+	// RecordModeReplace makes the values the whole RRset (create default).
+	RecordModeReplace = "replace"
+	// RecordModeAppend adds the values and keeps the rest of the RRset.
+	RecordModeAppend = "append"
+	// RecordModeRRset deletes the whole RRset (delete default).
+	RecordModeRRset = "rrset"
+	// RecordModeValue deletes only the given values.
+	RecordModeValue = "value"
+)
+
 // ------------------------------------
 // Register routes
 // ------------------------------------
@@ -49,6 +85,7 @@ func CreateRfc2136ClientApiGroup(v1 *gin.RouterGroup, app *AppData) *gin.RouterG
 	v1.GET("/dns/records", listDNSRecords(app))
 	v1.POST("/dns/records/create", createDNSRecord(app))
 	v1.POST("/dns/records/delete", deleteDNSRecord(app))
+	v1.POST("/dns/records/batch", batchDNSRecords(app))
 
 	return v1
 }
@@ -60,13 +97,18 @@ func CreateRfc2136ClientApiGroup(v1 *gin.RouterGroup, app *AppData) *gin.RouterG
 // that any logged-in user could point at any zone: convenient for probing keys
 // against an internal DNS server that is otherwise unreachable from outside, and
 // for generating load in someone else's name. Ownership is the same rule the
-// zone endpoints apply, so nothing legitimate changes.
+// zone endpoints apply, so nothing legitimate changes. A token limited to
+// zones is refused for the others here as well.
 func requireZoneOwner(app *AppData, c *gin.Context, user *UserClaims, zone string) bool {
 	name := strings.TrimSuffix(strings.TrimSpace(zone), ".")
 	if name == "" {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "zone is required"})
 		return false
 	}
+	if !requestAllowsZone(c, name) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "token is not valid for this zone"})
+		return false
+	}
 	isOwner, err := app.Storage.IsZoneOwner(user.PreferredUsername, name)
 	if err != nil {
 		app.Log.Errorf("requireZoneOwner: ownership check failed for zone '%s': %v", name, err)
@@ -81,6 +123,78 @@ func requireZoneOwner(app *AppData, c *gin.Context, user *UserClaims, zone strin
 	return true
 }
 
+// requireWritableZone refuses a write to a zone that is suspended or whose
+// lease expired (see AppData.requireZoneWritable). On failure the response is
+// written and false is returned.
+func requireWritableZone(app *AppData, c *gin.Context, zone string) bool {
+	status, resp, err := app.requireZoneWritable(strings.TrimSuffix(strings.TrimSpace(zone), "."))
+	if err != nil {
+		app.Log.Warnf("requireWritableZone: %v", err)
+		c.JSON(status, resp)
+		return false
+	}
+	return true
+}
+
+// zoneLimitsFor loads the record constraints and quotas of the rule governing
+// zone (nil: unrestricted). On failure the response is written and ok is false.
+func zoneLimitsFor(app *AppData, c *gin.Context, zone string) (*RecordConstraints, *ZoneQuotas, bool) {
+	constraints, quotas, err := app.zoneLimits(strings.TrimSuffix(strings.TrimSpace(zone), "."))
+	if err != nil {
+		app.Log.Errorf("zoneLimitsFor: failed to resolve the rule of zone '%s': %v", zone, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to resolve the policy of this zone"})
+		return nil, nil, false
+	}
+	return constraints, quotas, true
+}
+
+// zoneTSIGCredentials returns the TSIG key a request for zone is signed with.
+//
+// Explicit credentials are used as given, unless they name a named key of the
+// zone: an expired one is refused, and a scoped one is replaced by its owner's
+// key together with the scope the write must be checked against (nil: none).
+// Without any credentials, the caller's own key for
+// the zone is looked up in PowerDNS: the caller is authenticated and has passed
+// requireZoneOwner, so the service can hold the key on their behalf and browser
+// and token clients never handle the raw HMAC secret. Only GetZone's per-user
+// scoping is relied on — a co-owner's key is never picked. Call it after
+// requireZoneOwner.
+func zoneTSIGCredentials(app *AppData, c *gin.Context, user *UserClaims, zone, keyName, keyAlgo, key string) (string, string, string, *ZoneKeyScope, bool) {
+	name := strings.TrimSuffix(strings.TrimSpace(zone), ".")
+
+	if keyName != "" && keyAlgo != "" && key != "" {
+		k, scope, status, err := app.namedKeyCredentials(c.Request.Context(), name, keyName, keyAlgo, key)
+		if err != nil {
+			app.Log.Warnf("zoneTSIGCredentials: user '%s' on zone '%s': %v", user.PreferredUsername, name, err)
+			msg := "failed to check the TSIG key"
+			if status == http.StatusForbidden {
+				msg = err.Error()
+			}
+			c.JSON(status, ErrorResponse{Error: msg})
+			return "", "", "", nil, false
+		}
+		if k != nil {
+			keyName, keyAlgo, key = k.Keyname, k.Algorithm, k.Key
+		}
+		return dns.Fqdn(keyName), dns.Fqdn(keyAlgo), key, scope, true
+	}
+
+	k, err := app.userZoneKey(c.Request.Context(), user.PreferredUsername, name)
+	if errors.Is(err, errNoZoneKey) {
+		app.Log.Warnf("zoneTSIGCredentials: user '%s' has no key for zone '%s'", user.PreferredUsername, name)
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "you have no TSIG key for this zone; rotate the zone keys or send explicit TSIG credentials"})
+		return "", "", "", nil, false
+	}
+	if err != nil {
+		app.Log.Errorf("zoneTSIGCredentials: failed to look up key of user '%s' for zone '%s': %v", user.PreferredUsername, name, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to look up your TSIG key for this zone"})
+		return "", "", "", nil, false
+	}
+
+	app.Log.Debugf("zoneTSIGCredentials: signing for user '%s' with their key '%s' of zone '%s'", user.PreferredUsername, k.Keyname, name)
+	return dns.Fqdn(k.Keyname), dns.Fqdn(k.Algorithm), k.Key, nil, true
+}
+
 // canonicalRecordName ensures a record name is fully qualified (FQDN) relative to a zone.
 func canonicalRecordName(name, zone string) string {
 	zoneFQDN := dns.Fqdn(zone)
@@ -100,6 +214,118 @@ func canonicalRecordName(name, zone string) string {
 	return dns.Fqdn(name + "." + zoneFQDN)
 }
 
+// requestValues returns the values of a request in presentation format: Data
+// first, then Value, then Values, without blanks.
+func requestValues(req *DNSRecordRequest) ([]string, error) {
+	var values []string
+	if req.Data != nil {
+		v, err := req.Data.PresentationValue(req.Type)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	for _, v := range append([]string{req.Value}, req.Values...) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// requestRecords builds the validated records of a request, one per value and
+// without duplicates. All of them belong to the RRset (name, req.Type). A
+// request without TTL gets importDefaultTTL, before any constraint sees it.
+func requestRecords(name string, req *DNSRecordRequest) ([]dns.RR, error) {
+	values, err := requestValues(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("value, values or data is required")
+	}
+	ttl := req.TTL
+	if ttl == 0 {
+		ttl = importDefaultTTL
+	}
+
+	seen := make(map[string]bool)
+	rrs := make([]dns.RR, 0, len(values))
+	for _, v := range values {
+		rr, err := helper.NewRecord(name, req.Type, v, ttl)
+		if err != nil {
+			return nil, err
+		}
+		// The same record given twice (e.g. as value and as data) would be
+		// an error for some servers.
+		if key := helper.RecordKey(rr); !seen[key] {
+			seen[key] = true
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs, nil
+}
+
+// recordValue is the Value of DNSRecord: MX as "<preference> <host>", TXT
+// segments joined by spaces, anything else the RDATA in presentation format.
+func recordValue(rr dns.RR) string {
+	switch t := rr.(type) {
+	case *dns.A:
+		return t.A.String()
+	case *dns.AAAA:
+		return t.AAAA.String()
+	case *dns.CNAME:
+		return t.Target
+	case *dns.NS:
+		return t.Ns
+	case *dns.MX:
+		// MX records need both the preference and the target
+		return fmt.Sprintf("%d %s", t.Preference, t.Mx)
+	case *dns.TXT:
+		// TXT records have multiple strings in the slice 'Txt'; the
+		// boundaries are only kept in Data.
+		return strings.Join(t.Txt, " ")
+	}
+	// Fallback for types not explicitly handled: the RDATA in presentation
+	// format, i.e. the line without name, TTL, class and type — the same
+	// format the write endpoints take.
+	return strings.TrimSpace(strings.TrimPrefix(rr.String(), rr.Header().String()))
+}
+
+// recordOf returns rr in the response format.
+func recordOf(zoneFQDN string, rr dns.RR) DNSRecord {
+	h := rr.Header()
+
+	// The name of the record should be normalized if it's the zone apex
+	recordName := h.Name
+	if h.Name == zoneFQDN || strings.Trim(h.Name, ".") == strings.Trim(zoneFQDN, ".") {
+		// For the apex record, use the consistently FQDN version
+		recordName = zoneFQDN
+	} else if strings.HasPrefix(h.Name, `\@`) {
+		// If the name starts with the escaped apex, replace it with the FQDN apex.
+		recordName = zoneFQDN
+	}
+
+	return DNSRecord{
+		Zone:  zoneFQDN,
+		Name:  recordName,
+		Type:  dns.TypeToString[h.Rrtype],
+		TTL:   h.Ttl,
+		Value: recordValue(rr),
+		Data:  helper.RecordDataOf(rr),
+	}
+}
+
+// recordsOf returns records in the response format. Call it before the records
+// go into an update message, which rewrites class and TTL of deletions.
+func recordsOf(zoneFQDN string, rrs []dns.RR) []DNSRecord {
+	records := make([]DNSRecord, 0, len(rrs))
+	for _, rr := range rrs {
+		records = append(records, recordOf(zoneFQDN, rr))
+	}
+	return records
+}
+
 // --- New Utility Functions ---
 
 // GetServerAddress returns where THIS service sends its own AXFR and RFC 2136
@@ -111,15 +337,20 @@ func GetServerAddress(app *AppData) string {
 }
 
 // GetTSIGCredentials extracts and validates TSIG credentials from HTTP headers for AXFR.
-// It ensures FQDN formatting for KeyName and KeyAlgorithm.
+// It ensures FQDN formatting for KeyName and KeyAlgorithm. The headers are
+// optional (see zoneTSIGCredentials): none at all returns empty strings, only
+// some of them is an error.
 func GetTSIGCredentials(c *gin.Context) (keyNameFQDN, keyAlgoFQDN, key string, err *ErrorResponse) {
 	keyName := strings.TrimSpace(c.GetHeader("X-DNS-Key-Name"))
 	keyAlgo := strings.TrimSpace(c.GetHeader("X-DNS-Key-Algorithm"))
 	key = strings.TrimSpace(c.GetHeader("X-DNS-Key"))
 
+	if keyName == "" && keyAlgo == "" && key == "" {
+		return "", "", "", nil
+	}
 	if keyName == "" || keyAlgo == "" || key == "" {
 		return "", "", "", &ErrorResponse{
-			Error: "TSIG headers required: X-DNS-Key-Name, X-DNS-Key-Algorithm, X-DNS-Key",
+			Error: "TSIG headers must be sent together: X-DNS-Key-Name, X-DNS-Key-Algorithm, X-DNS-Key",
 		}
 	}
 
@@ -135,11 +366,18 @@ func GetTSIGCredentials(c *gin.Context) (keyNameFQDN, keyAlgoFQDN, key string, e
 	return keyNameFQDN, keyAlgoFQDN, key, nil
 }
 
-// CheckTSIGRequestData validates TSIG credentials from a JSON request body for UPDATEs.
-func CheckTSIGRequestData(req *DNSRecordRequest) *ErrorResponse {
-	if req.KeyName == "" || req.KeyAlgorithm == "" || req.Key == "" {
+// CheckTSIGRequestData validates TSIG credentials from a JSON request body for
+// UPDATEs. Like the headers they are optional, but all or none.
+func CheckTSIGRequestData(keyName, keyAlgorithm, key string) *ErrorResponse {
+	given := 0
+	for _, v := range []string{keyName, keyAlgorithm, key} {
+		if v != "" {
+			given++
+		}
+	}
+	if given != 0 && given != 3 {
 		return &ErrorResponse{
-			Error: "TSIG credentials required: key_name, key_algorithm, key",
+			Error: "TSIG credentials must be sent together: key_name, key_algorithm, key",
 		}
 	}
 	return nil
@@ -151,7 +389,7 @@ func CheckTSIGRequestData(req *DNSRecordRequest) *ErrorResponse {
 
 // listDNSRecords godoc
 // @Summary List DNS records for a zone
-// @Description Returns all DNS records for a given zone. TSIG headers are required.
+// @Description Returns all DNS records for a given zone. The TSIG headers X-DNS-Key-Name, X-DNS-Key-Algorithm and X-DNS-Key are optional; without them the caller's own key for the zone is used.
 // @Tags DNS
 // @Accept json
 // @Produce json
@@ -185,26 +423,24 @@ func listDNSRecords(app *AppData) gin.HandlerFunc {
 		app.Log.Infof("🚀 List DNS records called for zone: %s by user: %s", zoneFQDN, user.PreferredUsername)
 		app.Log.Debug("-------------------------------------------------------------------------------")
 
-		// Get TSIG credentials from headers
+		// Get TSIG credentials from headers, or the caller's own key
 		keyNameFQDN, keyAlgoFQDN, key, tsigErr := GetTSIGCredentials(c)
 		if tsigErr != nil {
-			app.Log.Error("TSIG headers missing")
+			app.Log.Error("TSIG headers incomplete")
 			c.JSON(http.StatusBadRequest, tsigErr)
 			return
 		}
+		// Reading is not scoped.
+		keyNameFQDN, keyAlgoFQDN, key, _, ok := zoneTSIGCredentials(app, c, user, zone, keyNameFQDN, keyAlgoFQDN, key)
+		if !ok {
+			return
+		}
 
 		dnsServer := GetServerAddress(app)
 
-		msg := new(dns.Msg)
-		msg.SetAxfr(zoneFQDN)
-		msg.SetTsig(keyNameFQDN, keyAlgoFQDN, 300, time.Now().Unix())
-
-		tr := new(dns.Transfer)
-		tr.TsigSecret = map[string]string{keyNameFQDN: key}
-
 		app.Log.Debugf("Sending AXFR request to DNS server %s for zone %s", dnsServer, zoneFQDN)
 
-		envChan, err := tr.In(msg, dnsServer)
+		rrs, err := helper.ZoneTransfer(keyNameFQDN, keyAlgoFQDN, key, dnsServer, zoneFQDN)
 		if err != nil {
 			app.Log.Errorf("Error performing AXFR for zone '%s': %v", zoneFQDN, err)
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
@@ -213,61 +449,14 @@ func listDNSRecords(app *AppData) gin.HandlerFunc {
 
 		var records []DNSRecord
 
-		for env := range envChan {
-			if env.Error != nil {
-				app.Log.Errorf("AXFR environment error for zone '%s': %v", zoneFQDN, env.Error)
-				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: env.Error.Error()})
-				return
-			}
+		for _, rr := range rrs {
+			h := rr.Header()
 
-			for _, rr := range env.RR {
-				h := rr.Header()
-
-				if h.Rrtype == dns.TypeSOA ||
-					h.Rrtype == dns.TypeRRSIG ||
-					h.Rrtype == dns.TypeDNSKEY {
-					continue
-				}
-
-				var recordValue string
-				switch t := rr.(type) {
-				case *dns.A:
-					recordValue = t.A.String()
-				case *dns.AAAA:
-					recordValue = t.AAAA.String()
-				case *dns.CNAME:
-					recordValue = t.Target
-				case *dns.NS:
-					recordValue = t.Ns
-				case *dns.MX:
-					// MX records need both the preference and the target
-					recordValue = fmt.Sprintf("%d %s", t.Preference, t.Mx)
-				case *dns.TXT:
-					// TXT records have multiple strings in the slice 'Txt'
-					recordValue = strings.Join(t.Txt, " ")
-				default:
-					// Fallback for types not explicitly handled
-					recordValue = rr.String()
-				}
-
-				// The name of the record should be normalized if it's the zone apex
-				recordName := h.Name
-
-				if h.Name == zoneFQDN || strings.Trim(h.Name, ".") == strings.Trim(zoneFQDN, ".") {
-					// For the apex record, use the consistently FQDN version
-					recordName = zoneFQDN
-				} else if strings.HasPrefix(h.Name, `\@`) {
-					// If the name starts with the escaped apex, replace it with the FQDN apex.
-					recordName = zoneFQDN
-				}
-				records = append(records, DNSRecord{
-					Zone:  zoneFQDN,
-					Name:  recordName,
-					Type:  dns.TypeToString[h.Rrtype],
-					TTL:   h.Ttl,
-					Value: recordValue,
-				})
+			if h.Rrtype == dns.TypeSOA || isDnssecType(h.Rrtype) {
+				continue
 			}
+
+			records = append(records, recordOf(zoneFQDN, rr))
 		}
 
 		// Dump all records for debugging
@@ -285,13 +474,14 @@ func listDNSRecords(app *AppData) gin.HandlerFunc {
 
 // createDNSRecord godoc
 // @Summary Create a DNS record
-// @Description Creates a new DNS record in the given zone. TSIG headers required: X-DNS-Key-Name, X-DNS-Key-Algorithm, X-DNS-Key
+// @Description Writes the RRset (name, type) in the given zone from value and/or values. With mode "replace" (default) the values become the whole RRset, with mode "append" they are added to it. Supported types: A, AAAA, CNAME, MX, TXT, SRV, CAA, NS, PTR, SSHFP; the value is the record data in presentation format (e.g. "10 mail.example.com." for MX). TSIG credentials (key_name, key_algorithm, key) are optional; without them the caller's own key for the zone is used. A named key limits the write to its scope.
 // @Tags DNS
 // @Accept json
 // @Produce json
 // @Param request body DNSRecordRequest true "DNS record to create"
-// @Success 201 {object} DNSRecord "Created record"
-// @Failure 400 {object} ErrorResponse "Invalid request or missing TSIG headers"
+// @Success 201 {object} DNSRecordWriteResponse "Written records"
+// @Failure 400 {object} ErrorResponse "Invalid request or incomplete TSIG credentials"
+// @Failure 403 {object} ErrorResponse "Not an owner of the zone, the record breaks the zone's policy or quota, or the named key is expired or out of scope"
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Security ApiKeyAuth
 // @ID createDnsRecord
@@ -310,12 +500,17 @@ func createDNSRecord(app *AppData) gin.HandlerFunc {
 		app.Log.Infof("🚀 Create record called for record %s, zone: %s by user: %s", req.Name, req.Zone, user.PreferredUsername)
 		app.Log.Debug("-------------------------------------------------------------------------------")
 
-		if tsigErr := CheckTSIGRequestData(&req); tsigErr != nil {
+		if tsigErr := CheckTSIGRequestData(req.KeyName, req.KeyAlgorithm, req.Key); tsigErr != nil {
 			c.JSON(http.StatusBadRequest, tsigErr)
 			return
 		}
 
-		if !requireZoneOwner(app, c, user, req.Zone) {
+		if !requireZoneOwner(app, c, user, req.Zone) || !requireWritableZone(app, c, req.Zone) {
+			return
+		}
+
+		keyName, keyAlgo, key, scope, ok := zoneTSIGCredentials(app, c, user, req.Zone, req.KeyName, req.KeyAlgorithm, req.Key)
+		if !ok {
 			return
 		}
 
@@ -323,37 +518,62 @@ func createDNSRecord(app *AppData) gin.HandlerFunc {
 		name := canonicalRecordName(req.Name, req.Zone)
 		dnsServer := GetServerAddress(app)
 
-		// UPSERT = delete first, then add
-		switch strings.ToUpper(req.Type) {
-		case "A":
-			_, _ = helper.Rfc2136DeleteARecord(req.KeyName, req.KeyAlgorithm, req.Key, dnsServer, zone, name)
-			_, err := helper.Rfc2136AddARecord(req.KeyName, req.KeyAlgorithm, req.Key, dnsServer, zone, name, req.Value, req.TTL)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-				return
-			}
-
-		case "AAAA":
-			_, _ = helper.Rfc2136DeleteAAAARecord(req.KeyName, req.KeyAlgorithm, req.Key, dnsServer, zone, name)
-			_, err := helper.Rfc2136AddAAAARecord(req.KeyName, req.KeyAlgorithm, req.Key, dnsServer, zone, name, req.Value, req.TTL)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-				return
-			}
-
+		rrs, err := requestRecords(name, &req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		constraints, quotas, ok := zoneLimitsFor(app, c, req.Zone)
+		if !ok {
+			return
+		}
+		if err := constraints.CheckAll(zone, rrs); err != nil {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if err := scope.CheckAll(zone, rrs); err != nil {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+			return
+		}
+		records := recordsOf(zone, rrs)
+
+		var action string
+		u := helper.NewRfc2136Update(zone)
+		switch strings.ToLower(strings.TrimSpace(req.Mode)) {
+		case "", RecordModeReplace:
+			// Replace the RRset as one update message, so the name never
+			// resolves to nothing in between.
+			action = "upserted"
+			u.DeleteRRset(name, rrs[0].Header().Rrtype)
+			u.Add(rrs)
+		case RecordModeAppend:
+			action = "appended"
+			u.Add(rrs)
 		default:
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "unsupported type (supported: A, AAAA)"})
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("unsupported mode %q (supported: %s, %s)", req.Mode, RecordModeReplace, RecordModeAppend)})
+			return
+		}
+		if status, err := checkRecordQuota(app, quotas, u, keyName, keyAlgo, key, zone); err != nil {
+			c.JSON(status, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if keyName, keyAlgo, key, ok = updateCredentialsFor(app, c, req.Zone, keyName, keyAlgo, key); !ok {
+			return
+		}
+		msg, err := u.Send(keyName, keyAlgo, key, dnsServer)
+		countUpdate(msg, err)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 			return
 		}
 
-		// Echo the record, NOT the request: req carries the TSIG key the client
+		app.audit(c.Request.Context(), AuditRecordCreate, name+" "+records[0].Type, req.Zone, nil, gin.H{"mode": action, "records": records})
+		app.recordZoneVersion(c.Request.Context(), req.Zone, ZoneVersionAPI)
+
+		// Echo the records, NOT the request: req carries the TSIG key the client
 		// sent, and a credential has no business in a response body (or in
 		// whatever logs and proxies that body passes through).
-		c.JSON(http.StatusCreated, gin.H{
-			"status": "ok",
-			"action": "upserted",
-			"record": DNSRecord{Zone: zone, Name: name, Type: strings.ToUpper(req.Type), TTL: req.TTL, Value: req.Value},
-		})
+		c.JSON(http.StatusCreated, DNSRecordWriteResponse{Status: "ok", Action: action, Record: records[0], Records: records})
 	}
 }
 
@@ -363,13 +583,13 @@ func createDNSRecord(app *AppData) gin.HandlerFunc {
 
 // deleteDNSRecord godoc
 // @Summary Delete a DNS record
-// @Description Deletes an existing DNS record from the zone. TSIG headers required: X-DNS-Key-Name, X-DNS-Key-Algorithm, X-DNS-Key
+// @Description Deletes records of the given type and name from the zone. With mode "rrset" (default) the whole RRset goes, with mode "value" only the records matching value and/or values. Supported types: A, AAAA, CNAME, MX, TXT, SRV, CAA, NS, PTR, SSHFP. TSIG credentials (key_name, key_algorithm, key) are optional; without them the caller's own key for the zone is used. A named key limits the write to its scope.
 // @Tags DNS
 // @Accept json
 // @Produce json
 // @Param request body DNSRecordRequest true "DNS record to delete"
-// @Success 200 {object} DNSRecord "Deleted record"
-// @Failure 400 {object} ErrorResponse "Invalid request or missing TSIG headers"
+// @Success 200 {object} DNSRecordWriteResponse "Deleted records"
+// @Failure 400 {object} ErrorResponse "Invalid request or incomplete TSIG credentials"
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Security ApiKeyAuth
 // @ID deleteDnsRecord
@@ -385,10 +605,8 @@ func deleteDNSRecord(app *AppData) gin.HandlerFunc {
 		}
 
 		// TSIG check
-		if req.KeyName == "" || req.KeyAlgorithm == "" || req.Key == "" {
-			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Error: "TSIG credentials required: key_name, key_algorithm, key",
-			})
+		if tsigErr := CheckTSIGRequestData(req.KeyName, req.KeyAlgorithm, req.Key); tsigErr != nil {
+			c.JSON(http.StatusBadRequest, tsigErr)
 			return
 		}
 
@@ -396,7 +614,12 @@ func deleteDNSRecord(app *AppData) gin.HandlerFunc {
 		app.Log.Infof("🚀 Delete record called for record %s, zone: %s by user: %s", req.Name, req.Zone, user.PreferredUsername)
 		app.Log.Debug("-------------------------------------------------------------------------------")
 
-		if !requireZoneOwner(app, c, user, req.Zone) {
+		if !requireZoneOwner(app, c, user, req.Zone) || !requireWritableZone(app, c, req.Zone) {
+			return
+		}
+
+		keyName, keyAlgo, key, scope, ok := zoneTSIGCredentials(app, c, user, req.Zone, req.KeyName, req.KeyAlgorithm, req.Key)
+		if !ok {
 			return
 		}
 
@@ -406,30 +629,52 @@ func deleteDNSRecord(app *AppData) gin.HandlerFunc {
 
 		dnsServer := GetServerAddress(app)
 
-		switch strings.ToUpper(req.Type) {
-		case "A":
-			_, err := helper.Rfc2136DeleteARecord(req.KeyName, req.KeyAlgorithm, req.Key, dnsServer, zone, name)
+		rrtype, err := rrtypeOf(req.Type)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		recordType := dns.TypeToString[rrtype]
+		if err := scope.Check(zone, name, recordType); err != nil {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if keyName, keyAlgo, key, ok = updateCredentialsFor(app, c, req.Zone, keyName, keyAlgo, key); !ok {
+			return
+		}
+
+		// Like create: the records, never the request with its TSIG key.
+		var records []DNSRecord
+		switch strings.ToLower(strings.TrimSpace(req.Mode)) {
+		case "", RecordModeRRset:
+			msg, err := helper.Rfc2136DeleteRRset(keyName, keyAlgo, key, dnsServer, zone, name, rrtype)
+			countUpdate(msg, err)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 				return
 			}
-
-		case "AAAA":
-			_, err := helper.Rfc2136DeleteAAAARecord(req.KeyName, req.KeyAlgorithm, req.Key, dnsServer, zone, name)
+			records = []DNSRecord{{Zone: zone, Name: name, Type: recordType}}
+		case RecordModeValue:
+			rrs, err := requestRecords(name, &req)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			records = recordsOf(zone, rrs)
+			msg, err := helper.Rfc2136DeleteRecords(keyName, keyAlgo, key, dnsServer, zone, rrs)
+			countUpdate(msg, err)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 				return
 			}
-
 		default:
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "unsupported type (supported: A, AAAA)"})
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("unsupported mode %q (supported: %s, %s)", req.Mode, RecordModeRRset, RecordModeValue)})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"status": "ok",
-			"action": "deleted",
-			"record": req,
-		})
+		app.audit(c.Request.Context(), AuditRecordDelete, name+" "+recordType, req.Zone, gin.H{"records": records}, nil)
+		app.recordZoneVersion(c.Request.Context(), req.Zone, ZoneVersionAPI)
+
+		c.JSON(http.StatusOK, DNSRecordWriteResponse{Status: "ok", Action: "deleted", Record: records[0], Records: records})
 	}
 }
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/farberg/dynamic-zones/internal/helper"
+	"github.com/miekg/dns"
+)
+
+// value and values are one list: blanks and repeats must not reach the update
+// message, where a repeated value would be an error for some servers.
+func TestRequestRecordsCombinesValueAndValues(t *testing.T) {
+	req := &DNSRecordRequest{
+		Type:   "A",
+		TTL:    60,
+		Value:  "192.0.2.1",
+		Values: []string{"192.0.2.2", " ", "192.0.2.1", "192.0.2.3"},
+	}
+
+	rrs, err := requestRecords("www.example.com.", req)
+	if err != nil {
+		t.Fatalf("requestRecords failed: %v", err)
+	}
+
+	want := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}
+	if len(rrs) != len(want) {
+		t.Fatalf("expected %d records, got %v", len(want), rrs)
+	}
+	for i, rr := range rrs {
+		if got := rr.(*dns.A).A.String(); got != want[i] {
+			t.Errorf("record %d: expected %s, got %s", i, want[i], got)
+		}
+	}
+}
+
+// An omitted TTL is the default, not 0, also for the constraints' TTL range.
+func TestRequestRecordsDefaultsTTL(t *testing.T) {
+	rrs, err := requestRecords("www.example.com.", &DNSRecordRequest{Type: "A", Value: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("requestRecords failed: %v", err)
+	}
+	if ttl := rrs[0].Header().Ttl; ttl != importDefaultTTL {
+		t.Errorf("expected TTL %d, got %d", importDefaultTTL, ttl)
+	}
+}
+
+func TestRequestRecordsRejectsMissingOrBadValues(t *testing.T) {
+	if _, err := requestRecords("www.example.com.", &DNSRecordRequest{Type: "A"}); err == nil {
+		t.Error("expected a request without values to be rejected")
+	}
+	bad := &DNSRecordRequest{Type: "A", Values: []string{"192.0.2.1", "2001:db8::1"}}
+	if _, err := requestRecords("www.example.com.", bad); err == nil {
+		t.Error("expected an IPv6 value in an A RRset to be rejected")
+	}
+}
+
+// A batch is one message, so one bad entry must fail the whole batch before
+// anything is sent — and say which entry it was.
+func TestBuildBatchUpdateNamesTheBadEntry(t *testing.T) {
+	req := &DNSBatchRequest{
+		Zone: "example.com",
+		Changes: []DNSRecordChange{
+			{Action: "add", Name: "www", Type: "A", Value: "192.0.2.1"},
+			{Action: "delete", Name: "old", Type: "TXT"},
+			{Action: "add", Name: "mail", Type: "MX", Value: "mail.example.com."},
+		},
+	}
+	if _, _, err := buildBatchUpdate(req, nil); err == nil || !strings.HasPrefix(err.Error(), "changes[2]:") {
+		t.Errorf("expected changes[2] to be reported, got %v", err)
+	}
+
+	req.Changes = req.Changes[:2]
+	req.Prerequisites = []DNSPrerequisite{{Condition: "rrset_equals", Name: "www"}}
+	if _, _, err := buildBatchUpdate(req, nil); err == nil || !strings.HasPrefix(err.Error(), "prerequisites[0]:") {
+		t.Errorf("expected prerequisites[0] to be reported, got %v", err)
+	}
+
+	req.Prerequisites = []DNSPrerequisite{{Condition: "rrset_exists", Name: "www", Type: "A"}}
+	_, records, err := buildBatchUpdate(req, nil)
+	if err != nil {
+		t.Fatalf("expected a valid batch, got %v", err)
+	}
+	if len(records) != 2 || records[0].Name != "www.example.com." || records[1].Type != "TXT" {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
+
+// TSIG credentials are optional since the service holds the caller's key, but a
+// partial set is a client bug and must not silently fall back to that key.
+func TestCheckTSIGRequestDataIsAllOrNothing(t *testing.T) {
+	if err := CheckTSIGRequestData("", "", ""); err != nil {
+		t.Errorf("expected no credentials to be accepted, got %v", err)
+	}
+	if err := CheckTSIGRequestData("key.", "hmac-sha512", "c2VjcmV0"); err != nil {
+		t.Errorf("expected full credentials to be accepted, got %v", err)
+	}
+	if err := CheckTSIGRequestData("key.", "", "c2VjcmV0"); err == nil {
+		t.Error("expected partial credentials to be rejected")
+	}
+}
+
+// The same record as value and as data is one record, and what a write echoes
+// is the typed form a client can send back.
+func TestRequestRecordsAcceptsData(t *testing.T) {
+	pref := uint16(10)
+	req := &DNSRecordRequest{
+		Type:  "MX",
+		Value: "10 mail.example.com.",
+		Data:  &helper.RecordData{Preference: &pref, Target: "mail.example.com"},
+	}
+
+	rrs, err := requestRecords("example.com.", req)
+	if err != nil {
+		t.Fatalf("requestRecords failed: %v", err)
+	}
+	if len(rrs) != 1 {
+		t.Fatalf("expected value and data to collapse into 1 record, got %v", rrs)
+	}
+
+	rec := recordOf("example.com.", rrs[0])
+	if rec.Data == nil || *rec.Data.Preference != 10 || rec.Data.Target != "mail.example.com." {
+		t.Errorf("unexpected data %+v", rec.Data)
+	}
+}
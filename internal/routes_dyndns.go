@@ -0,0 +1,98 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateDynDnsRoutes adds the DynDNS2 update URL. It lives outside /v1 because
+// clients have the path built in, and authenticates with HTTP Basic instead of
+// a bearer header, which routers cannot send.
+func CreateDynDnsRoutes(router *gin.Engine, app *AppData) {
+	router.GET("/nic/update", RequestIDMiddleware(), dynDnsUpdate(app))
+}
+
+// dynDnsToken returns the API token of a DynDNS2 request: the password of the
+// Basic credentials (the user name is not checked, clients insist on sending
+// one), or a bearer token. nil if none authenticates, or if the token may not
+// write records from the client's address.
+func dynDnsToken(app *AppData, c *gin.Context) (*Token, error) {
+	tokenString, ok := cutBearerPrefix(c.GetHeader("Authorization"))
+	if _, password, basic := c.Request.BasicAuth(); basic {
+		tokenString, ok = password, true
+	}
+	if !ok || !strings.HasPrefix(tokenString, ApiTokenPrefix) {
+		return nil, nil
+	}
+	token, err := app.Storage.GetToken(c.Request.Context(), tokenString)
+	if err != nil || token == nil || token.ReadOnly {
+		return nil, err
+	}
+	if !token.HasScope(TokenScopeRecordsWrite) || !token.AllowsIP(c.ClientIP()) {
+		return nil, nil
+	}
+	return token, nil
+}
+
+// dynDnsUpdate godoc
+// @Summary DynDNS2 update
+// @Description Points hostnames at the client's addresses, for routers and ddclient speaking the DynDNS2 protocol. Authenticate with HTTP Basic, any user name and an API token with the records:write scope (or none) as the password; a token limited to zones only updates hostnames in them. hostname is a comma-separated list; myip (and myipv6) a comma-separated list of IPv4 and IPv6 addresses, the client's address when missing. Only the A or AAAA RRset of a given address family is replaced. The body is one DynDNS2 return code per hostname: good, nochg, badauth, notfqdn, nohost, dnserr or 911.
+// @Tags DNS
+// @Produce plain
+// @Param hostname query string true "Hostnames to update, comma-separated"
+// @Param myip query string false "Addresses, comma-separated; the client's address when missing"
+// @Param myipv6 query string false "IPv6 addresses, comma-separated"
+// @Success 200 {string} string "good 192.0.2.1"
+// @Failure 401 {string} string "badauth"
+// @ID dynDnsUpdate
+// @Router /nic/update [get]
+func dynDnsUpdate(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := dynDnsToken(app, c)
+		if err != nil {
+			app.Log.Errorf("dynDnsUpdate: token lookup failed: %v", err)
+			c.String(http.StatusInternalServerError, DynDns911)
+			return
+		}
+		if token == nil {
+			app.Log.Warnf("dynDnsUpdate: no valid writable token (scheme %q)", authScheme(c.GetHeader("Authorization")))
+			c.Header("WWW-Authenticate", `Basic realm="dynamic-zones"`)
+			c.String(http.StatusUnauthorized, DynDnsBadauth)
+			return
+		}
+		app.TokenUsage.Record(token.ID, c.ClientIP())
+		setAuditActor(c, token.Username, AuthMethodApiToken, token.ID)
+
+		hostnames := splitList(c.Query("hostname"))
+		if len(hostnames) == 0 {
+			c.String(http.StatusBadRequest, DynDnsNotfqdn)
+			return
+		}
+		// Without myip the address the request came from, as forwarded by the
+		// ingress. A forged X-Forwarded-For gains nothing: myip is trusted anyway.
+		myip := c.Query("myip")
+		if myip == "" && c.Query("myipv6") == "" {
+			myip = c.ClientIP()
+		}
+		ips, err := parseDynDnsIPs(myip, c.Query("myipv6"))
+		if err != nil || len(ips) == 0 {
+			app.Log.Warnf("dynDnsUpdate: %s sent no usable address: %v", token.Username, err)
+			c.String(http.StatusBadRequest, DynDns911)
+			return
+		}
+
+		lines := make([]string, 0, len(hostnames))
+		for _, hostname := range hostnames {
+			status, resp, err := app.DynDnsUpdate(c.Request.Context(), token, hostname, ips)
+			if err != nil {
+				app.Log.Warn("dynDnsUpdate failed: ", err)
+				lines = append(lines, dynDnsCode(status))
+				continue
+			}
+			lines = append(lines, resp.(string))
+		}
+		c.String(http.StatusOK, strings.Join(lines, "\n"))
+	}
+}
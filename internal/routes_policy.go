@@ -18,6 +18,18 @@ type ZoneResponse struct {
 	// Whether this zone may be shared with additional owners (and policy-entitled
 	// users auto-join). Comes from the governing policy rule.
 	SharingAllowed bool `json:"sharing_allowed"`
+	// Whether the zone is created DNSSEC-signed, from the governing policy rule.
+	Dnssec bool `json:"dnssec"`
+	// The limits on records in this zone, from the governing policy rule.
+	RecordConstraints
+	// The base zone the rule grants that this zone is (or sits below); quotas
+	// are counted per base zone.
+	BaseZone string `json:"base_zone,omitempty"`
+	// The quotas of the governing policy rule.
+	ZoneQuotas
+	// Days the zone lives without renewal, from the governing policy rule; 0
+	// means forever.
+	LeaseDays uint32 `json:"lease_days,omitempty"`
 }
 
 // CreatePolicyApiGroup sets up the /policies API group and its routes.
@@ -104,7 +116,7 @@ func createPolicyRule(app *AppData) gin.HandlerFunc {
 		}
 
 		// Create Policy
-		createdRule, err := app.PolicyCreateRule(req)
+		createdRule, err := app.PolicyCreateRule(c.Request.Context(), req)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -168,7 +180,7 @@ func updatePolicyRule(app *AppData) gin.HandlerFunc {
 		}
 
 		// Update the rule
-		updatedRule, err := app.PolicyUpdateRule(id, req)
+		updatedRule, err := app.PolicyUpdateRule(c.Request.Context(), id, req)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -219,7 +231,7 @@ func deletePolicyRule(app *AppData) gin.HandlerFunc {
 		}
 
 		// Delete the rule
-		err = app.PolicyDeleteRule(id)
+		err = app.PolicyDeleteRule(c.Request.Context(), id)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
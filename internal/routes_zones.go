@@ -1,7 +1,10 @@
 package app
 
 import (
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,10 +23,150 @@ func CreateApiV1Zones(v1 *gin.RouterGroup, app *AppData) *gin.RouterGroup {
 	v1.POST("/zones/:zone/owners", addZoneOwner(app))
 	v1.DELETE("/zones/:zone/owners/:owner", removeZoneOwner(app))
 	v1.POST("/zones/:zone/keys/rotate", rotateZoneKeys(app))
+	v1.GET("/zones/:zone/keys/rotation", getZoneKeyRotation(app))
+
+	// Zone leases: zones of rules with lease_days expire unless renewed (owner-only).
+	v1.GET("/zones/:zone/lease", getZoneLease(app))
+	v1.POST("/zones/:zone/renew", renewZone(app))
+
+	// Trash: deleted zones are kept for a while and can be restored (owners and admins).
+	v1.GET("/trash", listZoneTrash(app))
+	v1.POST("/zones/:zone/restore", restoreZone(app))
+
+	// History: versions of a zone's records, their diffs and rollback (owner-only).
+	v1.GET("/zones/:zone/history", listZoneHistory(app))
+	v1.GET("/zones/:zone/history/:version", getZoneVersion(app))
+	v1.GET("/zones/:zone/history/:version/diff", diffZoneVersion(app))
+	v1.POST("/zones/:zone/history/:version/rollback", rollbackZone(app))
+
+	// Named keys: extra, optionally scoped TSIG keys of an owner (owner-only).
+	v1.GET("/zones/:zone/keys", listZoneKeys(app))
+	v1.POST("/zones/:zone/keys", createZoneKey(app))
+	v1.DELETE("/zones/:zone/keys/:keyname", deleteZoneKey(app))
+
+	// DNSSEC key rollover of a signed zone (owner-only).
+	v1.POST("/zones/:zone/dnssec/rollover", rolloverZoneDnssec(app))
+
+	// Zone files: BIND master format backup and migration (owner-only).
+	v1.GET("/zones/:zone/export", exportZone(app))
+	v1.POST("/zones/:zone/import", importZone(app))
+
+	// Declarative records: the complete desired record set (owner-only).
+	v1.PUT("/zones/:zone/records", replaceZoneRecords(app))
 
 	return v1
 }
 
+// maxZoneFileBytes bounds an imported zone file.
+const maxZoneFileBytes = 1 << 20
+
+// exportZone returns a zone as a BIND zone file.
+//
+//	@Summary		Export a zone file
+//	@Description	Returns all records of the zone as an RFC 1035 master file (BIND zone file), transferred with the caller's own key. Owner-only.
+//	@Tags			zones
+//	@Produce		plain
+//	@Security		Bearer
+//	@Param			zone	path		string			true	"The zone name."
+//	@Success		200		{string}	string			"The zone file."
+//	@Failure		403		{object}	map[string]any	"Forbidden."
+//	@ID				exportZone
+//	@Router			/v1/zones/{zone}/export [get]
+func exportZone(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		zone := c.Param("zone")
+		status, resp, err := app.ZoneExport(c.Request.Context(), user.PreferredUsername, zone)
+		if err != nil {
+			app.Log.Error("exportZone failed: ", err)
+			c.JSON(status, resp)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", zone+".zone"))
+		c.Data(status, "text/plain; charset=utf-8", []byte(resp.(string)))
+	}
+}
+
+// importZone makes a zone hold the records of a zone file.
+//
+//	@Summary		Import a zone file
+//	@Description	Parses the request body as an RFC 1035 master file (BIND zone file) and makes the zone hold exactly its records, in one atomic update. Apex SOA/NS, enforced default records and unsupported types are skipped and left as they are. Returns the diff; with dry_run=true nothing is changed. Owner-only.
+//	@Tags			zones
+//	@Accept			plain
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string				true	"The zone name."
+//	@Param			dry_run	query		bool				false	"Only return the diff."
+//	@Param			body	body		string				true	"The zone file."
+//	@Success		200		{object}	ZoneImportResponse	"The applied (or, for a dry run, pending) diff."
+//	@Failure		400		{object}	map[string]any		"Invalid zone file."
+//	@Failure		403		{object}	map[string]any		"Forbidden."
+//	@ID				importZone
+//	@Router			/v1/zones/{zone}/import [post]
+func importZone(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		zone := c.Param("zone")
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxZoneFileBytes))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Zone file unreadable or larger than %d bytes", maxZoneFileBytes)})
+			return
+		}
+		dryRun := c.Query("dry_run") == "true"
+
+		status, resp, err := app.ZoneImport(c.Request.Context(), user.PreferredUsername, zone, string(body), dryRun)
+		if err != nil {
+			app.Log.Error("importZone failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// replaceZoneRecords makes a zone hold a complete desired record set.
+//
+//	@Summary		Replace the records of a zone
+//	@Description	Takes the complete desired record set of the zone as JSON or, with a YAML Content-Type, as YAML, compares it with a zone transfer and makes the zone hold exactly these records, in one atomic update. Apex SOA/NS, enforced default records and unsupported types are skipped and left as they are; with keep_foreign the records of external-dns (its TXT ownership markers and the records they mark) and with ignore further names are left alone too. Returns the plan; with dry_run=true nothing is changed. Owner-only.
+//	@Tags			zones
+//	@Accept			json,application/x-yaml
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string				true	"The zone name."
+//	@Param			dry_run	query		bool				false	"Only return the plan."
+//	@Param			body	body		ZoneRecordsRequest	true	"The desired records."
+//	@Success		200		{object}	ZoneImportResponse	"The applied (or, for a dry run, pending) diff."
+//	@Failure		400		{object}	map[string]any		"Invalid records."
+//	@Failure		403		{object}	map[string]any		"Forbidden."
+//	@ID				replaceZoneRecords
+//	@Router			/v1/zones/{zone}/records [put]
+func replaceZoneRecords(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		zone := c.Param("zone")
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxZoneFileBytes)
+		var req ZoneRecordsRequest
+		var err error
+		switch c.ContentType() {
+		case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+			err = c.ShouldBindYAML(&req)
+		default:
+			err = c.ShouldBindJSON(&req)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+		dryRun := c.Query("dry_run") == "true"
+
+		status, resp, err := app.ZoneRecordsReplace(c.Request.Context(), user.PreferredUsername, zone, req, dryRun)
+		if err != nil {
+			app.Log.Error("replaceZoneRecords failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
 // AddOwnerRequest is the request body for adding a zone owner.
 type AddOwnerRequest struct {
 	Email string `json:"email" binding:"required"`
@@ -134,19 +277,415 @@ func removeZoneOwner(app *AppData) gin.HandlerFunc {
 // rotateZoneKeys regenerates every owner's TSIG key for a zone.
 //
 //	@Summary		Rotate zone keys
-//	@Description	Regenerates the TSIG key of every owner (e.g. after a suspected key compromise). Owner-only; all owners must re-fetch their key.
+//	@Description	Regenerates the TSIG key of every owner. Owner-only; all owners must re-fetch their key.
+//	@Description	With a grace period configured (ZONE_DEFAULTS_KEY_ROTATION_GRACE) the new keys are issued under new names next to the old ones, which keep working until cutoff_at and are then deleted; the rotation state is returned. immediate=true (e.g. after a suspected key compromise) replaces the keys at once.
+//	@Description	With key_algorithm the new keys switch to that algorithm; otherwise they keep the zone's current one.
 //	@Tags			zones
 //	@Produce		json
 //	@Security		Bearer
-//	@Param			zone	path		string			true	"The zone name."
-//	@Success		200		{object}	map[string]any	"Rotation result."
+//	@Param			zone			path		string			true	"The zone name."
+//	@Param			key_algorithm	query		string				false	"TSIG algorithm of the new keys, one of the configured ones (see GET /v1/zones/)."
+//	@Param			immediate		query		bool				false	"Replace the old keys at once instead of after the grace period."
+//	@Success		200				{object}	KeyRotationStatus	"Rotation state (graceful), or the number of rotated keys (immediate)."
+//	@Failure		409				{object}	ErrorResponse		"A graceful rotation is in progress."
 //	@ID				rotateZoneKeys
 //	@Router			/v1/zones/{zone}/keys/rotate [post]
 func rotateZoneKeys(app *AppData) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user := c.MustGet(UserDataKey).(*UserClaims)
 		zone := c.Param("zone")
-		status, resp, _ := app.ZoneRotateKeys(c.Request.Context(), user, zone)
+		status, resp, _ := app.ZoneRotateKeys(c.Request.Context(), user, zone, c.Query("key_algorithm"), c.Query("immediate") == "true")
+		c.JSON(status, resp)
+	}
+}
+
+// getZoneKeyRotation returns the key rotation state of a zone.
+//
+//	@Summary		Get the key rotation state
+//	@Description	Returns whether a graceful key rotation is in progress, each owner's old and new key name, and the cutoff at which the old keys are deleted. Owner-only.
+//	@Tags			zones
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string				true	"The zone name."
+//	@Success		200		{object}	KeyRotationStatus	"Rotation state."
+//	@Failure		403		{object}	ErrorResponse		"Not an owner of the zone."
+//	@ID				getZoneKeyRotation
+//	@Router			/v1/zones/{zone}/keys/rotation [get]
+func getZoneKeyRotation(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		status, resp, err := app.ZoneKeyRotationStatus(c.Request.Context(), user, c.Param("zone"))
+		if err != nil {
+			app.Log.Error("getZoneKeyRotation failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// getZoneLease returns the lease of a zone.
+//
+//	@Summary		Get the zone lease
+//	@Description	Returns how long the zone lives without renewal (lease_days of its policy rule, 0 = forever), when the lease expires, whether the owners were warned, and for a disabled zone when it is deleted. Owner-only.
+//	@Tags			zones
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string			true	"The zone name."
+//	@Success		200		{object}	ZoneLease		"Lease state."
+//	@Failure		403		{object}	ErrorResponse	"Not an owner of the zone."
+//	@ID				getZoneLease
+//	@Router			/v1/zones/{zone}/lease [get]
+func getZoneLease(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		status, resp, err := app.ZoneLeaseStatus(c.Request.Context(), user.PreferredUsername, c.Param("zone"))
+		if err != nil {
+			app.Log.Error("getZoneLease failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// renewZone renews the lease of a zone.
+//
+//	@Summary		Renew a zone
+//	@Description	Starts a new lease of lease_days for the zone. Changing a record renews the lease as well, also through RFC 2136. When a lease expires the records of the zone are disabled (SOA, NS and DS stay); renewing a disabled zone enables them again, until it is deleted after ZONE_DEFAULTS_LEASE_GRACE_DAYS. Owner-only.
+//	@Tags			zones
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string			true	"The zone name."
+//	@Success		200		{object}	ZoneLease		"The new lease."
+//	@Failure		403		{object}	ErrorResponse	"Not an owner of the zone."
+//	@Failure		502		{object}	ErrorResponse	"The records could not be enabled."
+//	@ID				renewZone
+//	@Router			/v1/zones/{zone}/renew [post]
+func renewZone(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		status, resp, err := app.ZoneRenew(c.Request.Context(), user.PreferredUsername, c.Param("zone"))
+		if err != nil {
+			app.Log.Error("renewZone failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// listZoneTrash lists the deleted zones the caller may restore.
+//
+//	@Summary		List deleted zones
+//	@Description	Lists the deleted zones in the trash, newest first, with the owners and records they are restored with. Owners see the zones they owned; super-admins see all, delegated admins those within their zone suffixes. Deleted zones are kept for ZONE_DEFAULTS_TRASH_RETENTION_DAYS.
+//	@Tags			zones
+//	@Produce		json
+//	@Security		Bearer
+//	@Success		200	{array}		DeletedZone		"The deleted zones."
+//	@Failure		500	{object}	ErrorResponse	"Internal server error."
+//	@ID				listZoneTrash
+//	@Router			/v1/trash [get]
+func listZoneTrash(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		status, resp, err := app.ZoneTrashList(c.Request.Context(), user)
+		if err != nil {
+			app.Log.Error("listZoneTrash failed: ", err)
+			c.JSON(status, resp)
+			return
+		}
+
+		// A token limited to zones sees only those.
+		visible := make([]DeletedZone, 0)
+		for _, z := range resp.([]DeletedZone) {
+			if requestAllowsZone(c, z.Zone) {
+				visible = append(visible, z)
+			}
+		}
+		c.JSON(status, visible)
+	}
+}
+
+// restoreZone restores a deleted zone from the trash.
+//
+//	@Summary		Restore a deleted zone
+//	@Description	Recreates a deleted zone from the trash for the owners it had, with new TSIG keys, and writes its records back. Named keys are not restored. Owners may restore a zone a policy rule still grants to one of them; admins any zone within their scope.
+//	@Tags			zones
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string			true	"The zone name."
+//	@Param			id		query		int				false	"The deletion to restore, if the zone was deleted more than once (default: the latest)."
+//	@Success		201		{object}	map[string]any	"The restored zone, its owners and the number of RRsets written."
+//	@Failure		400		{object}	ErrorResponse	"Invalid id."
+//	@Failure		403		{object}	ErrorResponse	"No rule grants the zone anymore."
+//	@Failure		404		{object}	ErrorResponse	"The zone is not in the trash."
+//	@Failure		409		{object}	ErrorResponse	"The zone exists again."
+//	@ID				restoreZone
+//	@Router			/v1/zones/{zone}/restore [post]
+func restoreZone(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		var id uint64
+		if v := c.Query("id"); v != "" {
+			var err error
+			if id, err = strconv.ParseUint(v, 10, 32); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid id"})
+				return
+			}
+		}
+		status, resp, err := app.ZoneRestore(c.Request.Context(), user, c.Param("zone"), uint(id))
+		if err != nil {
+			app.Log.Error("restoreZone failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// zoneVersionParam parses a version ID; with current, "current" is 0, the
+// records the zone holds now.
+func zoneVersionParam(c *gin.Context, value string, current bool) (uint, bool) {
+	if current && value == "current" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid version"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// listZoneHistory lists the versions of a zone.
+//
+//	@Summary		List zone versions
+//	@Description	Lists the versions of the zone's records, newest first, without the records. A version is stored after every change through the API and, for changes sent straight to the nameserver over RFC 2136, by a periodic zone transfer. SOA, NS, DNSSEC and enforced default records are not part of it. Owner-only.
+//	@Tags			zones
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string			true	"The zone name."
+//	@Param			limit	query		int				false	"At most this many versions (default 50, max 500)."
+//	@Success		200		{array}		ZoneVersion		"The versions."
+//	@Failure		400		{object}	ErrorResponse	"Invalid limit."
+//	@Failure		403		{object}	ErrorResponse	"Not an owner of the zone."
+//	@ID				listZoneHistory
+//	@Router			/v1/zones/{zone}/history [get]
+func listZoneHistory(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		limit := zoneHistoryDefaultLimit
+		if v := c.Query("limit"); v != "" {
+			var err error
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > zoneHistoryMaxLimit {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid limit, expected 1 to " + strconv.Itoa(zoneHistoryMaxLimit)})
+				return
+			}
+		}
+		status, resp, err := app.ZoneHistory(c.Request.Context(), user.PreferredUsername, c.Param("zone"), limit)
+		if err != nil {
+			app.Log.Error("listZoneHistory failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// getZoneVersion returns one version of a zone with its records.
+//
+//	@Summary		Get a zone version
+//	@Description	Returns one version of the zone with its RRsets. Owner-only.
+//	@Tags			zones
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string			true	"The zone name."
+//	@Param			version	path		int				true	"The version ID."
+//	@Success		200		{object}	ZoneVersion		"The version."
+//	@Failure		403		{object}	ErrorResponse	"Not an owner of the zone."
+//	@Failure		404		{object}	ErrorResponse	"No such version."
+//	@ID				getZoneVersion
+//	@Router			/v1/zones/{zone}/history/{version} [get]
+func getZoneVersion(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		id, ok := zoneVersionParam(c, c.Param("version"), false)
+		if !ok {
+			return
+		}
+		status, resp, err := app.ZoneVersionDetail(c.Request.Context(), user.PreferredUsername, c.Param("zone"), id)
+		if err != nil {
+			app.Log.Error("getZoneVersion failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// diffZoneVersion compares two versions of a zone.
+//
+//	@Summary		Diff zone versions
+//	@Description	Returns the records added and removed from version `from` (default: the version before) to this version, in zone file format. The version "current" is the records the zone holds now; comparing with it needs `from`. Owner-only.
+//	@Tags			zones
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string			true	"The zone name."
+//	@Param			version	path		string			true	"The version ID, or current."
+//	@Param			from	query		int				false	"The version to compare with."
+//	@Success		200		{object}	ZoneDiff		"The diff."
+//	@Failure		400		{object}	ErrorResponse	"Invalid version."
+//	@Failure		403		{object}	ErrorResponse	"Not an owner of the zone."
+//	@Failure		404		{object}	ErrorResponse	"No such version."
+//	@ID				diffZoneVersion
+//	@Router			/v1/zones/{zone}/history/{version}/diff [get]
+func diffZoneVersion(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		to, ok := zoneVersionParam(c, c.Param("version"), true)
+		if !ok {
+			return
+		}
+		var from uint
+		if v := c.Query("from"); v != "" {
+			if from, ok = zoneVersionParam(c, v, false); !ok {
+				return
+			}
+		}
+		status, resp, err := app.ZoneVersionDiff(c.Request.Context(), user.PreferredUsername, c.Param("zone"), from, to)
+		if err != nil {
+			app.Log.Error("diffZoneVersion failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// rollbackZone rolls a zone back to a version.
+//
+//	@Summary		Roll a zone back
+//	@Description	Makes the zone hold the records of the version again, in one atomic change, and returns what was added and removed. Records the rule of the zone no longer allows, or more records than its quota, are refused. SOA, NS, DNSSEC and enforced default records stay as they are. Owner-only.
+//	@Tags			zones
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string			true	"The zone name."
+//	@Param			version	path		int				true	"The version ID."
+//	@Param			dry_run	query		bool			false	"Only return the diff."
+//	@Success		200		{object}	ZoneDiff		"The changes."
+//	@Failure		403		{object}	ErrorResponse	"Not an owner of the zone, or the version breaks the policy."
+//	@Failure		404		{object}	ErrorResponse	"No such version."
+//	@Failure		502		{object}	ErrorResponse	"The DNS server refused the change."
+//	@ID				rollbackZone
+//	@Router			/v1/zones/{zone}/history/{version}/rollback [post]
+func rollbackZone(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		id, ok := zoneVersionParam(c, c.Param("version"), false)
+		if !ok {
+			return
+		}
+		dryRun := c.Query("dry_run") == "true"
+		status, resp, err := app.ZoneRollback(c.Request.Context(), user.PreferredUsername, c.Param("zone"), id, dryRun)
+		if err != nil {
+			app.Log.Error("rollbackZone failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// listZoneKeys lists the caller's named keys of a zone.
+//
+//	@Summary		List named zone keys
+//	@Description	Lists the caller's named TSIG keys of a zone, without their secrets. Owner-only.
+//	@Tags			zones
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string			true	"The zone name."
+//	@Success		200		{object}	map[string]any	"The keys."
+//	@Failure		403		{object}	ErrorResponse	"Not an owner of the zone."
+//	@ID				listZoneKeys
+//	@Router			/v1/zones/{zone}/keys [get]
+func listZoneKeys(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		status, resp, err := app.ZoneKeysList(c.Request.Context(), user, c.Param("zone"))
+		if err != nil {
+			app.Log.Error("listZoneKeys failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// createZoneKey creates a named key of the caller on a zone.
+//
+//	@Summary		Create a named zone key
+//	@Description	Creates an extra TSIG key of the caller for a zone, with an optional label and expiry. allowed_record_types and name_prefix scope the key: PowerDNS cannot check a scope, so a scoped key may transfer the zone but only writes through the record API, which enforces it (direct_updates is false). An unscoped key also updates the nameserver directly. The secret is returned only now. Owner-only.
+//	@Tags			zones
+//	@Accept			json
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string			true	"The zone name."
+//	@Param			body	body		NamedKeyRequest	true	"The key to create."
+//	@Success		201		{object}	NamedKeyCreated	"The key with its secret."
+//	@Failure		400		{object}	ErrorResponse	"Invalid scope, algorithm or expiry."
+//	@Failure		403		{object}	ErrorResponse	"Not an owner of the zone."
+//	@Failure		409		{object}	ErrorResponse	"Too many keys."
+//	@Failure		502		{object}	ErrorResponse	"PowerDNS failed."
+//	@ID				createZoneKey
+//	@Router			/v1/zones/{zone}/keys [post]
+func createZoneKey(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		var req NamedKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+			return
+		}
+		status, resp, err := app.ZoneKeyCreate(c.Request.Context(), user, c.Param("zone"), req)
+		if err != nil {
+			app.Log.Error("createZoneKey failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// deleteZoneKey revokes one of the caller's named keys.
+//
+//	@Summary		Revoke a named zone key
+//	@Description	Revokes and deletes one of the caller's named TSIG keys of a zone; it stops working at once. Owner-only.
+//	@Tags			zones
+//	@Security		Bearer
+//	@Param			zone	path	string	true	"The zone name."
+//	@Param			keyname	path	string	true	"The name of the key."
+//	@Success		204		"Key revoked."
+//	@Failure		403		{object}	ErrorResponse	"Not an owner of the zone."
+//	@Failure		404		{object}	ErrorResponse	"No such key of the caller."
+//	@Failure		502		{object}	ErrorResponse	"PowerDNS failed."
+//	@ID				deleteZoneKey
+//	@Router			/v1/zones/{zone}/keys/{keyname} [delete]
+func deleteZoneKey(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		status, resp, err := app.ZoneKeyDelete(c.Request.Context(), user, c.Param("zone"), c.Param("keyname"))
+		if err != nil {
+			app.Log.Error("deleteZoneKey failed: ", err)
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// rolloverZoneDnssec runs one phase of a DNSSEC key rollover.
+//
+//	@Summary		Roll the DNSSEC keys of a zone
+//	@Description	Replaces the signing key of a signed zone in two phases. "start" publishes a new key and adds its DS next to the old one; "finish", once the DNSKEY and DS TTLs have passed, signs with the new key and deletes the old one. The DS in the parent zone is updated by the service where it holds the parent; otherwise update it upstream from the returned DS records between the phases. Owner-only.
+//	@Tags			zones
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			zone	path		string			true	"The zone name."
+//	@Param			phase	query		string			true	"Rollover phase"	Enums(start, finish)
+//	@Success		200		{object}	DnssecInfo		"Keys and DS records after the phase."
+//	@Failure		400		{object}	ErrorResponse	"Invalid phase."
+//	@Failure		403		{object}	ErrorResponse	"Not an owner of the zone."
+//	@Failure		409		{object}	ErrorResponse	"Zone unsigned, or the phase does not fit the rollover state."
+//	@Failure		502		{object}	ErrorResponse	"PowerDNS failed."
+//	@ID				rolloverZoneDnssec
+//	@Router			/v1/zones/{zone}/dnssec/rollover [post]
+func rolloverZoneDnssec(app *AppData) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(UserDataKey).(*UserClaims)
+		zone := c.Param("zone")
+		status, resp, err := app.ZoneDnssecRollover(c.Request.Context(), user, zone, c.Query("phase"))
+		if err != nil {
+			app.Log.Error("rolloverZoneDnssec failed: ", err)
+		}
 		c.JSON(status, resp)
 	}
 }
@@ -154,6 +693,8 @@ func rotateZoneKeys(app *AppData) gin.HandlerFunc {
 // AvailableZonesResponse defines the structure of the response for the /v1/zones/ endpoint.
 type AvailableZonesResponse struct {
 	Zones []ZoneStatus `json:"zones"`
+	// KeyAlgorithms are the TSIG algorithms zone keys may use, the default first.
+	KeyAlgorithms []string `json:"key_algorithms"`
 }
 
 type ZoneStatus struct {
@@ -173,12 +714,14 @@ type ZoneStatus struct {
 	Owners []string `json:"owners,omitempty"`
 	// SharingAllowed: whether this zone may be shared (governing rule opt-in).
 	SharingAllowed bool `json:"sharing_allowed"`
+	// Usage: what the zone uses of its rule's quotas (absent for orphaned zones).
+	Usage *ZoneUsage `json:"usage,omitempty"`
 }
 
 // getZones returns a list of available DNS zones for the authenticated user.
 //
 //	@Summary		Get available zones
-//	@Description	Retrieves a list of DNS zones that the user is allowed to access.
+//	@Description	Retrieves a list of DNS zones that the user is allowed to access, with their usage of the governing rule's quotas.
 //	@Tags			zones
 //	@Accept			json
 //	@Produce		json
@@ -204,6 +747,13 @@ func getZones(app *AppData) gin.HandlerFunc {
 		app.Log.Debugf("Zones for user by policy: %+v", userZones)
 		zonesWithStatus := make([]ZoneStatus, 0, len(userZones))
 
+		createdZones, err := app.Storage.ListUserZones(user.PreferredUsername)
+		if err != nil {
+			app.Log.Errorf("Error listing user zones: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list user zones"})
+			return
+		}
+
 		for _, zone := range userZones {
 			existsInStorage, err := app.Storage.ZoneExists(zone.Zone)
 			if err != nil {
@@ -243,6 +793,7 @@ func getZones(app *AppData) gin.HandlerFunc {
 				AllowSubdomains:           zone.AllowSubdomains,
 				SharingAllowed:            zone.SharingAllowed,
 				Owners:                    owners,
+				Usage:                     app.zoneUsage(c.Request.Context(), user.PreferredUsername, createdZones, &zone, existsInStorage && isOwner),
 			})
 		}
 
@@ -259,13 +810,6 @@ func getZones(app *AppData) gin.HandlerFunc {
 			}
 		}
 
-		createdZones, err := app.Storage.ListUserZones(user.PreferredUsername)
-		if err != nil {
-			app.Log.Errorf("Error listing user zones: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list user zones"})
-			return
-		}
-
 		// A zone held through SHARING rather than policy is a base zone too, so
 		// resolve the governing rule of every owned zone up front and let those
 		// that allow subdomains act as parents below. Without this a co-owner's
@@ -305,17 +849,22 @@ func getZones(app *AppData) gin.HandlerFunc {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list zone owners"})
 				return
 			}
+			def := govDefs[cz.Zone]
+			var usage *ZoneUsage
+			if def != nil {
+				usage = app.zoneUsage(c.Request.Context(), user.PreferredUsername, createdZones, def, true)
+			}
 			if parent == "" {
 				// A zone the user owns that is neither a policy base zone nor a
 				// subzone of one -> a zone SHARED with them (or orphaned). Show it as
 				// a top-level managed zone, using its governing rule's flags.
-				def := govDefs[cz.Zone]
 				zonesWithStatus = append(zonesWithStatus, ZoneStatus{
 					Name:            cz.Zone,
 					Exists:          true,
 					AllowSubdomains: def != nil && def.AllowSubdomains,
 					SharingAllowed:  def != nil && def.SharingAllowed,
 					Owners:          zOwners,
+					Usage:           usage,
 				})
 				continue
 			}
@@ -326,10 +875,19 @@ func getZones(app *AppData) gin.HandlerFunc {
 				SharingAllowed:  baseSharing[parent], // and the parent's sharing setting
 				Parent:          parent,
 				Owners:          zOwners,
+				Usage:           usage,
 			})
 		}
 
-		zones := AvailableZonesResponse{Zones: zonesWithStatus}
+		// A token limited to zones sees only those.
+		visible := zonesWithStatus[:0]
+		for _, z := range zonesWithStatus {
+			if requestAllowsZone(c, z.Name) {
+				visible = append(visible, z)
+			}
+		}
+
+		zones := AvailableZonesResponse{Zones: visible, KeyAlgorithms: app.tsigAlgorithms()}
 
 		app.Log.Debug("🟢 Returning zones: ", zones)
 		c.JSON(http.StatusOK, zones)
@@ -417,6 +975,7 @@ func getZone(app *AppData) gin.HandlerFunc {
 //	@Produce		json
 //	@Security		Bearer
 //	@Param		zone	path	string	true	"The name of the zone to create."
+//	@Param		key_algorithm	query	string	false	"TSIG algorithm of the zone key, one of the configured ones (see GET /v1/zones/). Defaults to the first."
 //	@Success		201	{object}	ZoneDataResponse	"The created DNS zone."
 //	@Failure		400	{object}	map[string]any	"Bad request."
 //	@Failure		403	{object}	map[string]any	"Forbidden."
@@ -463,7 +1022,7 @@ func postZone(app *AppData) gin.HandlerFunc {
 
 		app.Log.Infof("User is allowed to create zone: %s for user: %s", zone, user.PreferredUsername)
 
-		statusCode, returnValue, err := app.ZoneCreate(ctx, user.PreferredUsername, *zoneDef)
+		statusCode, returnValue, err := app.ZoneCreate(ctx, user.PreferredUsername, *zoneDef, c.Query("key_algorithm"))
 		if err != nil {
 			app.Log.Error("Failed: ", err)
 		}
@@ -20,9 +20,22 @@ const ApiTokenPrefix = "dynz_token_"
 
 type Zone struct {
 	gorm.Model
-	Zone              string    `gorm:"primaryKey" json:"domain"`
-	Username          string    `gorm:"index" json:"user"`
+	Zone     string `gorm:"primaryKey" json:"domain"`
+	Username string `gorm:"index" json:"user"`
+	// RequiresRefreshAt is when the lease of the zone expires, if its rule
+	// sets lease_days. All owner rows of a zone share the lease state.
 	RequiresRefreshAt time.Time `json:"requires_refresh_at"`
+	// LeaseWarnedAt is when the owners were warned that the lease expires.
+	LeaseWarnedAt *time.Time `json:"lease_warned_at,omitempty"`
+	// DisabledAt is when the records of the zone were disabled because the
+	// lease expired.
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	// SuspendedAt is when an admin disabled the records of the zone; they
+	// stay disabled until an admin enables them, whatever the lease does.
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+	// LeaseSerial is the SOA serial last seen by the lease check; a newer one
+	// means the zone was changed, which renews the lease.
+	LeaseSerial uint32 `gorm:"not null;default:0" json:"-"`
 }
 
 type Token struct {
@@ -46,6 +59,14 @@ type Token struct {
 	TokenString string    `gorm:"-" json:"token_string,omitempty" example:"dynz_token_abcdef123456" swagger:"desc(The API token — returned ONLY when it is created)"`
 	ExpiresAt   time.Time `json:"expires_at" example:"2025-12-31T23:59:59Z" swagger:"desc(Token expiration date and time)"`
 	ReadOnly    bool      `json:"read_only" gorm:"default:false" example:"false"`
+	// TokenScope limits the token to zones, permissions and addresses.
+	TokenScope
+	// LastUsedAt and LastUsedIP are when and from where the token last
+	// authenticated a request, written in batches (see TokenUsage).
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" example:"2025-11-05T08:30:00Z"`
+	LastUsedIP string     `gorm:"type:varchar(64)" json:"last_used_ip,omitempty" example:"192.0.2.7"`
+	// ExpiryNotifiedAt is when the owner was warned that the token expires.
+	ExpiryNotifiedAt *time.Time `json:"expiry_notified_at,omitempty"`
 }
 
 // PolicyRule represents a DNS policy rule.
@@ -63,9 +84,22 @@ type PolicyRule struct {
 	// (and policy-entitled users auto-join). Off by default (opt-in per rule);
 	// added via GORM AutoMigrate (new column, defaults to false -> backfills
 	// existing rules to false, preserving the old single-owner behaviour).
-	SharingAllowed bool      `gorm:"not null;default:false" json:"sharing_allowed"`
-	Description    string    `gorm:"type:text;default:null" json:"description,omitempty"`
-	CreatedAt      time.Time `json:"created_at"`
+	SharingAllowed bool `gorm:"not null;default:false" json:"sharing_allowed"`
+	// Dnssec signs the zones created under the rule and publishes their DS in
+	// the parent zone. Existing rules stay unsigned (new column, false).
+	Dnssec bool `gorm:"not null;default:false" json:"dnssec"`
+	// RecordConstraints limit the records written into matched zones. New
+	// nullable/zero-default columns via AutoMigrate: existing rules stay
+	// unrestricted.
+	RecordConstraints
+	// ZoneQuotas bound the zones and records handed out under the rule. New
+	// zero-default columns via AutoMigrate: existing rules stay unlimited.
+	ZoneQuotas
+	// LeaseDays is how long a zone of the rule lives without being renewed or
+	// changed; 0 (the default for existing rules) keeps zones forever.
+	LeaseDays   uint32    `gorm:"not null;default:0" json:"lease_days,omitempty"`
+	Description string    `gorm:"type:text;default:null" json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 // DelegationPolicy grants a user (or wildcard filter) the right to manage
@@ -131,14 +165,36 @@ func NewStorage(dbType string, connectionString string) (*Storage, error) {
 	sqlDB.SetMaxOpenConns(10)
 	sqlDB.SetMaxIdleConns(5)
 
-	err = db.AutoMigrate(&Zone{}, &Token{}, &PolicyRule{}, &DelegationPolicy{})
+	err = db.AutoMigrate(&Zone{}, &Token{}, &PolicyRule{}, &DelegationPolicy{}, &AuditEvent{}, &NamedKey{}, &KeyRotation{}, &Webhook{}, &WebhookDelivery{}, &DeletedZone{}, &ZoneVersion{})
 	if err != nil {
 		return nil, fmt.Errorf("storage.NewStorage: Failed to auto-migrate database: %w", err)
 	}
+	if err := migrateZoneBoundTokens(db); err != nil {
+		return nil, fmt.Errorf("storage.NewStorage: %w", err)
+	}
 
 	return &Storage{db: db}, nil
 }
 
+// migrateZoneBoundTokens turns the DynDNS tokens bound to one zone by the
+// former tokens.zone column into tokens limited to that zone and to writing
+// records, and drops the column. Without it they would come back unrestricted.
+func migrateZoneBoundTokens(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Token{}, "zone") {
+		return nil
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE tokens SET zones = zone, scopes = ? WHERE zone IS NOT NULL AND zone <> ''", TokenScopeRecordsWrite).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&Token{}, "zone")
+	})
+	if err != nil {
+		return fmt.Errorf("migrateZoneBoundTokens: %w", err)
+	}
+	return nil
+}
+
 func (storage *Storage) GetAllZones(ctx context.Context, ch chan<- Zone) error {
 	defer close(ch)
 
@@ -204,8 +260,14 @@ func (storage *Storage) GetZone(user string, zone string) (*Zone, error) {
 
 func (storage *Storage) CreateZone(user string, zone string, requiresRefreshAt time.Time) (*Zone, error) {
 	d := &Zone{
-		Username: user,
-		Zone:     zone,
+		Username:          user,
+		Zone:              zone,
+		RequiresRefreshAt: requiresRefreshAt,
+	}
+	// A zone has one lease: a new owner joins the current one.
+	var current Zone
+	if err := storage.db.Where("zone = ?", zone).Order("requires_refresh_at desc").Take(&current).Error; err == nil {
+		d.RequiresRefreshAt, d.LeaseWarnedAt, d.DisabledAt, d.LeaseSerial = current.RequiresRefreshAt, current.LeaseWarnedAt, current.DisabledAt, current.LeaseSerial
 	}
 	if err := storage.db.Create(d).Error; err != nil {
 		return nil, fmt.Errorf("storage.CreateZone: Failed to create zone ('%s') for user ('%s'): %w", zone, user, err)
@@ -311,6 +373,15 @@ func (storage *Storage) GetTokens(ctx context.Context, username string) ([]Token
 	return validTokens, nil
 }
 
+// CountTokens returns how many unexpired API tokens are stored (across all users).
+func (storage *Storage) CountTokens() (int64, error) {
+	var n int64
+	if err := storage.db.Model(&Token{}).Where("expires_at > ?", time.Now()).Count(&n).Error; err != nil {
+		return 0, fmt.Errorf("storage.CountTokens: %w", err)
+	}
+	return n, nil
+}
+
 // HashToken is the one-way mapping from a token to what the database stores.
 func HashToken(tokenString string) string {
 	sum := sha256.Sum256([]byte(tokenString))
@@ -328,7 +399,8 @@ func tokenDisplayPrefix(tokenString string) string {
 	return tokenString[:shown]
 }
 
-func (storage *Storage) CreateToken(ctx context.Context, username string, ttl time.Duration, readOnly bool) (*Token, error) {
+// CreateToken issues a token to username, limited to scope.
+func (storage *Storage) CreateToken(ctx context.Context, username string, ttl time.Duration, readOnly bool, scope TokenScope) (*Token, error) {
 	// Generate a secure random token string
 	b := make([]byte, 16) // 16 bytes → 32 hex chars
 	if _, err := rand.Read(b); err != nil {
@@ -343,6 +415,7 @@ func (storage *Storage) CreateToken(ctx context.Context, username string, ttl ti
 		TokenPrefix: tokenDisplayPrefix(tokenString),
 		ExpiresAt:   time.Now().Add(ttl),
 		ReadOnly:    readOnly,
+		TokenScope:  scope,
 	}
 
 	if err := storage.db.WithContext(ctx).Create(token).Error; err != nil {
@@ -354,6 +427,36 @@ func (storage *Storage) CreateToken(ctx context.Context, username string, ttl ti
 	return token, nil
 }
 
+// TokenTouch records that token id was last used at from ip.
+func (storage *Storage) TokenTouch(id uint, at time.Time, ip string) error {
+	err := storage.db.Model(&Token{}).Where("id = ?", id).
+		Updates(map[string]any{"last_used_at": at, "last_used_ip": ip}).Error
+	if err != nil {
+		return fmt.Errorf("storage.TokenTouch: %w", err)
+	}
+	return nil
+}
+
+// TokensExpiringBefore returns the unexpired tokens that expire before
+// deadline and whose owner was not warned yet.
+func (storage *Storage) TokensExpiringBefore(deadline time.Time) ([]Token, error) {
+	var tokens []Token
+	err := storage.db.Where("expires_at > ? AND expires_at <= ? AND expiry_notified_at IS NULL", time.Now(), deadline).
+		Order("expires_at asc").Find(&tokens).Error
+	if err != nil {
+		return nil, fmt.Errorf("storage.TokensExpiringBefore: %w", err)
+	}
+	return tokens, nil
+}
+
+// TokenMarkNotified records that the owner of token id was warned at.
+func (storage *Storage) TokenMarkNotified(id uint, at time.Time) error {
+	if err := storage.db.Model(&Token{}).Where("id = ?", id).Update("expiry_notified_at", at).Error; err != nil {
+		return fmt.Errorf("storage.TokenMarkNotified: %w", err)
+	}
+	return nil
+}
+
 func (storage *Storage) DeleteToken(ctx context.Context, username string, id int) (int, gin.H, error) {
 	result := storage.db.WithContext(ctx).
 		Where("username = ? AND id = ?", username, id).
@@ -423,7 +526,9 @@ func (s *Storage) PolicyUpdate(rule *PolicyRule) (*PolicyRule, error) {
 	// field here also forces GORM to write its ZERO value (Updates skips zero fields of a
 	// struct otherwise) — required for booleans like SharingAllowed/AllowSubdomains so
 	// that toggling them OFF actually persists (SEC #9: sharing must be revocable).
-	result := s.db.Model(rule).Select("ZonePattern", "ZoneSoa", "TargetUserFilter", "AllowSubdomains", "Description", "SharingAllowed").Updates(rule)
+	result := s.db.Model(rule).Select("ZonePattern", "ZoneSoa", "TargetUserFilter", "AllowSubdomains", "Description", "SharingAllowed", "Dnssec",
+		"AllowedRecordTypes", "AllowedNamePatterns", "AllowedNetworks", "MinTTL", "MaxTTL",
+		"MaxZonesPerUser", "MaxSubzoneDepth", "MaxRecordsPerZone", "LeaseDays").Updates(rule)
 
 	if result.Error != nil {
 		return nil, fmt.Errorf("storage.Update: Failed to update rule %d: %w", rule.ID, result.Error)
@@ -524,6 +629,16 @@ func (s *Storage) ListAllZones() ([]Zone, error) {
 	return zones, nil
 }
 
+// CountZones returns how many zones are stored (across all users); a zone with
+// several owners counts once.
+func (s *Storage) CountZones() (int64, error) {
+	var n int64
+	if err := s.db.Model(&Zone{}).Distinct("zone").Count(&n).Error; err != nil {
+		return 0, fmt.Errorf("storage.CountZones: %w", err)
+	}
+	return n, nil
+}
+
 // GetZoneByName looks up a zone by its name (zone names are unique/primary key).
 // Returns (nil, nil) if no such zone exists.
 func (s *Storage) GetZoneByName(zone string) (*Zone, error) {
@@ -17,11 +17,11 @@ func TestExpiredTokenDoesNotAuthenticate(t *testing.T) {
 	}
 	ctx := context.Background()
 
-	valid, err := db.CreateToken(ctx, "alice", time.Hour, false)
+	valid, err := db.CreateToken(ctx, "alice", time.Hour, false, TokenScope{})
 	if err != nil {
 		t.Fatalf("create valid token: %v", err)
 	}
-	expired, err := db.CreateToken(ctx, "alice", -time.Minute, false)
+	expired, err := db.CreateToken(ctx, "alice", -time.Minute, false, TokenScope{})
 	if err != nil {
 		t.Fatalf("create expired token: %v", err)
 	}
@@ -49,7 +49,7 @@ func TestTokensAreStoredHashed(t *testing.T) {
 	}
 	ctx := context.Background()
 
-	created, err := db.CreateToken(ctx, "alice", time.Hour, false)
+	created, err := db.CreateToken(ctx, "alice", time.Hour, false, TokenScope{})
 	if err != nil {
 		t.Fatalf("create token: %v", err)
 	}
@@ -0,0 +1,275 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// ApiTokenKey is the gin context key of the API token a request was
+// authenticated with; unset for OIDC.
+const ApiTokenKey = "__api_token"
+
+// Permission scopes of API tokens.
+const (
+	// TokenScopeRecordsWrite: write records, via the record API, zone import
+	// and /nic/update.
+	TokenScopeRecordsWrite = "records:write"
+	TokenScopeZonesCreate  = "zones:create"
+	TokenScopeTokensManage = "tokens:manage"
+	TokenScopePolicyRead   = "policy:read"
+)
+
+var tokenScopes = []string{TokenScopeRecordsWrite, TokenScopeZonesCreate, TokenScopeTokensManage, TokenScopePolicyRead}
+
+// tokenRouteScopes is the scope a restricted token needs per route, "" for
+// the routes any of them may use: reading its zones and their records. Routes
+// not listed are refused to such tokens.
+var tokenRouteScopes = map[string]string{
+	"GET /v1/zones/":                    "",
+	"GET /v1/zones/:zone":               "",
+	"GET /v1/zones/:zone/owners":        "",
+	"GET /v1/zones/:zone/keys":          "",
+	"GET /v1/zones/:zone/keys/rotation": "",
+	"GET /v1/zones/:zone/export":        "",
+	"GET /v1/zones/:zone/lease":         "",
+	"GET /v1/trash":                     "",
+	"GET /v1/dns/records":               "",
+	"POST /v1/dns/records/create":       TokenScopeRecordsWrite,
+	"POST /v1/dns/records/delete":       TokenScopeRecordsWrite,
+	"POST /v1/dns/records/batch":        TokenScopeRecordsWrite,
+	"POST /v1/zones/:zone/import":       TokenScopeRecordsWrite,
+	"PUT /v1/zones/:zone/records":       TokenScopeRecordsWrite,
+	"POST /v1/zones/:zone/renew":        TokenScopeRecordsWrite,
+	"POST /v1/zones/:zone":              TokenScopeZonesCreate,
+	"POST /v1/zones/:zone/restore":      TokenScopeZonesCreate,
+	"GET /v1/tokens/":                   TokenScopeTokensManage,
+	"POST /v1/tokens/":                  TokenScopeTokensManage,
+	"DELETE /v1/tokens/:id":             TokenScopeTokensManage,
+	"GET /v1/policies/rules":            TokenScopePolicyRead,
+	"GET /v1/policies/delegations":      TokenScopePolicyRead,
+	"GET /v1/policies/orphaned-zones":   TokenScopePolicyRead,
+
+	// Zone history.
+	"GET /v1/zones/:zone/history":                    "",
+	"GET /v1/zones/:zone/history/:version":           "",
+	"GET /v1/zones/:zone/history/:version/diff":      "",
+	"POST /v1/zones/:zone/history/:version/rollback": TokenScopeRecordsWrite,
+}
+
+// TokenScope restricts what an API token may do. Every field is a
+// comma-separated list, and empty means unrestricted.
+type TokenScope struct {
+	// Zones the token may act on, each with its subzones.
+	Zones string `gorm:"type:varchar(1024);default:null" json:"zones,omitempty" example:"home.alice.users.example.com"`
+	// Scopes are the permissions of the token, see the TokenScope constants.
+	// Without any the token acts with the full rights of its owner.
+	Scopes string `gorm:"type:varchar(255);default:null" json:"scopes,omitempty" example:"records:write"`
+	// AllowedIPs are the addresses and CIDRs the token may be used from.
+	AllowedIPs string `gorm:"type:varchar(1024);default:null" json:"allowed_ips,omitempty" example:"192.0.2.0/24,2001:db8::1"`
+}
+
+// Validate normalizes the lists and checks that every entry is usable.
+func (s *TokenScope) Validate() error {
+	zones := splitList(s.Zones)
+	for i, zone := range zones {
+		zones[i] = auditZone(zone)
+		if _, ok := dns.IsDomainName(zones[i]); !ok || zones[i] == "" {
+			return fmt.Errorf("invalid zone %q", zone)
+		}
+	}
+	s.Zones = strings.Join(zones, ",")
+
+	scopes := splitList(strings.ToLower(s.Scopes))
+	for _, scope := range scopes {
+		if !slices.Contains(tokenScopes, scope) {
+			return fmt.Errorf("unknown scope %q (known: %s)", scope, strings.Join(tokenScopes, ", "))
+		}
+	}
+	s.Scopes = strings.Join(scopes, ",")
+
+	networks := splitList(s.AllowedIPs)
+	for _, n := range networks {
+		if _, err := parseTokenNetwork(n); err != nil {
+			return err
+		}
+	}
+	s.AllowedIPs = strings.Join(networks, ",")
+	return nil
+}
+
+// parseTokenNetwork parses a CIDR, or a single address as a network of one.
+func parseTokenNetwork(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		bits := 8 * len(ip.To16())
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address or network %q", s)
+	}
+	return n, nil
+}
+
+// Restricted reports whether the token is limited in any way: to zones,
+// scopes or addresses. A restricted token only reaches the routes of
+// tokenRouteScopes.
+func (s *TokenScope) Restricted() bool {
+	return s.Zones != "" || s.Scopes != "" || s.AllowedIPs != ""
+}
+
+// HasScope reports whether the token holds scope; one without scopes holds
+// all of them.
+func (s *TokenScope) HasScope(scope string) bool {
+	return s.Scopes == "" || slices.Contains(splitList(s.Scopes), scope)
+}
+
+// AllowsZone reports whether the token may act on zone.
+func (s *TokenScope) AllowsZone(zone string) bool {
+	if s.Zones == "" {
+		return true
+	}
+	zoneFQDN := dns.Fqdn(auditZone(zone))
+	for _, allowed := range splitList(s.Zones) {
+		if dns.IsSubDomain(dns.Fqdn(allowed), zoneFQDN) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsIP reports whether the token may be used from the address ip.
+func (s *TokenScope) AllowsIP(ip string) bool {
+	if s.AllowedIPs == "" {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	for _, network := range splitList(s.AllowedIPs) {
+		if n, err := parseTokenNetwork(network); err == nil && addr != nil && n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Narrow limits s to what parent allows, for a token created with a token:
+// a list s leaves empty is inherited, one it sets must lie within parent's.
+func (s *TokenScope) Narrow(parent *TokenScope) error {
+	if parent.Zones != "" {
+		if s.Zones == "" {
+			s.Zones = parent.Zones
+		}
+		for _, zone := range splitList(s.Zones) {
+			if !parent.AllowsZone(zone) {
+				return fmt.Errorf("zone %s is outside of this token's zones", zone)
+			}
+		}
+	}
+	if parent.Scopes != "" {
+		if s.Scopes == "" {
+			s.Scopes = parent.Scopes
+		}
+		for _, scope := range splitList(s.Scopes) {
+			if !parent.HasScope(scope) {
+				return fmt.Errorf("scope %s is not one of this token's scopes", scope)
+			}
+		}
+	}
+	if parent.AllowedIPs != "" {
+		if s.AllowedIPs == "" {
+			s.AllowedIPs = parent.AllowedIPs
+		}
+		for _, network := range splitList(s.AllowedIPs) {
+			n, err := parseTokenNetwork(network)
+			if err != nil {
+				return err
+			}
+			if !parent.containsNetwork(n) {
+				return fmt.Errorf("network %s is outside of this token's addresses", network)
+			}
+		}
+	}
+	return nil
+}
+
+// containsNetwork reports whether n lies within one of the allowed networks.
+func (s *TokenScope) containsNetwork(n *net.IPNet) bool {
+	ones, _ := n.Mask.Size()
+	for _, network := range splitList(s.AllowedIPs) {
+		p, err := parseTokenNetwork(network)
+		if err != nil {
+			continue
+		}
+		if pOnes, _ := p.Mask.Size(); p.Contains(n.IP) && pOnes <= ones && len(p.IP) == len(n.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTokenRequest refuses a request its token does not allow: from another
+// address, to a route a restricted token may not use, outside its scopes or
+// for a zone outside its zones. It
+// returns the status and message of the refusal, or 0.
+func checkTokenRequest(c *gin.Context, token *Token) (int, string) {
+	if !token.AllowsIP(c.ClientIP()) {
+		return http.StatusForbidden, "token is not valid from this address"
+	}
+	if token.Restricted() {
+		scope, listed := tokenRouteScopes[c.Request.Method+" "+c.FullPath()]
+		if !listed {
+			return http.StatusForbidden, "a restricted token may not use this operation"
+		}
+		if scope != "" && !token.HasScope(scope) {
+			return http.StatusForbidden, "token lacks the scope " + scope
+		}
+	}
+	if zone := c.Param("zone"); zone != "" && !token.AllowsZone(zone) {
+		return http.StatusForbidden, "token is not valid for this zone"
+	}
+	return 0, ""
+}
+
+// requestToken returns the API token of the request, nil for OIDC.
+func requestToken(c *gin.Context) *Token {
+	if v, ok := c.Get(ApiTokenKey); ok {
+		return v.(*Token)
+	}
+	return nil
+}
+
+// requestAllowsZone reports whether the request's token, if any, may act on
+// zone. Handlers taking the zone from the body or the query call it; a path
+// parameter is already checked by the middleware.
+func requestAllowsZone(c *gin.Context, zone string) bool {
+	token := requestToken(c)
+	return token == nil || token.AllowsZone(zone)
+}
+
+// apiTokenTTL returns the lifetime of a new token: the configured default, or
+// hours if set, which may not exceed the configured maximum.
+func (app *AppData) apiTokenTTL(hours int) (time.Duration, error) {
+	if hours < 0 {
+		return 0, fmt.Errorf("ttl_hours must not be negative")
+	}
+	if hours == 0 {
+		return time.Duration(app.Config.WebServer.ApiTokenTTLHours) * time.Hour, nil
+	}
+	limit := app.Config.WebServer.ApiTokenMaxTTLHours
+	if limit == 0 {
+		limit = app.Config.WebServer.ApiTokenTTLHours
+	}
+	if hours > limit {
+		return 0, fmt.Errorf("ttl_hours must be at most %d", limit)
+	}
+	return time.Duration(hours) * time.Hour, nil
+}
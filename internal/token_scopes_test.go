@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A scoped token reaches only the routes its scopes name and the zones it is
+// limited to, from its addresses, and cannot create a wider token. A token
+// limited only to zones still stays off the routes no token may use.
+func TestTokenScopes(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	scope := TokenScope{Zones: "Home.alice.users.example.com.", Scopes: "records:write", AllowedIPs: "192.0.2.0/24"}
+	if err := scope.Validate(); err != nil || scope.Zones != "home.alice.users.example.com" {
+		t.Fatalf("Validate: %+v %v", scope, err)
+	}
+	if err := (&TokenScope{Scopes: "zones:delete"}).Validate(); err == nil {
+		t.Errorf("expected an unknown scope to be refused")
+	}
+	token, err := app.Storage.CreateToken(ctx, "alice", time.Hour, false, scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	v1 := router.Group("/v1")
+	v1.Use(CombinedAuthMiddleware(nil, app.Storage, nil, app.Log, false))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	v1.GET("/zones/:zone", ok)
+	v1.POST("/zones/:zone", ok)
+	v1.DELETE("/zones/:zone", ok)
+	v1.POST("/dns/records/create", ok)
+	v1.GET("/tokens/", ok)
+	v1.GET("/audit", ok)
+
+	cases := []struct {
+		method, path, addr string
+		want               int
+	}{
+		{http.MethodGet, "/v1/zones/home.alice.users.example.com", "192.0.2.7", http.StatusOK},
+		{http.MethodGet, "/v1/zones/pi.home.alice.users.example.com", "192.0.2.7", http.StatusOK},
+		{http.MethodGet, "/v1/zones/alice.users.example.com", "192.0.2.7", http.StatusForbidden},
+		{http.MethodPost, "/v1/dns/records/create", "192.0.2.7", http.StatusOK},
+		{http.MethodPost, "/v1/zones/home.alice.users.example.com", "192.0.2.7", http.StatusForbidden},
+		{http.MethodDelete, "/v1/zones/home.alice.users.example.com", "192.0.2.7", http.StatusForbidden},
+		{http.MethodGet, "/v1/tokens/", "192.0.2.7", http.StatusForbidden},
+		{http.MethodGet, "/v1/zones/home.alice.users.example.com", "198.51.100.1", http.StatusForbidden},
+	}
+	serve := func(token *Token, method, path, addr string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = addr + ":40000"
+		req.Header.Set("Authorization", "Bearer "+token.TokenString)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	for _, tc := range cases {
+		if got := serve(token, tc.method, tc.path, tc.addr); got != tc.want {
+			t.Errorf("%s %s from %s: expected %d, got %d", tc.method, tc.path, tc.addr, tc.want, got)
+		}
+	}
+
+	zonesOnly, err := app.Storage.CreateToken(ctx, "alice", time.Hour, false, TokenScope{Zones: "home.alice.users.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := serve(zonesOnly, http.MethodGet, "/v1/audit", "192.0.2.7"); got != http.StatusForbidden {
+		t.Errorf("expected a token limited to zones to be refused on the audit log, got %d", got)
+	}
+	if got := serve(zonesOnly, http.MethodGet, "/v1/tokens/", "192.0.2.7"); got != http.StatusOK {
+		t.Errorf("expected a token limited to zones to hold every scope, got %d", got)
+	}
+
+	child := TokenScope{Zones: "pi.home.alice.users.example.com", AllowedIPs: "192.0.2.8"}
+	if err := child.Narrow(&token.TokenScope); err != nil || child.Scopes != "records:write" {
+		t.Errorf("expected a narrower token to inherit the scopes, got %+v %v", child, err)
+	}
+	for _, wider := range []TokenScope{{Zones: "alice.users.example.com"}, {Scopes: "tokens:manage"}, {AllowedIPs: "192.0.0.0/16"}} {
+		if err := wider.Narrow(&token.TokenScope); err == nil {
+			t.Errorf("expected %+v to be refused as wider than its parent", wider)
+		}
+	}
+}
+
+// A DynDNS token bound to a zone by the former tokens.zone column keeps its
+// limits as a token scope.
+func TestZoneBoundTokenMigration(t *testing.T) {
+	app := newTestApp(t)
+	token, err := app.Storage.CreateToken(context.Background(), "alice", time.Hour, false, TokenScope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := app.Storage.db
+	// The column as AutoMigrate added it.
+	if err := db.Exec("ALTER TABLE `tokens` ADD `zone` varchar(255)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("UPDATE tokens SET zone = ? WHERE id = ?", "home.alice.users.example.com", token.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateZoneBoundTokens(db); err != nil {
+		t.Fatal(err)
+	}
+	var migrated Token
+	if err := db.First(&migrated, token.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if migrated.Zones != "home.alice.users.example.com" || migrated.Scopes != TokenScopeRecordsWrite || db.Migrator().HasColumn(&Token{}, "zone") {
+		t.Errorf("expected the zone as the token's only zone with records:write, got %+v", migrated.TokenScope)
+	}
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How often recorded token usage is written to the database.
+const tokenUsageFlushInterval = 30 * time.Second
+
+// How often tokens close to their expiry are looked for.
+const tokenExpiryCheckInterval = time.Hour
+
+type tokenUse struct {
+	at time.Time
+	ip string
+}
+
+// TokenUsage collects when and from where API tokens are used, and writes only
+// the latest use of each token to the database in batches, so authenticating a
+// request never waits for a write.
+type TokenUsage struct {
+	store *Storage
+
+	mu      sync.Mutex
+	pending map[uint]tokenUse
+}
+
+// NewTokenUsage returns a collector writing to store.
+func NewTokenUsage(store *Storage) *TokenUsage {
+	return &TokenUsage{store: store, pending: make(map[uint]tokenUse)}
+}
+
+// Record notes that token id was used just now from ip. A nil collector
+// records nothing.
+func (u *TokenUsage) Record(id uint, ip string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.pending[id] = tokenUse{at: time.Now().UTC(), ip: ip}
+	u.mu.Unlock()
+}
+
+// Apply puts the usage not yet written into tokens, so a list is current.
+func (u *TokenUsage) Apply(tokens []Token) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i := range tokens {
+		if use, ok := u.pending[tokens[i].ID]; ok {
+			tokens[i].LastUsedAt, tokens[i].LastUsedIP = &use.at, use.ip
+		}
+	}
+}
+
+// Flush writes the recorded usage. What fails to be written is kept for the
+// next flush, unless the token was used again since.
+func (u *TokenUsage) Flush() error {
+	u.mu.Lock()
+	batch := u.pending
+	u.pending = make(map[uint]tokenUse)
+	u.mu.Unlock()
+
+	var failed error
+	for id, use := range batch {
+		if err := u.store.TokenTouch(id, use.at, use.ip); err != nil {
+			failed = err
+			u.mu.Lock()
+			if _, used := u.pending[id]; !used {
+				u.pending[id] = use
+			}
+			u.mu.Unlock()
+		}
+	}
+	if failed != nil {
+		return fmt.Errorf("TokenUsage.Flush: %w", failed)
+	}
+	return nil
+}
+
+// RunTokenUsageFlush flushes every tokenUsageFlushInterval until ctx ends, and
+// once more then.
+func (app *AppData) RunTokenUsageFlush(ctx context.Context) {
+	ticker := time.NewTicker(tokenUsageFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := app.TokenUsage.Flush(); err != nil {
+				app.Log.Warnf("app.RunTokenUsageFlush: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := app.TokenUsage.Flush(); err != nil {
+				app.Log.Warnf("app.RunTokenUsageFlush: %v", err)
+			}
+		}
+	}
+}
+
+// RunTokenExpiryWarnings warns the owners of tokens about to expire, every
+// tokenExpiryCheckInterval until ctx ends.
+func (app *AppData) RunTokenExpiryWarnings(ctx context.Context) {
+	if app.Config.Notify.TokenExpiryWarningDays <= 0 {
+		app.Log.Info("Token expiry warnings are disabled.")
+		return
+	}
+	ticker := time.NewTicker(tokenExpiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		app.warnExpiringTokens(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// warnExpiringTokens notifies the owner of every token that expires within the
+// configured number of days, once per token.
+func (app *AppData) warnExpiringTokens(ctx context.Context) {
+	now := time.Now()
+	deadline := now.Add(time.Duration(app.Config.Notify.TokenExpiryWarningDays) * 24 * time.Hour)
+	tokens, err := app.Storage.TokensExpiringBefore(deadline)
+	if err != nil {
+		app.Log.Warnf("app.warnExpiringTokens: %v", err)
+		return
+	}
+	for _, token := range tokens {
+		lastUsed := "never"
+		if token.LastUsedAt != nil {
+			lastUsed = fmt.Sprintf("%s from %s", token.LastUsedAt.Format(time.RFC3339), token.LastUsedIP)
+		}
+		err := app.Notifier.Notify(ctx, Notification{
+			Kind:      NotifyTokenExpiry,
+			Recipient: token.Username,
+			Subject:   fmt.Sprintf("API token %s expires on %s", token.TokenPrefix, token.ExpiresAt.Format("2006-01-02")),
+			Body: fmt.Sprintf("Your API token %s expires at %s (last used: %s).\n\nCreate a new token and replace it wherever it is in use before then; expired tokens stop working.",
+				token.TokenPrefix, token.ExpiresAt.Format(time.RFC3339), lastUsed),
+			Data: token,
+		})
+		if err != nil {
+			app.Log.Warnf("app.warnExpiringTokens: token %d of %s: %v", token.ID, token.Username, err)
+			continue
+		}
+		if err := app.Storage.TokenMarkNotified(token.ID, now); err != nil {
+			app.Log.Warnf("app.warnExpiringTokens: %v", err)
+		}
+	}
+}
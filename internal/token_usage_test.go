@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// recordingNotifier keeps what it is asked to deliver.
+type recordingNotifier struct {
+	sent []Notification
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, msg Notification) error {
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+// Token usage reaches the database only on a flush, but a list shows it at
+// once. Owners are warned once about a token that expires soon.
+func TestTokenUsageAndExpiryWarnings(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	notifier := &recordingNotifier{}
+	app.TokenUsage, app.Notifier = NewTokenUsage(app.Storage), notifier
+	app.Config.Notify.TokenExpiryWarningDays = 7
+
+	soon, err := app.Storage.CreateToken(ctx, "alice@dhbw.de", 48*time.Hour, false, TokenScope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.Storage.CreateToken(ctx, "alice@dhbw.de", 30*24*time.Hour, false, TokenScope{}); err != nil {
+		t.Fatal(err)
+	}
+
+	app.TokenUsage.Record(soon.ID, "192.0.2.7")
+	tokens, _ := app.Storage.GetTokens(ctx, "alice@dhbw.de")
+	if tokens[0].LastUsedAt != nil {
+		t.Fatalf("expected the usage to wait for a flush, got %+v", tokens[0])
+	}
+	app.TokenUsage.Apply(tokens)
+	if tokens[0].LastUsedAt == nil || tokens[0].LastUsedIP != "192.0.2.7" {
+		t.Errorf("expected the pending usage in the list, got %+v", tokens[0])
+	}
+	if err := app.TokenUsage.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	tokens, _ = app.Storage.GetTokens(ctx, "alice@dhbw.de")
+	if tokens[0].LastUsedAt == nil || tokens[0].LastUsedIP != "192.0.2.7" {
+		t.Errorf("expected the usage to be stored, got %+v", tokens[0])
+	}
+
+	app.warnExpiringTokens(ctx)
+	if len(notifier.sent) != 1 || notifier.sent[0].Recipient != "alice@dhbw.de" || notifier.sent[0].Kind != NotifyTokenExpiry {
+		t.Fatalf("expected one warning about the token expiring soon, got %+v", notifier.sent)
+	}
+	app.warnExpiringTokens(ctx)
+	if len(notifier.sent) != 1 {
+		t.Errorf("expected the owner to be warned only once, got %d warnings", len(notifier.sent))
+	}
+}
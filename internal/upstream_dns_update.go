@@ -53,6 +53,7 @@ func RunPeriodicUpstreamDnsUpdateCheck(app AppData) {
 	// Run periodic DNS update checks
 	for {
 		err := PerformSingleUpstreamDnsUpdateCheck(&app.Config.UpstreamDns, dynamicZonesDnsIPAddress, log, false)
+		upstreamUpdates.WithLabelValues(resultLabel(err)).Inc()
 		if err != nil {
 			log.Errorf("Error during upstream DNS update check: %v", err)
 		}
@@ -119,7 +120,7 @@ func addRecord(ipAddr net.IP, c *UpstreamDnsUpdateConfig, recordNameFQDN string,
 			toNsUpdateCommand(c.Tsig_Name, c.Tsig_Alg, c.Server, c.Port, c.Zone, "update add "+recordNameFQDN+" "+fmt.Sprintf("%d", c.Ttl)+" IN A "+ipAddr.String()))
 
 		// Pass the FQDN name to the zones library
-		msg, err := helper.Rfc2136AddARecord(c.Tsig_Name, c.Tsig_Alg, c.Tsig_Secret, remoteDnsServer, c.Zone, recordNameFQDN, ipAddr.String(), uint32(c.Ttl))
+		msg, err := addAddressRecord(c, remoteDnsServer, recordNameFQDN, "A", ipAddr)
 		if err != nil {
 			log.Errorf("Failed to add A record for %s in zone %s: %v", recordNameFQDN, c.Zone, err)
 			return err
@@ -129,7 +130,7 @@ func addRecord(ipAddr net.IP, c *UpstreamDnsUpdateConfig, recordNameFQDN string,
 	} else if ipAddr.To16() != nil { //IPv6
 		log.Debugf("Adding new AAAA record for %s in zone %s with address %s", recordNameFQDN, c.Zone, ipAddr)
 		// Pass the FQDN name to the zones library
-		msg, err := helper.Rfc2136AddAAAARecord(c.Tsig_Name, c.Tsig_Alg, c.Tsig_Secret, remoteDnsServer, c.Zone, recordNameFQDN, ipAddr.String(), uint32(c.Ttl))
+		msg, err := addAddressRecord(c, remoteDnsServer, recordNameFQDN, "AAAA", ipAddr)
 		if err != nil {
 			log.Errorf("Failed to add AAAA record for %s in zone %s: %v", recordNameFQDN, c.Zone, err)
 			return err
@@ -143,6 +144,15 @@ func addRecord(ipAddr net.IP, c *UpstreamDnsUpdateConfig, recordNameFQDN string,
 	return nil
 }
 
+// addAddressRecord adds the A or AAAA record announcing ipAddr upstream.
+func addAddressRecord(c *UpstreamDnsUpdateConfig, remoteDnsServer, recordNameFQDN, recordType string, ipAddr net.IP) (*dns.Msg, error) {
+	rr, err := helper.NewRecord(recordNameFQDN, recordType, ipAddr.String(), uint32(c.Ttl))
+	if err != nil {
+		return nil, err
+	}
+	return helper.Rfc2136AddRecords(c.Tsig_Name, c.Tsig_Alg, c.Tsig_Secret, remoteDnsServer, c.Zone, []dns.RR{rr})
+}
+
 func deleteRecords(c *UpstreamDnsUpdateConfig, recordNameFQDN string, log *zap.SugaredLogger) error {
 	remoteDnsServer := fmt.Sprintf("%s:%d", c.Server, c.Port)
 
@@ -152,7 +162,7 @@ func deleteRecords(c *UpstreamDnsUpdateConfig, recordNameFQDN string, log *zap.S
 		toNsUpdateCommand(c.Tsig_Name, c.Tsig_Alg, c.Server, c.Port, c.Zone, "update delete "+recordNameFQDN))
 
 	// Delete A records
-	msgA, err := helper.Rfc2136DeleteARecord(c.Tsig_Name, c.Tsig_Alg, c.Tsig_Secret, remoteDnsServer, c.Zone, recordNameFQDN)
+	msgA, err := helper.Rfc2136DeleteRRset(c.Tsig_Name, c.Tsig_Alg, c.Tsig_Secret, remoteDnsServer, c.Zone, recordNameFQDN, dns.TypeA)
 	if err != nil {
 		log.Errorf("Failed to delete A record for %s in zone %s: %v", recordNameFQDN, c.Zone, err)
 		return err
@@ -160,7 +170,7 @@ func deleteRecords(c *UpstreamDnsUpdateConfig, recordNameFQDN string, log *zap.S
 	log.Debugf("Successfully deleted A records for %s in zone %s: %v", recordNameFQDN, c.Zone, msgA)
 
 	// Delete AAAA records
-	msgAAAA, err := helper.Rfc2136DeleteAAAARecord(c.Tsig_Name, c.Tsig_Alg, c.Tsig_Secret, remoteDnsServer, c.Zone, recordNameFQDN)
+	msgAAAA, err := helper.Rfc2136DeleteRRset(c.Tsig_Name, c.Tsig_Alg, c.Tsig_Secret, remoteDnsServer, c.Zone, recordNameFQDN, dns.TypeAAAA)
 	if err != nil {
 		log.Errorf("Failed to delete AAAA record for %s in zone %s: %v", recordNameFQDN, c.Zone, err)
 		return err
@@ -0,0 +1,585 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Events sent to webhooks. They share their names with the audit actions they
+// accompany; EventZoneOrphaned has no audit action of its own, it follows from
+// a policy change.
+const (
+	EventZoneCreated      = AuditZoneCreate
+	EventZoneDeleted      = AuditZoneDelete
+	EventZoneRestored     = AuditZoneRestore
+	EventZoneOrphaned     = "zone.orphaned"
+	EventZoneOwnerAdded   = AuditZoneOwnerAdd
+	EventZoneOwnerRemoved = AuditZoneOwnerRemove
+	EventZoneKeysRotated  = AuditZoneKeysRotate
+	EventRuleCreated      = AuditRuleCreate
+	EventRuleUpdated      = AuditRuleUpdate
+	EventRuleDeleted      = AuditRuleDelete
+)
+
+var webhookEvents = []string{
+	EventZoneCreated, EventZoneDeleted, EventZoneRestored, EventZoneOrphaned, EventZoneOwnerAdded, EventZoneOwnerRemoved,
+	EventZoneKeysRotated, EventRuleCreated, EventRuleUpdated, EventRuleDeleted,
+}
+
+// Values of WebhookDelivery.Status.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body,
+// keyed with the webhook's secret.
+const WebhookSignatureHeader = "X-Dynamic-Zones-Signature"
+
+const (
+	// webhookMaxAttempts is how often a delivery is tried before it fails.
+	webhookMaxAttempts = 10
+	// webhookBackoff is the wait after the first failed attempt; it doubles
+	// with every further one, up to webhookMaxBackoff.
+	webhookBackoff    = 30 * time.Second
+	webhookMaxBackoff = time.Hour
+	// webhookPollInterval is how often the queue is looked at for retries.
+	webhookPollInterval = 10 * time.Second
+	// webhookBatchSize bounds the deliveries sent in one go.
+	webhookBatchSize = 100
+	webhookTimeout   = 10 * time.Second
+)
+
+// Webhook is an outgoing webhook: matching events are POSTed to URL as JSON.
+type Webhook struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `gorm:"type:varchar(2048);not null" json:"url"`
+	// Secret keys the signature of every delivery. It is shown once, when the
+	// webhook is created.
+	Secret string `gorm:"type:varchar(255);not null" json:"-"`
+	// Events is a comma-separated list of the events sent, each exact or a
+	// prefix ending in "." ("zone."). Empty sends all of them.
+	Events      string `gorm:"type:text;default:null" json:"events,omitempty"`
+	Description string `gorm:"type:text;default:null" json:"description,omitempty"`
+	Enabled     bool   `gorm:"not null" json:"enabled"`
+}
+
+// Wants reports whether event is sent to the webhook.
+func (w *Webhook) Wants(event string) bool {
+	if !w.Enabled {
+		return false
+	}
+	events := splitList(w.Events)
+	if len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if prefix, ok := strings.CutSuffix(e, "."); ok && strings.HasPrefix(event, prefix+".") || e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookCreated is the response to creating a webhook, the only one holding
+// its secret.
+type WebhookCreated struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookRequest creates or changes a webhook.
+type WebhookRequest struct {
+	URL string `json:"url" binding:"required"`
+	// Secret is generated when empty on creation, and kept when empty on an
+	// update.
+	Secret      string `json:"secret,omitempty"`
+	Events      string `json:"events,omitempty" example:"zone.,policy.rule.update"`
+	Description string `json:"description,omitempty"`
+	// Enabled defaults to true.
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// Validate checks the URL and events, and normalizes the event list.
+func (r *WebhookRequest) Validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("url: %q is not an http(s) URL", r.URL)
+	}
+	events := splitList(strings.ToLower(r.Events))
+	for _, e := range events {
+		known := slices.ContainsFunc(webhookEvents, func(event string) bool {
+			return (&Webhook{Events: e, Enabled: true}).Wants(event)
+		})
+		if !known {
+			return fmt.Errorf("events: %q matches no event (known: %s)", e, strings.Join(webhookEvents, ", "))
+		}
+	}
+	r.Events = strings.Join(events, ",")
+	return nil
+}
+
+// WebhookEvent is the body of a delivery.
+type WebhookEvent struct {
+	// ID is the same in every delivery of the event.
+	ID    string    `json:"id"`
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	// Zone is lower case without trailing dot; a rule's SOA for policy events.
+	Zone      string `json:"zone,omitempty"`
+	Actor     string `json:"actor,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Data      any    `json:"data,omitempty"`
+}
+
+// WebhookDelivery is an event queued for, or sent to, a webhook. Deliveries
+// are stored before they are sent, so none are lost on a restart.
+type WebhookDelivery struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	WebhookID uint      `gorm:"index" json:"webhook_id"`
+	Event     string    `gorm:"type:varchar(64)" json:"event"`
+	Payload   string    `gorm:"type:text" json:"payload" swaggertype:"object"`
+	Status    string    `gorm:"type:varchar(16);index" json:"status" enums:"pending,delivered,failed"`
+	Attempts  int       `json:"attempts"`
+	// NextAttemptAt is when a pending delivery is tried (again).
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	LastError     string     `gorm:"type:text;default:null" json:"last_error,omitempty"`
+}
+
+// MarshalJSON embeds the payload as JSON instead of a string holding JSON.
+func (d WebhookDelivery) MarshalJSON() ([]byte, error) {
+	type plain WebhookDelivery
+	return json.Marshal(struct {
+		plain
+		Payload json.RawMessage `json:"payload"`
+	}{plain(d), json.RawMessage(d.Payload)})
+}
+
+// WebhookCreate stores a webhook.
+func (s *Storage) WebhookCreate(webhook *Webhook) error {
+	if err := s.db.Create(webhook).Error; err != nil {
+		return fmt.Errorf("storage.WebhookCreate: %w", err)
+	}
+	return nil
+}
+
+// WebhookList returns all webhooks.
+func (s *Storage) WebhookList() ([]Webhook, error) {
+	webhooks := []Webhook{}
+	if err := s.db.Order("id asc").Find(&webhooks).Error; err != nil {
+		return nil, fmt.Errorf("storage.WebhookList: %w", err)
+	}
+	return webhooks, nil
+}
+
+// WebhookGet returns webhook id.
+func (s *Storage) WebhookGet(id uint) (*Webhook, error) {
+	var webhook Webhook
+	if err := s.db.First(&webhook, id).Error; err != nil {
+		return nil, fmt.Errorf("storage.WebhookGet: %w", err)
+	}
+	return &webhook, nil
+}
+
+// WebhookUpdate saves a changed webhook.
+func (s *Storage) WebhookUpdate(webhook *Webhook) error {
+	if err := s.db.Save(webhook).Error; err != nil {
+		return fmt.Errorf("storage.WebhookUpdate: %w", err)
+	}
+	return nil
+}
+
+// WebhookDelete deletes webhook id with its deliveries.
+func (s *Storage) WebhookDelete(id uint) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", id).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		res := tx.Delete(&Webhook{}, id)
+		if res.Error == nil && res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return res.Error
+	})
+	if err != nil {
+		return fmt.Errorf("storage.WebhookDelete: %w", err)
+	}
+	return nil
+}
+
+// WebhookDeliveryCreate queues deliveries.
+func (s *Storage) WebhookDeliveryCreate(deliveries []WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := s.db.Create(&deliveries).Error; err != nil {
+		return fmt.Errorf("storage.WebhookDeliveryCreate: %w", err)
+	}
+	return nil
+}
+
+// WebhookDeliveryListDue returns up to limit pending deliveries due at now,
+// oldest first.
+func (s *Storage) WebhookDeliveryListDue(now time.Time, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := s.db.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("id asc").Limit(limit).Find(&deliveries).Error
+	if err != nil {
+		return nil, fmt.Errorf("storage.WebhookDeliveryListDue: %w", err)
+	}
+	return deliveries, nil
+}
+
+// WebhookDeliveryList returns the latest limit deliveries to webhook id,
+// newest first.
+func (s *Storage) WebhookDeliveryList(id uint, limit int) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	if err := s.db.Where("webhook_id = ?", id).Order("id desc").Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, fmt.Errorf("storage.WebhookDeliveryList: %w", err)
+	}
+	return deliveries, nil
+}
+
+// WebhookDeliveryUpdate saves the outcome of an attempt.
+func (s *Storage) WebhookDeliveryUpdate(delivery *WebhookDelivery) error {
+	if err := s.db.Save(delivery).Error; err != nil {
+		return fmt.Errorf("storage.WebhookDeliveryUpdate: %w", err)
+	}
+	return nil
+}
+
+// WebhookListAll returns all webhooks, without their secrets.
+func (app *AppData) WebhookListAll() (int, any, error) {
+	webhooks, err := app.Storage.WebhookList()
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list webhooks", fmt.Errorf("app.WebhookListAll: %w", err))
+	}
+	return http.StatusOK, webhooks, nil
+}
+
+// WebhookAdd creates a webhook. The response holds its secret, generated when
+// req has none.
+func (app *AppData) WebhookAdd(ctx context.Context, req WebhookRequest) (int, any, error) {
+	if err := req.Validate(); err != nil {
+		return errorResult(http.StatusBadRequest, err.Error(), fmt.Errorf("app.WebhookAdd: %w", err))
+	}
+	if req.Secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return errorResult(http.StatusInternalServerError, "Failed to generate a secret", fmt.Errorf("app.WebhookAdd: %w", err))
+		}
+		req.Secret = hex.EncodeToString(b)
+	}
+	webhook := Webhook{URL: req.URL, Secret: req.Secret, Events: req.Events, Description: req.Description, Enabled: req.Enabled == nil || *req.Enabled}
+	if err := app.Storage.WebhookCreate(&webhook); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to store the webhook", fmt.Errorf("app.WebhookAdd: %w", err))
+	}
+	app.audit(ctx, AuditWebhookCreate, fmt.Sprintf("webhook/%d", webhook.ID), "", nil, webhook)
+	return http.StatusCreated, WebhookCreated{Webhook: webhook, Secret: webhook.Secret}, nil
+}
+
+// WebhookChange replaces the settings of webhook id; an empty secret keeps the
+// current one.
+func (app *AppData) WebhookChange(ctx context.Context, id uint, req WebhookRequest) (int, any, error) {
+	if err := req.Validate(); err != nil {
+		return errorResult(http.StatusBadRequest, err.Error(), fmt.Errorf("app.WebhookChange: %w", err))
+	}
+	webhook, err := app.Storage.WebhookGet(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errorResult(http.StatusNotFound, "Webhook not found", fmt.Errorf("app.WebhookChange: %w", err))
+	} else if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to look up the webhook", fmt.Errorf("app.WebhookChange: %w", err))
+	}
+	before := *webhook
+	webhook.URL, webhook.Events, webhook.Description = req.URL, req.Events, req.Description
+	webhook.Enabled = req.Enabled == nil || *req.Enabled
+	if req.Secret != "" {
+		webhook.Secret = req.Secret
+	}
+	if err := app.Storage.WebhookUpdate(webhook); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to store the webhook", fmt.Errorf("app.WebhookChange: %w", err))
+	}
+	// Secret is not serialized: a new one shows only as secret_changed.
+	app.audit(ctx, AuditWebhookUpdate, fmt.Sprintf("webhook/%d", id), "", before, gin.H{"webhook": webhook, "secret_changed": req.Secret != ""})
+	return http.StatusOK, webhook, nil
+}
+
+// WebhookRemove deletes webhook id and its deliveries.
+func (app *AppData) WebhookRemove(ctx context.Context, id uint) (int, any, error) {
+	before, err := app.Storage.WebhookGet(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errorResult(http.StatusNotFound, "Webhook not found", fmt.Errorf("app.WebhookRemove: %w", err))
+	} else if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to look up the webhook", fmt.Errorf("app.WebhookRemove: %w", err))
+	}
+	if err := app.Storage.WebhookDelete(id); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to delete the webhook", fmt.Errorf("app.WebhookRemove: %w", err))
+	}
+	app.audit(ctx, AuditWebhookDelete, fmt.Sprintf("webhook/%d", id), "", before, nil)
+	return http.StatusNoContent, nil, nil
+}
+
+// WebhookDeliveries returns the latest limit deliveries to webhook id.
+func (app *AppData) WebhookDeliveries(id uint, limit int) (int, any, error) {
+	if _, err := app.Storage.WebhookGet(id); errors.Is(err, gorm.ErrRecordNotFound) {
+		return errorResult(http.StatusNotFound, "Webhook not found", fmt.Errorf("app.WebhookDeliveries: %w", err))
+	} else if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to look up the webhook", fmt.Errorf("app.WebhookDeliveries: %w", err))
+	}
+	deliveries, err := app.Storage.WebhookDeliveryList(id, limit)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list deliveries", fmt.Errorf("app.WebhookDeliveries: %w", err))
+	}
+	return http.StatusOK, deliveries, nil
+}
+
+// emit queues event for every webhook that wants it and wakes the dispatcher.
+// Like audit it only logs failures: the change it reports has been made.
+func (app *AppData) emit(ctx context.Context, event, zone string, data any) {
+	webhooks, err := app.Storage.WebhookList()
+	if err != nil {
+		app.Log.Errorf("app.emit: %s on %s: %v", event, zone, err)
+		return
+	}
+	webhooks = slices.DeleteFunc(webhooks, func(w Webhook) bool { return !w.Wants(event) })
+	if len(webhooks) == 0 {
+		return
+	}
+
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	actor := auditActorFrom(ctx)
+	payload, err := json.Marshal(WebhookEvent{
+		ID:        hex.EncodeToString(id),
+		Event:     event,
+		Time:      time.Now().UTC(),
+		Zone:      auditZone(zone),
+		Actor:     actor.Actor,
+		RequestID: actor.RequestID,
+		Data:      data,
+	})
+	if err != nil {
+		app.Log.Errorf("app.emit: %s on %s: %v", event, zone, err)
+		return
+	}
+
+	now := time.Now()
+	deliveries := make([]WebhookDelivery, 0, len(webhooks))
+	for _, w := range webhooks {
+		deliveries = append(deliveries, WebhookDelivery{
+			WebhookID:     w.ID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	if err := app.Storage.WebhookDeliveryCreate(deliveries); err != nil {
+		app.Log.Errorf("app.emit: %s on %s: %v", event, zone, err)
+		return
+	}
+	app.Webhooks.Wake()
+}
+
+// webhooksWant reports whether some webhook wants event, so events that are
+// costly to detect are only looked for when someone listens.
+func (app *AppData) webhooksWant(event string) bool {
+	webhooks, err := app.Storage.WebhookList()
+	if err != nil {
+		app.Log.Errorf("app.webhooksWant: %v", err)
+		return false
+	}
+	return slices.ContainsFunc(webhooks, func(w Webhook) bool { return w.Wants(event) })
+}
+
+// watchOrphans returns a function to call after a policy change: it emits
+// EventZoneOrphaned for every zone the change orphaned.
+func (app *AppData) watchOrphans(ctx context.Context) func() {
+	if !app.webhooksWant(EventZoneOrphaned) {
+		return func() {}
+	}
+	before, err := app.OrphanedZones()
+	if err != nil {
+		app.Log.Errorf("app.watchOrphans: %v", err)
+		return func() {}
+	}
+	return func() {
+		after, err := app.OrphanedZones()
+		if err != nil {
+			app.Log.Errorf("app.watchOrphans: %v", err)
+			return
+		}
+		for _, orphan := range after {
+			if !slices.Contains(before, orphan) {
+				app.emit(ctx, EventZoneOrphaned, orphan.Zone, orphan)
+			}
+		}
+	}
+}
+
+// signWebhook returns the signature header value of body.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoffAfter returns the wait after the given number of failed
+// attempts.
+func webhookBackoffAfter(attempts int) time.Duration {
+	wait := webhookBackoff
+	for i := 1; i < attempts && wait < webhookMaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, webhookMaxBackoff)
+}
+
+// WebhookDispatcher sends the queued deliveries, retrying failed ones with
+// exponential backoff.
+type WebhookDispatcher struct {
+	store  *Storage
+	client *http.Client
+	log    *zap.SugaredLogger
+	wake   chan struct{}
+}
+
+// NewWebhookDispatcher returns a dispatcher sending the deliveries in store.
+func NewWebhookDispatcher(store *Storage, log *zap.SugaredLogger) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		store:  store,
+		client: &http.Client{Timeout: webhookTimeout},
+		log:    log,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Wake makes the dispatcher look at the queue now. A nil dispatcher leaves the
+// deliveries queued.
+func (d *WebhookDispatcher) Wake() {
+	if d == nil {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends due deliveries when woken and every webhookPollInterval until ctx
+// ends.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.DeliverDue(ctx, time.Now()); err != nil {
+			d.log.Warnf("WebhookDispatcher.Run: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue attempts every delivery due at now once.
+func (d *WebhookDispatcher) DeliverDue(ctx context.Context, now time.Time) error {
+	for {
+		deliveries, err := d.store.WebhookDeliveryListDue(now, webhookBatchSize)
+		if err != nil {
+			return fmt.Errorf("WebhookDispatcher.DeliverDue: %w", err)
+		}
+		webhooks := make(map[uint]*Webhook)
+		for i := range deliveries {
+			delivery := &deliveries[i]
+			webhook, ok := webhooks[delivery.WebhookID]
+			if !ok {
+				webhook, err = d.store.WebhookGet(delivery.WebhookID)
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue // deleted with its deliveries meanwhile
+				} else if err != nil {
+					return fmt.Errorf("WebhookDispatcher.DeliverDue: %w", err)
+				}
+				webhooks[delivery.WebhookID] = webhook
+			}
+			d.attempt(ctx, webhook, delivery, now)
+			if err := d.store.WebhookDeliveryUpdate(delivery); err != nil {
+				return fmt.Errorf("WebhookDispatcher.DeliverDue: %w", err)
+			}
+		}
+		if len(deliveries) < webhookBatchSize || ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// attempt sends delivery to webhook and records the outcome in delivery.
+func (d *WebhookDispatcher) attempt(ctx context.Context, webhook *Webhook, delivery *WebhookDelivery, now time.Time) {
+	if !webhook.Enabled {
+		delivery.Status, delivery.LastError = DeliveryFailed, "the webhook was disabled"
+		return
+	}
+	delivery.Attempts++
+	err := d.post(ctx, webhook, delivery)
+	if err == nil {
+		delivered := time.Now().UTC()
+		delivery.Status, delivery.DeliveredAt, delivery.LastError = DeliveryDelivered, &delivered, ""
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= webhookMaxAttempts {
+		delivery.Status = DeliveryFailed
+		d.log.Warnf("WebhookDispatcher: giving up on delivery %d of %s to %s after %d attempts: %v",
+			delivery.ID, delivery.Event, webhook.URL, delivery.Attempts, err)
+		return
+	}
+	delivery.NextAttemptAt = now.Add(webhookBackoffAfter(delivery.Attempts))
+	d.log.Infof("WebhookDispatcher: delivery %d of %s to %s failed, retrying at %s: %v",
+		delivery.ID, delivery.Event, webhook.URL, delivery.NextAttemptAt.Format(time.RFC3339), err)
+}
+
+func (d *WebhookDispatcher) post(ctx context.Context, webhook *Webhook, delivery *WebhookDelivery) error {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dynamic-zones-webhook")
+	req.Header.Set("X-Dynamic-Zones-Event", delivery.Event)
+	req.Header.Set("X-Dynamic-Zones-Delivery", fmt.Sprint(delivery.ID))
+	req.Header.Set(WebhookSignatureHeader, signWebhook(webhook.Secret, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", webhook.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Events are queued for the webhooks that want them and delivered signed; a
+// failed delivery is retried later. Deleting the rule a zone was granted by
+// orphans the zone.
+func TestWebhookDeliveries(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	dispatcher := NewWebhookDispatcher(app.Storage, app.Log)
+
+	var received []WebhookEvent
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(WebhookSignatureHeader) != signWebhook("s3cret", body) {
+			t.Errorf("expected a valid signature, got %q", r.Header.Get(WebhookSignatureHeader))
+		}
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event WebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("invalid payload %s: %v", body, err)
+		}
+		received = append(received, event)
+	}))
+	defer server.Close()
+
+	if status, _, err := app.WebhookAdd(ctx, WebhookRequest{URL: server.URL, Events: "zone.orphaned,policy.", Secret: "s3cret"}); status != http.StatusCreated {
+		t.Fatalf("WebhookAdd: %d %v", status, err)
+	}
+	if status, _, _ := app.WebhookAdd(ctx, WebhookRequest{URL: server.URL, Events: "record."}); status != http.StatusBadRequest {
+		t.Errorf("expected events matching nothing to be refused, got %d", status)
+	}
+
+	rule, err := app.PolicyCreateRule(ctx, PolicyRuleRequest{
+		ZonePattern:      "%u.users.dhbw.site",
+		ZoneSoa:          "users.dhbw.site",
+		TargetUserFilter: "*",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addZone(t, app, "alice", "alice.users.dhbw.site")
+	app.emit(ctx, EventZoneCreated, "alice.users.dhbw.site", nil) // not wanted
+
+	now := time.Now()
+	if err := dispatcher.DeliverDue(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, _ := app.Storage.WebhookDeliveryList(1, 10)
+	if len(deliveries) != 1 || deliveries[0].Status != DeliveryPending || deliveries[0].Attempts != 1 || !deliveries[0].NextAttemptAt.After(now) {
+		t.Fatalf("expected the rule creation to wait for a retry, got %+v", deliveries)
+	}
+
+	failing = false
+	if err := app.PolicyDeleteRule(ctx, int64(rule.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.DeliverDue(ctx, now.Add(webhookBackoff)); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 3 || received[0].Event != EventRuleCreated || received[1].Event != EventRuleDeleted ||
+		received[2].Event != EventZoneOrphaned || received[2].Zone != "alice.users.dhbw.site" {
+		t.Fatalf("expected the rule creation, deletion and the orphaned zone, got %+v", received)
+	}
+
+	if got := webhookBackoffAfter(webhookMaxAttempts); got != webhookMaxBackoff {
+		t.Errorf("expected the backoff to be capped at %s, got %s", webhookMaxBackoff, got)
+	}
+}
+
+// Joining a shared zone adds an owner just like being added by one.
+func TestZoneJoinEmitsOwnerAdded(t *testing.T) {
+	app := newTestApp(t)
+	useFakePdns(t, app)
+	ctx := context.Background()
+	const zone = "team.example.com"
+
+	if status, _, err := app.WebhookAdd(ctx, WebhookRequest{URL: "http://127.0.0.1:1/", Events: EventZoneOwnerAdded}); status != http.StatusCreated {
+		t.Fatalf("WebhookAdd: %d %v", status, err)
+	}
+	if _, err := app.PolicyCreateRule(ctx, PolicyRuleRequest{ZonePattern: zone, ZoneSoa: "example.com", TargetUserFilter: "*", SharingAllowed: true}); err != nil {
+		t.Fatal(err)
+	}
+	if status, _, err := app.ZoneCreate(ctx, "alice", ZoneResponse{Zone: zone, ZoneSOA: "example.com"}, ""); status != http.StatusCreated {
+		t.Fatalf("ZoneCreate: %d %v", status, err)
+	}
+	if status, _, err := app.ZoneJoin(ctx, &UserClaims{PreferredUsername: "bob"}, zone); status != http.StatusOK {
+		t.Fatalf("ZoneJoin: %d %v", status, err)
+	}
+
+	deliveries, _ := app.Storage.WebhookDeliveryList(1, 10)
+	if len(deliveries) != 1 || deliveries[0].Event != EventZoneOwnerAdded {
+		t.Fatalf("expected one %s delivery, got %+v", EventZoneOwnerAdded, deliveries)
+	}
+	var event WebhookEvent
+	if err := json.Unmarshal([]byte(deliveries[0].Payload), &event); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := event.Data.(map[string]any); data["owner"] != "bob" {
+		t.Errorf("expected bob as the new owner, got %+v", event.Data)
+	}
+}
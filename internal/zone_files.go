@@ -0,0 +1,280 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/farberg/dynamic-zones/internal/helper"
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// importDefaultTTL is the TTL of imported records that have none and are not
+// covered by a $TTL line.
+const importDefaultTTL = 3600
+
+// errNoZoneKey is returned by userZoneKey when the user owns the zone but has no
+// key on it (e.g. after a failed rotation).
+var errNoZoneKey = errors.New("no TSIG key of this user on the zone")
+
+// ZoneImportSkipped is a record of an imported file that was left alone.
+type ZoneImportSkipped struct {
+	Record string `json:"record"`
+	Reason string `json:"reason"`
+}
+
+// ZoneImportResponse is the diff of an import: what was (or, for a dry run,
+// would be) added and removed, and what the file held that is not imported.
+type ZoneImportResponse struct {
+	Zone    string              `json:"zone"`
+	DryRun  bool                `json:"dry_run"`
+	Add     []string            `json:"add"`
+	Remove  []string            `json:"remove"`
+	Skipped []ZoneImportSkipped `json:"skipped"`
+}
+
+// userZoneKey returns the user's own TSIG key for zone. GetZone scopes the
+// lookup to that user, so a co-owner's key is never picked.
+func (app *AppData) userZoneKey(ctx context.Context, username, zone string) (*ZoneKey, error) {
+	pdnsZone, err := app.PowerDns.GetZone(ctx, zone, username)
+	if err != nil {
+		return nil, fmt.Errorf("app.userZoneKey: %w", err)
+	}
+	if len(pdnsZone.ZoneKeys) == 0 {
+		return nil, errNoZoneKey
+	}
+	return &pdnsZone.ZoneKeys[0], nil
+}
+
+// zoneRecordsAsUser transfers all records of zone, signed with the user's key.
+// The records of the DNSSEC signer are left out; they are not the user's.
+func (app *AppData) zoneRecordsAsUser(ctx context.Context, username, zone string) (int, []dns.RR, error) {
+	key, err := app.userZoneKey(ctx, username, zone)
+	if errors.Is(err, errNoZoneKey) {
+		return http.StatusNotFound, nil, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	rrs, err := helper.ZoneTransfer(key.Keyname, key.Algorithm, key.Key, GetServerAddress(app), zone)
+	if err != nil {
+		return http.StatusBadGateway, nil, err
+	}
+	records := rrs[:0]
+	for _, rr := range rrs {
+		if !isDnssecType(rr.Header().Rrtype) {
+			records = append(records, rr)
+		}
+	}
+	return http.StatusOK, records, nil
+}
+
+// protectedRecords returns the (name, type) pairs the service itself maintains
+// in zone — the enforced default records. Import neither writes nor removes
+// them, so a zone file cannot replace what policy puts there.
+func (app *AppData) protectedRecords(zone string) map[string]bool {
+	zoneFQDN := dns.Fqdn(zone)
+	protected := make(map[string]bool)
+	for _, list := range [][]DefaultRecord{app.Config.ZoneDefaults.DefaultRecords, app.Config.ZoneDefaults.DefaultRecordsSoa} {
+		for _, r := range list {
+			name := zoneFQDN
+			if r.Name != "" && r.Name != "@" {
+				name = dns.Fqdn(r.Name + "." + zoneFQDN)
+			}
+			protected[strings.ToLower(name)+" "+strings.ToUpper(r.Type)] = true
+		}
+	}
+	return protected
+}
+
+// subzoneDelegations returns the names of the stored zones below zone, in
+// lower case. The service delegates them (see EnsureIntermediateZoneExists),
+// so their NS and DS records in zone are its own, not the owner's.
+func (app *AppData) subzoneDelegations(zone string) (map[string]bool, error) {
+	subzones, err := app.subzonesOf(zone)
+	if err != nil {
+		return nil, fmt.Errorf("app.subzoneDelegations: %w", err)
+	}
+	delegations := make(map[string]bool, len(subzones))
+	for _, subzone := range subzones {
+		delegations[strings.ToLower(dns.Fqdn(subzone))] = true
+	}
+	return delegations, nil
+}
+
+// importSkipReason says why a record is not managed by import, or "" if it is.
+// delegations holds the names subzoneDelegations returns.
+func importSkipReason(rr dns.RR, zoneFQDN string, protected, delegations map[string]bool) string {
+	h := rr.Header()
+	name := strings.ToLower(h.Name)
+	recordType := dns.TypeToString[h.Rrtype]
+	apex := name == strings.ToLower(zoneFQDN)
+
+	switch {
+	case apex && (h.Rrtype == dns.TypeSOA || h.Rrtype == dns.TypeNS):
+		return "apex SOA and NS are maintained by the service"
+	case delegations[name] && (h.Rrtype == dns.TypeNS || h.Rrtype == dns.TypeDS):
+		return "delegation of a subzone"
+	case protected[name+" "+recordType]:
+		return "enforced default record"
+	case !helper.IsSupportedRecordType(recordType):
+		return "unsupported type " + recordType
+	}
+	return ""
+}
+
+// ZoneExport returns the zone's records as an RFC 1035 master file.
+func (app *AppData) ZoneExport(ctx context.Context, username, zone string) (int, any, error) {
+	isOwner, err := app.Storage.IsZoneOwner(username, zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to check zone ownership", fmt.Errorf("app.ZoneExport: %w", err))
+	}
+	if !isOwner {
+		return errorResult(http.StatusForbidden, "You are not an owner of this zone", fmt.Errorf("app.ZoneExport: %s not owned by %s", zone, username))
+	}
+
+	status, rrs, err := app.zoneRecordsAsUser(ctx, username, zone)
+	if err != nil {
+		return errorResult(status, "Failed to transfer the zone", fmt.Errorf("app.ZoneExport: %w", err))
+	}
+
+	var buf bytes.Buffer
+	if err := helper.WriteZoneFile(&buf, zone, rrs); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to write the zone file", fmt.Errorf("app.ZoneExport: %w", err))
+	}
+	return http.StatusOK, buf.String(), nil
+}
+
+// ZoneImport makes the zone hold the records of zoneFile. Apex SOA/NS, the
+// delegations of subzones, the enforced default records and types the record
+// API does not write are skipped on both sides: they are neither imported nor
+// removed. The changes are sent as ONE update, so an import applies completely
+// or not at all. With dryRun only the diff is returned.
+func (app *AppData) ZoneImport(ctx context.Context, username, zone, zoneFile string, dryRun bool) (int, any, error) {
+	isOwner, err := app.Storage.IsZoneOwner(username, zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to check zone ownership", fmt.Errorf("app.ZoneImport: %w", err))
+	}
+	if !isOwner {
+		return errorResult(http.StatusForbidden, "You are not an owner of this zone", fmt.Errorf("app.ZoneImport: %s not owned by %s", zone, username))
+	}
+
+	parsed, err := helper.ParseZoneFile(strings.NewReader(zoneFile), zone, importDefaultTTL)
+	if err != nil {
+		return errorResult(http.StatusBadRequest, "Invalid zone file: "+err.Error(), fmt.Errorf("app.ZoneImport: %w", err))
+	}
+	return app.syncZoneRecords(ctx, "app.ZoneImport", AuditZoneImport, username, zone, parsed, recordSyncOptions{}, dryRun)
+}
+
+// recordSyncOptions names records a sync leaves alone besides those
+// importSkipReason names.
+type recordSyncOptions struct {
+	// KeepForeign leaves alone the records other writers own: external-dns
+	// ownership markers and the records they mark.
+	KeepForeign bool
+	// Ignore holds name patterns (path.Match syntax, relative to the zone,
+	// "@" for the apex) whose records are left alone.
+	Ignore []string
+}
+
+// syncZoneRecords makes zone hold exactly desired, in ONE update, so the
+// records change completely or not at all. Records importSkipReason or opts
+// exclude are skipped on both sides: they are neither written nor removed.
+// With dryRun only the diff is returned. op prefixes errors and logs; action is
+// the audit action.
+func (app *AppData) syncZoneRecords(ctx context.Context, op, action, username, zone string, desired []dns.RR, opts recordSyncOptions, dryRun bool) (int, any, error) {
+	zoneFQDN := dns.Fqdn(zone)
+	if status, resp, err := app.requireZoneWritable(zone); err != nil {
+		return status, resp, fmt.Errorf("%s: %w", op, err)
+	}
+	constraints, quotas, err := app.zoneLimits(zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to resolve the policy of this zone", fmt.Errorf("%s: %w", op, err))
+	}
+
+	status, current, err := app.zoneRecordsAsUser(ctx, username, zone)
+	if err != nil {
+		return errorResult(status, "Failed to transfer the zone", fmt.Errorf("%s: %w", op, err))
+	}
+
+	protected := app.protectedRecords(zone)
+	delegations, err := app.subzoneDelegations(zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to look up the subzones of this zone", fmt.Errorf("%s: %w", op, err))
+	}
+	foreign := foreignRecords(zoneFQDN, current, opts)
+	skipReason := func(rr dns.RR) string {
+		if reason := importSkipReason(rr, zoneFQDN, protected, delegations); reason != "" {
+			return reason
+		}
+		return foreign(rr)
+	}
+	response := ZoneImportResponse{Zone: zoneFQDN, DryRun: dryRun, Add: []string{}, Remove: []string{}, Skipped: []ZoneImportSkipped{}}
+
+	var wanted []dns.RR
+	for _, rr := range desired {
+		if !dns.IsSubDomain(zoneFQDN, rr.Header().Name) {
+			return errorResult(http.StatusBadRequest, fmt.Sprintf("Record %s is outside of zone %s", rr.Header().Name, zoneFQDN), fmt.Errorf("%s: foreign record %s", op, rr.Header().Name))
+		}
+		if reason := skipReason(rr); reason != "" {
+			response.Skipped = append(response.Skipped, ZoneImportSkipped{Record: rr.String(), Reason: reason})
+			continue
+		}
+		wanted = append(wanted, rr)
+	}
+	var managed []dns.RR
+	for _, rr := range current {
+		if skipReason(rr) == "" {
+			managed = append(managed, rr)
+		}
+	}
+
+	add, remove := helper.DiffRecords(managed, wanted)
+	if err := constraints.CheckAll(zoneFQDN, add); err != nil {
+		return errorResult(http.StatusForbidden, err.Error(), fmt.Errorf("%s: %w", op, err))
+	}
+	for _, rr := range add {
+		response.Add = append(response.Add, rr.String())
+	}
+	for _, rr := range remove {
+		response.Remove = append(response.Remove, rr.String())
+	}
+
+	if dryRun || len(add)+len(remove) == 0 {
+		return http.StatusOK, response, nil
+	}
+	if len(add)+len(remove) > maxBatchChanges {
+		return errorResult(http.StatusBadRequest, fmt.Sprintf("At most %d changes are applied at once, this one has %d; send the records in parts", maxBatchChanges, len(add)+len(remove)),
+			fmt.Errorf("%s: %d changes", op, len(add)+len(remove)))
+	}
+
+	key, err := app.userZoneKey(ctx, username, zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to look up your TSIG key", fmt.Errorf("%s: %w", op, err))
+	}
+
+	// Removals first: a record whose TTL changes is removed and added again.
+	u := helper.NewRfc2136Update(zoneFQDN)
+	u.DeleteRecords(remove)
+	u.Add(add)
+	if err := quotas.CheckRecordCount(zoneFQDN, current, u.Apply(current)); err != nil {
+		return errorResult(http.StatusForbidden, err.Error(), fmt.Errorf("%s: %w", op, err))
+	}
+	if key, err = app.apiUpdateKey(zone, key); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to resolve the policy of this zone", fmt.Errorf("%s: %w", op, err))
+	}
+	msg, err := u.Send(key.Keyname, key.Algorithm, key.Key, GetServerAddress(app))
+	countUpdate(msg, err)
+	if err != nil {
+		return errorResult(http.StatusBadGateway, "The DNS server refused the update: "+err.Error(), fmt.Errorf("%s: %w", op, err))
+	}
+
+	app.Log.Infof("%s: %s changed %s: %d added, %d removed, %d skipped", op, username, zone, len(add), len(remove), len(response.Skipped))
+	app.audit(ctx, action, zone, zone, gin.H{"records": response.Remove}, gin.H{"records": response.Add})
+	app.recordZoneVersion(ctx, zone, ZoneVersionAPI)
+	return http.StatusOK, response, nil
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// Import must never touch what the service maintains, on either side of the
+// diff — an imported file cannot drop the apex NS or the enforced CAA.
+func TestImportSkipsServiceRecords(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.ZoneDefaults.DefaultRecords = []DefaultRecord{
+		{Name: "_acme-challenge", Type: "CNAME", Content: "auth.example.net."},
+		{Name: "@", Type: "CAA", Content: `0 issue "letsencrypt.org"`},
+	}
+	protected := app.protectedRecords("example.com")
+
+	cases := []struct {
+		record string
+		skip   bool
+	}{
+		{"example.com. 300 IN NS ns1.example.net.", true},
+		{"example.com. 300 IN SOA ns1.example.net. hostmaster.example.com. 1 2 3 4 5", true},
+		{"_acme-challenge.example.com. 300 IN CNAME other.example.net.", true},
+		{`example.com. 300 IN CAA 0 issue "other-ca.example"`, true},
+		{"example.com. 300 IN HINFO \"cpu\" \"os\"", true},
+		{"sub.example.com. 300 IN NS ns1.example.net.", false},
+		{"www.example.com. 300 IN A 192.0.2.1", false},
+		{"example.com. 300 IN MX 10 mail.example.com.", false},
+	}
+	for _, tc := range cases {
+		rr, err := dns.NewRR(tc.record)
+		if err != nil {
+			t.Fatalf("bad test record %q: %v", tc.record, err)
+		}
+		reason := importSkipReason(rr, "example.com.", protected, nil)
+		if tc.skip && reason == "" {
+			t.Errorf("expected %q to be skipped", tc.record)
+		}
+		if !tc.skip && reason != "" {
+			t.Errorf("expected %q to be imported, skipped: %s", tc.record, reason)
+		}
+	}
+}
+
+// The service delegates a stored subzone from its parent; an import into the
+// parent must neither drop that delegation nor replace it.
+func TestImportSkipsSubzoneDelegations(t *testing.T) {
+	app := newTestApp(t)
+	addZone(t, app, "alice", "example.com")
+	addZone(t, app, "alice", "sub.example.com")
+	addZone(t, app, "bob", "other.org")
+	delegations, err := app.subzoneDelegations("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		record string
+		skip   bool
+	}{
+		{"sub.example.com. 300 IN NS ns1.example.net.", true},
+		{"SUB.example.com. 300 IN DS 12345 13 2 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", true},
+		{"sub.example.com. 300 IN TXT \"not a delegation\"", false},
+		{"lab.example.com. 300 IN NS ns1.example.net.", false},
+	}
+	for _, tc := range cases {
+		rr, err := dns.NewRR(tc.record)
+		if err != nil {
+			t.Fatalf("bad test record %q: %v", tc.record, err)
+		}
+		reason := importSkipReason(rr, "example.com.", nil, delegations)
+		if tc.skip && reason == "" {
+			t.Errorf("expected %q to be skipped", tc.record)
+		}
+		if !tc.skip && reason != "" {
+			t.Errorf("expected %q to be imported, skipped: %s", tc.record, reason)
+		}
+	}
+}
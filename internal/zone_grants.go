@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// The owner keys of a zone may update it over RFC 2136 straight at the
+// nameserver, past the checks of the API. Where the rule of a zone sets limits
+// only the API enforces, their update grants are withheld the way an admin
+// suspension withholds them (see SuspendZoneUpdates), and the API signs the
+// updates it has checked with the admin key instead. The keys may still
+// transfer the zone.
+
+// adminKey returns the configured admin TSIG key, or nil without one.
+func (app *AppData) adminKey() *ZoneKey {
+	zd := app.Config.ZoneDefaults
+	if zd.DefaultAdminTsigKeyName == "" || zd.DefaultAdminTsigKey == "" || zd.DefaultAdminTsigAlg == "" {
+		return nil
+	}
+	return &ZoneKey{Keyname: zd.DefaultAdminTsigKeyName, Algorithm: zd.DefaultAdminTsigAlg, Key: zd.DefaultAdminTsigKey}
+}
+
+// directUpdatesWithheld reports whether a rule with constraints and quotas
+// withholds the update grants of the owner keys of its zones: when it
+// constrains their records or limits how many they hold. Without an admin key
+// the API could not write either, so the grants stay.
+func (app *AppData) directUpdatesWithheld(constraints *RecordConstraints, quotas *ZoneQuotas) bool {
+	limited := quotas != nil && quotas.MaxRecordsPerZone > 0
+	return app.adminKey() != nil && (!constraints.Empty() || limited)
+}
+
+// apiUpdateKey returns the key an update of zone that the API has checked is
+// signed with: key itself, or the admin key while the rule of the zone
+// withholds the direct update grants.
+func (app *AppData) apiUpdateKey(zone string, key *ZoneKey) (*ZoneKey, error) {
+	constraints, quotas, err := app.zoneLimits(zone)
+	if err != nil {
+		return nil, fmt.Errorf("app.apiUpdateKey: %w", err)
+	}
+	if app.directUpdatesWithheld(constraints, quotas) {
+		return app.adminKey(), nil
+	}
+	return key, nil
+}
+
+// updateCredentialsFor returns the credentials an update of zone that the API
+// has checked is sent with, see apiUpdateKey. On failure it has written the
+// response and returns false.
+func updateCredentialsFor(app *AppData, c *gin.Context, zone, keyName, keyAlgo, key string) (string, string, string, bool) {
+	k, err := app.apiUpdateKey(zone, &ZoneKey{Keyname: keyName, Algorithm: keyAlgo, Key: key})
+	if err != nil {
+		app.Log.Errorf("updateCredentialsFor: zone '%s': %v", zone, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to resolve the policy of this zone"})
+		return "", "", "", false
+	}
+	return dns.Fqdn(k.Keyname), dns.Fqdn(k.Algorithm), k.Key, true
+}
+
+// syncZoneUpdateGrants withholds the update grants of the owner keys of zone
+// while an admin suspended it, its lease expired or its rule withholds them,
+// and restores them otherwise.
+func (app *AppData) syncZoneUpdateGrants(ctx context.Context, zone string) error {
+	rows, err := app.Storage.ZoneRows(zone)
+	if err != nil {
+		return fmt.Errorf("app.syncZoneUpdateGrants: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	l := groupZoneLeases(rows)[0]
+	withhold := l.suspended != nil || l.disabled != nil
+	if !withhold {
+		constraints, quotas, err := app.zoneLimits(zone)
+		if err != nil {
+			return fmt.Errorf("app.syncZoneUpdateGrants: %w", err)
+		}
+		withhold = app.directUpdatesWithheld(constraints, quotas)
+	}
+
+	if withhold {
+		err = app.PowerDns.SuspendZoneUpdates(ctx, zone)
+	} else {
+		err = app.PowerDns.ResumeZoneUpdates(ctx, zone)
+	}
+	if err != nil {
+		return fmt.Errorf("app.syncZoneUpdateGrants: %w", err)
+	}
+	return nil
+}
+
+// SyncAllZoneUpdateGrants runs syncZoneUpdateGrants for every stored zone, at
+// startup, so that zones created before their rule withheld the grants follow
+// it. Failures are logged.
+func (app *AppData) SyncAllZoneUpdateGrants(ctx context.Context) {
+	rows, err := app.Storage.ListAllZones()
+	if err != nil {
+		app.Log.Warnf("app.SyncAllZoneUpdateGrants: %v", err)
+		return
+	}
+	for _, l := range groupZoneLeases(rows) {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := app.syncZoneUpdateGrants(ctx, l.zone); err != nil {
+			app.Log.Warnf("app.SyncAllZoneUpdateGrants: %s: %v", l.zone, err)
+		}
+	}
+}
+
+// watchUpdateGrants returns a function to call after a policy change: it runs
+// syncZoneUpdateGrants for every zone whose rule now withholds the update
+// grants where it did not before, or the other way round.
+func (app *AppData) watchUpdateGrants(ctx context.Context) func() {
+	withheld := func() (map[string]bool, error) {
+		rows, err := app.Storage.ListAllZones()
+		if err != nil {
+			return nil, err
+		}
+		zones := make(map[string]bool)
+		for _, l := range groupZoneLeases(rows) {
+			constraints, quotas, err := app.zoneLimits(l.zone)
+			if err != nil {
+				return nil, err
+			}
+			zones[l.zone] = app.directUpdatesWithheld(constraints, quotas)
+		}
+		return zones, nil
+	}
+	before, err := withheld()
+	if err != nil {
+		app.Log.Errorf("app.watchUpdateGrants: %v", err)
+		return func() {}
+	}
+	return func() {
+		after, err := withheld()
+		if err != nil {
+			app.Log.Errorf("app.watchUpdateGrants: %v", err)
+			return
+		}
+		for zone, withhold := range after {
+			if withhold == before[zone] {
+				continue
+			}
+			if err := app.syncZoneUpdateGrants(ctx, zone); err != nil {
+				app.Log.Warnf("app.watchUpdateGrants: %s: %v", zone, err)
+			}
+		}
+	}
+}
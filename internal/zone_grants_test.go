@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// A constrained zone cannot be updated with its own keys past the API: their
+// grants are withheld, and the API signs with the admin key instead. Once the
+// rule drops its constraints, the keys get their grants back, until it limits
+// the records.
+func TestConstrainedZoneWithholdsDirectUpdates(t *testing.T) {
+	app := newTestApp(t)
+	fake := useFakePdns(t, app)
+	ctx := context.Background()
+	app.Config.ZoneDefaults.DefaultAdminTsigKeyName = "admin-key"
+	app.Config.ZoneDefaults.DefaultAdminTsigAlg = "hmac-sha256"
+	app.Config.ZoneDefaults.DefaultAdminTsigKey = "YWRtaW4="
+	const zone = "alice.users.example.com"
+	const updaters = zone + ". TSIG-ALLOW-DNSUPDATE"
+
+	req := PolicyRuleRequest{ZonePattern: "%u.users.example.com", ZoneSoa: "users.example.com", TargetUserFilter: "*",
+		RecordConstraints: RecordConstraints{AllowedRecordTypes: "A,AAAA"}}
+	rule, err := app.PolicyCreateRule(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _, err := app.ZoneCreate(ctx, "alice", ZoneResponse{Zone: zone, ZoneSOA: "users.example.com"}, ""); status != http.StatusCreated {
+		t.Fatalf("ZoneCreate: %d %v", status, err)
+	}
+	aliceKey := app.PowerDns.keyNameFor("alice", zone)
+	if slices.Contains(fake.metadata[updaters], aliceKey) || !slices.Contains(fake.metadata[zone+". "+string(metadataSuspendedUpdates)], aliceKey) {
+		t.Errorf("expected the update grant of the owner to be withheld, got %v", fake.metadata[updaters])
+	}
+	if key, err := app.apiUpdateKey(zone, &ZoneKey{Keyname: aliceKey}); err != nil || key.Keyname != "admin-key" {
+		t.Errorf("expected the API to sign with the admin key, got %+v %v", key, err)
+	}
+
+	req.RecordConstraints = RecordConstraints{}
+	if _, err := app.PolicyUpdateRule(ctx, int64(rule.ID), req); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(fake.metadata[updaters], aliceKey) {
+		t.Errorf("expected the update grant back without constraints, got %v", fake.metadata[updaters])
+	}
+	if key, _ := app.apiUpdateKey(zone, &ZoneKey{Keyname: aliceKey}); key.Keyname != aliceKey {
+		t.Errorf("expected the API to sign with the owner key, got %+v", key)
+	}
+
+	// A record quota cannot be checked by PowerDNS either.
+	req.ZoneQuotas = ZoneQuotas{MaxRecordsPerZone: 10}
+	if _, err := app.PolicyUpdateRule(ctx, int64(rule.ID), req); err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(fake.metadata[updaters], aliceKey) {
+		t.Errorf("expected the update grant to be withheld with a record quota, got %v", fake.metadata[updaters])
+	}
+}
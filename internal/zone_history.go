@@ -0,0 +1,539 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+)
+
+// Values of ZoneVersion.Source.
+const (
+	// ZoneVersionAPI follows a change made through this service.
+	ZoneVersionAPI = "api"
+	// ZoneVersionTransfer was found by the periodic zone transfer: a change
+	// sent straight to the nameserver over RFC 2136.
+	ZoneVersionTransfer = "transfer"
+	// ZoneVersionRollback follows a rollback to an earlier version.
+	ZoneVersionRollback = "rollback"
+)
+
+// Page size of GET /v1/zones/{zone}/history.
+const (
+	zoneHistoryDefaultLimit = 50
+	zoneHistoryMaxLimit     = 500
+)
+
+// ZoneVersion is the records of a zone at one point in time. A version is
+// only stored when the records differ from the previous one.
+type ZoneVersion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	Zone      string    `gorm:"type:varchar(255);index;not null" json:"zone"`
+	Source    string    `gorm:"type:varchar(16)" json:"source" enums:"api,transfer,rollback"`
+	// Actor and RequestID are those of the change; "system" for a transfer.
+	Actor     string `gorm:"type:varchar(255)" json:"actor"`
+	RequestID string `gorm:"type:varchar(64)" json:"request_id,omitempty"`
+	// Digest is the SHA-256 of RRsets, to tell a change from none.
+	Digest string `gorm:"type:varchar(64)" json:"digest"`
+	// RRsets holds the JSON of the zone's []RRsetSnapshot, without what the
+	// service maintains itself (see userRRsets). Lists leave it out.
+	RRsets string `gorm:"type:text" json:"rrsets,omitempty" swaggertype:"array,object"`
+}
+
+// MarshalJSON embeds the RRsets as JSON.
+func (v ZoneVersion) MarshalJSON() ([]byte, error) {
+	type plain ZoneVersion
+	var rrsets json.RawMessage
+	if v.RRsets != "" {
+		rrsets = json.RawMessage(v.RRsets)
+	}
+	return json.Marshal(struct {
+		plain
+		RRsets json.RawMessage `json:"rrsets,omitempty"`
+	}{plain(v), rrsets})
+}
+
+// Snapshot returns the stored RRsets.
+func (v *ZoneVersion) Snapshot() ([]RRsetSnapshot, error) {
+	var rrsets []RRsetSnapshot
+	if err := json.Unmarshal([]byte(v.RRsets), &rrsets); err != nil {
+		return nil, fmt.Errorf("RRsets of zone version %d: %w", v.ID, err)
+	}
+	return rrsets, nil
+}
+
+// ZoneDiff is what changes between two versions of a zone, as records in
+// zone file format.
+type ZoneDiff struct {
+	Zone string `json:"zone"`
+	// From and To are version IDs; 0 is the records the zone holds now.
+	From   uint     `json:"from"`
+	To     uint     `json:"to"`
+	DryRun bool     `json:"dry_run,omitempty"`
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// ZoneVersionCreate stores a version of a zone.
+func (s *Storage) ZoneVersionCreate(v *ZoneVersion) error {
+	if err := s.db.Create(v).Error; err != nil {
+		return fmt.Errorf("storage.ZoneVersionCreate: %w", err)
+	}
+	return nil
+}
+
+// ZoneVersionList returns up to limit versions of zone, newest first, without
+// their records.
+func (s *Storage) ZoneVersionList(zone string, limit int) ([]ZoneVersion, error) {
+	var versions []ZoneVersion
+	err := s.db.Select("id", "created_at", "zone", "source", "actor", "request_id", "digest").Where("zone = ?", zone).Order("id desc").Limit(limit).Find(&versions).Error
+	if err != nil {
+		return nil, fmt.Errorf("storage.ZoneVersionList: %w", err)
+	}
+	return versions, nil
+}
+
+// ZoneVersionGet returns version id of zone, or the latest version of zone
+// when id is 0. Nil if there is none.
+func (s *Storage) ZoneVersionGet(zone string, id uint) (*ZoneVersion, error) {
+	var v ZoneVersion
+	query := s.db.Where("zone = ?", zone)
+	if id != 0 {
+		query = query.Where("id = ?", id)
+	}
+	err := query.Order("id desc").First(&v).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage.ZoneVersionGet: %w", err)
+	}
+	return &v, nil
+}
+
+// ZoneVersionPrevious returns the version of zone before version id, nil if
+// id is the first.
+func (s *Storage) ZoneVersionPrevious(zone string, id uint) (*ZoneVersion, error) {
+	var v ZoneVersion
+	err := s.db.Where("zone = ? AND id < ?", zone, id).Order("id desc").First(&v).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage.ZoneVersionPrevious: %w", err)
+	}
+	return &v, nil
+}
+
+// ZoneVersionPrune deletes all but the newest keep versions of zone.
+func (s *Storage) ZoneVersionPrune(zone string, keep int) error {
+	var ids []uint
+	if err := s.db.Model(&ZoneVersion{}).Where("zone = ?", zone).Order("id desc").Offset(keep).Pluck("id", &ids).Error; err != nil {
+		return fmt.Errorf("storage.ZoneVersionPrune: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := s.db.Delete(&ZoneVersion{}, ids).Error; err != nil {
+		return fmt.Errorf("storage.ZoneVersionPrune: %w", err)
+	}
+	return nil
+}
+
+// ZoneVersionDeleteAll deletes the history of zone.
+func (s *Storage) ZoneVersionDeleteAll(zone string) error {
+	if err := s.db.Where("zone = ?", zone).Delete(&ZoneVersion{}).Error; err != nil {
+		return fmt.Errorf("storage.ZoneVersionDeleteAll: %w", err)
+	}
+	return nil
+}
+
+// snapshotRR parses one record of an RRset.
+func snapshotRR(s RRsetSnapshot, content string) (dns.RR, error) {
+	return dns.NewRR(fmt.Sprintf("%s %d IN %s %s", s.Name, s.TTL, s.Type, content))
+}
+
+// rrContent returns the data of rr the way PowerDNS stores it.
+func rrContent(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// rrsetsOf groups records, e.g. of a zone transfer, into RRsets.
+func rrsetsOf(rrs []dns.RR) []RRsetSnapshot {
+	var rrsets []RRsetSnapshot
+	index := make(map[string]int)
+	for _, rr := range rrs {
+		h := rr.Header()
+		key := strings.ToLower(h.Name) + " " + dns.TypeToString[h.Rrtype]
+		i, ok := index[key]
+		if !ok {
+			i = len(rrsets)
+			index[key] = i
+			rrsets = append(rrsets, RRsetSnapshot{Name: h.Name, Type: dns.TypeToString[h.Rrtype], TTL: h.Ttl})
+		}
+		rrsets[i].Records = append(rrsets[i].Records, rrContent(rr))
+	}
+	return rrsets
+}
+
+// canonicalRRsets returns rrsets in one form, whether they were read from the
+// PowerDNS API or transferred: lower-case names, record data as the DNS
+// library prints it, everything sorted. Equal zones give equal JSON.
+func canonicalRRsets(rrsets []RRsetSnapshot) []RRsetSnapshot {
+	canonical := make([]RRsetSnapshot, 0, len(rrsets))
+	for _, s := range rrsets {
+		c := RRsetSnapshot{Name: strings.ToLower(dns.Fqdn(s.Name)), Type: strings.ToUpper(s.Type), TTL: s.TTL}
+		for _, content := range s.Records {
+			if rr, err := snapshotRR(c, content); err == nil {
+				content = rrContent(rr)
+			}
+			c.Records = append(c.Records, content)
+		}
+		slices.Sort(c.Records)
+		c.Records = slices.Compact(c.Records)
+		canonical = append(canonical, c)
+	}
+	slices.SortFunc(canonical, func(a, b RRsetSnapshot) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Type, b.Type))
+	})
+	return canonical
+}
+
+// snapshotRRs parses the records of rrsets, leaving out those the DNS library
+// cannot parse.
+func snapshotRRs(rrsets []RRsetSnapshot) []dns.RR {
+	var rrs []dns.RR
+	for _, s := range rrsets {
+		for _, content := range s.Records {
+			if rr, err := snapshotRR(s, content); err == nil {
+				rrs = append(rrs, rr)
+			}
+		}
+	}
+	return rrs
+}
+
+// snapshotLines returns the records of rrsets in zone file format.
+func snapshotLines(rrsets []RRsetSnapshot) map[string]bool {
+	lines := make(map[string]bool)
+	for _, s := range rrsets {
+		for _, content := range s.Records {
+			if rr, err := snapshotRR(s, content); err == nil {
+				lines[rr.String()] = true
+			} else {
+				lines[fmt.Sprintf("%s\t%d\tIN\t%s\t%s", s.Name, s.TTL, s.Type, content)] = true
+			}
+		}
+	}
+	return lines
+}
+
+// diffRRsets returns the records to add and remove to get from from to to,
+// and the RRsets that do it: to's RRsets that differ from from's, and empty
+// ones for the RRsets only from has.
+func diffRRsets(from, to []RRsetSnapshot) (add, remove []string, changes []RRsetSnapshot) {
+	before, after := snapshotLines(from), snapshotLines(to)
+	for line := range after {
+		if !before[line] {
+			add = append(add, line)
+		}
+	}
+	for line := range before {
+		if !after[line] {
+			remove = append(remove, line)
+		}
+	}
+	slices.Sort(add)
+	slices.Sort(remove)
+
+	key := func(s RRsetSnapshot) string { return s.Name + " " + s.Type }
+	old := make(map[string]RRsetSnapshot, len(from))
+	for _, s := range from {
+		old[key(s)] = s
+	}
+	for _, s := range to {
+		if o, ok := old[key(s)]; !ok || o.TTL != s.TTL || !slices.Equal(o.Records, s.Records) {
+			changes = append(changes, s)
+		}
+		delete(old, key(s))
+	}
+	for _, s := range from {
+		if _, gone := old[key(s)]; gone {
+			changes = append(changes, RRsetSnapshot{Name: s.Name, Type: s.Type})
+		}
+	}
+	return add, remove, changes
+}
+
+// zoneHistoryEnabled reports whether zone versions are kept.
+func (app *AppData) zoneHistoryEnabled() bool {
+	return app.Config.ZoneDefaults.HistoryVersions > 0
+}
+
+// currentRRsets returns the records of zone that its versions hold.
+func (app *AppData) currentRRsets(ctx context.Context, zone string) ([]RRsetSnapshot, error) {
+	rrsets, err := app.PowerDns.ZoneRRsets(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if rrsets, err = app.userRRsets(zone, rrsets); err != nil {
+		return nil, err
+	}
+	return canonicalRRsets(rrsets), nil
+}
+
+// recordZoneVersion stores the records zone holds after a change through the
+// API. A failure is logged, not returned: the change itself has happened.
+func (app *AppData) recordZoneVersion(ctx context.Context, zone, source string) {
+	if !app.zoneHistoryEnabled() {
+		return
+	}
+	zone = auditZone(zone)
+	rrsets, err := app.currentRRsets(ctx, zone)
+	if err == nil {
+		err = app.storeZoneVersion(ctx, zone, source, rrsets)
+	}
+	if err != nil {
+		app.Log.Warnf("app.recordZoneVersion: %s: %v", zone, err)
+	}
+}
+
+// storeZoneVersion stores rrsets, canonical, as the newest version of zone
+// unless the newest one holds the same records.
+func (app *AppData) storeZoneVersion(ctx context.Context, zone, source string, rrsets []RRsetSnapshot) error {
+	records, err := json.Marshal(rrsets)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(records)
+	digest := hex.EncodeToString(sum[:])
+
+	latest, err := app.Storage.ZoneVersionGet(zone, 0)
+	if err != nil {
+		return err
+	}
+	if latest != nil && latest.Digest == digest {
+		return nil
+	}
+	actor := auditActorFrom(ctx)
+	version := &ZoneVersion{Zone: zone, Source: source, Actor: actor.Actor, RequestID: actor.RequestID, Digest: digest, RRsets: string(records)}
+	if err := app.Storage.ZoneVersionCreate(version); err != nil {
+		return err
+	}
+	return app.Storage.ZoneVersionPrune(zone, app.Config.ZoneDefaults.HistoryVersions)
+}
+
+// ZoneHistory returns up to limit versions of zone, newest first. Owner-only.
+func (app *AppData) ZoneHistory(ctx context.Context, username, zone string, limit int) (int, any, error) {
+	zone = auditZone(zone)
+	if status, resp, err := app.requireOwner(username, zone); err != nil {
+		return status, resp, fmt.Errorf("app.ZoneHistory: %w", err)
+	}
+	versions, err := app.Storage.ZoneVersionList(zone, limit)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the history", fmt.Errorf("app.ZoneHistory: %w", err))
+	}
+	return http.StatusOK, versions, nil
+}
+
+// zoneVersion returns version id of zone, with a result for the caller when
+// there is none.
+func (app *AppData) zoneVersion(zone string, id uint) (*ZoneVersion, int, any, error) {
+	v, err := app.Storage.ZoneVersionGet(zone, id)
+	if err != nil {
+		status, resp, err := errorResult(http.StatusInternalServerError, "Failed to read the history", err)
+		return nil, status, resp, err
+	}
+	if v == nil {
+		status, resp, err := errorResult(http.StatusNotFound, "No such version of the zone", fmt.Errorf("version %d of %s not found", id, zone))
+		return nil, status, resp, err
+	}
+	return v, 0, nil, nil
+}
+
+// ZoneVersionDetail returns version id of zone with its records. Owner-only.
+func (app *AppData) ZoneVersionDetail(ctx context.Context, username, zone string, id uint) (int, any, error) {
+	zone = auditZone(zone)
+	if status, resp, err := app.requireOwner(username, zone); err != nil {
+		return status, resp, fmt.Errorf("app.ZoneVersionDetail: %w", err)
+	}
+	v, status, resp, err := app.zoneVersion(zone, id)
+	if v == nil {
+		return status, resp, fmt.Errorf("app.ZoneVersionDetail: %w", err)
+	}
+	return http.StatusOK, v, nil
+}
+
+// ZoneVersionDiff returns what changed from version from to version to of
+// zone. from 0 is the version before to; to 0 compares with the records the
+// zone holds now. Owner-only.
+func (app *AppData) ZoneVersionDiff(ctx context.Context, username, zone string, from, to uint) (int, any, error) {
+	zone = auditZone(zone)
+	if status, resp, err := app.requireOwner(username, zone); err != nil {
+		return status, resp, fmt.Errorf("app.ZoneVersionDiff: %w", err)
+	}
+
+	var after []RRsetSnapshot
+	if to == 0 {
+		current, err := app.currentRRsets(ctx, zone)
+		if err != nil {
+			return errorResult(http.StatusBadGateway, "Failed to read the zone", fmt.Errorf("app.ZoneVersionDiff: %w", err))
+		}
+		after = current
+	} else {
+		v, status, resp, err := app.zoneVersion(zone, to)
+		if v == nil {
+			return status, resp, fmt.Errorf("app.ZoneVersionDiff: %w", err)
+		}
+		if after, err = v.Snapshot(); err != nil {
+			return errorResult(http.StatusInternalServerError, "Failed to read the version", fmt.Errorf("app.ZoneVersionDiff: %w", err))
+		}
+	}
+
+	var before []RRsetSnapshot
+	switch {
+	case from != 0:
+		v, status, resp, err := app.zoneVersion(zone, from)
+		if v == nil {
+			return status, resp, fmt.Errorf("app.ZoneVersionDiff: %w", err)
+		}
+		if before, err = v.Snapshot(); err != nil {
+			return errorResult(http.StatusInternalServerError, "Failed to read the version", fmt.Errorf("app.ZoneVersionDiff: %w", err))
+		}
+	case to != 0:
+		previous, err := app.Storage.ZoneVersionPrevious(zone, to)
+		if err != nil {
+			return errorResult(http.StatusInternalServerError, "Failed to read the history", fmt.Errorf("app.ZoneVersionDiff: %w", err))
+		}
+		if previous != nil {
+			from = previous.ID
+			if before, err = previous.Snapshot(); err != nil {
+				return errorResult(http.StatusInternalServerError, "Failed to read the version", fmt.Errorf("app.ZoneVersionDiff: %w", err))
+			}
+		}
+	default:
+		return errorResult(http.StatusBadRequest, "Compare the current records with a version (from)", fmt.Errorf("app.ZoneVersionDiff: no version"))
+	}
+
+	add, remove, _ := diffRRsets(before, after)
+	return http.StatusOK, ZoneDiff{Zone: zone, From: from, To: to, Add: add, Remove: remove}, nil
+}
+
+// ZoneRollback makes zone hold the records of version id again, in one
+// atomic change. Records the version held that the policy rule no longer
+// allows, or that exceed its quota, are refused. With dryRun only the diff is
+// returned. Owner-only.
+func (app *AppData) ZoneRollback(ctx context.Context, username, zone string, id uint, dryRun bool) (int, any, error) {
+	zone = auditZone(zone)
+	zoneFQDN := dns.Fqdn(zone)
+	if status, resp, err := app.requireOwner(username, zone); err != nil {
+		return status, resp, fmt.Errorf("app.ZoneRollback: %w", err)
+	}
+	if status, resp, err := app.requireZoneWritable(zone); err != nil {
+		return status, resp, fmt.Errorf("app.ZoneRollback: %w", err)
+	}
+	v, status, resp, err := app.zoneVersion(zone, id)
+	if v == nil {
+		return status, resp, fmt.Errorf("app.ZoneRollback: %w", err)
+	}
+	target, err := v.Snapshot()
+	if err == nil {
+		// Versions stored before a subzone was delegated may hold its NS.
+		target, err = app.userRRsets(zone, target)
+	}
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the version", fmt.Errorf("app.ZoneRollback: %w", err))
+	}
+	current, err := app.currentRRsets(ctx, zone)
+	if err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to read the zone", fmt.Errorf("app.ZoneRollback: %w", err))
+	}
+	add, remove, changes := diffRRsets(current, target)
+
+	constraints, quotas, err := app.zoneLimits(zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to resolve the policy of the zone", fmt.Errorf("app.ZoneRollback: %w", err))
+	}
+	var addRRs []dns.RR
+	for _, line := range add {
+		if rr, err := dns.NewRR(line); err == nil {
+			addRRs = append(addRRs, rr)
+		}
+	}
+	if err := constraints.CheckAll(zoneFQDN, addRRs); err != nil {
+		return errorResult(http.StatusForbidden, err.Error(), fmt.Errorf("app.ZoneRollback: %w", err))
+	}
+	if err := quotas.CheckRecordCount(zoneFQDN, snapshotRRs(current), snapshotRRs(target)); err != nil {
+		return errorResult(http.StatusForbidden, err.Error(), fmt.Errorf("app.ZoneRollback: %w", err))
+	}
+
+	diff := ZoneDiff{Zone: zone, To: v.ID, DryRun: dryRun, Add: add, Remove: remove}
+	if dryRun || len(changes) == 0 {
+		return http.StatusOK, diff, nil
+	}
+	if err := app.PowerDns.ReplaceRRsets(ctx, zone, changes); err != nil {
+		return errorResult(http.StatusBadGateway, "The DNS server refused the rollback", fmt.Errorf("app.ZoneRollback: %w", err))
+	}
+
+	app.Log.Infof("app.ZoneRollback: %s rolled %s back to version %d: %d added, %d removed", username, zone, v.ID, len(add), len(remove))
+	app.audit(ctx, AuditZoneRollback, zone, zone, gin.H{"records": remove}, gin.H{"version": v.ID, "records": add})
+	app.recordZoneVersion(ctx, zone, ZoneVersionRollback)
+	return http.StatusOK, diff, nil
+}
+
+// RunZoneHistorySnapshots transfers every zone each interval until ctx ends
+// and stores a version when its records changed, which catches the changes
+// sent straight to the nameserver over RFC 2136.
+func (app *AppData) RunZoneHistorySnapshots(ctx context.Context) {
+	interval := time.Duration(app.Config.ZoneDefaults.HistoryIntervalSeconds) * time.Second
+	if !app.zoneHistoryEnabled() || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.snapshotZones(ctx)
+		}
+	}
+}
+
+// snapshotZones transfers every zone with the key of one of its owners.
+func (app *AppData) snapshotZones(ctx context.Context) {
+	rows, err := app.Storage.ListAllZones()
+	if err != nil {
+		app.Log.Warnf("app.snapshotZones: %v", err)
+		return
+	}
+	for _, l := range groupZoneLeases(rows) {
+		if ctx.Err() != nil {
+			return
+		}
+		_, rrs, err := app.zoneRecordsAsUser(ctx, l.owners[0], l.zone)
+		var rrsets []RRsetSnapshot
+		if err == nil {
+			rrsets, err = app.userRRsets(l.zone, rrsetsOf(rrs))
+		}
+		if err == nil {
+			err = app.storeZoneVersion(ctx, l.zone, ZoneVersionTransfer, canonicalRRsets(rrsets))
+		}
+		if err != nil {
+			app.Log.Warnf("app.snapshotZones: %s: %v", l.zone, err)
+		}
+	}
+}
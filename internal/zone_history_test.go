@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// A version is kept per change of the records, diffs between versions show
+// what changed, and a rollback brings the records of a version back, but not
+// the delegations of subzones. The oldest versions beyond the limit are pruned.
+func TestZoneHistoryAndRollback(t *testing.T) {
+	app := newTestApp(t)
+	fake := useFakePdns(t, app)
+	ctx := context.Background()
+	app.Config.ZoneDefaults.HistoryVersions = 3
+	const zone = "alice.users.example.com"
+	const www, txt = zone + ". www." + zone + ". A", zone + ". " + zone + ". TXT"
+
+	if _, err := app.PolicyCreateRule(ctx, PolicyRuleRequest{ZonePattern: "%u.users.example.com", ZoneSoa: "users.example.com", TargetUserFilter: "*"}); err != nil {
+		t.Fatal(err)
+	}
+	if status, _, err := app.ZoneCreate(ctx, "alice", ZoneResponse{Zone: zone, ZoneSOA: "users.example.com"}, ""); status != http.StatusCreated {
+		t.Fatalf("ZoneCreate: %d %v", status, err)
+	}
+	fake.rrsets[www] = []string{"192.0.2.1"}
+	app.recordZoneVersion(ctx, zone, ZoneVersionAPI)
+	app.recordZoneVersion(ctx, zone, ZoneVersionAPI) // nothing changed
+	fake.rrsets[www], fake.rrsets[txt] = []string{"192.0.2.2"}, []string{`"hello"`}
+	app.recordZoneVersion(ctx, zone, ZoneVersionAPI)
+
+	_, resp, err := app.ZoneHistory(ctx, "alice", zone, zoneHistoryDefaultLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := resp.([]ZoneVersion)
+	if len(versions) != 3 || versions[0].RRsets != "" {
+		t.Fatalf("expected 3 versions without records, got %+v", versions)
+	}
+	if status, _, _ := app.ZoneHistory(ctx, "bob", zone, zoneHistoryDefaultLimit); status != http.StatusForbidden {
+		t.Errorf("expected others to be refused, got %d", status)
+	}
+
+	_, resp, _ = app.ZoneVersionDiff(ctx, "alice", zone, 0, versions[0].ID)
+	diff := resp.(ZoneDiff)
+	if diff.From != versions[1].ID || len(diff.Add) != 2 || len(diff.Remove) != 1 || diff.Remove[0] != "www."+zone+".\t0\tIN\tA\t192.0.2.1" {
+		t.Fatalf("expected the A record to change and the TXT record to appear, got %+v", diff)
+	}
+
+	if _, resp, _ := app.ZoneRollback(ctx, "alice", zone, versions[1].ID, true); len(resp.(ZoneDiff).Add) != 1 || fake.rrsets[txt] == nil {
+		t.Fatalf("expected a dry run to change nothing, got %+v", resp)
+	}
+	if status, resp, err := app.ZoneRollback(ctx, "alice", zone, versions[1].ID, false); status != http.StatusOK {
+		t.Fatalf("ZoneRollback: %d %+v %v", status, resp, err)
+	}
+	if !slices.Equal(fake.rrsets[www], []string{"192.0.2.1"}) || fake.rrsets[txt] != nil {
+		t.Fatalf("expected the records of the version back, got %v", fake.rrsets)
+	}
+	_, resp, _ = app.ZoneHistory(ctx, "alice", zone, zoneHistoryDefaultLimit)
+	if versions := resp.([]ZoneVersion); len(versions) != 3 || versions[0].Source != ZoneVersionRollback {
+		t.Errorf("expected the rollback as the newest of 3 versions, got %+v", versions)
+	}
+
+	// The delegation of a subzone is the service's: versions leave it out and
+	// rollbacks leave it alone.
+	const delegation = zone + ". dev." + zone + ". NS"
+	addZone(t, app, "alice", "dev."+zone)
+	fake.rrsets[delegation] = []string{"ns.example.com."}
+	if current, _ := app.currentRRsets(ctx, zone); slices.ContainsFunc(current, func(s RRsetSnapshot) bool { return s.Type == "NS" }) {
+		t.Errorf("expected the records without the delegation, got %+v", current)
+	}
+	if status, resp, err := app.ZoneRollback(ctx, "alice", zone, versions[1].ID, false); status != http.StatusOK || fake.rrsets[delegation] == nil {
+		t.Fatalf("expected a rollback to keep the delegation: %d %+v %v", status, resp, err)
+	}
+
+	// A zone transfer and the PowerDNS API give the same version.
+	rr, _ := dns.NewRR(`www.alice.users.example.com. 300 IN TXT "a b"`)
+	transferred := canonicalRRsets(rrsetsOf([]dns.RR{rr}))
+	read := canonicalRRsets([]RRsetSnapshot{{Name: "WWW.alice.users.example.com.", Type: "TXT", TTL: 300, Records: []string{`"a b"`}}})
+	if !reflect.DeepEqual(transferred, read) {
+		t.Errorf("expected equal snapshots, got %+v and %+v", transferred, read)
+	}
+}
@@ -0,0 +1,436 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/farberg/dynamic-zones/internal/helper"
+	"github.com/gin-gonic/gin"
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+)
+
+// maxNamedKeysPerOwner bounds the named keys one owner holds on one zone.
+const maxNamedKeysPerOwner = 20
+
+// keyExpiryInterval is how often expired named keys and the old keys of
+// graceful rotations are deleted.
+const keyExpiryInterval = time.Minute
+
+// ZoneKeyScope restricts what a named key may write. Both fields are optional;
+// a key without either writes like its owner's own key.
+//
+// PowerDNS cannot check a scope on RFC 2136 updates sent straight to the
+// nameserver (see RecordConstraints), so a scoped key is only granted AXFR
+// there. Its writes go through the record API, which checks the scope and
+// signs them with the owner's key.
+type ZoneKeyScope struct {
+	// AllowedRecordTypes is a comma-separated list of types, e.g. "TXT".
+	AllowedRecordTypes string `gorm:"type:varchar(255);default:null" json:"allowed_record_types,omitempty"`
+	// NamePrefix is what record names relative to the zone must start with,
+	// e.g. "_acme-challenge"; "@" is the apex.
+	NamePrefix string `gorm:"type:varchar(255);default:null" json:"name_prefix,omitempty"`
+}
+
+// Restricted reports whether the scope limits anything.
+func (s *ZoneKeyScope) Restricted() bool {
+	return s != nil && (len(splitList(s.AllowedRecordTypes)) > 0 || s.NamePrefix != "")
+}
+
+// Validate checks that the scope can be applied.
+func (s *ZoneKeyScope) Validate() error {
+	for _, t := range splitList(s.AllowedRecordTypes) {
+		if !helper.IsSupportedRecordType(t) {
+			return fmt.Errorf("allowed_record_types: %q is not a supported type (supported: %s)", t, strings.Join(helper.SupportedRecordTypes, ", "))
+		}
+	}
+	if strings.ContainsAny(s.NamePrefix, " \t,") || strings.HasSuffix(s.NamePrefix, ".") {
+		return fmt.Errorf("name_prefix: %q is not a relative record name", s.NamePrefix)
+	}
+	return nil
+}
+
+// Check reports why a key with this scope may not write the recordType RRset
+// at name in zoneFQDN, or nil if it may. A nil scope allows everything.
+func (s *ZoneKeyScope) Check(zoneFQDN, name, recordType string) error {
+	if !s.Restricted() {
+		return nil
+	}
+	if types := splitList(s.AllowedRecordTypes); len(types) > 0 {
+		allowed := false
+		for _, t := range types {
+			allowed = allowed || strings.EqualFold(t, recordType)
+		}
+		if !allowed {
+			return fmt.Errorf("key scope: type %s is not allowed for this key (allowed: %s)", recordType, strings.Join(types, ", "))
+		}
+	}
+	if rel := relativeRecordName(name, zoneFQDN); !strings.HasPrefix(rel, strings.ToLower(s.NamePrefix)) {
+		return fmt.Errorf("key scope: name %q does not start with %q", rel, s.NamePrefix)
+	}
+	return nil
+}
+
+// CheckAll is Check for several records, stopping at the first violation.
+func (s *ZoneKeyScope) CheckAll(zoneFQDN string, rrs []dns.RR) error {
+	for _, rr := range rrs {
+		if err := s.Check(zoneFQDN, rr.Header().Name, dns.TypeToString[rr.Header().Rrtype]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NamedKey is an extra TSIG key an owner created for a zone, e.g. one for
+// cert-manager that may only write _acme-challenge TXT records. The secret
+// lives in PowerDNS only and is returned once, on creation.
+type NamedKey struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Zone is lower case without trailing dot.
+	Zone      string `gorm:"type:varchar(255);index" json:"zone"`
+	Username  string `gorm:"type:varchar(255);index" json:"owner"`
+	Keyname   string `gorm:"type:varchar(255);uniqueIndex" json:"keyname"`
+	Algorithm string `gorm:"type:varchar(32)" json:"algorithm"`
+	Label     string `gorm:"type:varchar(255)" json:"label,omitempty"`
+	// ExpiresAt, when set, is when the key stops working and is deleted.
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	ZoneKeyScope
+	// DirectUpdates is whether PowerDNS accepts updates signed with the key
+	// itself; false for scoped keys, which write through the record API.
+	DirectUpdates bool `gorm:"not null;default:false" json:"direct_updates"`
+}
+
+// Expired reports whether the key has expired at now.
+func (k *NamedKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// NamedKeyRequest is the body of POST /v1/zones/{zone}/keys.
+type NamedKeyRequest struct {
+	Label     string     `json:"label,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Algorithm is one of the configured TSIG algorithms; the first by default.
+	Algorithm string `json:"algorithm,omitempty"`
+	ZoneKeyScope
+}
+
+// NamedKeyCreated is a new named key together with its secret.
+type NamedKeyCreated struct {
+	NamedKey
+	Key string `json:"key"`
+}
+
+// NamedKeyCreate stores a named key.
+func (s *Storage) NamedKeyCreate(key *NamedKey) error {
+	if err := s.db.Create(key).Error; err != nil {
+		return fmt.Errorf("storage.NamedKeyCreate: %w", err)
+	}
+	return nil
+}
+
+// NamedKeyList returns the named keys of zone, only those of username unless
+// it is empty.
+func (s *Storage) NamedKeyList(zone, username string) ([]NamedKey, error) {
+	keys := []NamedKey{}
+	q := s.db.Where("zone = ?", auditZone(zone))
+	if username != "" {
+		q = q.Where("username = ?", username)
+	}
+	if err := q.Order("id asc").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("storage.NamedKeyList: %w", err)
+	}
+	return keys, nil
+}
+
+// NamedKeyListAll returns every named key.
+func (s *Storage) NamedKeyListAll() ([]NamedKey, error) {
+	var keys []NamedKey
+	if err := s.db.Order("id asc").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("storage.NamedKeyListAll: %w", err)
+	}
+	return keys, nil
+}
+
+// NamedKeyListExpired returns the named keys that have expired at now.
+func (s *Storage) NamedKeyListExpired(now time.Time) ([]NamedKey, error) {
+	var keys []NamedKey
+	if err := s.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("storage.NamedKeyListExpired: %w", err)
+	}
+	return keys, nil
+}
+
+// NamedKeyGet returns the named key called keyname, nil if there is none.
+func (s *Storage) NamedKeyGet(keyname string) (*NamedKey, error) {
+	var key NamedKey
+	err := s.db.Where("keyname = ?", strings.TrimSuffix(keyname, ".")).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage.NamedKeyGet: %w", err)
+	}
+	return &key, nil
+}
+
+// NamedKeyDelete deletes a named key.
+func (s *Storage) NamedKeyDelete(id uint) error {
+	if err := s.db.Delete(&NamedKey{}, id).Error; err != nil {
+		return fmt.Errorf("storage.NamedKeyDelete: %w", err)
+	}
+	return nil
+}
+
+// AddNamedKey generates a key with algorithm and grants it AXFR on zone, and
+// dynamic updates too when directUpdates is set. It returns the secret.
+func (p *PowerDnsClient) AddNamedKey(ctx context.Context, zone, keyname, algorithm string, directUpdates bool) (string, error) {
+	zoneFQDN := dns.Fqdn(zone)
+	key, err := helper.GenerateTSIGKey(algorithm)
+	if err != nil {
+		return "", fmt.Errorf("AddNamedKey: failed to generate TSIG key: %w", err)
+	}
+	if directUpdates {
+		if err := p.addKeyToZone(ctx, zoneFQDN, keyname, algorithm, key); err != nil {
+			return "", fmt.Errorf("AddNamedKey: %w", err)
+		}
+		return key, nil
+	}
+
+	if _, err := p.powerdns.TSIGKeys.Create(ctx, keyname, algorithm, key); err != nil {
+		return "", fmt.Errorf("AddNamedKey: failed to create TSIG key '%s': %w", keyname, err)
+	}
+	if err := p.addValueToMetadata(ctx, zoneFQDN, powerdns.MetadataTSIGAllowAXFR, keyname); err != nil {
+		return "", fmt.Errorf("AddNamedKey: %w", err)
+	}
+	return key, nil
+}
+
+// DeleteZoneKey revokes keyname on zone and deletes it. A zone or key that is
+// already gone is not an error.
+func (p *PowerDnsClient) DeleteZoneKey(ctx context.Context, zone, keyname string) error {
+	zoneFQDN := dns.Fqdn(zone)
+	_ = p.revokeUpdateGrant(ctx, zoneFQDN, keyname)
+	_ = p.removeValueFromMetadata(ctx, zoneFQDN, powerdns.MetadataTSIGAllowAXFR, keyname)
+
+	if err := p.powerdns.TSIGKeys.Delete(ctx, keyname); err != nil && !isPdnsNotFound(err) {
+		return fmt.Errorf("DeleteZoneKey: failed to delete TSIG key '%s': %w", keyname, err)
+	}
+	return nil
+}
+
+// GetUserKey returns a user TSIG key with its secret.
+func (p *PowerDnsClient) GetUserKey(ctx context.Context, keyname string) (*ZoneKey, error) {
+	key, err := p.powerdns.TSIGKeys.Get(ctx, keyname)
+	if err != nil {
+		return nil, fmt.Errorf("GetUserKey: %w", err)
+	}
+	if key.Name == nil || key.Algorithm == nil || key.Key == nil {
+		return nil, fmt.Errorf("GetUserKey: TSIG key '%s' is incomplete", keyname)
+	}
+	return &ZoneKey{Keyname: *key.Name, Algorithm: *key.Algorithm, Key: *key.Key}, nil
+}
+
+// requireOwner returns an error result unless username owns zone.
+func (app *AppData) requireOwner(username, zone string) (int, any, error) {
+	isOwner, err := app.Storage.IsZoneOwner(username, zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to check ownership", err)
+	}
+	if !isOwner {
+		return errorResult(http.StatusForbidden, "You are not an owner of this zone", fmt.Errorf("%s not owned by %s", zone, username))
+	}
+	return 0, nil, nil
+}
+
+// ZoneKeysList returns the caller's named keys of zone, without secrets.
+func (app *AppData) ZoneKeysList(ctx context.Context, caller *UserClaims, zone string) (int, any, error) {
+	if status, resp, err := app.requireOwner(caller.PreferredUsername, zone); err != nil {
+		return status, resp, fmt.Errorf("app.ZoneKeysList: %w", err)
+	}
+	keys, err := app.Storage.NamedKeyList(zone, caller.PreferredUsername)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list keys", fmt.Errorf("app.ZoneKeysList: %w", err))
+	}
+	return http.StatusOK, gin.H{"keys": keys}, nil
+}
+
+// ZoneKeyCreate creates a named key of the caller on zone and returns it with
+// its secret, which is not shown again.
+func (app *AppData) ZoneKeyCreate(ctx context.Context, caller *UserClaims, zone string, req NamedKeyRequest) (int, any, error) {
+	username := caller.PreferredUsername
+	if status, resp, err := app.requireOwner(username, zone); err != nil {
+		return status, resp, fmt.Errorf("app.ZoneKeyCreate: %w", err)
+	}
+
+	algorithm := req.Algorithm
+	if algorithm == "" {
+		algorithm = app.tsigAlgorithms()[0]
+	}
+	if !slices.Contains(app.tsigAlgorithms(), algorithm) {
+		return errorResult(http.StatusBadRequest, fmt.Sprintf("TSIG algorithm %q is not allowed, use one of %v", algorithm, app.tsigAlgorithms()), nil)
+	}
+	scope := ZoneKeyScope{AllowedRecordTypes: strings.ToUpper(strings.Join(splitList(req.AllowedRecordTypes), ",")), NamePrefix: strings.TrimSpace(req.NamePrefix)}
+	if err := scope.Validate(); err != nil {
+		return errorResult(http.StatusBadRequest, err.Error(), nil)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return errorResult(http.StatusBadRequest, "expires_at must lie in the future", nil)
+	}
+	if len(req.Label) > 255 {
+		return errorResult(http.StatusBadRequest, "label is longer than 255 characters", nil)
+	}
+
+	existing, err := app.Storage.NamedKeyList(zone, username)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to list keys", fmt.Errorf("app.ZoneKeyCreate: %w", err))
+	}
+	if len(existing) >= maxNamedKeysPerOwner {
+		return errorResult(http.StatusConflict, fmt.Sprintf("You already hold %d keys for this zone; revoke one first", len(existing)), nil)
+	}
+
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to generate key name", fmt.Errorf("app.ZoneKeyCreate: %w", err))
+	}
+	key := NamedKey{
+		Zone:          auditZone(zone),
+		Username:      username,
+		Keyname:       userKeyPrefix + hex.EncodeToString(b),
+		Algorithm:     algorithm,
+		Label:         strings.TrimSpace(req.Label),
+		ExpiresAt:     req.ExpiresAt,
+		ZoneKeyScope:  scope,
+		DirectUpdates: !scope.Restricted(),
+	}
+
+	secret, err := app.PowerDns.AddNamedKey(ctx, zone, key.Keyname, algorithm, key.DirectUpdates)
+	if err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to create key on DNS server", fmt.Errorf("app.ZoneKeyCreate: %w", err))
+	}
+	if err := app.Storage.NamedKeyCreate(&key); err != nil {
+		if err := app.PowerDns.DeleteZoneKey(ctx, zone, key.Keyname); err != nil {
+			app.Log.Warnf("app.ZoneKeyCreate: key %s left in PowerDNS: %v", key.Keyname, err)
+		}
+		return errorResult(http.StatusInternalServerError, "Failed to store key", fmt.Errorf("app.ZoneKeyCreate: %w", err))
+	}
+
+	app.Log.Infof("app.ZoneKeyCreate: %s created key %s on %s", username, key.Keyname, zone)
+	app.audit(ctx, AuditZoneKeyCreate, zone+"/keys/"+key.Keyname, zone, nil, key)
+	return http.StatusCreated, NamedKeyCreated{NamedKey: key, Key: secret}, nil
+}
+
+// ZoneKeyDelete revokes and deletes one of the caller's named keys of zone.
+func (app *AppData) ZoneKeyDelete(ctx context.Context, caller *UserClaims, zone, keyname string) (int, any, error) {
+	if status, resp, err := app.requireOwner(caller.PreferredUsername, zone); err != nil {
+		return status, resp, fmt.Errorf("app.ZoneKeyDelete: %w", err)
+	}
+	key, err := app.Storage.NamedKeyGet(keyname)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to look up key", fmt.Errorf("app.ZoneKeyDelete: %w", err))
+	}
+	if key == nil || key.Zone != auditZone(zone) || key.Username != caller.PreferredUsername {
+		return errorResult(http.StatusNotFound, "You have no such key for this zone", nil)
+	}
+	if err := app.deleteNamedKeys(ctx, []NamedKey{*key}); err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to delete key", fmt.Errorf("app.ZoneKeyDelete: %w", err))
+	}
+	app.audit(ctx, AuditZoneKeyDelete, zone+"/keys/"+key.Keyname, zone, key, nil)
+	return http.StatusNoContent, nil, nil
+}
+
+// deleteNamedKeys deletes keys from PowerDNS and storage, stopping at the
+// first failure so a key is never forgotten while it still works.
+func (app *AppData) deleteNamedKeys(ctx context.Context, keys []NamedKey) error {
+	for _, key := range keys {
+		if err := app.PowerDns.DeleteZoneKey(ctx, key.Zone, key.Keyname); err != nil {
+			return fmt.Errorf("app.deleteNamedKeys: %w", err)
+		}
+		if err := app.Storage.NamedKeyDelete(key.ID); err != nil {
+			return fmt.Errorf("app.deleteNamedKeys: %w", err)
+		}
+	}
+	return nil
+}
+
+// namedKeyCredentials resolves explicit TSIG credentials that name a named
+// key. It returns nil, nil when keyName is no named key, so the credentials
+// are used as given. An unscoped key is used as given too; a scoped one is
+// checked here, as PowerDNS does not let it update, and the returned key of
+// its owner signs instead, with the scope to enforce.
+func (app *AppData) namedKeyCredentials(ctx context.Context, zone, keyName, keyAlgo, key string) (*ZoneKey, *ZoneKeyScope, int, error) {
+	nk, err := app.Storage.NamedKeyGet(keyName)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, fmt.Errorf("app.namedKeyCredentials: %w", err)
+	}
+	if nk == nil {
+		return nil, nil, 0, nil
+	}
+	if nk.Zone != auditZone(zone) {
+		return nil, nil, http.StatusForbidden, fmt.Errorf("key %s is not a key of this zone", nk.Keyname)
+	}
+	if nk.Expired(time.Now()) {
+		return nil, nil, http.StatusForbidden, fmt.Errorf("key %s has expired", nk.Keyname)
+	}
+	if !nk.Restricted() {
+		return &ZoneKey{Keyname: keyName, Algorithm: keyAlgo, Key: key}, nil, 0, nil
+	}
+
+	stored, err := app.PowerDns.GetUserKey(ctx, nk.Keyname)
+	if err != nil {
+		return nil, nil, http.StatusBadGateway, fmt.Errorf("app.namedKeyCredentials: %w", err)
+	}
+	if !strings.EqualFold(strings.TrimSuffix(stored.Algorithm, "."), strings.TrimSuffix(keyAlgo, ".")) ||
+		subtle.ConstantTimeCompare([]byte(stored.Key), []byte(key)) != 1 {
+		return nil, nil, http.StatusForbidden, fmt.Errorf("TSIG credentials of key %s do not match", nk.Keyname)
+	}
+	ownerKey, err := app.userZoneKey(ctx, nk.Username, zone)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, fmt.Errorf("app.namedKeyCredentials: %w", err)
+	}
+	return ownerKey, &nk.ZoneKeyScope, 0, nil
+}
+
+// RunKeyExpiry deletes expired named keys and the old keys of graceful
+// rotations past their cutoff every keyExpiryInterval until ctx ends. The
+// record API refuses expired named keys already; this takes them out of
+// PowerDNS, where unscoped keys could otherwise still update directly.
+func (app *AppData) RunKeyExpiry(ctx context.Context) {
+	ticker := time.NewTicker(keyExpiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.expireNamedKeys(ctx)
+			app.finishKeyRotations(ctx)
+		}
+	}
+}
+
+// expireNamedKeys deletes the named keys that have expired.
+func (app *AppData) expireNamedKeys(ctx context.Context) {
+	keys, err := app.Storage.NamedKeyListExpired(time.Now())
+	if err != nil {
+		app.Log.Warnf("app.expireNamedKeys: %v", err)
+		return
+	}
+	for _, key := range keys {
+		if err := app.deleteNamedKeys(ctx, []NamedKey{key}); err != nil {
+			app.Log.Warnf("app.expireNamedKeys: %v", err)
+			continue
+		}
+		app.Log.Infof("app.expireNamedKeys: key %s of %s on %s expired", key.Keyname, key.Username, key.Zone)
+		app.audit(ctx, AuditZoneKeyExpire, key.Zone+"/keys/"+key.Keyname, key.Zone, key, nil)
+	}
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A scoped named key is only granted AXFR in PowerDNS; its writes are signed
+// with the owner's key and limited to its scope. Expired keys are deleted.
+func TestNamedZoneKeys(t *testing.T) {
+	app := newTestApp(t)
+	fake := useFakePdns(t, app)
+	ctx := context.Background()
+	alice := &UserClaims{Email: "alice@dhbw.de", PreferredUsername: "alice@dhbw.de"}
+	const zone = "alice.users.example.com"
+
+	if status, _, err := app.ZoneCreate(ctx, alice.PreferredUsername, ZoneResponse{Zone: zone, ZoneSOA: "users.example.com"}, ""); status != http.StatusCreated {
+		t.Fatalf("ZoneCreate: %d %v", status, err)
+	}
+
+	status, resp, err := app.ZoneKeyCreate(ctx, alice, zone, NamedKeyRequest{Label: "cert-manager", ZoneKeyScope: ZoneKeyScope{AllowedRecordTypes: "txt", NamePrefix: "_acme-challenge"}})
+	scoped, _ := resp.(NamedKeyCreated)
+	if status != http.StatusCreated || scoped.DirectUpdates || scoped.AllowedRecordTypes != "TXT" {
+		t.Fatalf("ZoneKeyCreate: %d %+v %v", status, resp, err)
+	}
+	if slices.Contains(fake.metadata[zone+". TSIG-ALLOW-DNSUPDATE"], scoped.Keyname) || !slices.Contains(fake.metadata[zone+". TSIG-ALLOW-AXFR"], scoped.Keyname) {
+		t.Errorf("expected a scoped key to be granted AXFR only, got %v", fake.metadata)
+	}
+
+	if _, _, status, _ := app.namedKeyCredentials(ctx, zone, scoped.Keyname, scoped.Algorithm, "wrong"); status != http.StatusForbidden {
+		t.Errorf("expected a wrong secret to be refused, got %d", status)
+	}
+	signer, scope, _, err := app.namedKeyCredentials(ctx, zone, scoped.Keyname+".", scoped.Algorithm+".", scoped.Key)
+	if err != nil || signer.Keyname != app.PowerDns.keyNameFor(alice.PreferredUsername, zone) {
+		t.Fatalf("expected the owner's key to sign, got %+v %v", signer, err)
+	}
+	if err := scope.Check(zone+".", "_acme-challenge.www."+zone+".", "TXT"); err != nil {
+		t.Errorf("expected the challenge record to be in scope: %v", err)
+	}
+	if scope.Check(zone+".", "www."+zone+".", "TXT") == nil || scope.Check(zone+".", "_acme-challenge."+zone+".", "A") == nil {
+		t.Errorf("expected other names and types to be out of scope")
+	}
+
+	expiry := time.Now().Add(time.Hour)
+	status, resp, _ = app.ZoneKeyCreate(ctx, alice, zone, NamedKeyRequest{ExpiresAt: &expiry})
+	unscoped, _ := resp.(NamedKeyCreated)
+	if status != http.StatusCreated || !unscoped.DirectUpdates || !slices.Contains(fake.metadata[zone+". TSIG-ALLOW-DNSUPDATE"], unscoped.Keyname) {
+		t.Fatalf("expected an unscoped key to update directly: %d %+v", status, resp)
+	}
+	if report, err := app.reverseDrift(ctx); err != nil || len(report.DanglingGrants) != 0 || len(report.UnreferencedKeys) != 0 {
+		t.Errorf("expected named keys not to be drift, got %+v %v", report, err)
+	}
+
+	bob := &UserClaims{Email: "bob@dhbw.de", PreferredUsername: "bob@dhbw.de"}
+	if status, _, _ := app.ZoneKeyCreate(ctx, bob, zone, NamedKeyRequest{}); status != http.StatusForbidden {
+		t.Errorf("expected a non-owner to be refused, got %d", status)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if err := app.Storage.db.Model(&NamedKey{}).Where("keyname = ?", unscoped.Keyname).Update("expires_at", past).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, _, status, _ := app.namedKeyCredentials(ctx, zone, unscoped.Keyname, unscoped.Algorithm, unscoped.Key); status != http.StatusForbidden {
+		t.Errorf("expected an expired key to be refused, got %d", status)
+	}
+	app.expireNamedKeys(ctx)
+	if _, ok := fake.keys[unscoped.Keyname]; ok || slices.Contains(fake.metadata[zone+". TSIG-ALLOW-DNSUPDATE"], unscoped.Keyname) {
+		t.Errorf("expected the expired key to be deleted from PowerDNS")
+	}
+
+	if status, _, _ := app.ZoneKeyDelete(ctx, alice, zone, scoped.Keyname); status != http.StatusNoContent {
+		t.Fatalf("ZoneKeyDelete: %d", status)
+	}
+	if _, resp, _ := app.ZoneKeysList(ctx, alice, zone); len(resp.(gin.H)["keys"].([]NamedKey)) != 0 {
+		t.Errorf("expected no keys left, got %+v", resp)
+	}
+}
@@ -0,0 +1,413 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/miekg/dns"
+)
+
+// How often zone leases are checked.
+const zoneLeaseCheckInterval = time.Hour
+
+// ZoneLease is the lease state of a zone.
+type ZoneLease struct {
+	Zone string `json:"zone"`
+	// LeaseDays comes from the governing policy rule; 0 means the zone does
+	// not expire.
+	LeaseDays uint32 `json:"lease_days"`
+	// ExpiresAt is when the records are disabled unless the zone is renewed
+	// or changed before.
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	WarnedAt   *time.Time `json:"warned_at,omitempty"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	// DeleteAt is when a disabled zone is deleted unless it is renewed.
+	DeleteAt *time.Time `json:"delete_at,omitempty"`
+}
+
+// zoneLeaseRows is the lease state the owner rows of one zone share.
+type zoneLeaseRows struct {
+	zone      string
+	owners    []string
+	createdAt time.Time
+	expiry    time.Time
+	warnedAt  *time.Time
+	disabled  *time.Time
+	suspended *time.Time
+	serial    uint32
+}
+
+// leaseEnd returns when a lease of days starting at now ends.
+func leaseEnd(now time.Time, days uint32) time.Time {
+	return now.Add(time.Duration(days) * 24 * time.Hour)
+}
+
+func (app *AppData) leaseWarning() time.Duration {
+	return time.Duration(app.Config.ZoneDefaults.LeaseWarningDays) * 24 * time.Hour
+}
+
+func (app *AppData) leaseGrace() time.Duration {
+	return time.Duration(app.Config.ZoneDefaults.LeaseGraceDays) * 24 * time.Hour
+}
+
+// groupZoneLeases folds the owner rows of each zone into its lease state.
+// Rows are written together, but a row created before leases were kept has
+// none; the latest expiry wins.
+func groupZoneLeases(rows []Zone) []*zoneLeaseRows {
+	var leases []*zoneLeaseRows
+	byZone := make(map[string]*zoneLeaseRows)
+	for _, row := range rows {
+		l, ok := byZone[row.Zone]
+		if !ok {
+			l = &zoneLeaseRows{zone: row.Zone, createdAt: row.CreatedAt}
+			byZone[row.Zone] = l
+			leases = append(leases, l)
+		}
+		l.owners = append(l.owners, row.Username)
+		if row.CreatedAt.Before(l.createdAt) {
+			l.createdAt = row.CreatedAt
+		}
+		if row.RequiresRefreshAt.After(l.expiry) {
+			l.expiry = row.RequiresRefreshAt
+		}
+		if row.LeaseWarnedAt != nil && l.warnedAt == nil {
+			l.warnedAt = row.LeaseWarnedAt
+		}
+		if row.DisabledAt != nil && l.disabled == nil {
+			l.disabled = row.DisabledAt
+		}
+		if row.SuspendedAt != nil && l.suspended == nil {
+			l.suspended = row.SuspendedAt
+		}
+		l.serial = max(l.serial, row.LeaseSerial)
+	}
+	return leases
+}
+
+// zoneLease returns the lease state of zone under a lease of days.
+func (app *AppData) zoneLease(l *zoneLeaseRows, days uint32) ZoneLease {
+	lease := ZoneLease{Zone: auditZone(l.zone), LeaseDays: days, WarnedAt: l.warnedAt, DisabledAt: l.disabled}
+	if days > 0 && l.expiry.After(l.createdAt) {
+		expiry := l.expiry
+		lease.ExpiresAt = &expiry
+	}
+	if l.disabled != nil {
+		deleteAt := l.disabled.Add(app.leaseGrace())
+		lease.DeleteAt = &deleteAt
+	}
+	return lease
+}
+
+// ZoneRows returns the owner rows of zone.
+func (s *Storage) ZoneRows(zone string) ([]Zone, error) {
+	var rows []Zone
+	if err := s.db.Where("zone = ?", zone).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("storage.ZoneRows: %w", err)
+	}
+	return rows, nil
+}
+
+// ZoneLeaseSet updates the lease columns of every owner row of zone.
+func (s *Storage) ZoneLeaseSet(zone string, fields map[string]any) error {
+	if err := s.db.Model(&Zone{}).Where("zone = ?", zone).Updates(fields).Error; err != nil {
+		return fmt.Errorf("storage.ZoneLeaseSet: %w", err)
+	}
+	return nil
+}
+
+// ZoneSerial returns the SOA serial of zone.
+func (p *PowerDnsClient) ZoneSerial(ctx context.Context, zone string) (uint32, error) {
+	z, err := p.powerdns.Zones.Get(ctx, dns.Fqdn(zone))
+	if err != nil {
+		return 0, fmt.Errorf("ZoneSerial: %w", err)
+	}
+	if z.Serial == nil {
+		return 0, nil
+	}
+	return *z.Serial, nil
+}
+
+// SetZoneRecordsDisabled disables or enables every record of zone except the
+// SOA, NS and DS records, which keep the zone and the delegations below it in
+// place: a disabled zone still exists, but answers nothing its owners put in.
+func (p *PowerDnsClient) SetZoneRecordsDisabled(ctx context.Context, zone string, disabled bool) error {
+	z, err := p.powerdns.Zones.Get(ctx, dns.Fqdn(zone))
+	if err != nil {
+		return fmt.Errorf("SetZoneRecordsDisabled: %w", err)
+	}
+	var sets []powerdns.RRset
+	for _, rrset := range z.RRsets {
+		if rrset.Type == nil || slices.Contains([]powerdns.RRType{powerdns.RRTypeSOA, powerdns.RRTypeNS, powerdns.RRTypeDS}, *rrset.Type) {
+			continue
+		}
+		changed := false
+		for i := range rrset.Records {
+			if rrset.Records[i].Disabled == nil || *rrset.Records[i].Disabled != disabled {
+				rrset.Records[i].Disabled = powerdns.Bool(disabled)
+				changed = true
+			}
+		}
+		if changed {
+			rrset.ChangeType = powerdns.ChangeTypePtr(powerdns.ChangeTypeReplace)
+			rrset.Comments = nil
+			sets = append(sets, rrset)
+		}
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	if err := p.powerdns.Records.Patch(ctx, dns.Fqdn(zone), &powerdns.RRsets{Sets: sets}); err != nil {
+		return fmt.Errorf("SetZoneRecordsDisabled: %w", err)
+	}
+	return nil
+}
+
+// zoneLeaseOf returns the lease rows and the lease length of a stored zone.
+func (app *AppData) zoneLeaseOf(zone string) (*zoneLeaseRows, uint32, error) {
+	rows, err := app.Storage.ZoneRows(zone)
+	if err != nil {
+		return nil, 0, fmt.Errorf("app.zoneLeaseOf: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, 0, fmt.Errorf("app.zoneLeaseOf: %s is not stored", zone)
+	}
+	def, err := app.zoneGoverningDef(zone)
+	if err != nil {
+		return nil, 0, fmt.Errorf("app.zoneLeaseOf: %w", err)
+	}
+	var days uint32
+	if def != nil {
+		days = def.LeaseDays
+	}
+	return groupZoneLeases(rows)[0], days, nil
+}
+
+// ZoneLeaseStatus returns the lease of zone. Owner-only.
+func (app *AppData) ZoneLeaseStatus(ctx context.Context, username, zone string) (int, any, error) {
+	if status, resp, err := app.requireOwner(username, zone); err != nil {
+		return status, resp, fmt.Errorf("app.ZoneLeaseStatus: %w", err)
+	}
+	rows, days, err := app.zoneLeaseOf(zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to look up the lease", err)
+	}
+	return http.StatusOK, app.zoneLease(rows, days), nil
+}
+
+// ZoneRenew starts a new lease of zone, and enables its records and the update
+// grants of its keys again if the lease had expired and no admin suspended the
+// zone. Owner-only.
+func (app *AppData) ZoneRenew(ctx context.Context, username, zone string) (int, any, error) {
+	if status, resp, err := app.requireOwner(username, zone); err != nil {
+		return status, resp, fmt.Errorf("app.ZoneRenew: %w", err)
+	}
+	rows, days, err := app.zoneLeaseOf(zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to look up the lease", err)
+	}
+	before := app.zoneLease(rows, days)
+
+	expired := rows.disabled != nil
+	if expired && rows.suspended == nil {
+		if err := app.PowerDns.SetZoneRecordsDisabled(ctx, zone, false); err != nil {
+			return errorResult(http.StatusBadGateway, "Failed to enable the records of the zone", fmt.Errorf("app.ZoneRenew: %w", err))
+		}
+	}
+	if err := app.renewZoneLease(ctx, rows, days, time.Now()); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to store the lease", fmt.Errorf("app.ZoneRenew: %w", err))
+	}
+	if expired {
+		if err := app.syncZoneUpdateGrants(ctx, zone); err != nil {
+			return errorResult(http.StatusBadGateway, "Failed to restore the update grants of the zone", fmt.Errorf("app.ZoneRenew: %w", err))
+		}
+	}
+	after := app.zoneLease(rows, days)
+
+	app.Log.Infof("app.ZoneRenew: %s renewed %s", username, zone)
+	app.audit(ctx, AuditZoneRenew, zone, zone, before, after)
+	return http.StatusOK, after, nil
+}
+
+// renewZoneLease stores a new lease of days from now in rows and the database.
+// The current serial is remembered, so only later changes count as activity.
+func (app *AppData) renewZoneLease(ctx context.Context, rows *zoneLeaseRows, days uint32, now time.Time) error {
+	serial, err := app.PowerDns.ZoneSerial(ctx, rows.zone)
+	if err != nil {
+		app.Log.Warnf("app.renewZoneLease: %v", err)
+	}
+	rows.expiry, rows.warnedAt, rows.disabled, rows.serial = leaseEnd(now, days), nil, nil, serial
+	if days == 0 {
+		rows.expiry = now
+	}
+	return app.Storage.ZoneLeaseSet(rows.zone, map[string]any{
+		"requires_refresh_at": rows.expiry, "lease_warned_at": nil, "disabled_at": nil, "lease_serial": serial,
+	})
+}
+
+// RunZoneLeases checks the zone leases every zoneLeaseCheckInterval until ctx
+// ends.
+func (app *AppData) RunZoneLeases(ctx context.Context) {
+	ticker := time.NewTicker(zoneLeaseCheckInterval)
+	defer ticker.Stop()
+	for {
+		app.checkZoneLeases(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkZoneLeases moves every zone with a lease on: renewed when it was
+// changed, warned before its lease expires, disabled when it has, and deleted
+// when it stayed disabled for the grace period. Subzones go first, so a parent
+// whose subzones expired with it can be deleted in the same run.
+func (app *AppData) checkZoneLeases(ctx context.Context, now time.Time) {
+	rows, err := app.Storage.ListAllZones()
+	if err != nil {
+		app.Log.Warnf("app.checkZoneLeases: %v", err)
+		return
+	}
+	leases := groupZoneLeases(rows)
+	slices.SortStableFunc(leases, func(a, b *zoneLeaseRows) int {
+		return dns.CountLabel(dns.Fqdn(b.zone)) - dns.CountLabel(dns.Fqdn(a.zone))
+	})
+	for _, l := range leases {
+		if ctx.Err() != nil {
+			return
+		}
+		def, err := app.zoneGoverningDef(l.zone)
+		if err != nil {
+			app.Log.Warnf("app.checkZoneLeases: %s: %v", l.zone, err)
+			continue
+		}
+		// Orphaned zones are left to the admins; zones without a lease stay.
+		if def == nil || def.LeaseDays == 0 {
+			continue
+		}
+		if err := app.checkZoneLease(ctx, l, def.LeaseDays, now); err != nil {
+			app.Log.Warnf("app.checkZoneLeases: %s: %v", l.zone, err)
+		}
+	}
+}
+
+// checkZoneLease takes one step in the lease of one zone.
+func (app *AppData) checkZoneLease(ctx context.Context, l *zoneLeaseRows, days uint32, now time.Time) error {
+	zone := auditZone(l.zone)
+
+	if l.disabled != nil {
+		if now.Before(l.disabled.Add(app.leaseGrace())) {
+			return nil
+		}
+		status, _, err := app.ZoneDelete(ctx, l.owners[0], l.zone)
+		if err != nil {
+			return fmt.Errorf("deleting the expired zone (%d): %w", status, err)
+		}
+		app.Log.Infof("app.checkZoneLease: %s deleted, its lease expired on %s", zone, l.expiry.Format(time.RFC3339))
+		body := fmt.Sprintf("Your zone %s was deleted: its lease expired on %s and it was not renewed since.", zone, l.expiry.Format(time.RFC3339))
+		if retention := app.zoneTrashRetention(); retention > 0 {
+			body += fmt.Sprintf(" It can be restored (POST /v1/zones/%s/restore) until %s.", zone, now.Add(retention).Format(time.RFC3339))
+		}
+		app.notifyZoneOwners(ctx, l.owners, Notification{
+			Kind:    NotifyZoneDeleted,
+			Subject: fmt.Sprintf("Zone %s was deleted", zone),
+			Body:    body,
+			Data:    gin.H{"zone": zone},
+		})
+		return nil
+	}
+
+	// No lease yet: the zone predates leases, its rule or was adopted.
+	if !l.expiry.After(l.createdAt) {
+		return app.renewZoneLease(ctx, l, days, now)
+	}
+
+	due := !now.Before(l.expiry.Add(-app.leaseWarning()))
+	if !due && l.serial != 0 {
+		return nil
+	}
+	serial, err := app.PowerDns.ZoneSerial(ctx, l.zone)
+	if err != nil {
+		return err
+	}
+	switch {
+	case l.serial == 0:
+		// The first serial seen is the base later changes are counted from.
+		if err := app.Storage.ZoneLeaseSet(l.zone, map[string]any{"lease_serial": serial}); err != nil {
+			return err
+		}
+		l.serial = serial
+	case serial != l.serial:
+		app.Log.Infof("app.checkZoneLease: %s was changed, renewing its lease", zone)
+		return app.renewZoneLease(ctx, l, days, now)
+	}
+	if !due {
+		return nil
+	}
+
+	if l.warnedAt == nil {
+		// Owners always get the full warning period, also when a lease starts
+		// out shorter or the warning comes late.
+		expiry := l.expiry
+		if minimum := now.Add(app.leaseWarning()); expiry.Before(minimum) {
+			expiry = minimum
+		}
+		if err := app.Storage.ZoneLeaseSet(l.zone, map[string]any{"requires_refresh_at": expiry, "lease_warned_at": now}); err != nil {
+			return err
+		}
+		app.notifyZoneOwners(ctx, l.owners, Notification{
+			Kind:    NotifyLeaseExpiry,
+			Subject: fmt.Sprintf("Zone %s expires on %s", zone, expiry.Format("2006-01-02")),
+			Body: fmt.Sprintf("The lease of your zone %s expires at %s. Renew it (POST /v1/zones/%s/renew) or change a record before then; "+
+				"otherwise its records are disabled, and %d days later the zone is deleted.",
+				zone, expiry.Format(time.RFC3339), zone, app.Config.ZoneDefaults.LeaseGraceDays),
+			Data: gin.H{"zone": zone, "expires_at": expiry},
+		})
+		return nil
+	}
+	if now.Before(l.expiry) {
+		return nil
+	}
+
+	// Else the keys could still write records, served once it is renewed.
+	if err := app.PowerDns.SuspendZoneUpdates(ctx, l.zone); err != nil {
+		return err
+	}
+	if err := app.PowerDns.SetZoneRecordsDisabled(ctx, l.zone, true); err != nil {
+		return err
+	}
+	// Disabling bumps the serial; that is not activity.
+	if serial, err = app.PowerDns.ZoneSerial(ctx, l.zone); err != nil {
+		return err
+	}
+	if err := app.Storage.ZoneLeaseSet(l.zone, map[string]any{"disabled_at": now, "lease_serial": serial}); err != nil {
+		return err
+	}
+	deleteAt := now.Add(app.leaseGrace())
+	app.Log.Infof("app.checkZoneLease: %s disabled, its lease expired on %s", zone, l.expiry.Format(time.RFC3339))
+	app.audit(ctx, AuditZoneDisable, zone, zone, nil, gin.H{"expired_at": l.expiry, "delete_at": deleteAt})
+	app.notifyZoneOwners(ctx, l.owners, Notification{
+		Kind:    NotifyZoneDisabled,
+		Subject: fmt.Sprintf("Zone %s was disabled", zone),
+		Body: fmt.Sprintf("The lease of your zone %s expired, so its records no longer resolve. Renew it (POST /v1/zones/%s/renew) "+
+			"before %s to enable them again; after that the zone is deleted.", zone, zone, deleteAt.Format(time.RFC3339)),
+		Data: gin.H{"zone": zone, "delete_at": deleteAt},
+	})
+	return nil
+}
+
+// notifyZoneOwners sends msg to every owner in owners.
+func (app *AppData) notifyZoneOwners(ctx context.Context, owners []string, msg Notification) {
+	for _, owner := range owners {
+		msg.Recipient = owner
+		if err := app.Notifier.Notify(ctx, msg); err != nil {
+			app.Log.Warnf("app.notifyZoneOwners: %s to %s: %v", msg.Kind, owner, err)
+		}
+	}
+}
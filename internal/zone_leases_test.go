@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// A zone is warned about before its lease expires, renewed by a change,
+// disabled (records and update grants) when the lease expired, enabled again
+// by a renewal, and deleted when it stays disabled for the grace period.
+func TestZoneLeases(t *testing.T) {
+	app := newTestApp(t)
+	fake := useFakePdns(t, app)
+	ctx := context.Background()
+	notifier := &recordingNotifier{}
+	app.Notifier = notifier
+	app.Config.ZoneDefaults.LeaseWarningDays, app.Config.ZoneDefaults.LeaseGraceDays = 7, 30
+	const zone = "alice.users.example.com"
+	const www = zone + ". www." + zone + ". A"
+	const updaters = zone + ". TSIG-ALLOW-DNSUPDATE"
+	day := 24 * time.Hour
+
+	if _, err := app.PolicyCreateRule(ctx, PolicyRuleRequest{ZonePattern: "%u.users.example.com", ZoneSoa: "users.example.com", TargetUserFilter: "*", LeaseDays: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if status, _, err := app.ZoneCreate(ctx, "alice", ZoneResponse{Zone: zone, ZoneSOA: "users.example.com", LeaseDays: 30}, ""); status != http.StatusCreated {
+		t.Fatalf("ZoneCreate: %d %v", status, err)
+	}
+	fake.rrsets[www], fake.serials[zone+"."] = []string{"192.0.2.1"}, 1
+	lease := func() ZoneLease {
+		t.Helper()
+		_, resp, err := app.ZoneLeaseStatus(ctx, "alice", zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.(ZoneLease)
+	}
+	start := time.Now()
+	if l := lease(); l.ExpiresAt == nil || l.ExpiresAt.Sub(start) < 29*day {
+		t.Fatalf("expected a lease of 30 days, got %+v", l)
+	}
+
+	app.checkZoneLeases(ctx, start.Add(24*day))
+	app.checkZoneLeases(ctx, start.Add(24*day))
+	if len(notifier.sent) != 1 || notifier.sent[0].Kind != NotifyLeaseExpiry || notifier.sent[0].Recipient != "alice" {
+		t.Fatalf("expected one warning, got %+v", notifier.sent)
+	}
+
+	fake.serials[zone+"."]++ // a record was changed
+	app.checkZoneLeases(ctx, start.Add(25*day))
+	if l := lease(); l.WarnedAt != nil || l.ExpiresAt.Sub(start) < 54*day {
+		t.Fatalf("expected the change to renew the lease, got %+v", l)
+	}
+
+	// Checked only after the lease expired: the owner still gets the full
+	// warning period before the zone is disabled.
+	app.checkZoneLeases(ctx, start.Add(60*day))
+	app.checkZoneLeases(ctx, start.Add(66*day))
+	if fake.disabled[www] {
+		t.Fatal("expected the zone to be disabled only a warning period after the warning")
+	}
+	app.checkZoneLeases(ctx, start.Add(68*day))
+	if l := lease(); !fake.disabled[www] || l.DisabledAt == nil || l.DeleteAt == nil {
+		t.Fatalf("expected the records to be disabled, got %+v %v", l, fake.disabled)
+	}
+	aliceKey := app.PowerDns.keyNameFor("alice", zone)
+	if slices.Contains(fake.metadata[updaters], aliceKey) {
+		t.Errorf("expected the update grant to be withheld, got %v", fake.metadata[updaters])
+	}
+
+	if status, resp, err := app.ZoneRenew(ctx, "alice", zone); status != http.StatusOK || fake.disabled[www] {
+		t.Fatalf("ZoneRenew: %d %+v %v, disabled %v", status, resp, err, fake.disabled[www])
+	}
+	if !slices.Contains(fake.metadata[updaters], aliceKey) {
+		t.Errorf("expected the renewal to restore the update grant, got %v", fake.metadata[updaters])
+	}
+	if status, _, _ := app.ZoneRenew(ctx, "bob", zone); status != http.StatusForbidden {
+		t.Errorf("expected others to be refused, got %d", status)
+	}
+
+	now := time.Now()
+	app.checkZoneLeases(ctx, now.Add(24*day))
+	app.checkZoneLeases(ctx, now.Add(31*day))
+	app.checkZoneLeases(ctx, now.Add(60*day))
+	if owners, _ := app.Storage.ListZoneOwners(zone); len(owners) != 1 {
+		t.Fatalf("expected the zone to stay during the grace period, got owners %v", owners)
+	}
+	app.checkZoneLeases(ctx, now.Add(62*day))
+	if owners, _ := app.Storage.ListZoneOwners(zone); len(owners) != 0 || fake.zones[zone+"."] {
+		t.Fatalf("expected the zone to be deleted after the grace period, got owners %v", owners)
+	}
+	if last := notifier.sent[len(notifier.sent)-1]; last.Kind != NotifyZoneDeleted {
+		t.Errorf("expected the owner to be told about the deletion, got %+v", last)
+	}
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/farberg/dynamic-zones/internal/helper"
+	"github.com/miekg/dns"
+)
+
+// ZoneQuotas bound how much a policy rule hands out. A rule with a %u pattern
+// and AllowSubdomains otherwise lets every user delegate any number of
+// subzones, each with its own storage row, PowerDNS zone and TSIG key. Zero
+// means no limit, so existing rules keep working.
+//
+// Zones are counted per base zone (the zone the rule grants, see
+// ZoneResponse.BaseZone): a user's base zone and the subzones below it that
+// they own, whoever created them.
+type ZoneQuotas struct {
+	// MaxZonesPerUser bounds the zones a user holds under one base zone,
+	// the base zone included.
+	MaxZonesPerUser uint32 `gorm:"not null;default:0" json:"max_zones_per_user,omitempty"`
+	// MaxSubzoneDepth bounds how many labels a subzone may add below the base
+	// zone: 1 allows sub.<base>, but not a.sub.<base>.
+	MaxSubzoneDepth uint32 `gorm:"not null;default:0" json:"max_subzone_depth,omitempty"`
+	// MaxRecordsPerZone bounds the records of each zone, not counting the
+	// apex SOA and NS the service maintains. Like record constraints, it
+	// withholds the direct update grants of the zone keys (see
+	// directUpdatesWithheld).
+	MaxRecordsPerZone uint32 `gorm:"not null;default:0" json:"max_records_per_zone,omitempty"`
+}
+
+// QuotaUsage is the use of one quota; Limit 0 means no limit.
+type QuotaUsage struct {
+	Used  int    `json:"used"`
+	Limit uint32 `json:"limit"`
+}
+
+// ZoneUsage is what a zone uses of the quotas of its rule.
+type ZoneUsage struct {
+	// Zones the user holds under the base zone.
+	Zones QuotaUsage `json:"zones"`
+	// SubzoneDepth of this zone below the base zone.
+	SubzoneDepth QuotaUsage `json:"subzone_depth"`
+	// Records of this zone; only counted when limited, as it takes a zone transfer.
+	Records *QuotaUsage `json:"records,omitempty"`
+}
+
+// quotaBase returns the base zone quotas of def are counted under.
+func quotaBase(def *ZoneResponse) string {
+	if def.BaseZone != "" {
+		return def.BaseZone
+	}
+	return def.Zone
+}
+
+// subzoneDepth returns how many labels zone adds below base (0 for base itself).
+func subzoneDepth(zone, base string) int {
+	return dns.CountLabel(dns.Fqdn(zone)) - dns.CountLabel(dns.Fqdn(base))
+}
+
+// zonesUnder counts the zones of owned at or below base.
+func zonesUnder(owned []Zone, base string) int {
+	n := 0
+	for _, z := range owned {
+		if strings.EqualFold(z.Zone, base) || isSubdomainOf(z.Zone, base) {
+			n++
+		}
+	}
+	return n
+}
+
+// quotaRecordCount counts the records of a zone that MaxRecordsPerZone limits.
+func quotaRecordCount(zoneFQDN string, rrs []dns.RR) int {
+	n := 0
+	for _, rr := range rrs {
+		h := rr.Header()
+		if strings.EqualFold(h.Name, zoneFQDN) && (h.Rrtype == dns.TypeSOA || h.Rrtype == dns.TypeNS) {
+			continue
+		}
+		if isDnssecType(h.Rrtype) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// checkZoneQuotas reports whether username may create the zone of def. The
+// error message is meant for the user.
+func (app *AppData) checkZoneQuotas(username string, def *ZoneResponse) (int, error) {
+	base := quotaBase(def)
+
+	if limit := def.MaxSubzoneDepth; limit > 0 {
+		if depth := subzoneDepth(def.Zone, base); depth > int(limit) {
+			return http.StatusForbidden, fmt.Errorf("quota: %s is %d levels below %s, the policy allows %d", def.Zone, depth, base, limit)
+		}
+	}
+
+	if limit := def.MaxZonesPerUser; limit > 0 {
+		owned, err := app.Storage.ListUserZones(username)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("app.checkZoneQuotas: %w", err)
+		}
+		if n := zonesUnder(owned, base); n >= int(limit) {
+			return http.StatusForbidden, fmt.Errorf("quota: you already hold %d zone(s) under %s, the policy allows %d", n, base, limit)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// CheckRecordCount reports whether a zone holding current may hold next. A
+// change that does not grow the zone is always allowed, so a zone above a
+// lowered limit can still be cleaned up. A nil receiver means no limit.
+func (q *ZoneQuotas) CheckRecordCount(zoneFQDN string, current, next []dns.RR) error {
+	if q == nil || q.MaxRecordsPerZone == 0 {
+		return nil
+	}
+	before, after := quotaRecordCount(zoneFQDN, current), quotaRecordCount(zoneFQDN, next)
+	if after > int(q.MaxRecordsPerZone) && after > before {
+		return fmt.Errorf("quota: the zone would hold %d records, the policy allows %d", after, q.MaxRecordsPerZone)
+	}
+	return nil
+}
+
+// checkRecordQuota refuses an update that would leave zone with more records
+// than quotas allow. Counting takes a zone transfer, signed with the key the
+// update is sent with, so it only runs when a limit is set (nil: none).
+func checkRecordQuota(app *AppData, quotas *ZoneQuotas, u *helper.Rfc2136Update, keyName, keyAlgo, key, zone string) (int, error) {
+	if quotas == nil || quotas.MaxRecordsPerZone == 0 {
+		return http.StatusOK, nil
+	}
+	current, err := helper.ZoneTransfer(keyName, keyAlgo, key, GetServerAddress(app), zone)
+	if err != nil {
+		return http.StatusBadGateway, fmt.Errorf("failed to count the records of the zone: %w", err)
+	}
+	if err := quotas.CheckRecordCount(dns.Fqdn(zone), current, u.Apply(current)); err != nil {
+		return http.StatusForbidden, err
+	}
+	return http.StatusOK, nil
+}
+
+// zoneUsage reports what a zone of username uses of the quotas of def. owned
+// is the user's zones; records are only counted for an existing zone with a
+// record limit.
+func (app *AppData) zoneUsage(ctx context.Context, username string, owned []Zone, def *ZoneResponse, exists bool) *ZoneUsage {
+	base := quotaBase(def)
+	usage := &ZoneUsage{
+		Zones:        QuotaUsage{Used: zonesUnder(owned, base), Limit: def.MaxZonesPerUser},
+		SubzoneDepth: QuotaUsage{Used: subzoneDepth(def.Zone, base), Limit: def.MaxSubzoneDepth},
+	}
+	if exists && def.MaxRecordsPerZone > 0 {
+		if _, rrs, err := app.zoneRecordsAsUser(ctx, username, def.Zone); err != nil {
+			app.Log.Warnf("app.zoneUsage: failed to count the records of %s: %v", def.Zone, err)
+		} else {
+			usage.Records = &QuotaUsage{Used: quotaRecordCount(dns.Fqdn(def.Zone), rrs), Limit: def.MaxRecordsPerZone}
+		}
+	}
+	return usage
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// Quotas are counted per base zone, and a subzone resolves back to the base
+// zone of its rule — also when it is requested below another subzone.
+func TestZoneQuotasCountPerBaseZone(t *testing.T) {
+	app := newTestApp(t)
+	if _, err := app.PolicyCreateRule(context.Background(), PolicyRuleRequest{
+		ZonePattern:      "%u.users.dhbw.site",
+		ZoneSoa:          "users.dhbw.site",
+		TargetUserFilter: "*@dhbw.de",
+		AllowSubdomains:  true,
+		ZoneQuotas:       ZoneQuotas{MaxZonesPerUser: 3, MaxSubzoneDepth: 1},
+	}); err != nil {
+		t.Fatalf("PolicyCreateRule failed: %v", err)
+	}
+	user := &UserClaims{Email: "alice@dhbw.de", PreferredUsername: "alice@dhbw.de"}
+	base := "alice-at-dhbw-de.users.dhbw.site"
+
+	check := func(zone string) int {
+		t.Helper()
+		allowed, def, err := app.PolicyIsZoneAllowedForUser(zone, user)
+		if err != nil || !allowed {
+			t.Fatalf("expected %s to be allowed, got %v, %v", zone, allowed, err)
+		}
+		if def.BaseZone != base {
+			t.Errorf("expected base zone %s for %s, got %s", base, zone, def.BaseZone)
+		}
+		status, _ := app.checkZoneQuotas(user.PreferredUsername, def)
+		return status
+	}
+
+	if status := check("a.b." + base); status != http.StatusForbidden {
+		t.Errorf("expected a subzone 2 levels deep to be refused, got %d", status)
+	}
+
+	addZone(t, app, user.PreferredUsername, base)
+	addZone(t, app, user.PreferredUsername, "a."+base)
+	addZone(t, app, user.PreferredUsername, "other.dhbw.site") // not under the base zone
+	if status := check("b." + base); status != http.StatusOK {
+		t.Errorf("expected a third zone to be allowed, got %d", status)
+	}
+	addZone(t, app, user.PreferredUsername, "b."+base)
+	if status := check("c." + base); status != http.StatusForbidden {
+		t.Errorf("expected a fourth zone to be refused, got %d", status)
+	}
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/farberg/dynamic-zones/internal/helper"
+	"github.com/miekg/dns"
+)
+
+// externalDNSHeritage marks the TXT records external-dns keeps next to the
+// records it owns.
+const externalDNSHeritage = "heritage=external-dns"
+
+// externalDNSTxtPrefix is the txtPrefix of the external-dns configuration the
+// service hands out: its markers are named "dynamic-zones-dns-<type>-<name>".
+const externalDNSTxtPrefix = "dynamic-zones-dns-"
+
+// externalDNSRecordTypeTemplate stands for the record type in a txtPrefix.
+const externalDNSRecordTypeTemplate = "%{record_type}"
+
+// ZoneRecordSet is one RRset of the desired records of a zone.
+type ZoneRecordSet struct {
+	// Name is relative to the zone ("@" or empty for the apex) or absolute
+	// with a trailing dot.
+	Name string `json:"name" example:"www"`
+	Type string `json:"type" example:"A"`
+	// TTL defaults to 3600.
+	TTL    uint32             `json:"ttl,omitempty" example:"300"`
+	Value  string             `json:"value,omitempty"`
+	Values []string           `json:"values,omitempty"`
+	Data   *helper.RecordData `json:"data,omitempty"`
+}
+
+// ZoneRecordsRequest is the complete desired record set of a zone, in JSON or
+// YAML.
+type ZoneRecordsRequest struct {
+	// Records is required so that a missing key cannot empty the zone; an
+	// empty list removes every managed record.
+	Records []ZoneRecordSet `json:"records" binding:"required"`
+	// KeepForeign leaves the records of external-dns alone: its TXT ownership
+	// markers and the records they mark.
+	KeepForeign bool `json:"keep_foreign,omitempty"`
+	// Ignore holds further names whose records are left alone, relative to
+	// the zone, with path.Match wildcards (e.g. "_acme-challenge*").
+	Ignore []string `json:"ignore,omitempty" example:"_acme-challenge*"`
+}
+
+// desiredRecords builds the records of sets, one per value. An RRset given in
+// several sets must have a single TTL.
+func desiredRecords(zone string, sets []ZoneRecordSet) ([]dns.RR, error) {
+	var rrs []dns.RR
+	ttls := make(map[string]uint32)
+	for i, set := range sets {
+		name := canonicalRecordName(set.Name, zone)
+		ttl := set.TTL
+		if ttl == 0 {
+			ttl = importDefaultTTL
+		}
+		records, err := requestRecords(name, &DNSRecordRequest{Type: set.Type, TTL: ttl, Value: set.Value, Values: set.Values, Data: set.Data})
+		if err != nil {
+			return nil, fmt.Errorf("record %d (%s %s): %w", i, name, set.Type, err)
+		}
+		rrset := strings.ToLower(name) + " " + strings.ToUpper(set.Type)
+		if prev, ok := ttls[rrset]; ok && prev != ttl {
+			return nil, fmt.Errorf("record %d (%s %s): TTL %d differs from %d given before for the same RRset", i, name, set.Type, ttl, prev)
+		}
+		ttls[rrset] = ttl
+		rrs = append(rrs, records...)
+	}
+	return rrs, nil
+}
+
+// foreignRecords returns why opts leave a record alone, or "" if they do not.
+// The records external-dns owns are found by its markers in current, with or
+// without externalDNSTxtPrefix (see markExternalDNSOwned).
+func foreignRecords(zoneFQDN string, current []dns.RR, opts recordSyncOptions) func(dns.RR) string {
+	ownedNames := make(map[string]bool)
+	ownedRRsets := make(map[string]bool)
+	if opts.KeepForeign {
+		for _, rr := range current {
+			txt, ok := rr.(*dns.TXT)
+			if !ok || !strings.Contains(strings.Join(txt.Txt, ""), externalDNSHeritage) {
+				continue
+			}
+			label, rest, _ := strings.Cut(strings.ToLower(txt.Hdr.Name), ".")
+			for _, txtPrefix := range []string{"", externalDNSTxtPrefix} {
+				markExternalDNSOwned(label, rest, txtPrefix, ownedNames, ownedRRsets)
+			}
+		}
+	}
+
+	return func(rr dns.RR) string {
+		h := rr.Header()
+		name := strings.ToLower(h.Name)
+		if ownedNames[name] || ownedRRsets[name+" "+dns.TypeToString[h.Rrtype]] {
+			return "owned by external-dns"
+		}
+		relative := strings.TrimSuffix(strings.TrimSuffix(name, strings.ToLower(zoneFQDN)), ".")
+		if relative == "" {
+			relative = "@"
+		}
+		for _, pattern := range opts.Ignore {
+			if ok, _ := path.Match(strings.ToLower(pattern), relative); ok {
+				return "ignored name " + pattern
+			}
+		}
+		return ""
+	}
+}
+
+// markExternalDNSOwned adds to names and rrsets what the external-dns marker
+// label.rest owns if label starts with txtPrefix: the name without the prefix
+// (the legacy registry format; the marker itself with an empty prefix) and,
+// named "<prefix><type>-<name>", the RRset (name, type). A %{record_type}
+// template in txtPrefix stands for the type, which is then not repeated.
+func markExternalDNSOwned(label, rest, txtPrefix string, names, rrsets map[string]bool) {
+	txtPrefix = strings.ToLower(txtPrefix)
+	legacy := strings.ReplaceAll(txtPrefix, externalDNSRecordTypeTemplate, "")
+	if name, ok := strings.CutPrefix(label, legacy); ok && name != "" {
+		names[name+"."+rest] = true
+	}
+	for rrtype := range dns.StringToType {
+		typed := txtPrefix + strings.ToLower(rrtype) + "-"
+		if strings.Contains(txtPrefix, externalDNSRecordTypeTemplate) {
+			typed = strings.ReplaceAll(txtPrefix, externalDNSRecordTypeTemplate, strings.ToLower(rrtype))
+		}
+		if owner, ok := strings.CutPrefix(label, typed); ok && owner != "" {
+			rrsets[owner+"."+rest+" "+rrtype] = true
+		}
+	}
+}
+
+// ZoneRecordsReplace makes the zone hold exactly the records of req, the way
+// ZoneImport does with a zone file: apex SOA/NS, delegations of subzones,
+// enforced default records and the records req leaves alone are skipped on
+// both sides, and the changes are sent as ONE update. With dryRun only the plan is returned.
+func (app *AppData) ZoneRecordsReplace(ctx context.Context, username, zone string, req ZoneRecordsRequest, dryRun bool) (int, any, error) {
+	isOwner, err := app.Storage.IsZoneOwner(username, zone)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to check zone ownership", fmt.Errorf("app.ZoneRecordsReplace: %w", err))
+	}
+	if !isOwner {
+		return errorResult(http.StatusForbidden, "You are not an owner of this zone", fmt.Errorf("app.ZoneRecordsReplace: %s not owned by %s", zone, username))
+	}
+
+	for _, pattern := range req.Ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errorResult(http.StatusBadRequest, fmt.Sprintf("Invalid ignore pattern %q", pattern), fmt.Errorf("app.ZoneRecordsReplace: %w", err))
+		}
+	}
+	desired, err := desiredRecords(zone, req.Records)
+	if err != nil {
+		return errorResult(http.StatusBadRequest, "Invalid records: "+err.Error(), fmt.Errorf("app.ZoneRecordsReplace: %w", err))
+	}
+
+	opts := recordSyncOptions{KeepForeign: req.KeepForeign, Ignore: req.Ignore}
+	return app.syncZoneRecords(ctx, "app.ZoneRecordsReplace", AuditRecordReplace, username, zone, desired, opts, dryRun)
+}
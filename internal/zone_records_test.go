@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/miekg/dns"
+)
+
+// The desired records are read from YAML as from JSON, one record per value,
+// and the records of external-dns and ignored names are left alone.
+func TestZoneRecordsReplace(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	const zone = "alice.users.example.com"
+	addZone(t, app, "alice", zone)
+
+	var req ZoneRecordsRequest
+	body := "records:\n  - name: www\n    type: A\n    ttl: 300\n    values: [192.0.2.1, 192.0.2.2]\n  - name: '@'\n    type: TXT\n    value: '\"hello\"'\nkeep_foreign: true\n"
+	if err := binding.YAML.BindBody([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	rrs, err := desiredRecords(zone, req.Records)
+	if err != nil || len(rrs) != 3 || !req.KeepForeign {
+		t.Fatalf("expected 3 records, got %v %v", rrs, err)
+	}
+	if rrs[0].Header().Name != "www."+zone+"." || rrs[0].Header().Ttl != 300 || rrs[2].Header().Name != zone+"." || rrs[2].Header().Ttl != importDefaultTTL {
+		t.Errorf("expected names in the zone and the default TTL, got %v", rrs)
+	}
+	if _, err := desiredRecords(zone, []ZoneRecordSet{{Name: "www", Type: "A", TTL: 60, Value: "192.0.2.1"}, {Name: "www", Type: "A", TTL: 120, Value: "192.0.2.2"}}); err == nil {
+		t.Error("expected an RRset with two TTLs to be refused")
+	}
+	if err := binding.YAML.BindBody([]byte("keep_foreign: true\n"), &ZoneRecordsRequest{}); err == nil {
+		t.Error("expected a body without records to be refused")
+	}
+
+	var current []dns.RR
+	for _, s := range []string{
+		`app.alice.users.example.com. 300 IN TXT "heritage=external-dns,external-dns/owner=default"`,
+		`app.alice.users.example.com. 300 IN A 192.0.2.10`,
+		`a-api.alice.users.example.com. 300 IN TXT "heritage=external-dns,external-dns/owner=default"`,
+		`api.alice.users.example.com. 300 IN A 192.0.2.11`,
+		`api.alice.users.example.com. 300 IN TXT "mine"`,
+		`_acme-challenge.alice.users.example.com. 300 IN TXT "token"`,
+		`www.alice.users.example.com. 300 IN A 192.0.2.1`,
+		`dynamic-zones-dns-a-web.alice.users.example.com. 300 IN TXT "heritage=external-dns,external-dns/owner=dynamic-zones-dns"`,
+		`web.alice.users.example.com. 300 IN A 192.0.2.12`,
+		`web.alice.users.example.com. 300 IN AAAA 2001:db8::12`,
+		`dynamic-zones-dns-old.alice.users.example.com. 300 IN TXT "heritage=external-dns,external-dns/owner=dynamic-zones-dns"`,
+		`old.alice.users.example.com. 300 IN CNAME web.alice.users.example.com.`,
+	} {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		current = append(current, rr)
+	}
+	foreign := foreignRecords(zone+".", current, recordSyncOptions{KeepForeign: true, Ignore: []string{"_acme-challenge*"}})
+	for i, want := range []bool{true, true, true, true, false, true, false, true, true, false, true, true} {
+		if got := foreign(current[i]) != ""; got != want {
+			t.Errorf("record %v: expected left alone %v, got %v", current[i], want, got)
+		}
+	}
+	if foreign := foreignRecords(zone+".", current, recordSyncOptions{}); foreign(current[1]) != "" {
+		t.Error("expected external-dns records to be managed without keep_foreign")
+	}
+	names, rrsets := make(map[string]bool), make(map[string]bool)
+	markExternalDNSOwned("cname-ext-app", zone+".", "%{record_type}-ext-", names, rrsets)
+	if !rrsets["app."+zone+". CNAME"] || len(rrsets) != 1 {
+		t.Errorf("expected the %%{record_type} template to mark one CNAME RRset, got %v", rrsets)
+	}
+
+	if status, _, _ := app.ZoneRecordsReplace(ctx, "bob", zone, req, true); status != http.StatusForbidden {
+		t.Errorf("expected others to be refused, got %d", status)
+	}
+	if status, _, _ := app.ZoneRecordsReplace(ctx, "alice", zone, ZoneRecordsRequest{Records: []ZoneRecordSet{}, Ignore: []string{"["}}, true); status != http.StatusBadRequest {
+		t.Errorf("expected an invalid pattern to be refused, got %d", status)
+	}
+}
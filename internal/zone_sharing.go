@@ -209,5 +209,7 @@ func (app *AppData) subzoneDefViaOwnedParent(zone, user string) (*ZoneResponse,
 	if def == nil || !def.AllowSubdomains {
 		return nil, nil
 	}
-	return &ZoneResponse{Zone: zone, ZoneSOA: parent, AllowSubdomains: true, SharingAllowed: def.SharingAllowed}, nil
+	return &ZoneResponse{Zone: zone, ZoneSOA: parent, AllowSubdomains: true, SharingAllowed: def.SharingAllowed,
+		Dnssec: def.Dnssec, RecordConstraints: def.RecordConstraints, BaseZone: quotaBase(def), ZoneQuotas: def.ZoneQuotas,
+		LeaseDays: def.LeaseDays}, nil
 }
@@ -36,7 +36,7 @@ func newPdnsTestApp(t *testing.T) *AppData {
 	// container was addressed as localhost; against 127.0.0.1 every call came
 	// back "Not Found".
 	pdns, err := NewPowerDnsClient(baseURL, "localhost", pdnsDocker.GetApiKey(), 60,
-		[]string{"ns.example.com."}, "admin-key", "c3VwZXJzZWNyZXRhZG1pbmtleQ==", "hmac-sha256",
+		[]string{"ns.example.com."}, "admin-key", "c3VwZXJzZWNyZXRhZG1pbmtleQ==", "hmac-sha256", "",
 		nil, nil, log)
 	if err != nil {
 		t.Fatalf("failed to create PowerDNS client: %v", err)
@@ -100,7 +100,7 @@ func seedSharedParentWithSubzone(t *testing.T, app *AppData, owner, parent, subz
 	t.Helper()
 
 	for _, zone := range []string{parent, subzone} {
-		if _, err := app.PowerDns.CreateUserZone(t.Context(), owner, zone, true); err != nil {
+		if _, err := app.PowerDns.CreateUserZone(t.Context(), owner, zone, true, false, ""); err != nil {
 			t.Fatalf("failed to create zone %s in PowerDNS: %v", zone, err)
 		}
 		if _, err := app.Storage.CreateZone(owner, zone, time.Now()); err != nil {
@@ -184,7 +184,7 @@ func TestSubzoneCreationInheritsParentOwners(t *testing.T) {
 	if def == nil {
 		t.Fatal("a co-owner of a zone that allows subdomains must be allowed to delegate below it")
 	}
-	if status, resp, _ := app.ZoneCreate(ctx, coOwner, *def); status != 201 {
+	if status, resp, _ := app.ZoneCreate(ctx, coOwner, *def, ""); status != 201 {
 		t.Fatalf("ZoneCreate returned %d: %v", status, resp)
 	}
 
@@ -1,6 +1,9 @@
 package app
 
 import (
+	"context"
+	"encoding/base64"
+	"net/http"
 	"testing"
 	"time"
 
@@ -9,7 +12,7 @@ import (
 
 // newTestApp returns an AppData backed by a fresh in-memory sqlite storage. Only
 // the storage/policy side is wired — helpers that touch PowerDNS are covered by
-// the container-based tests.
+// the container-based tests or use useFakePdns.
 func newTestApp(t *testing.T) *AppData {
 	t.Helper()
 	// A private cache per test, so parallel tests do not share a database.
@@ -115,3 +118,47 @@ func TestSubzoneDefViaOwnedParent(t *testing.T) {
 		t.Errorf("expected no definition for a non-owner, got %+v", def)
 	}
 }
+
+// A co-owner's key follows the zone's algorithm, and a rotation can switch it
+// to another allowed one.
+func TestZoneKeyAlgorithms(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.ZoneDefaults.UserTsigAlgorithms = []string{"hmac-sha512", "hmac-sha256"}
+	fake := useFakePdns(t, app)
+	ctx := context.Background()
+	alice := &UserClaims{Email: "alice@dhbw.de", PreferredUsername: "alice@dhbw.de"}
+	def := ZoneResponse{Zone: "alice.users.example.com", ZoneSOA: "users.example.com"}
+
+	if status, _, _ := app.ZoneCreate(ctx, alice.PreferredUsername, def, "hmac-sha1"); status != http.StatusBadRequest {
+		t.Errorf("expected a disallowed algorithm to be refused, got %d", status)
+	}
+	if status, resp, err := app.ZoneCreate(ctx, alice.PreferredUsername, def, "hmac-sha256"); status != http.StatusCreated {
+		t.Fatalf("ZoneCreate: %d %v %v", status, resp, err)
+	}
+	addZone(t, app, "bob@dhbw.de", def.Zone)
+	if err := app.PowerDns.AddOwnerKey(ctx, def.Zone, "bob@dhbw.de"); err != nil {
+		t.Fatalf("AddOwnerKey: %v", err)
+	}
+
+	algorithms := func() map[string]int {
+		found := map[string]int{}
+		for _, k := range fake.keys {
+			key, _ := base64.StdEncoding.DecodeString(*k.Key)
+			found[*k.Algorithm] = len(key)
+		}
+		return found
+	}
+	if got := algorithms(); len(fake.keys) != 2 || got["hmac-sha256"] != 32 {
+		t.Fatalf("expected two 32 byte hmac-sha256 keys, got %v", got)
+	}
+
+	if status, _, _ := app.ZoneRotateKeys(ctx, alice, def.Zone, "hmac-sha384", true); status != http.StatusBadRequest {
+		t.Errorf("expected a rotation to a disallowed algorithm to be refused, got %d", status)
+	}
+	if status, _, _ := app.ZoneRotateKeys(ctx, alice, def.Zone, "hmac-sha512", true); status != http.StatusOK {
+		t.Fatalf("ZoneRotateKeys: %d", status)
+	}
+	if got := algorithms(); len(fake.keys) != 2 || got["hmac-sha512"] != 64 || got["hmac-sha256"] != 0 {
+		t.Errorf("expected two 64 byte hmac-sha512 keys after the rotation, got %v", got)
+	}
+}
@@ -0,0 +1,502 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+)
+
+// How often deleted zones past their retention are purged from the trash.
+const zoneTrashPurgeInterval = time.Hour
+
+// RRsetSnapshot is an RRset as it was in PowerDNS.
+type RRsetSnapshot struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     uint32   `json:"ttl"`
+	Records []string `json:"records"`
+}
+
+// DeletedZone is a deleted zone in the trash: its records and owners at the
+// time of the deletion, kept until ExpiresAt so the zone can be restored.
+type DeletedZone struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	DeletedAt time.Time `gorm:"index" json:"deleted_at"`
+	Zone      string    `gorm:"type:varchar(255);index;not null" json:"zone"`
+	// DeletedBy is the actor of the deletion, "system" for an expired lease.
+	DeletedBy string `gorm:"type:varchar(255)" json:"deleted_by"`
+	// Owners is the comma-separated list of the owners at the deletion.
+	Owners string `gorm:"type:text" json:"owners" swaggertype:"array,string"`
+	// ZoneSOA, Dnssec and KeyAlgorithm recreate the zone as it was.
+	ZoneSOA      string `gorm:"type:varchar(255)" json:"zone_soa"`
+	Dnssec       bool   `json:"dnssec"`
+	KeyAlgorithm string `gorm:"type:varchar(32)" json:"key_algorithm"`
+	// RRsets holds the JSON of the zone's []RRsetSnapshot, without what the
+	// service maintains itself (SOA, apex NS, DNSSEC and enforced records).
+	RRsets    string    `gorm:"type:text" json:"rrsets" swaggertype:"array,object"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	// SuspendedAt is set when an admin had suspended the zone; only admins
+	// may restore it, and it comes back suspended.
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+}
+
+// MarshalJSON lists the owners and embeds the RRsets as JSON.
+func (d DeletedZone) MarshalJSON() ([]byte, error) {
+	type plain DeletedZone
+	return json.Marshal(struct {
+		plain
+		Owners []string        `json:"owners"`
+		RRsets json.RawMessage `json:"rrsets"`
+	}{plain(d), d.OwnerList(), json.RawMessage(d.RRsets)})
+}
+
+// OwnerList returns the owners of the zone at its deletion.
+func (d *DeletedZone) OwnerList() []string {
+	return splitList(d.Owners)
+}
+
+// Snapshot returns the stored RRsets.
+func (d *DeletedZone) Snapshot() ([]RRsetSnapshot, error) {
+	var rrsets []RRsetSnapshot
+	if err := json.Unmarshal([]byte(d.RRsets), &rrsets); err != nil {
+		return nil, fmt.Errorf("RRsets of deleted zone %d: %w", d.ID, err)
+	}
+	return rrsets, nil
+}
+
+// DeletedZoneCreate puts a deleted zone into the trash.
+func (s *Storage) DeletedZoneCreate(d *DeletedZone) error {
+	if err := s.db.Create(d).Error; err != nil {
+		return fmt.Errorf("storage.DeletedZoneCreate: %w", err)
+	}
+	return nil
+}
+
+// DeletedZoneList returns the deleted zones in the trash, newest first.
+func (s *Storage) DeletedZoneList() ([]DeletedZone, error) {
+	var deleted []DeletedZone
+	if err := s.db.Order("id desc").Find(&deleted).Error; err != nil {
+		return nil, fmt.Errorf("storage.DeletedZoneList: %w", err)
+	}
+	return deleted, nil
+}
+
+// DeletedZoneGet returns the deleted zone id of zone, or the latest deletion
+// of zone when id is 0. Nil if there is none.
+func (s *Storage) DeletedZoneGet(zone string, id uint) (*DeletedZone, error) {
+	var d DeletedZone
+	query := s.db.Where("zone = ?", zone)
+	if id != 0 {
+		query = query.Where("id = ?", id)
+	}
+	err := query.Order("id desc").First(&d).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage.DeletedZoneGet: %w", err)
+	}
+	return &d, nil
+}
+
+// DeletedZoneDelete removes a deleted zone from the trash.
+func (s *Storage) DeletedZoneDelete(id uint) error {
+	if err := s.db.Delete(&DeletedZone{}, id).Error; err != nil {
+		return fmt.Errorf("storage.DeletedZoneDelete: %w", err)
+	}
+	return nil
+}
+
+// DeletedZonePurge removes the deleted zones whose retention ended before now
+// and returns their names.
+func (s *Storage) DeletedZonePurge(now time.Time) ([]string, error) {
+	var purged []DeletedZone
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id", "zone").Where("expires_at < ?", now).Find(&purged).Error; err != nil {
+			return err
+		}
+		if len(purged) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(purged))
+		for i, d := range purged {
+			ids[i] = d.ID
+		}
+		return tx.Delete(&DeletedZone{}, ids).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage.DeletedZonePurge: %w", err)
+	}
+	zones := make([]string, len(purged))
+	for i, d := range purged {
+		zones[i] = d.Zone
+	}
+	return zones, nil
+}
+
+// ZoneRRsets returns the RRsets of zone.
+func (p *PowerDnsClient) ZoneRRsets(ctx context.Context, zone string) ([]RRsetSnapshot, error) {
+	z, err := p.powerdns.Zones.Get(ctx, dns.Fqdn(zone))
+	if err != nil {
+		return nil, fmt.Errorf("ZoneRRsets: %w", err)
+	}
+	rrsets := make([]RRsetSnapshot, 0, len(z.RRsets))
+	for _, rrset := range z.RRsets {
+		if rrset.Name == nil || rrset.Type == nil {
+			continue
+		}
+		s := RRsetSnapshot{Name: *rrset.Name, Type: string(*rrset.Type)}
+		if rrset.TTL != nil {
+			s.TTL = *rrset.TTL
+		}
+		for _, record := range rrset.Records {
+			if record.Content != nil {
+				s.Records = append(s.Records, *record.Content)
+			}
+		}
+		rrsets = append(rrsets, s)
+	}
+	return rrsets, nil
+}
+
+// ReplaceRRsets writes rrsets into zone, each replacing the RRset of its name
+// and type. An empty RRset deletes it.
+func (p *PowerDnsClient) ReplaceRRsets(ctx context.Context, zone string, rrsets []RRsetSnapshot) error {
+	if len(rrsets) == 0 {
+		return nil
+	}
+	sets := make([]powerdns.RRset, 0, len(rrsets))
+	for _, s := range rrsets {
+		set := powerdns.RRset{
+			Name: powerdns.String(s.Name),
+			Type: powerdns.RRTypePtr(powerdns.RRType(s.Type)),
+		}
+		if len(s.Records) == 0 {
+			set.ChangeType = powerdns.ChangeTypePtr(powerdns.ChangeTypeDelete)
+			sets = append(sets, set)
+			continue
+		}
+		ttl := s.TTL
+		if ttl == 0 {
+			ttl = p.defaultTTLSeconds
+		}
+		set.ChangeType = powerdns.ChangeTypePtr(powerdns.ChangeTypeReplace)
+		set.TTL = powerdns.Uint32(ttl)
+		for _, content := range s.Records {
+			set.Records = append(set.Records, powerdns.Record{Content: powerdns.String(content), Disabled: powerdns.Bool(false)})
+		}
+		sets = append(sets, set)
+	}
+	if err := p.powerdns.Records.Patch(ctx, dns.Fqdn(zone), &powerdns.RRsets{Sets: sets}); err != nil {
+		return fmt.Errorf("ReplaceRRsets: %w", err)
+	}
+	return nil
+}
+
+// userRRsets leaves out of rrsets what the service maintains in zone itself:
+// the SOA, the apex NS, DNSSEC records, the NS and DS delegations of subzones
+// and the enforced default records. They are written anew when the zone or
+// its subzones are created.
+func (app *AppData) userRRsets(zone string, rrsets []RRsetSnapshot) ([]RRsetSnapshot, error) {
+	zoneFQDN := strings.ToLower(dns.Fqdn(zone))
+	protected := app.protectedRecords(zone)
+	delegations, err := app.subzoneDelegations(zone)
+	if err != nil {
+		return nil, fmt.Errorf("app.userRRsets: %w", err)
+	}
+	kept := make([]RRsetSnapshot, 0, len(rrsets))
+	for _, s := range rrsets {
+		name, rrtype := strings.ToLower(dns.Fqdn(s.Name)), dns.StringToType[strings.ToUpper(s.Type)]
+		switch {
+		case rrtype == dns.TypeSOA, rrtype == dns.TypeDS, isDnssecType(rrtype):
+		case name == zoneFQDN && rrtype == dns.TypeNS:
+		case delegations[name] && rrtype == dns.TypeNS:
+		case protected[name+" "+strings.ToUpper(s.Type)]:
+		default:
+			kept = append(kept, s)
+		}
+	}
+	return kept, nil
+}
+
+// zoneTrashRetention is how long deleted zones stay in the trash; 0 keeps none.
+func (app *AppData) zoneTrashRetention() time.Duration {
+	return time.Duration(app.Config.ZoneDefaults.TrashRetentionDays) * 24 * time.Hour
+}
+
+// zoneTrashEntry reads what the trash keeps of zone, about to be deleted: its
+// records and owners. It returns nil without a trash.
+func (app *AppData) zoneTrashEntry(ctx context.Context, zone string, owners []string) (*DeletedZone, error) {
+	retention := app.zoneTrashRetention()
+	if retention == 0 {
+		return nil, nil
+	}
+	rrsets, err := app.PowerDns.ZoneRRsets(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("app.zoneTrashEntry: %w", err)
+	}
+	rrsets, err = app.userRRsets(zone, rrsets)
+	if err != nil {
+		return nil, fmt.Errorf("app.zoneTrashEntry: %w", err)
+	}
+	records, err := json.Marshal(rrsets)
+	if err != nil {
+		return nil, fmt.Errorf("app.zoneTrashEntry: %w", err)
+	}
+	dnssec, err := app.PowerDns.ZoneDnssec(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("app.zoneTrashEntry: %w", err)
+	}
+	zoneSOA := parentZone(zone)
+	if def, err := app.zoneGoverningDef(zone); err != nil {
+		return nil, fmt.Errorf("app.zoneTrashEntry: %w", err)
+	} else if def != nil {
+		zoneSOA = def.ZoneSOA
+	}
+	var suspended *time.Time
+	if rows, err := app.Storage.ZoneRows(auditZone(zone)); err != nil {
+		return nil, fmt.Errorf("app.zoneTrashEntry: %w", err)
+	} else if len(rows) > 0 {
+		suspended = groupZoneLeases(rows)[0].suspended
+	}
+
+	now := time.Now()
+	return &DeletedZone{
+		DeletedAt:    now,
+		Zone:         auditZone(zone),
+		DeletedBy:    auditActorFrom(ctx).Actor,
+		Owners:       strings.Join(owners, ","),
+		ZoneSOA:      zoneSOA,
+		Dnssec:       dnssec.Signed,
+		KeyAlgorithm: app.PowerDns.zoneKeyAlgorithm(ctx, dns.Fqdn(zone)),
+		RRsets:       string(records),
+		ExpiresAt:    now.Add(retention),
+		SuspendedAt:  suspended,
+	}, nil
+}
+
+// trashZone puts the entry of a deleted zone (see zoneTrashEntry) into the
+// trash. Without a trash the history of the zone goes right away.
+func (app *AppData) trashZone(zone string, entry *DeletedZone) error {
+	if entry == nil {
+		return app.Storage.ZoneVersionDeleteAll(auditZone(zone))
+	}
+	return app.Storage.DeletedZoneCreate(entry)
+}
+
+// canRestore reports whether user may see and restore the deleted zone d: its
+// owners may, and the admins whose scope (see auditScopes) covers the zone.
+func (app *AppData) canRestore(user *UserClaims, d *DeletedZone, scopes []string) bool {
+	if scopes == nil || slices.Contains(d.OwnerList(), user.PreferredUsername) {
+		return true
+	}
+	return slices.ContainsFunc(scopes, func(suffix string) bool { return zoneInScope(d.Zone, suffix) })
+}
+
+// ZoneTrashList returns the deleted zones user may restore, newest first.
+func (app *AppData) ZoneTrashList(ctx context.Context, user *UserClaims) (int, any, error) {
+	scopes, err := app.auditScopes(user)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to check permissions", fmt.Errorf("app.ZoneTrashList: %w", err))
+	}
+	deleted, err := app.Storage.DeletedZoneList()
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the trash", fmt.Errorf("app.ZoneTrashList: %w", err))
+	}
+	visible := make([]DeletedZone, 0, len(deleted))
+	for i := range deleted {
+		if app.canRestore(user, &deleted[i], scopes) {
+			visible = append(visible, deleted[i])
+		}
+	}
+	return http.StatusOK, visible, nil
+}
+
+// ZoneRestore recreates a deleted zone from the trash: the zone with new keys
+// for its owners, and its records. id picks one of several deletions of the
+// zone; 0 restores the latest. Owners may restore a zone that a rule still
+// grants to one of them, within their zone quotas; admins may restore any zone
+// in their scope. A zone that was suspended only admins may restore.
+func (app *AppData) ZoneRestore(ctx context.Context, user *UserClaims, zone string, id uint) (int, any, error) {
+	zone = auditZone(zone)
+	d, err := app.Storage.DeletedZoneGet(zone, id)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the trash", fmt.Errorf("app.ZoneRestore: %w", err))
+	}
+	scopes, err := app.auditScopes(user)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to check permissions", fmt.Errorf("app.ZoneRestore: %w", err))
+	}
+	if d == nil || !app.canRestore(user, d, scopes) {
+		return errorResult(http.StatusNotFound, "Zone is not in the trash", fmt.Errorf("app.ZoneRestore: %s (%d) not in the trash of %s", zone, id, user.PreferredUsername))
+	}
+	owners := d.OwnerList()
+	if len(owners) == 0 {
+		return errorResult(http.StatusConflict, "The deleted zone has no owners to restore it for", fmt.Errorf("app.ZoneRestore: %s has no owners", zone))
+	}
+
+	var def *ZoneResponse
+	defs := make(map[string]*ZoneResponse, len(owners))
+	for _, o := range owners {
+		allowed, zoneDef, err := app.PolicyIsZoneAllowedForUser(zone, &UserClaims{Email: o, PreferredUsername: o})
+		if err != nil {
+			return errorResult(http.StatusInternalServerError, "Failed to evaluate policy", fmt.Errorf("app.ZoneRestore: %w", err))
+		}
+		if allowed && zoneDef != nil {
+			defs[o] = zoneDef
+			if def == nil {
+				def = zoneDef
+			}
+		}
+	}
+	isAdmin := scopes == nil || slices.ContainsFunc(scopes, func(suffix string) bool { return zoneInScope(zone, suffix) })
+	if def == nil && !isAdmin {
+		return errorResult(http.StatusForbidden, "No policy rule grants this zone anymore; ask an admin to restore it",
+			fmt.Errorf("app.ZoneRestore: %s is not granted to any of %v", zone, owners))
+	}
+	if d.SuspendedAt != nil && !isAdmin {
+		return errorResult(http.StatusForbidden, "The zone was suspended by an admin; ask an admin to restore it",
+			fmt.Errorf("app.ZoneRestore: %s was suspended", zone))
+	}
+
+	if status, msg, err := app.checkZoneExists(zone); err != nil {
+		return status, msg, err
+	}
+	// The zone counts against the quotas of its owners again, as on creation;
+	// admins restore it regardless.
+	if !isAdmin {
+		for _, o := range owners {
+			if defs[o] == nil {
+				continue
+			}
+			if status, err := app.checkZoneQuotas(o, defs[o]); err != nil {
+				msg := err.Error()
+				if status == http.StatusInternalServerError {
+					msg = "Failed to check zone quotas"
+				}
+				return errorResult(status, msg, fmt.Errorf("app.ZoneRestore: %w", err))
+			}
+		}
+	}
+	rrsets, err := d.Snapshot()
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to read the deleted records", fmt.Errorf("app.ZoneRestore: %w", err))
+	}
+
+	authoritative := getAuthoritativeZones(zone, d.ZoneSOA)
+	if len(authoritative) == 0 {
+		return errorResult(http.StatusConflict, "Zone is not below its SOA", fmt.Errorf("app.ZoneRestore: zone %q is not below %q", zone, d.ZoneSOA))
+	}
+	if err := app.ensureIntermediateZones(ctx, zone, authoritative, d.Dnssec); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to ensure intermediate zone exists", fmt.Errorf("app.ZoneRestore: %w", err))
+	}
+	algorithm := d.KeyAlgorithm
+	if !slices.Contains(app.tsigAlgorithms(), algorithm) {
+		algorithm = app.tsigAlgorithms()[0]
+	}
+	if _, err := app.PowerDns.CreateUserZone(ctx, owners[0], zone, true, d.Dnssec, algorithm); err != nil {
+		return errorResult(http.StatusInternalServerError, "Failed to create zone in DNS server", fmt.Errorf("app.ZoneRestore: %w", err))
+	}
+	for _, o := range owners[1:] {
+		if err := app.PowerDns.AddOwnerKey(ctx, zone, o); err != nil {
+			return errorResult(http.StatusInternalServerError, "Failed to provision zone key", fmt.Errorf("app.ZoneRestore: %w", err))
+		}
+	}
+	if d.Dnssec {
+		if err := app.publishDSChain(ctx, authoritative); err != nil {
+			return errorResult(http.StatusInternalServerError, "Failed to publish DS records", fmt.Errorf("app.ZoneRestore: %w", err))
+		}
+	}
+	if err := app.PowerDns.ReplaceRRsets(ctx, zone, rrsets); err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to write the records", fmt.Errorf("app.ZoneRestore: %w", err))
+	}
+
+	refreshTime := time.Now().Add(time.Duration(app.RefreshTime) * time.Second)
+	if def != nil && def.LeaseDays > 0 {
+		refreshTime = leaseEnd(time.Now(), def.LeaseDays)
+	}
+	for _, o := range owners {
+		if _, err := app.Storage.CreateZone(o, zone, refreshTime); err != nil {
+			return errorResult(http.StatusInternalServerError, "Failed to store the zone", fmt.Errorf("app.ZoneRestore: %w", err))
+		}
+	}
+	if d.SuspendedAt != nil {
+		if err := app.suspendRestoredZone(ctx, zone, *d.SuspendedAt); err != nil {
+			return errorResult(http.StatusBadGateway, "Failed to suspend the zone again", fmt.Errorf("app.ZoneRestore: %w", err))
+		}
+	}
+	if err := app.syncZoneUpdateGrants(ctx, zone); err != nil {
+		return errorResult(http.StatusBadGateway, "Failed to withhold the update grants of the zone", fmt.Errorf("app.ZoneRestore: %w", err))
+	}
+	if err := app.Storage.DeletedZoneDelete(d.ID); err != nil {
+		app.Log.Warnf("app.ZoneRestore: %s restored, but left in the trash: %v", zone, err)
+	}
+
+	app.Log.Infof("app.ZoneRestore: %s restored by %s with %d RRset(s)", zone, user.PreferredUsername, len(rrsets))
+	app.audit(ctx, AuditZoneRestore, zone, zone, nil, gin.H{"owners": owners, "deleted_at": d.DeletedAt, "rrsets": len(rrsets)})
+	app.emit(ctx, EventZoneRestored, zone, gin.H{"zone": zone, "owners": owners, "deleted_at": d.DeletedAt})
+	app.recordZoneVersion(ctx, zone, ZoneVersionAPI)
+	return http.StatusCreated, gin.H{"zone": zone, "owners": owners, "rrsets": len(rrsets)}, nil
+}
+
+// suspendRestoredZone suspends a restored zone again, as it was suspended at
+// its deletion: the update grants are withheld and the records disabled.
+func (app *AppData) suspendRestoredZone(ctx context.Context, zone string, suspendedAt time.Time) error {
+	if err := app.PowerDns.SuspendZoneUpdates(ctx, zone); err != nil {
+		return err
+	}
+	if err := app.PowerDns.SetZoneRecordsDisabled(ctx, zone, true); err != nil {
+		return err
+	}
+	return app.Storage.ZoneLeaseSet(zone, map[string]any{"suspended_at": suspendedAt})
+}
+
+// RunZoneTrash purges the deleted zones past their retention every
+// zoneTrashPurgeInterval until ctx ends.
+func (app *AppData) RunZoneTrash(ctx context.Context) {
+	ticker := time.NewTicker(zoneTrashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		app.purgeZoneTrash(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeZoneTrash removes the deleted zones past their retention, and the
+// history of those that neither exist nor are in the trash anymore.
+func (app *AppData) purgeZoneTrash(now time.Time) {
+	purged, err := app.Storage.DeletedZonePurge(now)
+	if err != nil {
+		app.Log.Warnf("app.purgeZoneTrash: %v", err)
+		return
+	}
+	for _, zone := range purged {
+		exists, err := app.Storage.ZoneExists(zone)
+		if err == nil && !exists {
+			var trashed *DeletedZone
+			if trashed, err = app.Storage.DeletedZoneGet(zone, 0); err == nil && trashed == nil {
+				err = app.Storage.ZoneVersionDeleteAll(zone)
+			}
+		}
+		if err != nil {
+			app.Log.Warnf("app.purgeZoneTrash: history of %s: %v", zone, err)
+		}
+	}
+	if len(purged) > 0 {
+		app.Log.Infof("app.purgeZoneTrash: purged %d deleted zone(s) from the trash", len(purged))
+	}
+}
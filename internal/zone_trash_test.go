@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// A deleted zone goes to the trash with its records and owners, and only once
+// it is deleted; an owner can restore it while a rule grants it, others cannot
+// see it. Expired entries are purged.
+func TestZoneTrashRestore(t *testing.T) {
+	app := newTestApp(t)
+	fake := useFakePdns(t, app)
+	ctx := context.Background()
+	app.Config.ZoneDefaults.TrashRetentionDays = 30
+	alice, bob := &UserClaims{Email: "alice", PreferredUsername: "alice"}, &UserClaims{Email: "bob", PreferredUsername: "bob"}
+	const zone = "alice.users.example.com"
+	const www = zone + ". www." + zone + ". A"
+
+	rule, err := app.PolicyCreateRule(ctx, PolicyRuleRequest{ZonePattern: "%u.users.example.com", ZoneSoa: "users.example.com", TargetUserFilter: "*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _, err := app.ZoneCreate(ctx, "alice", ZoneResponse{Zone: zone, ZoneSOA: "users.example.com"}, ""); status != http.StatusCreated {
+		t.Fatalf("ZoneCreate: %d %v", status, err)
+	}
+	fake.rrsets[www] = []string{"192.0.2.1"}
+	fake.rrsets[zone+". "+zone+". NS"] = []string{"ns.example.com."}
+
+	fake.failDelete = true
+	if status, _, _ := app.ZoneDelete(ctx, "alice", zone); status != http.StatusInternalServerError {
+		t.Fatalf("expected a failed deletion to be reported, got %d", status)
+	}
+	if _, resp, _ := app.ZoneTrashList(ctx, alice); len(resp.([]DeletedZone)) != 0 {
+		t.Fatalf("expected a zone that was not deleted to stay out of the trash, got %+v", resp)
+	}
+	fake.failDelete = false
+	if status, _, err := app.ZoneDelete(ctx, "alice", zone); status != http.StatusNoContent {
+		t.Fatalf("ZoneDelete: %d %v", status, err)
+	}
+	delete(fake.rrsets, www)
+	_, resp, _ := app.ZoneTrashList(ctx, alice)
+	if trash := resp.([]DeletedZone); len(trash) != 1 || trash[0].Owners != "alice" || trash[0].RRsets != `[{"name":"www.`+zone+`.","type":"A","ttl":0,"records":["192.0.2.1"]}]` {
+		t.Fatalf("expected the zone with its A record in the trash, got %+v", trash)
+	}
+	if _, resp, _ := app.ZoneTrashList(ctx, bob); len(resp.([]DeletedZone)) != 0 {
+		t.Errorf("expected others not to see the trash of alice, got %+v", resp)
+	}
+
+	if status, _, _ := app.ZoneRestore(ctx, bob, zone, 0); status != http.StatusNotFound {
+		t.Errorf("expected others to be refused, got %d", status)
+	}
+	if status, resp, err := app.ZoneRestore(ctx, alice, zone, 0); status != http.StatusCreated {
+		t.Fatalf("ZoneRestore: %d %+v %v", status, resp, err)
+	}
+	if owners, _ := app.Storage.ListZoneOwners(zone); !fake.zones[zone+"."] || !slices.Equal(owners, []string{"alice"}) || !slices.Equal(fake.rrsets[www], []string{"192.0.2.1"}) {
+		t.Fatalf("expected the zone, its owner and its records back, got owners %v, records %v", owners, fake.rrsets[www])
+	}
+	if status, _, _ := app.ZoneRestore(ctx, alice, zone, 0); status != http.StatusNotFound {
+		t.Errorf("expected a restored zone to leave the trash, got %d", status)
+	}
+
+	// Without a rule granting the zone, only an admin may bring it back.
+	if status, _, err := app.ZoneDelete(ctx, "alice", zone); status != http.StatusNoContent {
+		t.Fatalf("ZoneDelete: %d %v", status, err)
+	}
+	if err := app.PolicyDeleteRule(ctx, rule.ID); err != nil {
+		t.Fatal(err)
+	}
+	if status, _, _ := app.ZoneRestore(ctx, alice, zone, 0); status != http.StatusForbidden {
+		t.Errorf("expected an orphaned zone to need an admin, got %d", status)
+	}
+
+	if purged, err := app.Storage.DeletedZonePurge(time.Now().Add(31 * 24 * time.Hour)); err != nil || !slices.Equal(purged, []string{zone}) {
+		t.Errorf("expected the expired zone to be purged, got %v %v", purged, err)
+	}
+}
+
+// A restored zone counts against the zone quota of its owners like a new one,
+// unless an admin restores it.
+func TestZoneRestoreQuota(t *testing.T) {
+	app := newTestApp(t)
+	useFakePdns(t, app)
+	ctx := context.Background()
+	app.Config.ZoneDefaults.TrashRetentionDays = 30
+	app.Config.DnsPolicyConfig.SuperAdminEmails = map[string]struct{}{"root@example.com": {}}
+	alice, root := &UserClaims{Email: "alice", PreferredUsername: "alice"}, &UserClaims{Email: "root@example.com", PreferredUsername: "root@example.com"}
+	const zone = "a.alice.users.example.com"
+
+	if _, err := app.PolicyCreateRule(ctx, PolicyRuleRequest{ZonePattern: "%u.users.example.com", ZoneSoa: "users.example.com", TargetUserFilter: "*",
+		AllowSubdomains: true, ZoneQuotas: ZoneQuotas{MaxZonesPerUser: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if status, _, err := app.ZoneCreate(ctx, "alice", ZoneResponse{Zone: zone, ZoneSOA: "users.example.com"}, ""); status != http.StatusCreated {
+		t.Fatalf("ZoneCreate: %d %v", status, err)
+	}
+	if status, _, err := app.ZoneDelete(ctx, "alice", zone); status != http.StatusNoContent {
+		t.Fatalf("ZoneDelete: %d %v", status, err)
+	}
+	if status, _, err := app.ZoneCreate(ctx, "alice", ZoneResponse{Zone: "b.alice.users.example.com", ZoneSOA: "users.example.com"}, ""); status != http.StatusCreated {
+		t.Fatalf("ZoneCreate: %d %v", status, err)
+	}
+
+	if status, _, _ := app.ZoneRestore(ctx, alice, zone, 0); status != http.StatusForbidden {
+		t.Errorf("expected a restore beyond the quota to be refused, got %d", status)
+	}
+	if status, resp, err := app.ZoneRestore(ctx, root, zone, 0); status != http.StatusCreated {
+		t.Errorf("expected an admin to restore the zone, got %d %+v %v", status, resp, err)
+	}
+}